@@ -7,8 +7,8 @@ URL="http://localhost:8082/submit"
 PAYLOAD='{
   "input_file_path": "input.mp4",
   "output_file_path": "output.mp4",
-  "container_type": "mp4",
-  "flags": "--dry-run"
+  "output_container_type": "mp4",
+  "dry_run": "true"
 }'
 
 echo "Sending POST request to $URL..."
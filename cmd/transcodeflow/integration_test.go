@@ -9,11 +9,14 @@ import (
 	"testing"
 	"time"
 	"transcodeflow/internal/api"
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/joblog"
 	"transcodeflow/internal/model"
 	"transcodeflow/internal/repository/redis"
 	"transcodeflow/internal/service"
 	"transcodeflow/internal/telemetry"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -24,27 +27,30 @@ func TestServerIntegration(t *testing.T) {
 		t.Skip("Skipping integration test in CI environment")
 	}
 
-	// Set environment variables for test
-	os.Setenv("APP_MODE", "server")
-	os.Setenv("PORT", "8082") // Use a different port for testing
-	defer os.Unsetenv("APP_MODE")
-	defer os.Unsetenv("PORT")
+	cfg := config.Default()
+	cfg.Server.Port = 8082 // Use a different port for testing
+	cfg.Metrics.Enabled = false
 
 	// Initialize test dependencies
-	metrics, err := telemetry.NewDefaultMetricsClient()
+	metrics, err := telemetry.NewDefaultMetricsClient(cfg.Metrics, prometheus.NewRegistry())
 	if err != nil {
 		t.Fatalf("Failed to initialize metrics: %v", err)
 	}
 
 	// Initialize Redis client
-	redisClient, err := redis.NewDefaultRedisClient()
+	redisClient, err := redis.NewDefaultRedisClient(cfg.Redis)
 	if err != nil {
 		t.Fatalf("Failed to initialize Redis client: %v", err)
 	}
 	defer redisClient.Close()
 
+	jobLogs, err := joblog.NewStore(cfg.Logging.JobLogs, redisClient)
+	if err != nil {
+		t.Fatalf("Failed to initialize job log store: %v", err)
+	}
+
 	// Create services container
-	svc := service.NewServices(metrics, redisClient)
+	svc := service.NewServices(metrics, redisClient, jobLogs)
 
 	// Create context with cancellation for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -52,7 +58,7 @@ func TestServerIntegration(t *testing.T) {
 
 	// Start server in a goroutine
 	go func() {
-		if err := runServer(ctx, svc); err != nil {
+		if err := runServer(ctx, svc, cfg.Server); err != nil {
 			telemetry.Logger.Error("Server error", zap.Error(err))
 		}
 	}()
@@ -67,8 +73,8 @@ func TestServerIntegration(t *testing.T) {
 	t.Run("MissingRequiredFields", testMissingRequiredFields)
 }
 
-func runServer(ctx context.Context, svc *service.Services) error {
-	server := api.NewServer(svc)
+func runServer(ctx context.Context, svc *service.Services, cfg config.ServerConfig) error {
+	server := api.NewServer(svc, cfg)
 	return server.Start(ctx)
 }
 
@@ -130,9 +136,27 @@ func testMissingRequiredFields(t *testing.T) {
 }
 
 func TestWorkerDequeue(t *testing.T) {
-	os.Setenv("APP_MODE", "worker")
-	defer os.Unsetenv("APP_MODE")
+	// Skip in CI environments
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	// Run the worker for a while, then shut it down as a signal would
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	go main()
-	time.Sleep(time.Second * 10)
+	done := make(chan int, 1)
+	go func() { done <- run(ctx, []string{"work", "-metrics.enabled=false"}, prometheus.NewRegistry()) }()
+
+	select {
+	case code := <-done:
+		t.Fatalf("Worker exited before shutdown with code %d", code)
+	case <-ctx.Done():
+	}
+	select {
+	case code := <-done:
+		assert.Equal(t, 0, code, "Expected a clean shutdown")
+	case <-time.After(15 * time.Second):
+		t.Fatal("Worker did not stop after shutdown")
+	}
 }
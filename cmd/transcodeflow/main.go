@@ -2,64 +2,278 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"transcodeflow/internal/api"
+	"transcodeflow/internal/cli"
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/health"
+	"transcodeflow/internal/joblog"
+	"transcodeflow/internal/model"
 	"transcodeflow/internal/repository/redis"
 	"transcodeflow/internal/service"
 	"transcodeflow/internal/telemetry"
 	"transcodeflow/internal/worker"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
+// serviceCommand runs one of the long-lived processes
+type serviceCommand struct {
+	summary string
+	run     func(ctx context.Context, cfg config.Config, reg *prometheus.Registry) error
+}
+
+var serviceCommands = map[string]serviceCommand{
+	"serve":       {"Run the API server", runServe},
+	"work":        {"Run a transcoding worker", runWork},
+	"healthcheck": {"Run a worker that validates transcoded files", notAvailable("healthcheck")},
+	"replace":     {"Run a worker that replaces originals with validated files", notAvailable("replace")},
+	"scheduler":   {"Run the job scheduler", notAvailable("scheduler")},
+}
+
+// legacyModes maps the APP_MODE values used before subcommands existed
+var legacyModes = map[string]string{
+	"server": "serve",
+	"api":    "serve",
+	"worker": "work",
+}
+
 func main() {
-	// Initialize metrics
-	metrics, err := telemetry.NewDefaultMetricsClient()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], telemetry.NewRegistry())
+	stop()
+	os.Exit(code)
+}
+
+// run dispatches to a service command, config print or a CLI command and
+// returns the process exit code. Service metrics are registered with reg, so
+// tests can call run more than once with a fresh registry each time.
+func run(ctx context.Context, args []string, reg *prometheus.Registry) int {
+	if len(args) == 0 {
+		// Containers built before subcommands select the mode by environment
+		mode := strings.ToLower(os.Getenv("APP_MODE"))
+		if mode == "" {
+			mode = "server"
+		}
+		name, ok := legacyModes[mode]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown APP_MODE %q\n", mode)
+			return 2
+		}
+		args = []string{name}
+	}
+
+	switch name := args[0]; {
+	case name == "help" || name == "-h" || name == "--help":
+		cli.Run(ctx, []string{"help"}, os.Stdout, os.Stderr)
+		printServiceUsage(os.Stderr)
+		return 0
+	case name == "config":
+		return runConfig(args[1:], os.Stdout, os.Stderr)
+	case cli.IsCommand(name):
+		// CLI commands only talk to the API, so skip the service setup
+		return cli.Run(ctx, args, os.Stdout, os.Stderr)
+	}
+
+	cmd, ok := serviceCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q; run 'transcodeflow help' for a list\n", args[0])
+		return 2
+	}
+
+	cfg, err := loadConfig(args[0], args[1:], os.Stderr)
 	if err != nil {
-		telemetry.Logger.Fatal("Failed to initialize metrics", zap.Error(err))
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		}
+		return 2
 	}
 
-	// Initialize Redis client
-	redisClient, err := redis.NewDefaultRedisClient()
+	logger, closeLogs, err := telemetry.NewLogger(cfg.Logging, args[0])
 	if err != nil {
-		telemetry.Logger.Fatal("Failed to initialize Redis client", zap.Error(err))
+		fmt.Fprintf(os.Stderr, "Failed to set up logging: %v\n", err)
+		return 1
 	}
-	defer redisClient.Close()
+	telemetry.Logger = logger
+	defer func() {
+		logger.Sync()
+		// Push the last entries to Loki without holding up shutdown for long
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		closeLogs(flushCtx)
+	}()
 
-	// Create services container
-	svc := service.NewServices(metrics, redisClient)
+	shutdownTracing, err := telemetry.SetupTracing(ctx, cfg.Tracing, args[0])
+	if err != nil {
+		telemetry.Logger.Error("System error: Failed to set up tracing", zap.Error(err))
+		return 1
+	}
+	defer func() {
+		// Give buffered spans a moment to reach the collector
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			telemetry.Logger.Warn("Failed to flush traces", zap.Error(err))
+		}
+	}()
 
-	// Setup graceful shutdown
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	telemetry.Logger.Info("Starting application", zap.String("mode", args[0]))
+	if err := cmd.run(ctx, cfg, reg); err != nil {
+		telemetry.Logger.Error("System error: Exiting", zap.String("mode", args[0]), zap.Error(err))
+		return 1
+	}
+	return 0
+}
 
-	// Determine mode from environment variable
-	mode := strings.ToLower(os.Getenv("APP_MODE"))
-	if mode == "" {
-		// Default to server mode if not specified
-		mode = "server"
+// loadConfig parses the config flags of a command and merges every layer
+func loadConfig(name string, args []string, stderr io.Writer) (config.Config, error) {
+	loader := config.NewLoader()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: transcodeflow %s [flags]\n\nFlags:\n", name)
+		fs.PrintDefaults()
+	}
+	loader.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return config.Config{}, err
 	}
+	if fs.NArg() > 0 {
+		return config.Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return loader.Load()
+}
 
-	telemetry.Logger.Info("Starting application", zap.String("mode", mode))
+// runConfig implements 'config print'
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(stderr, "Usage: transcodeflow config print [flags]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Prints the effective configuration with secrets redacted.")
+		return 2
+	}
 
-	// Run in the appropriate mode
-	switch mode {
-	case "server", "api":
-		// Create and start server
-		server := api.NewServer(svc)
-		if err := server.Start(ctx); err != nil {
-			telemetry.Logger.Fatal("Server error", zap.Error(err))
+	cfg, err := loadConfig("config print", args[1:], stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
 		}
-	case "worker":
-		workerSvc := worker.NewWorkerService(svc, 4, nil, nil)
-		if err := workerSvc.Start(ctx); err != nil {
-			telemetry.Logger.Fatal("Worker error", zap.Error(err))
+		fmt.Fprintf(stderr, "Invalid configuration:\n%v\n", err)
+		return 2
+	}
+	if err := cfg.Print(stdout); err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printServiceUsage(w io.Writer) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Service commands:")
+
+	names := make([]string, 0, len(serviceCommands))
+	for name := range serviceCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, serviceCommands[name].summary)
+	}
+	fmt.Fprintf(tw, "  %s\t%s\n", "config print", "Show the effective configuration")
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Service commands read a YAML file from -config or %s, then environment\n", config.FileEnv)
+	fmt.Fprintln(w, "variables, then flags such as -server.port.")
+}
+
+// newServices connects to the backing services shared by every mode
+func newServices(cfg config.Config, reg *prometheus.Registry) (*service.Services, func(), error) {
+	metrics, err := telemetry.NewDefaultMetricsClient(cfg.Metrics, reg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("initializing metrics: %w", err)
+	}
+
+	redisClient, err := redis.NewDefaultRedisClient(cfg.Redis)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to Redis: %w", err)
+	}
+
+	jobLogs, err := joblog.NewStore(cfg.Logging.JobLogs, redisClient)
+	if err != nil {
+		redisClient.Close()
+		return nil, nil, err
+	}
+
+	return service.NewServices(metrics, redisClient, jobLogs), func() { redisClient.Close() }, nil
+}
+
+func runServe(ctx context.Context, cfg config.Config, reg *prometheus.Registry) error {
+	svc, closeServices, err := newServices(cfg, reg)
+	if err != nil {
+		return err
+	}
+	defer closeServices()
+
+	return api.NewServer(svc, cfg.Server).Start(ctx)
+}
+
+func runWork(ctx context.Context, cfg config.Config, reg *prometheus.Registry) error {
+	svc, closeServices, err := newServices(cfg, reg)
+	if err != nil {
+		return err
+	}
+	defer closeServices()
+
+	worker.JobLogLimit = cfg.Logging.JobLogs.MaxBytes
+	workerSvc := worker.NewWorkerService(svc, cfg.Worker.MaxParallelization, nil, nil)
+	workerSvc.EncoderDefaults = model.EncoderDefaults{
+		AV1Encoder:      model.AV1Encoder(cfg.Worker.AV1Encoder),
+		HardwareBackend: model.HardwareBackend(cfg.Worker.HardwareBackend),
+		HardwareDevice:  cfg.Worker.HardwareDevice,
+	}
+	sessions := cfg.Worker.HardwareSessions
+	if sessions == 0 {
+		sessions = cfg.Worker.MaxParallelization
+	}
+	workerSvc.Capabilities = worker.DetectCapabilities(ctx, model.HardwareBackend(cfg.Worker.HardwareBackend), sessions)
+	// Every entry from this process is labelled with the worker it came from
+	telemetry.Logger = telemetry.Logger.With(zap.String("worker_id", workerSvc.ID))
+	telemetry.Logger.Info("Detected worker capabilities",
+		zap.Int("encoders", len(workerSvc.Capabilities.Encoders)),
+		zap.Any("hardware_encode", workerSvc.Capabilities.HardwareEncode),
+		zap.Strings("devices", workerSvc.Capabilities.Devices),
+		zap.Int("cpus", workerSvc.Capabilities.CPUs))
+
+	// Workers have no API, so expose probes on a dedicated port
+	go func() {
+		if err := health.NewServer(svc, true, cfg.Worker.HealthPort).Start(ctx); err != nil {
+			telemetry.Logger.Error("Health server error", zap.Error(err))
 		}
-	default:
-		telemetry.Logger.Fatal("Unknown application mode", zap.String("mode", mode))
+	}()
+
+	return workerSvc.Start(ctx)
+}
+
+// notAvailable stands in for pipeline stages described in the design that
+// this build does not include yet
+func notAvailable(name string) func(context.Context, config.Config, *prometheus.Registry) error {
+	return func(context.Context, config.Config, *prometheus.Registry) error {
+		return fmt.Errorf("the %s service is not available in this build yet", name)
 	}
 }
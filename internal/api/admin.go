@@ -0,0 +1,498 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/repository/redis"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultInspectLimit = 20
+	maxInspectLimit     = 500
+)
+
+// QueuesResponse is returned by GET /admin/queues
+type QueuesResponse struct {
+	Queues map[string]int64 `json:"queues"`
+	Paused bool             `json:"paused"`
+}
+
+// JobSummary is the part of a queued job an operator needs to identify it
+type JobSummary struct {
+	ID                  string              `json:"id,omitempty"`
+	Type                model.JobType       `json:"type,omitempty"`
+	InputFilePath       string              `json:"input_file_path"`
+	OutputFilePath      string              `json:"output_file_path"`
+	OutputContainerType string              `json:"output_container_type,omitempty"`
+	QualityPreset       model.QualityPreset `json:"quality_preset,omitempty"`
+	Submitter           string              `json:"submitter,omitempty"`
+}
+
+// QueueItem is one decoded entry of a queue. Entries that cannot be decoded
+// are returned in Raw so they can still be found and purged.
+type QueueItem struct {
+	Position int64       `json:"position"`
+	Job      *JobSummary `json:"job,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Raw      string      `json:"raw,omitempty"`
+}
+
+// QueueContentsResponse is returned by GET /admin/queues/{queue}
+type QueueContentsResponse struct {
+	Queue  string      `json:"queue"`
+	Total  int64       `json:"total"`
+	Offset int64       `json:"offset"`
+	Items  []QueueItem `json:"items"`
+}
+
+// QueueOpResponse reports how many items a purge, move or requeue affected
+type QueueOpResponse struct {
+	Count  int64    `json:"count"`
+	JobIDs []string `json:"job_ids,omitempty"`
+}
+
+// WorkerListResponse is returned by GET /admin/workers
+type WorkerListResponse struct {
+	Workers []model.WorkerInfo `json:"workers"`
+}
+
+// adminRoutes returns the /admin endpoints, guarded by the admin API key
+func (s *Server) adminRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/queues", s.handleAdminQueues)
+	mux.HandleFunc("/admin/queues/{queue}", s.handleInspectQueue)
+	mux.HandleFunc("/admin/queues/{queue}/purge", s.handlePurgeQueue)
+	mux.HandleFunc("/admin/queues/{queue}/move", s.handleMoveQueue)
+	mux.HandleFunc("/admin/results/requeue", s.handleRequeueFailed)
+	mux.HandleFunc("/admin/workers", s.handleAdminWorkers)
+	mux.HandleFunc("/admin/workers/{id}/drain", s.handleDrainWorker(true))
+	mux.HandleFunc("/admin/workers/{id}/undrain", s.handleDrainWorker(false))
+	mux.HandleFunc("/admin/dispatch", s.handleDispatchState)
+	mux.HandleFunc("/admin/dispatch/pause", s.handleSetDispatch(true))
+	mux.HandleFunc("/admin/dispatch/resume", s.handleSetDispatch(false))
+	return s.requireAdmin(mux)
+}
+
+// requireAdmin rejects requests that do not carry the admin API key
+func (s *Server) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.adminKey == "" {
+			writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "Admin API is disabled")
+			return
+		}
+		key := r.Header.Get(APIKeyHeader)
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.adminKey)) != 1 {
+			requestLogger(r).Warn("User error: Rejected admin request", zap.String("client", clientIdentity(r)))
+			writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "A valid admin API key is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminQueues returns the depth of every queue and whether dispatching
+// is paused
+func (s *Server) handleAdminQueues(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	depths, err := s.services.Redis.QueueDepths(ctx)
+	if err != nil {
+		s.adminFailure(w, r, "Failed to read queue depths", err)
+		return
+	}
+	state, err := s.services.Redis.GetDispatchState(ctx, "")
+	if err != nil {
+		s.adminFailure(w, r, "Failed to read dispatch state", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, QueuesResponse{Queues: depths, Paused: state.Paused})
+}
+
+// handleInspectQueue returns queue entries in dispatch order with each job
+// decoded into a summary
+func (s *Server) handleInspectQueue(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	offset, ok := queryInt(w, r, "offset", 0, 0, math.MaxInt32)
+	if !ok {
+		return
+	}
+	limit, ok := queryInt(w, r, "limit", defaultInspectLimit, 1, maxInspectLimit)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	queue := r.PathValue("queue")
+	raw, total, err := s.services.Redis.ListQueue(ctx, queue, offset, limit)
+	if errors.Is(err, redis.ErrUnknownQueue) {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Queue not found")
+		return
+	}
+	if err != nil {
+		s.adminFailure(w, r, "Failed to read queue", err)
+		return
+	}
+
+	items := make([]QueueItem, len(raw))
+	for i, entry := range raw {
+		items[i] = decodeQueueItem(queue, entry)
+		items[i].Position = offset + int64(i)
+	}
+	writeJSON(w, r, http.StatusOK, QueueContentsResponse{Queue: queue, Total: total, Offset: offset, Items: items})
+}
+
+// decodeQueueItem summarizes a raw queue entry. The result queue holds
+// model.JobResult values; the others hold model.Job values.
+func decodeQueueItem(queue, entry string) QueueItem {
+	var item QueueItem
+	var job model.Job
+	var err error
+	if queue == redis.ResultQueue {
+		var result model.JobResult
+		err = json.Unmarshal([]byte(entry), &result)
+		job, item.Error = result.Job, result.Error
+	} else {
+		err = json.Unmarshal([]byte(entry), &job)
+	}
+	if err != nil {
+		item.Raw = entry
+		return item
+	}
+
+	item.Job = &JobSummary{
+		ID:                  job.ID,
+		Type:                job.Type,
+		InputFilePath:       job.InputFilePath,
+		OutputFilePath:      job.OutputFilePath,
+		OutputContainerType: job.OutputContainerType,
+		Submitter:           job.Submitter,
+	}
+	if job.SimpleOptions != nil {
+		item.Job.QualityPreset = job.SimpleOptions.QualityPreset
+	}
+	return item
+}
+
+// handlePurgeQueue deletes every entry in a queue. Jobs purged from the job
+// or held queue are cancelled.
+func (s *Server) handlePurgeQueue(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	queue := r.PathValue("queue")
+	removed, err := s.services.Redis.PurgeQueue(ctx, queue)
+	if errors.Is(err, redis.ErrUnknownQueue) {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Queue not found")
+		return
+	}
+	if err != nil {
+		s.adminFailure(w, r, "Failed to purge queue", err)
+		return
+	}
+
+	resp := QueueOpResponse{Count: int64(len(removed))}
+	if queue != redis.ResultQueue {
+		resp.JobIDs = s.cancelRemovedJobs(ctx, requestLogger(r), removed)
+	}
+	requestLogger(r).Warn("Admin purged queue", zap.String("queue", queue), zap.Int64("removed", resp.Count))
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// handleMoveQueue moves entries, oldest first, to the queue named by the
+// "to" query parameter. "limit" caps how many are moved; by default all are.
+// Jobs moved to the result queue will never run, so they are cancelled;
+// jobs moved to the held queue stay queued until moved back.
+func (s *Server) handleMoveQueue(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	from, to := r.PathValue("queue"), r.URL.Query().Get("to")
+	if to == "" || to == from {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid query parameters",
+			FieldError{"to", "must name a different queue"})
+		return
+	}
+	limit, ok := queryInt(w, r, "limit", 0, 0, math.MaxInt32)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	moved, err := s.services.Redis.MoveQueue(ctx, from, to, limit)
+	if errors.Is(err, redis.ErrUnknownQueue) {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Queue not found")
+		return
+	}
+	if err != nil {
+		s.adminFailure(w, r, "Failed to move queue entries", err)
+		return
+	}
+
+	resp := QueueOpResponse{Count: int64(len(moved))}
+	if from != redis.ResultQueue && to == redis.ResultQueue {
+		resp.JobIDs = s.cancelRemovedJobs(ctx, requestLogger(r), moved)
+	}
+	requestLogger(r).Warn("Admin moved queue entries", zap.String("from", from), zap.String("to", to), zap.Int64("moved", resp.Count))
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// cancelRemovedJobs settles jobs an administrator took out of the queues
+// for good. Each held a submitter quota slot that no worker will now
+// release, and the record of one still waiting to run is marked cancelled,
+// finishing its pipeline step. It returns the IDs of the jobs cancelled.
+func (s *Server) cancelRemovedJobs(ctx context.Context, log *zap.Logger, entries []string) []string {
+	var cancelled []string
+	for _, entry := range entries {
+		var job model.Job
+		if err := json.Unmarshal([]byte(entry), &job); err != nil {
+			continue
+		}
+		if job.Submitter != "" {
+			s.releaseSlot(ctx, log, job.Submitter)
+		}
+		if job.ID == "" {
+			continue
+		}
+
+		// Records no longer queued belong to a retry or have finished
+		record, err := s.services.Redis.UpdateJobRecord(ctx, job.ID, func(rec *model.JobRecord) error {
+			if rec.State != model.JobStateQueued {
+				return errInvalidTransition
+			}
+			now := time.Now().UTC()
+			rec.State = model.JobStateCancelled
+			rec.FinishedAt = &now
+			return nil
+		})
+		if errors.Is(err, errInvalidTransition) || errors.Is(err, redis.ErrJobNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Error("System error: Failed to cancel removed job", zap.String("job_id", job.ID), zap.Error(err))
+			continue
+		}
+		cancelled = append(cancelled, job.ID)
+		if err := s.pipelines.StepFinished(ctx, record); err != nil {
+			log.Error("System error: Failed to advance pipeline",
+				zap.String("pipeline_id", record.Job.Pipeline), zap.String("job_id", record.ID), zap.Error(err))
+		}
+	}
+	return cancelled
+}
+
+// handleRequeueFailed queues the job of every failed result again and marks
+// its record as queued
+func (s *Server) handleRequeueFailed(w http.ResponseWriter, r *http.Request) {
+	log := requestLogger(r)
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	results, err := s.services.Redis.RequeueFailedResults(ctx)
+	resp := QueueOpResponse{Count: int64(len(results))}
+	for _, result := range results {
+		s.services.Metrics.IncrementJobRetryCounter("admin")
+		if result.Job.ID == "" {
+			continue
+		}
+		resp.JobIDs = append(resp.JobIDs, result.Job.ID)
+		s.countRequeuedJob(ctx, log, result.Job)
+	}
+	if err != nil {
+		// Some jobs may already have been requeued; say which
+		log.Error("System error: Failed to requeue failed results",
+			zap.Int64("requeued", resp.Count), zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal,
+			fmt.Sprintf("Failed to requeue failed results after requeuing %d", resp.Count))
+		return
+	}
+
+	log.Warn("Admin requeued failed results", zap.Int64("requeued", resp.Count))
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// countRequeuedJob brings the record and submitter quota of a job requeued by
+// an administrator in line with a normal retry. Admin requeues bypass the
+// quota, but the slot must still be counted since the worker releases one
+// when the job finishes.
+func (s *Server) countRequeuedJob(ctx context.Context, log *zap.Logger, job model.Job) {
+	_, err := s.services.Redis.UpdateJobRecord(ctx, job.ID, func(rec *model.JobRecord) error {
+		switch {
+		case job.Attempt == 0:
+			rec.Attempts++
+		case rec.Attempts >= job.Attempt:
+			// A worker already started the requeued attempt
+			return errInvalidTransition
+		default:
+			rec.Attempts = job.Attempt
+		}
+		rec.State = model.JobStateQueued
+		rec.StartedAt = nil
+		rec.FinishedAt = nil
+		rec.WorkerID = ""
+		rec.Error = ""
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.ErrJobNotFound) && !errors.Is(err, errInvalidTransition) {
+		log.Error("System error: Failed to update requeued job record", zap.String("job_id", job.ID), zap.Error(err))
+	}
+
+	if s.limits.MaxActiveJobs > 0 && job.Submitter != "" {
+		if _, err := s.services.Redis.ReserveSubmitterSlot(ctx, job.Submitter, math.MaxInt64); err != nil {
+			log.Error("System error: Failed to count requeued job against quota", zap.String("job_id", job.ID), zap.Error(err))
+		}
+	}
+}
+
+// handleAdminWorkers lists registered workers including their drain state
+func (s *Server) handleAdminWorkers(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	workers, err := s.services.Redis.ListWorkers(ctx)
+	if err != nil {
+		s.adminFailure(w, r, "Failed to list workers", err)
+		return
+	}
+	if workers == nil {
+		workers = []model.WorkerInfo{}
+	}
+	writeJSON(w, r, http.StatusOK, WorkerListResponse{Workers: workers})
+}
+
+// handleDrainWorker stops a worker taking new jobs, or lets it resume
+func (s *Server) handleDrainWorker(draining bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		id := r.PathValue("id")
+		workers, err := s.services.Redis.ListWorkers(ctx)
+		if err != nil {
+			s.adminFailure(w, r, "Failed to list workers", err)
+			return
+		}
+		var worker *model.WorkerInfo
+		for i := range workers {
+			if workers[i].ID == id {
+				worker = &workers[i]
+			}
+		}
+		// Undraining a worker that has since gone away is fine; draining one
+		// is almost certainly a typo
+		if worker == nil && draining {
+			writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Worker not found")
+			return
+		}
+
+		if err := s.services.Redis.SetWorkerDraining(ctx, id, draining); err != nil {
+			s.adminFailure(w, r, "Failed to update worker", err)
+			return
+		}
+
+		requestLogger(r).Warn("Admin changed worker drain state", zap.String("worker_id", id), zap.Bool("draining", draining))
+		if worker == nil {
+			worker = &model.WorkerInfo{ID: id}
+		}
+		worker.Draining = draining
+		writeJSON(w, r, http.StatusOK, worker)
+	}
+}
+
+// handleDispatchState reports whether dispatching is paused
+func (s *Server) handleDispatchState(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	state, err := s.services.Redis.GetDispatchState(ctx, "")
+	if err != nil {
+		s.adminFailure(w, r, "Failed to read dispatch state", err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, model.DispatchState{Paused: state.Paused})
+}
+
+// handleSetDispatch pauses or resumes dispatching on every worker. Jobs
+// already running are not affected.
+func (s *Server) handleSetDispatch(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		if err := s.services.Redis.SetDispatchPaused(ctx, paused); err != nil {
+			s.adminFailure(w, r, "Failed to update dispatch state", err)
+			return
+		}
+
+		requestLogger(r).Warn("Admin changed dispatch state", zap.Bool("paused", paused))
+		writeJSON(w, r, http.StatusOK, model.DispatchState{Paused: paused})
+	}
+}
+
+// adminFailure logs a Redis failure and sends a 500
+func (s *Server) adminFailure(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	requestLogger(r).Error("System error: "+msg, zap.Error(err))
+	writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, msg)
+}
+
+// queryInt parses an optional integer query parameter within [min, max],
+// writing a 400 and returning false if it is invalid
+func queryInt(w http.ResponseWriter, r *http.Request, name string, def, min, max int64) (int64, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < min || n > max {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid query parameters",
+			FieldError{name, fmt.Sprintf("must be an integer between %d and %d", min, max)})
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/repository/redis"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminKey = "admin-secret"
+
+// serveAdmin sends an authenticated admin request through the router
+func serveAdmin(server *Server, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(APIKeyHeader, testAdminKey)
+	rr := httptest.NewRecorder()
+	server.routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAdminRequiresKey(t *testing.T) {
+	server, _, _ := newJobsTestServer(t)
+
+	rr := serveRoutes(server, "GET", "/admin/queues")
+	assert.Equal(t, http.StatusForbidden, rr.Code, "admin API should be disabled without a configured key")
+
+	server.adminKey = testAdminKey
+	rr = serveRoutes(server, "GET", "/admin/queues")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req := httptest.NewRequest("GET", "/admin/queues", nil)
+	req.Header.Set(APIKeyHeader, "wrong")
+	rr = httptest.NewRecorder()
+	server.routes().ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestAdminQueues(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+	redisMock.On("QueueDepths", mock.Anything).Return(map[string]int64{"jobs": 3, "results": 1, "held": 0}, nil)
+	redisMock.On("GetDispatchState", mock.Anything, "").Return(model.DispatchState{Paused: true}, nil)
+
+	rr := serveAdmin(server, "GET", "/admin/queues")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp QueuesResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, int64(3), resp.Queues["jobs"])
+	assert.True(t, resp.Paused)
+}
+
+func TestAdminInspectQueue(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+
+	job, _ := json.Marshal(model.Job{
+		ID: "abc", InputFilePath: "in.mkv", OutputFilePath: "out.mp4",
+		SimpleOptions: &model.SimpleOptions{QualityPreset: model.PresetFast},
+	})
+	result, _ := json.Marshal(model.JobResult{Job: model.Job{ID: "def", InputFilePath: "a.mkv"}, Error: "exit status 1"})
+	redisMock.On("ListQueue", mock.Anything, "jobs", int64(5), int64(2)).Return([]string{string(job), "not json"}, int64(10), nil)
+	redisMock.On("ListQueue", mock.Anything, "results", int64(0), int64(defaultInspectLimit)).Return([]string{string(result)}, int64(1), nil)
+
+	rr := serveAdmin(server, "GET", "/admin/queues/jobs?offset=5&limit=2")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp QueueContentsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, int64(10), resp.Total)
+	require.Len(t, resp.Items, 2)
+	assert.Equal(t, int64(5), resp.Items[0].Position)
+	assert.Equal(t, "abc", resp.Items[0].Job.ID)
+	assert.Equal(t, model.PresetFast, resp.Items[0].Job.QualityPreset)
+	assert.Nil(t, resp.Items[1].Job)
+	assert.Equal(t, "not json", resp.Items[1].Raw)
+
+	rr = serveAdmin(server, "GET", "/admin/queues/results")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.Items, 1)
+	assert.Equal(t, "def", resp.Items[0].Job.ID)
+	assert.Equal(t, "exit status 1", resp.Items[0].Error)
+}
+
+func TestAdminUnknownQueue(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+	redisMock.On("PurgeQueue", mock.Anything, "nope").Return(nil, fmt.Errorf("%w: %q", redis.ErrUnknownQueue, "nope"))
+
+	rr := serveAdmin(server, "POST", "/admin/queues/nope/purge")
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAdminMoveQueue(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+	redisMock.On("MoveQueue", mock.Anything, "jobs", "held", int64(0)).Return([]string{`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`, `{"id":"d"}`}, nil)
+
+	rr := serveAdmin(server, "POST", "/admin/queues/jobs/move?to=held")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp QueueOpResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, int64(4), resp.Count)
+	assert.Empty(t, resp.JobIDs, "parked jobs stay queued")
+
+	rr = serveAdmin(server, "POST", "/admin/queues/jobs/move?to=jobs")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestAdminPurgeCancelsJobs(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+	server.limits = config.RateLimitConfig{MaxActiveJobs: 5}
+
+	redisMock.On("PurgeQueue", mock.Anything, "held").Return([]string{
+		`{"id":"abc","submitter":"ip:192.0.2.1"}`,
+		`{"id":"def","submitter":"ip:192.0.2.1"}`,
+		"not json",
+	}, nil)
+	queued := model.JobRecord{ID: "abc", State: model.JobStateQueued}
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+		err := update(&queued)
+		return queued, err
+	})
+	// Cancelled while queued: the record stays as it is, but its slot is still held
+	redisMock.On("UpdateJobRecord", mock.Anything, "def", mock.Anything).Return(applyUpdate(model.JobRecord{ID: "def", State: model.JobStateCancelled}))
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "ip:192.0.2.1").Return(nil).Twice()
+
+	rr := serveAdmin(server, "POST", "/admin/queues/held/purge")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp QueueOpResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, int64(3), resp.Count)
+	assert.Equal(t, []string{"abc"}, resp.JobIDs)
+	assert.Equal(t, model.JobStateCancelled, queued.State)
+	assert.NotNil(t, queued.FinishedAt)
+}
+
+func TestAdminMoveToResultsCancelsJobs(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+
+	redisMock.On("MoveQueue", mock.Anything, "jobs", "results", int64(1)).Return([]string{`{"id":"abc"}`}, nil)
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).Return(applyUpdate(model.JobRecord{ID: "abc", State: model.JobStateQueued}))
+
+	rr := serveAdmin(server, "POST", "/admin/queues/jobs/move?to=results&limit=1")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp QueueOpResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"abc"}, resp.JobIDs)
+}
+
+func TestAdminRequeueFailed(t *testing.T) {
+	server, metricsMock, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+	server.limits = config.RateLimitConfig{MaxActiveJobs: 5}
+
+	failed := model.JobRecord{ID: "abc", State: model.JobStateFailed, Attempts: 0, Error: "exit status 1"}
+	redisMock.On("RequeueFailedResults", mock.Anything).Return([]model.JobResult{
+		{Job: model.Job{ID: "abc", Submitter: "ip:192.0.2.1"}, Error: "exit status 1"},
+		{Job: model.Job{InputFilePath: "legacy.mkv"}, Error: "exit status 1"},
+	}, nil)
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).Return(applyUpdate(failed))
+	redisMock.On("ReserveSubmitterSlot", mock.Anything, "ip:192.0.2.1", mock.AnythingOfType("int64")).Return(true, nil)
+	metricsMock.On("IncrementJobRetryCounter", "admin").Return().Times(2)
+
+	rr := serveAdmin(server, "POST", "/admin/results/requeue")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp QueueOpResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, QueueOpResponse{Count: 2, JobIDs: []string{"abc"}}, resp)
+	redisMock.AssertCalled(t, "ReserveSubmitterSlot", mock.Anything, "ip:192.0.2.1", mock.AnythingOfType("int64"))
+}
+
+func TestAdminDrainWorker(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+	redisMock.On("ListWorkers", mock.Anything).Return([]model.WorkerInfo{{ID: "host-1"}}, nil)
+	redisMock.On("SetWorkerDraining", mock.Anything, "host-1", true).Return(nil)
+
+	rr := serveAdmin(server, "POST", "/admin/workers/host-1/drain")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var worker model.WorkerInfo
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &worker))
+	assert.True(t, worker.Draining)
+
+	rr = serveAdmin(server, "POST", "/admin/workers/host-2/drain")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	redisMock.AssertNotCalled(t, "SetWorkerDraining", mock.Anything, "host-2", true)
+}
+
+func TestAdminPauseDispatch(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	server.adminKey = testAdminKey
+	redisMock.On("SetDispatchPaused", mock.Anything, true).Return(nil)
+	redisMock.On("SetDispatchPaused", mock.Anything, false).Return(errors.New("redis down"))
+
+	rr := serveAdmin(server, "POST", "/admin/dispatch/pause")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var state model.DispatchState
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &state))
+	assert.True(t, state.Paused)
+
+	rr = serveAdmin(server, "POST", "/admin/dispatch/resume")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
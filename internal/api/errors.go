@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"transcodeflow/internal/telemetry"
+
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader carries the request ID to and from clients
+const RequestIDHeader = "X-Request-ID"
+
+// Machine-readable error codes returned in ErrorResponse
+const (
+	ErrCodeInvalidJSON      = "invalid_json"
+	ErrCodeValidation       = "validation_failed"
+	ErrCodeRequestTooLarge  = "request_too_large"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeForbidden        = "forbidden"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeConflict         = "conflict"
+	ErrCodeRateLimited      = "rate_limited"
+	ErrCodeQuotaExceeded    = "quota_exceeded"
+	ErrCodeInternal         = "internal_error"
+)
+
+// ErrorResponse is the envelope for every API error
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError describes what went wrong with a request
+type APIError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+type requestIDKey struct{}
+
+// validRequestID restricts client-supplied IDs to something safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// withRequestID assigns every request an ID, reusing the client's if it sent
+// a sane one, and echoes it back in the response headers
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID assigned to the request, if any
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns the global logger tagged with the request ID and,
+// for traced requests, the trace and span IDs
+func requestLogger(r *http.Request) *zap.Logger {
+	fields := telemetry.TraceFields(r.Context())
+	if id := requestID(r); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if len(fields) == 0 {
+		return telemetry.Logger
+	}
+	return telemetry.Logger.With(fields...)
+}
+
+// allowMethod writes a 405 error and returns false unless the request uses method
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method Not Allowed")
+	return false
+}
+
+// writeError sends an ErrorResponse with the given status
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details ...FieldError) {
+	recordResponseStatus(r, status, message)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	resp := ErrorResponse{Error: APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: requestID(r),
+	}}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		requestLogger(r).Error("System error: Failed to write error response", zap.Error(err))
+	}
+}
+
+// classifyDecodeError maps a JSON decoding failure to a client error. Decode
+// problems are always caused by the request, never by the server.
+func classifyDecodeError(err error) (status int, code, message string, details []FieldError) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge,
+			fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), nil
+	case errors.As(err, &syntaxErr):
+		return http.StatusBadRequest, ErrCodeInvalidJSON,
+			fmt.Sprintf("Malformed JSON at byte %d: %v", syntaxErr.Offset, syntaxErr), nil
+	case errors.As(err, &typeErr):
+		return http.StatusBadRequest, ErrCodeValidation, "Request body failed validation",
+			[]FieldError{{Field: typeErr.Field, Message: fmt.Sprintf("must be %s, got %s", withArticle(goTypeToJSON(typeErr.Type.Kind().String())), typeErr.Value)}}
+	default:
+		return http.StatusBadRequest, ErrCodeInvalidJSON, "Malformed JSON: " + err.Error(), nil
+	}
+}
+
+// goTypeToJSON names a Go kind the way the JSON schema would
+func goTypeToJSON(kind string) string {
+	switch kind {
+	case "bool":
+		return "boolean"
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "integer"
+	case "float32", "float64":
+		return "number"
+	case "slice", "array":
+		return "array"
+	case "map", "struct", "ptr":
+		return "object"
+	}
+	return kind
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeErrorResponse(t *testing.T, rr *httptest.ResponseRecorder) APIError {
+	t.Helper()
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp.Error
+}
+
+func TestWithRequestID(t *testing.T) {
+	var seen string
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+	}))
+
+	// Generated when the client sends none
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	assert.Len(t, seen, 16)
+	assert.Equal(t, seen, rr.Header().Get(RequestIDHeader))
+
+	// Reused when the client sends a sane one
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "support-ticket-42")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, "support-ticket-42", seen)
+	assert.Equal(t, "support-ticket-42", rr.Header().Get(RequestIDHeader))
+
+	// Replaced when it could corrupt logs
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotEqual(t, "bad id\nwith newline", seen)
+}
+
+func TestClassifyDecodeError(t *testing.T) {
+	var job model.Job
+	typeErr := json.Unmarshal([]byte(`{"simple_options":{"resolution":1080}}`), &job)
+	syntaxErr := json.Unmarshal([]byte(`{"input_file_path":}`), &job)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantField  string
+	}{
+		{"Type mismatch is a client error", typeErr, http.StatusBadRequest, ErrCodeValidation, "simple_options.resolution"},
+		{"Syntax error", syntaxErr, http.StatusBadRequest, ErrCodeInvalidJSON, ""},
+		{"Body too large", &http.MaxBytesError{Limit: 10}, http.StatusRequestEntityTooLarge, ErrCodeRequestTooLarge, ""},
+		{"Other decode error", errors.New("unexpected EOF"), http.StatusBadRequest, ErrCodeInvalidJSON, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code, _, details := classifyDecodeError(tt.err)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantCode, code)
+			if tt.wantField != "" {
+				require.Len(t, details, 1)
+				assert.Equal(t, tt.wantField, details[0].Field)
+				assert.Equal(t, "must be a string, got number", details[0].Message)
+			}
+		})
+	}
+}
+
+func TestHandleSubmitJobErrorEnvelope(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+	metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+
+	server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server)
+	handler := withRequestID(http.HandlerFunc(server.handleSubmitJob))
+
+	req := httptest.NewRequest("POST", "/submit", bytes.NewBufferString(`{invalid json}`))
+	req.Header.Set(RequestIDHeader, "trace-me")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	apiErr := decodeErrorResponse(t, rr)
+	assert.Equal(t, ErrCodeInvalidJSON, apiErr.Code)
+	assert.Equal(t, "trace-me", apiErr.RequestID)
+}
+
+func TestMethodNotAllowedErrorEnvelope(t *testing.T) {
+	server := NewServer(&service.Services{Metrics: mocks.NewMetricsClient(t), Redis: mocks.NewRedisClient(t)}, config.Default().Server)
+
+	rr := httptest.NewRecorder()
+	server.handleSubmitJob(rr, httptest.NewRequest("GET", "/submit", nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, ErrCodeMethodNotAllowed, decodeErrorResponse(t, rr).Code)
+}
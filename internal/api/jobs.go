@@ -0,0 +1,353 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"transcodeflow/internal/joblog"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/repository/redis"
+	"transcodeflow/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// SubmitResponse is returned when a job is accepted
+type SubmitResponse struct {
+	ID    string         `json:"id"`
+	State model.JobState `json:"state"`
+}
+
+// JobListResponse is returned by GET /jobs
+type JobListResponse struct {
+	Jobs []model.JobRecord `json:"jobs"`
+}
+
+// errInvalidTransition is returned from record updates that the job's current
+// state does not allow
+var errInvalidTransition = errors.New("invalid job state transition")
+
+// handleListJobs returns recent jobs, optionally filtered by state
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	state := model.JobState(r.URL.Query().Get("state"))
+	if state != "" && !model.IsValidJobState(state) {
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid query parameters",
+			FieldError{"state", "must be one of queued, running, succeeded, failed, cancelled, skipped"})
+		return
+	}
+
+	limit := defaultListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Invalid query parameters",
+				FieldError{"limit", fmt.Sprintf("must be an integer between 1 and %d", maxListLimit)})
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	records, err := s.services.Redis.ListJobRecords(ctx, state, limit)
+	if err != nil {
+		requestLogger(r).Error("System error: Failed to list jobs", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to list jobs")
+		return
+	}
+	if records == nil {
+		records = []model.JobRecord{}
+	}
+	writeJSON(w, r, http.StatusOK, JobListResponse{Jobs: records})
+}
+
+// handlePlanJob answers a dry run synchronously: it plans the submitted job
+// without queueing it. Inputs are probed from the API server, so paths it
+// cannot see produce a warning instead of probe data.
+func (s *Server) handlePlanJob(w http.ResponseWriter, r *http.Request) {
+	r, span := startRequestSpan(r, "plan job")
+	defer span.End()
+
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	job, ok := s.decodeJob(w, r, requestLogger(r))
+	if !ok {
+		return
+	}
+
+	plan := s.planner.Plan(r.Context(), job)
+	span.SetAttributes(attribute.String("plan.action", string(plan.Action)))
+	writeJSON(w, r, http.StatusOK, plan)
+}
+
+// handleGetJob returns the record for a single job
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	record, ok := s.loadJobRecord(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, record)
+}
+
+// handleJobLogs returns the output captured while the job ran
+func (s *Server) handleJobLogs(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	record, ok := s.loadJobRecord(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Output is stored when an attempt finishes; a retried job shows its
+	// previous attempt until then
+	output, err := s.services.JobLogs.Load(ctx, record.ID)
+	if err != nil && !errors.Is(err, joblog.ErrNotFound) {
+		requestLogger(r).Error("System error: Failed to load job logs", zap.String("job_id", record.ID), zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to load job logs")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, output)
+	if record.Error != "" {
+		fmt.Fprintf(w, "\nerror: %s\n", record.Error)
+	}
+}
+
+// handleCancelJob cancels a queued or running job. Queued jobs are skipped
+// when a worker dequeues them; running jobs are stopped by their worker.
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	record, err := s.services.Redis.UpdateJobRecord(ctx, r.PathValue("id"), func(rec *model.JobRecord) error {
+		if rec.State.IsTerminal() {
+			return errInvalidTransition
+		}
+		now := time.Now().UTC()
+		rec.State = model.JobStateCancelled
+		rec.FinishedAt = &now
+		return nil
+	})
+	if !s.checkRecordUpdate(w, r, err, "Job has already finished") {
+		return
+	}
+
+	requestLogger(r).Info("Job cancelled", zap.String("job_id", record.ID))
+	writeJSON(w, r, http.StatusOK, record)
+}
+
+// handleRetryJob queues a failed or cancelled job again under the same ID.
+// A worker still stopping a cancelled job's earlier attempt notices the new
+// attempt and leaves the record and its outcome to it.
+func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request) {
+	r, span := startRequestSpan(r, "retry job")
+	defer span.End()
+	span.SetAttributes(attribute.String("job.id", r.PathValue("id")))
+	log := requestLogger(r)
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	existing, ok := s.loadJobRecord(w, r)
+	if !ok {
+		return
+	}
+	if existing.State != model.JobStateFailed && existing.State != model.JobStateCancelled {
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "Only failed or cancelled jobs can be retried")
+		return
+	}
+	if existing.Job.Pipeline != "" {
+		// The pipeline has moved on from its failed step
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "Jobs queued by a pipeline cannot be retried; submit the pipeline again")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if !s.reserveSlot(ctx, w, r, existing.Job.Submitter) {
+		return
+	}
+
+	record, err := s.services.Redis.UpdateJobRecord(ctx, existing.ID, func(rec *model.JobRecord) error {
+		if rec.State != model.JobStateFailed && rec.State != model.JobStateCancelled {
+			return errInvalidTransition
+		}
+		rec.State = model.JobStateQueued
+		rec.Attempts++
+		rec.StartedAt = nil
+		rec.FinishedAt = nil
+		rec.WorkerID = ""
+		rec.Error = ""
+		return nil
+	})
+	if err != nil {
+		s.releaseSlot(ctx, log, existing.Job.Submitter)
+	}
+	if !s.checkRecordUpdate(w, r, err, "Only failed or cancelled jobs can be retried") {
+		return
+	}
+
+	// A copy of the earlier attempt may still be queued if it was cancelled
+	// there; workers drop it since its attempt is out of date
+	job := record.Job
+	job.Attempt = record.Attempts
+	if err := s.pushJob(ctx, log, job); err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to enqueue job")
+		return
+	}
+
+	log.Info("Job retried", zap.String("job_id", record.ID), zap.Int("attempts", record.Attempts))
+	s.services.Metrics.IncrementQueuePushCounter("job_retried")
+	s.services.Metrics.IncrementJobRetryCounter("api")
+	writeJSON(w, r, http.StatusAccepted, SubmitResponse{ID: record.ID, State: record.State})
+}
+
+// loadJobRecord fetches the job named in the path, writing an error response
+// and returning false if it cannot
+func (s *Server) loadJobRecord(w http.ResponseWriter, r *http.Request) (model.JobRecord, bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	record, err := s.services.Redis.GetJobRecord(ctx, r.PathValue("id"))
+	if errors.Is(err, redis.ErrJobNotFound) {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Job not found")
+		return record, false
+	}
+	if err != nil {
+		requestLogger(r).Error("System error: Failed to load job", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to load job")
+		return record, false
+	}
+	return record, true
+}
+
+// checkRecordUpdate maps the result of UpdateJobRecord to an error response
+func (s *Server) checkRecordUpdate(w http.ResponseWriter, r *http.Request, err error, conflictMsg string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, redis.ErrJobNotFound):
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Job not found")
+	case errors.Is(err, errInvalidTransition):
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, conflictMsg)
+	default:
+		requestLogger(r).Error("System error: Failed to update job", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to update job")
+	}
+	return false
+}
+
+// reserveSlot counts a job against its submitter's quota, writing a 429 or
+// 500 response and returning false if it cannot
+func (s *Server) reserveSlot(ctx context.Context, w http.ResponseWriter, r *http.Request, submitter string) bool {
+	if s.limits.MaxActiveJobs <= 0 {
+		return true
+	}
+
+	log := requestLogger(r)
+	reserved, err := s.services.Redis.ReserveSubmitterSlot(ctx, submitter, s.limits.MaxActiveJobs)
+	if err != nil {
+		log.Error("System error: Failed to check submitter quota", zap.Error(err))
+		s.services.Metrics.IncrementServerRequestCounter("failed")
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Server error")
+		return false
+	}
+	if !reserved {
+		log.Warn("User error: Submitter job quota exceeded",
+			zap.String("submitter", submitter),
+			zap.Int64("max_active_jobs", s.limits.MaxActiveJobs))
+		s.services.Metrics.IncrementThrottledRequestCounter("quota")
+		s.services.Metrics.IncrementServerRequestCounter("failed")
+		writeTooManyRequests(w, r, s.limits.QuotaRetryAfter, ErrCodeQuotaExceeded, "Job quota exceeded")
+		return false
+	}
+	return true
+}
+
+// releaseSlot gives back a quota slot reserved for a job that was not queued
+func (s *Server) releaseSlot(ctx context.Context, log *zap.Logger, submitter string) {
+	if s.limits.MaxActiveJobs <= 0 {
+		return
+	}
+	if err := s.services.Redis.ReleaseSubmitterSlot(ctx, submitter); err != nil {
+		log.Error("System error: Failed to release submitter slot", zap.Error(err))
+	}
+}
+
+// pushJob enqueues a job whose record already exists. On failure the quota
+// slot is released and the record marked failed so it can be retried.
+func (s *Server) pushJob(ctx context.Context, log *zap.Logger, job model.Job) error {
+	// The worker continues the trace from the producer span, so a job can be
+	// followed from submission to its result
+	ctx, span := telemetry.Tracer().Start(ctx, "enqueue job",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("job.id", job.ID)))
+	job.TraceContext = telemetry.InjectTraceContext(ctx)
+
+	jobBytes, err := json.Marshal(job)
+	if err == nil {
+		err = s.services.Redis.EnqueueJob(ctx, string(jobBytes))
+	}
+	telemetry.EndSpan(span, err)
+	if err == nil {
+		return nil
+	}
+
+	log.Error("System error: Failed to enqueue job", zap.String("job_id", job.ID), zap.Error(err))
+	s.releaseSlot(ctx, log, job.Submitter)
+	_, updateErr := s.services.Redis.UpdateJobRecord(ctx, job.ID, func(rec *model.JobRecord) error {
+		now := time.Now().UTC()
+		rec.State = model.JobStateFailed
+		rec.FinishedAt = &now
+		rec.Error = "failed to enqueue job: " + err.Error()
+		return nil
+	})
+	if updateErr != nil {
+		log.Error("System error: Failed to mark unqueued job as failed", zap.Error(updateErr))
+	}
+	s.services.Metrics.IncrementServerRequestCounter("failed")
+	return err
+}
+
+// writeJSON sends a successful JSON response
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	recordResponseStatus(r, status, "")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		requestLogger(r).Error("System error: Failed to write response", zap.Error(err))
+	}
+}
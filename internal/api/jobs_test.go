@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/joblog"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/planner"
+	"transcodeflow/internal/repository/redis"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// serveRoutes sends a request through the same router as Start
+func serveRoutes(server *Server, method, path string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	server.routes().ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+	return rr
+}
+
+// applyUpdate makes the UpdateJobRecord mock run the update function against
+// the given record, like the Redis implementation does
+func applyUpdate(record model.JobRecord) func(context.Context, string, func(*model.JobRecord) error) (model.JobRecord, error) {
+	return func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+		if err := update(&record); err != nil {
+			return model.JobRecord{}, err
+		}
+		return record, nil
+	}
+}
+
+func newJobsTestServer(t *testing.T) (*Server, *mocks.MetricsClient, *mocks.RedisClient) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+	return NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server), metricsMock, redisMock
+}
+
+func TestHandleListJobs(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	redisMock.On("ListJobRecords", mock.Anything, model.JobStateFailed, 10).Return([]model.JobRecord{
+		{ID: "abc", State: model.JobStateFailed},
+	}, nil)
+
+	rr := serveRoutes(server, "GET", "/jobs?state=failed&limit=10")
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	var resp JobListResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.Jobs, 1)
+	assert.Equal(t, "abc", resp.Jobs[0].ID)
+}
+
+func TestHandleListJobsInvalidQuery(t *testing.T) {
+	server, _, _ := newJobsTestServer(t)
+
+	for _, path := range []string{"/jobs?state=exploded", "/jobs?limit=0", "/jobs?limit=abc"} {
+		rr := serveRoutes(server, "GET", path)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, path)
+	}
+}
+
+func TestHandleGetJob(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	redisMock.On("GetJobRecord", mock.Anything, "abc").Return(model.JobRecord{ID: "abc", State: model.JobStateRunning}, nil)
+	redisMock.On("GetJobRecord", mock.Anything, "missing").Return(model.JobRecord{}, redis.ErrJobNotFound)
+
+	rr := serveRoutes(server, "GET", "/jobs/abc")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var record model.JobRecord
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &record))
+	assert.Equal(t, model.JobStateRunning, record.State)
+
+	rr = serveRoutes(server, "GET", "/jobs/missing")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serveRoutes(server, "DELETE", "/jobs/abc")
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestHandleJobLogs(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	logsMock := mocks.NewStore(t)
+	server.services.JobLogs = logsMock
+	redisMock.On("GetJobRecord", mock.Anything, "abc").Return(model.JobRecord{
+		ID: "abc", State: model.JobStateFailed, Error: "exit status 1",
+	}, nil)
+	redisMock.On("GetJobRecord", mock.Anything, "queued").Return(model.JobRecord{
+		ID: "queued", State: model.JobStateQueued,
+	}, nil)
+	redisMock.On("GetJobRecord", mock.Anything, "broken").Return(model.JobRecord{ID: "broken"}, nil)
+	logsMock.On("Load", mock.Anything, "abc").Return("frame=100", nil)
+	logsMock.On("Load", mock.Anything, "queued").Return("", joblog.ErrNotFound)
+	logsMock.On("Load", mock.Anything, "broken").Return("", errors.New("connection refused"))
+
+	rr := serveRoutes(server, "GET", "/jobs/abc/logs")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "frame=100\nerror: exit status 1\n", rr.Body.String())
+
+	rr = serveRoutes(server, "GET", "/jobs/queued/logs")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Body.String(), "jobs that have not finished have no output yet")
+
+	rr = serveRoutes(server, "GET", "/jobs/broken/logs")
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestHandleCancelJob(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    model.JobState
+		wantCode int
+	}{
+		{"Queued job", model.JobStateQueued, http.StatusOK},
+		{"Running job", model.JobStateRunning, http.StatusOK},
+		{"Finished job", model.JobStateSucceeded, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, redisMock := newJobsTestServer(t)
+			redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).
+				Return(applyUpdate(model.JobRecord{ID: "abc", State: tt.state}))
+
+			rr := serveRoutes(server, "POST", "/jobs/abc/cancel")
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode == http.StatusOK {
+				var record model.JobRecord
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &record))
+				assert.Equal(t, model.JobStateCancelled, record.State)
+				assert.NotNil(t, record.FinishedAt)
+			}
+		})
+	}
+}
+
+func TestHandleRetryJob(t *testing.T) {
+	server, metricsMock, redisMock := newJobsTestServer(t)
+
+	failed := model.JobRecord{
+		ID:       "abc",
+		State:    model.JobStateFailed,
+		Attempts: 1,
+		Error:    "exit status 1",
+		Job:      model.Job{ID: "abc", InputFilePath: "in.mkv", OutputFilePath: "out.mkv"},
+	}
+	redisMock.On("GetJobRecord", mock.Anything, "abc").Return(failed, nil)
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).Return(applyUpdate(failed))
+	var queued model.Job
+	redisMock.On("EnqueueJob", mock.Anything, mock.AnythingOfType("string")).Run(func(args mock.Arguments) {
+		json.Unmarshal([]byte(args.String(1)), &queued)
+	}).Return(nil)
+	metricsMock.On("IncrementQueuePushCounter", "job_retried").Return()
+	metricsMock.On("IncrementJobRetryCounter", "api").Return()
+
+	rr := serveRoutes(server, "POST", "/jobs/abc/retry")
+
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	var resp SubmitResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, SubmitResponse{ID: "abc", State: model.JobStateQueued}, resp)
+	// Workers drop any copy of the first attempt still queued
+	assert.Equal(t, 2, queued.Attempt)
+}
+
+func TestHandleRetryJobNotFailed(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	redisMock.On("GetJobRecord", mock.Anything, "abc").Return(model.JobRecord{ID: "abc", State: model.JobStateRunning}, nil)
+
+	rr := serveRoutes(server, "POST", "/jobs/abc/retry")
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	redisMock.AssertNotCalled(t, "EnqueueJob", mock.Anything, mock.Anything)
+}
+
+func TestHandleGetJobRedisError(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	redisMock.On("GetJobRecord", mock.Anything, "abc").Return(model.JobRecord{}, errors.New("connection refused"))
+
+	rr := serveRoutes(server, "GET", "/jobs/abc")
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestHandlePlanJob(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	proberMock := mocks.NewProber(t)
+	proberMock.On("Probe", mock.Anything, "/media/in.mp4").Return(&model.ProbeResult{DurationSeconds: 120, SizeBytes: 1000}, nil)
+	redisMock.On("GetThroughput", mock.Anything, "custom/libx264/sw").Return(model.Throughput{Samples: 2, Speed: 4, CompressionRatio: 2}, nil)
+	server.planner = planner.New(proberMock, redisMock)
+
+	body := `{"input_file_path": "/media/in.mp4", "output_file_path": "/media/out.mp4", "output_arguments": "-c:v libx264"}`
+	rr := httptest.NewRecorder()
+	server.routes().ServeHTTP(rr, httptest.NewRequest("POST", "/jobs/plan", strings.NewReader(body)))
+
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var plan model.JobPlan
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &plan))
+	assert.Equal(t, model.PlanActionEncode, plan.Action)
+	assert.Equal(t, []string{"ffmpeg", "-y", "-hide_banner", "-i", "/media/in.mp4", "-c:v", "libx264", "/media/out.mp4"}, plan.Command)
+	require.NotNil(t, plan.Estimate)
+	assert.Equal(t, 30.0, plan.Estimate.DurationSeconds)
+	assert.Equal(t, int64(500), plan.Estimate.OutputBytes)
+	redisMock.AssertNotCalled(t, "EnqueueJob", mock.Anything, mock.Anything)
+}
+
+func TestHandlePlanJobInvalid(t *testing.T) {
+	server, _, _ := newJobsTestServer(t)
+
+	rr := serveRoutes(server, "GET", "/jobs/plan")
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+
+	rr = httptest.NewRecorder()
+	server.routes().ServeHTTP(rr, httptest.NewRequest("POST", "/jobs/plan", strings.NewReader(`{"input_file_path": ""}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
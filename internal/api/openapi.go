@@ -0,0 +1,393 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"transcodeflow/internal/model"
+)
+
+// openAPISpec is the OpenAPI 3 document describing every endpoint, less
+// the job types, which apiDocument adds from the registry
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// FieldError describes a single problem found while validating a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// schema is the subset of the OpenAPI schema object used by the validator
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties json.RawMessage    `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	Pattern              string             `json:"pattern"`
+	MinLength            *int               `json:"minLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	AnyOf                []*schema          `json:"anyOf"`
+
+	pattern    *regexp.Regexp
+	additional *schema
+	closed     bool
+}
+
+type openAPIDocument struct {
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// apiDocument returns the served document and the component schemas
+// request bodies are validated against. It is built on first use, after
+// every job type has been registered.
+var apiDocument = sync.OnceValues(func() ([]byte, map[string]*schema) {
+	spec := mustAddJobTypes(openAPISpec, model.JobHandlers())
+	return spec, mustLoadSchemas(spec)
+})
+
+// mustAddJobTypes adds job types to the Job schema of an OpenAPI document:
+// each type joins the type enum and its options become a property
+func mustAddJobTypes(spec []byte, handlers []*model.JobHandler) []byte {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		panic("invalid embedded OpenAPI document: " + err.Error())
+	}
+	job, _ := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})["Job"].(map[string]interface{})
+	properties, _ := job["properties"].(map[string]interface{})
+	if properties == nil {
+		panic("embedded OpenAPI document has no Job properties")
+	}
+
+	kind, _ := properties["type"].(map[string]interface{})
+	if kind == nil {
+		panic("embedded OpenAPI document has no Job type property")
+	}
+	types := make([]interface{}, len(handlers))
+	descriptions := []string{fmt.Sprint(kind["description"]) + "."}
+	for i, h := range handlers {
+		types[i] = string(h.Type)
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s.", h.Type, h.Description))
+		if h.Options == "" {
+			continue
+		}
+		var options interface{}
+		if err := json.Unmarshal([]byte(h.Schema), &options); err != nil {
+			panic(fmt.Sprintf("invalid schema for %s jobs: %v", h.Type, err))
+		}
+		properties[h.Options] = options
+	}
+	kind["enum"] = types
+	kind["description"] = strings.Join(descriptions, " ")
+
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic("cannot encode OpenAPI document: " + err.Error())
+	}
+	return out
+}
+
+func mustLoadSchemas(spec []byte) map[string]*schema {
+	var doc openAPIDocument
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		panic("invalid embedded OpenAPI document: " + err.Error())
+	}
+	for name, s := range doc.Components.Schemas {
+		if err := s.compile(); err != nil {
+			panic(fmt.Sprintf("invalid schema %s: %v", name, err))
+		}
+	}
+	return doc.Components.Schemas
+}
+
+// compile prepares patterns and additionalProperties for validation
+func (s *schema) compile() error {
+	if s == nil {
+		return nil
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = re
+	}
+
+	if raw := bytes.TrimSpace(s.AdditionalProperties); len(raw) > 0 {
+		if string(raw) == "false" {
+			s.closed = true
+		} else if string(raw) != "true" {
+			s.additional = &schema{}
+			if err := json.Unmarshal(raw, s.additional); err != nil {
+				return err
+			}
+		}
+	}
+
+	children := []*schema{s.Items, s.additional}
+	for _, p := range s.Properties {
+		children = append(children, p)
+	}
+	children = append(children, s.AnyOf...)
+	for _, child := range children {
+		if err := child.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateRequest checks a JSON request body against a named component
+// schema, returning every problem found. An error is returned only when the
+// body is not well-formed JSON.
+func validateRequest(schemaName string, body []byte) ([]FieldError, error) {
+	_, schemas := apiDocument()
+	s, ok := schemas[schemaName]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema %q", schemaName)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+
+	var problems []FieldError
+	s.validate("", value, &problems)
+	return problems, nil
+}
+
+func (s *schema) resolve() *schema {
+	if s.Ref == "" {
+		return s
+	}
+	name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+	_, schemas := apiDocument()
+	if target, ok := schemas[name]; ok {
+		return target
+	}
+	return s
+}
+
+func (s *schema) validate(path string, value interface{}, problems *[]FieldError) {
+	s = s.resolve()
+
+	if len(s.AnyOf) > 0 {
+		var alternatives []string
+		for _, option := range s.AnyOf {
+			var optionProblems []FieldError
+			option.validate(path, value, &optionProblems)
+			if len(optionProblems) == 0 {
+				return
+			}
+			for _, p := range optionProblems {
+				alternatives = append(alternatives, p.Message)
+			}
+		}
+		*problems = append(*problems, FieldError{path, strings.Join(alternatives, ", or ")})
+		return
+	}
+
+	if s.Type != "" && !matchesType(s.Type, value) {
+		*problems = append(*problems, FieldError{path, fmt.Sprintf("must be %s, got %s", withArticle(s.Type), jsonTypeName(value))})
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		*problems = append(*problems, FieldError{path, "must be one of " + formatEnum(s.Enum)})
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			msg := fmt.Sprintf("must be at least %d characters", *s.MinLength)
+			if *s.MinLength == 1 {
+				msg = "must not be empty"
+			}
+			*problems = append(*problems, FieldError{path, msg})
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			*problems = append(*problems, FieldError{path, "must match pattern " + s.Pattern})
+		}
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			break
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			*problems = append(*problems, FieldError{path, fmt.Sprintf("must be at least %g", *s.Minimum)})
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			*problems = append(*problems, FieldError{path, fmt.Sprintf("must be at most %g", *s.Maximum)})
+		}
+	case map[string]interface{}:
+		s.validateObject(path, v, problems)
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, problems)
+			}
+		}
+	}
+}
+
+func (s *schema) validateObject(path string, obj map[string]interface{}, problems *[]FieldError) {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			*problems = append(*problems, FieldError{joinPath(path, name), "is required"})
+		}
+	}
+
+	// Report in a stable order so clients and tests see consistent output
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field := joinPath(path, name)
+		if prop, ok := s.Properties[name]; ok {
+			if obj[name] == nil && !contains(s.Required, name) {
+				// Explicit nulls are treated like omitted optional fields
+				continue
+			}
+			prop.validate(field, obj[name], problems)
+		} else if s.additional != nil {
+			s.additional.validate(field, obj[name], problems)
+		} else if s.closed {
+			*problems = append(*problems, FieldError{field, "unknown field"})
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func matchesType(typ string, value interface{}) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := n.Int64()
+		return err == nil
+	}
+	return true
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func withArticle(typ string) string {
+	switch typ {
+	case "array", "integer", "object":
+		return "an " + typ
+	}
+	return "a " + typ
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		switch a := allowed.(type) {
+		case float64:
+			// Enum numbers are parsed as float64, request numbers as json.Number
+			if n, ok := value.(json.Number); ok {
+				if f, err := n.Float64(); err == nil && f == a {
+					return true
+				}
+			}
+		default:
+			if allowed == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func formatEnum(enum []interface{}) string {
+	quoted := make([]string, len(enum))
+	for i, v := range enum {
+		if s, ok := v.(string); ok {
+			quoted[i] = fmt.Sprintf("%q", s)
+		} else {
+			quoted[i] = fmt.Sprint(v)
+		}
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// handleOpenAPI serves the OpenAPI document
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method Not Allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	spec, _ := apiDocument()
+	w.Write(spec)
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleOpenAPI(t *testing.T) {
+	server := NewServer(&service.Services{Metrics: mocks.NewMetricsClient(t), Redis: mocks.NewRedisClient(t)}, config.Default().Server)
+
+	rr := httptest.NewRecorder()
+	server.handleOpenAPI(rr, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+	assert.Contains(t, doc["paths"], "/submit")
+
+	// Every registered job type and its options are published
+	job := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})["Job"].(map[string]interface{})
+	properties := job["properties"].(map[string]interface{})
+	for _, h := range model.JobHandlers() {
+		assert.Contains(t, properties["type"].(map[string]interface{})["enum"], string(h.Type))
+		if h.Options != "" {
+			assert.Contains(t, properties, h.Options)
+		}
+	}
+}
+
+func TestAddJobTypes(t *testing.T) {
+	spec := mustAddJobTypes(openAPISpec, []*model.JobHandler{{
+		Type:        "waveform",
+		Description: "Draw the audio as an image",
+		Options:     "waveform",
+		Schema:      `{"type": "object", "additionalProperties": false, "properties": {"colour": {"type": "string"}}}`,
+	}})
+	schemas := mustLoadSchemas(spec)
+	job := schemas["Job"]
+	assert.Equal(t, []interface{}{"waveform"}, job.Properties["type"].Enum)
+	require.Contains(t, job.Properties, "waveform")
+	assert.True(t, job.Properties["waveform"].closed)
+}
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []FieldError
+	}{
+		{
+			name: "Valid simple job",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","dry_run":"true",
+				"simple_options":{"quality_preset":"quality","resolution":"1080p","audio_quality":"high"}}`,
+			want: nil,
+		},
+		{
+			name: "Explicit resolution",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","simple_options":{"resolution":"1280:720"}}`,
+			want: nil,
+		},
+		{
+			name: "Null optional field",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","simple_options":null}`,
+			want: nil,
+		},
+		{
+			name: "Missing required fields",
+			body: `{}`,
+			want: []FieldError{
+				{"input_file_path", "is required"},
+			},
+		},
+		{
+			name: "Empty required field",
+			body: `{"input_file_path":"","output_file_path":"/out.mp4"}`,
+			want: []FieldError{{"input_file_path", "must not be empty"}},
+		},
+		{
+			name: "Unknown field",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","flags":"--dry-run"}`,
+			want: []FieldError{{"flags", "unknown field"}},
+		},
+		{
+			name: "Flags sent as booleans",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","dry_run":true,"simple_options":{"use_hardware_acceleration":false}}`,
+			want: nil,
+		},
+		{
+			name: "Flags in legacy string forms",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","dry_run":"yes","simple_options":{"keep_original_resolution":"0"}}`,
+			want: nil,
+		},
+		{
+			name: "Unrecognised flag",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","dry_run":1}`,
+			want: []FieldError{{"dry_run", `must be a boolean, got number, or must be a string, got number`}},
+		},
+		{
+			name: "Several nested problems",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","simple_options":{
+				"quality_preset":"insane","resolution":"8k","audio_quality":"ultra","use_hardware_acceleration":"sometimes"}}`,
+			want: []FieldError{
+				{"simple_options.audio_quality", `must be one of "low", "medium", "high"`},
+				{"simple_options.quality_preset", `must be one of "ultrafast", "fast", "balanced", "quality", "slow", "ultraslow"`},
+				{"simple_options.resolution", `must be one of "480p", "720p", "1080p", "4k", "2160p", "original", or must match pattern ^-?[0-9]+:-?[0-9]+$`},
+				{"simple_options.use_hardware_acceleration", `must be a boolean, got string, or must be one of "true", "false", "yes", "no", "on", "off", "1", "0", ""`},
+			},
+		},
+		{
+			name: "Requirements",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","requirements":{"hardware_encode":["av1"],"software_fallback":true}}`,
+		},
+		{
+			name: "Hardware requirement for an unknown codec",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","requirements":{"hardware_encode":["mpeg2"]}}`,
+			want: []FieldError{{"requirements.hardware_encode[0]", `must be one of "h264", "hevc", "av1", "vp9"`}},
+		},
+		{
+			name: "ABR ladder",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out/show","abr":{"formats":["hls","dash"],"renditions":[{"resolution":"1080p","video_bitrate":"5000k"},{"name":"sd","resolution":"480p","video_bitrate":"1.4M","audio_bitrate":"96k"}]}}`,
+		},
+		{
+			name: "ABR rendition without a bitrate",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out/show","abr":{"renditions":[{"resolution":"720p","video_bitrate":"fast"},{"resolution":"480p"}]}}`,
+			want: []FieldError{
+				{"abr.renditions[0].video_bitrate", "must match pattern ^[0-9]+(\\.[0-9]+)?[kKmM]?$"},
+				{"abr.renditions[1].video_bitrate", "is required"},
+			},
+		},
+		{
+			name: "Sprite job",
+			body: `{"type":"sprite","input_file_path":"/in.mkv","output_file_path":"/sprites/in","sprite":{"interval_seconds":5,"columns":8}}`,
+		},
+		{
+			name: "Unknown job type and thumbnail format",
+			body: `{"type":"waveform","input_file_path":"/in.mkv","output_file_path":"/thumbs","thumbnails":{"format":"bmp"}}`,
+			want: []FieldError{
+				{"thumbnails.format", `must be one of "jpg", "png", "webp"`},
+				{"type", `must be one of "transcode", "remux", "audio_extract", "subtitle_extract", "thumbnails", "sprite", "preview", "probe", "verify"`},
+			},
+		},
+		{
+			name: "Probe without an output",
+			body: `{"type":"probe","input_file_path":"/in.mkv"}`,
+		},
+		{
+			name: "Audio extract options",
+			body: `{"type":"audio_extract","input_file_path":"/in.mkv","output_file_path":"/out.m4a","audio_extract":{"stream":1,"codec":"vorbis","bitrate":"loud"}}`,
+			want: []FieldError{
+				{"audio_extract.bitrate", "must match pattern ^[0-9]+(\\.[0-9]+)?[kKmM]?$"},
+				{"audio_extract.codec", `must be one of "copy", "aac", "opus", "mp3", "flac"`},
+			},
+		},
+		{
+			name: "Numbers within their bounds",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mkv","simple_options":{"av1_encoder":"libsvtav1","film_grain":50,
+				"subtitles":{"mode":"burn","track":0},"loudness":{"target_lufs":-70,"true_peak":0,"lra":20}}}`,
+		},
+		{
+			name: "Numbers out of range",
+			body: `{"input_file_path":"/in.mkv","output_file_path":"/out.mkv","simple_options":{"av1_encoder":"libsvtav1","film_grain":51,
+				"subtitles":{"mode":"burn","track":-1},"loudness":{"target_lufs":-4.5,"true_peak":-9.5,"lra":0.5}}}`,
+			want: []FieldError{
+				{"simple_options.film_grain", "must be at most 50"},
+				{"simple_options.loudness.lra", "must be at least 1"},
+				{"simple_options.loudness.target_lufs", "must be at most -5"},
+				{"simple_options.loudness.true_peak", "must be at least -9"},
+				{"simple_options.subtitles.track", "must be at least 0"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateRequest("Job", []byte(tt.body))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateRequestMalformedJSON(t *testing.T) {
+	_, err := validateRequest("Job", []byte(`{"input_file_path":`))
+	assert.Error(t, err)
+}
+
+func TestHandleSubmitJobSchemaViolation(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+	metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+
+	server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server)
+
+	body := `{"input_file_path":"/in.mkv","output_file_path":"/out.mp4","dry_run":"maybe","simple_options":{"quality_preset":"insane"}}`
+	rr := httptest.NewRecorder()
+	server.handleSubmitJob(rr, httptest.NewRequest("POST", "/submit", bytes.NewBufferString(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, ErrCodeValidation, resp.Error.Code)
+	require.Len(t, resp.Error.Details, 2)
+	assert.Equal(t, "dry_run", resp.Error.Details[0].Field)
+	assert.Equal(t, "simple_options.quality_preset", resp.Error.Details[1].Field)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/repository/redis"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// handleSubmitPipeline validates a pipeline and queues the steps that depend
+// on nothing. The rest are queued by workers as their parents finish.
+func (s *Server) handleSubmitPipeline(w http.ResponseWriter, r *http.Request) {
+	r, span := startRequestSpan(r, "submit pipeline")
+	defer span.End()
+	log := requestLogger(r)
+
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	pipeline, ok := s.decodePipeline(w, r, log)
+	if !ok {
+		s.services.Metrics.IncrementServerRequestCounter("failed")
+		return
+	}
+
+	record := model.NewPipelineRecord(model.NewJobID(), pipeline, clientIdentity(r), time.Now().UTC())
+	span.SetAttributes(attribute.String("pipeline.id", record.ID), attribute.String("job.submitter", record.Submitter))
+	log = log.With(zap.String("pipeline_id", record.ID))
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// A pipeline holds one slot of its submitter's quota until it finishes,
+	// however many steps it runs
+	if !s.reserveSlot(ctx, w, r, record.Submitter) {
+		return
+	}
+	if err := s.services.Redis.CreatePipelineRecord(ctx, record); err != nil {
+		log.Error("System error: Failed to create pipeline record", zap.Error(err))
+		s.releaseSlot(ctx, log, record.Submitter)
+		s.services.Metrics.IncrementServerRequestCounter("failed")
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to start pipeline")
+		return
+	}
+
+	started, err := s.pipelines.Start(ctx, record.ID)
+	if err != nil {
+		log.Error("System error: Failed to start pipeline", zap.Error(err))
+		s.releaseSlot(ctx, log, record.Submitter)
+		s.services.Metrics.IncrementServerRequestCounter("failed")
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to start pipeline")
+		return
+	}
+
+	log.Info("Pipeline submitted successfully", zap.Int("steps", len(pipeline.Steps)),
+		zap.String("on_failure", string(pipeline.OnFailure)))
+	s.services.Metrics.IncrementServerRequestCounter("success")
+	writeJSON(w, r, http.StatusAccepted, started)
+}
+
+// decodePipeline reads a pipeline from the request body and checks it
+// against the OpenAPI schema and its own rules, writing an error response
+// when it is unusable
+func (s *Server) decodePipeline(w http.ResponseWriter, r *http.Request, log *zap.Logger) (model.Pipeline, bool) {
+	var pipeline model.Pipeline
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		log.Error("User error: Failed to read request body", zap.Error(err))
+		status, code, msg, details := classifyDecodeError(err)
+		writeError(w, r, status, code, msg, details...)
+		return pipeline, false
+	}
+
+	problems, err := validateRequest("Pipeline", body)
+	if err != nil {
+		log.Error("User error: Failed to decode pipeline from request", zap.Error(err))
+		status, code, msg, details := classifyDecodeError(err)
+		writeError(w, r, status, code, msg, details...)
+		return pipeline, false
+	}
+	if len(problems) > 0 {
+		log.Error("User error: Pipeline failed schema validation", zap.Any("problems", problems))
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Request body failed validation", problems...)
+		return pipeline, false
+	}
+
+	if err := json.Unmarshal(body, &pipeline); err != nil {
+		log.Error("User error: Failed to decode pipeline from request", zap.Error(err))
+		status, code, msg, details := classifyDecodeError(err)
+		writeError(w, r, status, code, msg, details...)
+		return pipeline, false
+	}
+
+	// Reject unknown steps, cycles and jobs ffmpeg cannot carry out
+	var invalid *model.ValidationError
+	if err := pipeline.Validate(); errors.As(err, &invalid) {
+		log.Error("User error: Pipeline is invalid", zap.Error(err))
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Request body failed validation",
+			FieldError{invalid.Field, invalid.Message})
+		return pipeline, false
+	}
+	// Workers POST the finished record from inside the network, so only
+	// let submitters name hosts the operator allows
+	if pipeline.NotifyURL != "" && !s.notifyAllowed(pipeline.NotifyURL) {
+		log.Error("User error: Pipeline notify_url host is not allowed", zap.String("notify_url", pipeline.NotifyURL))
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Request body failed validation",
+			FieldError{"notify_url", "host is not in server.notify_hosts"})
+		return pipeline, false
+	}
+
+	return pipeline, true
+}
+
+// handleGetPipeline returns the record of a pipeline. Queued steps whose job
+// a worker has started are reported as running.
+func (s *Server) handleGetPipeline(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	record, err := s.services.Redis.GetPipelineRecord(ctx, r.PathValue("id"))
+	if errors.Is(err, redis.ErrPipelineNotFound) {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "Pipeline not found")
+		return
+	}
+	if err != nil {
+		requestLogger(r).Error("System error: Failed to load pipeline", zap.Error(err))
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to load pipeline")
+		return
+	}
+
+	for i, step := range record.Steps {
+		if step.State != model.StepQueued {
+			continue
+		}
+		job, err := s.services.Redis.GetJobRecord(ctx, step.JobID)
+		if err == nil && job.State == model.JobStateRunning {
+			record.Steps[i].State = model.StepRunning
+		}
+	}
+	writeJSON(w, r, http.StatusOK, record)
+}
+
+// notifyAllowed reports whether a notify_url names a host in
+// server.notify_hosts. Any host is allowed when none are configured.
+func (s *Server) notifyAllowed(notifyURL string) bool {
+	if len(s.notifyHosts) == 0 {
+		return true
+	}
+	u, err := url.Parse(notifyURL)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(s.notifyHosts, strings.ToLower(u.Hostname()))
+}
+
+// splitHosts parses the comma-separated server.notify_hosts setting
+func splitHosts(hosts string) []string {
+	var split []string
+	for _, host := range strings.Split(hosts, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			split = append(split, host)
+		}
+	}
+	return split
+}
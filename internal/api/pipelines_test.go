@@ -0,0 +1,194 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/repository/redis"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testPipelineBody = `{
+	"on_failure": "compensate",
+	"steps": [
+		{"name": "encode", "job": {"input_file_path": "/media/in.mkv", "output_file_path": "/media/out.mp4"}},
+		{"name": "thumbs", "job": {"type": "thumbnails", "input_file_path": "{{steps.encode.output}}", "output_file_path": "/media/thumbs"}}
+	]
+}`
+
+func postPipeline(server *Server, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	server.routes().ServeHTTP(rr, httptest.NewRequest("POST", "/pipelines", strings.NewReader(body)))
+	return rr
+}
+
+func TestHandleSubmitPipeline(t *testing.T) {
+	server, metricsMock, redisMock := newJobsTestServer(t)
+
+	var stored model.PipelineRecord
+	redisMock.On("CreatePipelineRecord", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(model.PipelineRecord)
+	}).Return(nil)
+	redisMock.On("UpdatePipelineRecord", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, _ string, update func(*model.PipelineRecord) error) (model.PipelineRecord, error) {
+			err := update(&stored)
+			return stored, err
+		})
+	redisMock.On("CreateJobRecord", mock.Anything, mock.Anything).Return(nil).Once()
+	var queued model.Job
+	redisMock.On("EnqueueJob", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		json.Unmarshal([]byte(args.String(1)), &queued)
+	}).Return(nil).Once()
+	metricsMock.On("IncrementServerRequestCounter", "success").Return()
+
+	rr := postPipeline(server, testPipelineBody)
+
+	require.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	var record model.PipelineRecord
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &record))
+	assert.Equal(t, model.PipelineRunning, record.State)
+	assert.Equal(t, model.FailureCompensate, record.Pipeline.OnFailure)
+	require.Len(t, record.Steps, 2)
+	assert.Equal(t, model.StepQueued, record.Steps[0].State)
+	assert.Equal(t, model.StepPending, record.Steps[1].State)
+	assert.Equal(t, record.Steps[0].JobID, queued.ID)
+	assert.Equal(t, record.ID, queued.Pipeline)
+}
+
+func TestHandleSubmitPipelineInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		field string
+	}{
+		{
+			name:  "Unknown field",
+			body:  `{"steps": [], "retries": 3}`,
+			field: "retries",
+		},
+		{
+			name:  "Invalid step job",
+			body:  `{"steps": [{"name": "a", "job": {"input_file_path": "in.mkv", "output_file_path": "out.mp4", "dry_run": 3}}]}`,
+			field: "steps[0].job.dry_run",
+		},
+		{
+			name:  "No steps",
+			body:  `{"steps": []}`,
+			field: "steps",
+		},
+		{
+			name: "Cycle",
+			body: `{"steps": [
+				{"name": "a", "depends_on": ["b"], "job": {"type": "verify", "input_file_path": "in.mkv"}},
+				{"name": "b", "depends_on": ["a"], "job": {"type": "verify", "input_file_path": "in.mkv"}}
+			]}`,
+			field: "steps",
+		},
+		{
+			name:  "Missing output path",
+			body:  `{"steps": [{"name": "a", "job": {"input_file_path": "in.mkv"}}]}`,
+			field: "steps[0].job.output_file_path",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, metricsMock, redisMock := newJobsTestServer(t)
+			metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+
+			rr := postPipeline(server, tt.body)
+
+			require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+			var resp ErrorResponse
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			require.NotEmpty(t, resp.Error.Details)
+			assert.Equal(t, tt.field, resp.Error.Details[0].Field)
+			redisMock.AssertNotCalled(t, "CreatePipelineRecord", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestHandleSubmitPipelineNotifyHosts(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+	cfg := config.Default().Server
+	cfg.NotifyHosts = "hooks.example.com, CI.example.com"
+	server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, cfg)
+	metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+
+	rr := postPipeline(server, `{"notify_url": "http://169.254.169.254/latest", "steps": [{"name": "a", "job": {"type": "verify", "input_file_path": "in.mkv"}}]}`)
+
+	require.Equal(t, http.StatusBadRequest, rr.Code, rr.Body.String())
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.NotEmpty(t, resp.Error.Details)
+	assert.Equal(t, "notify_url", resp.Error.Details[0].Field)
+	redisMock.AssertNotCalled(t, "CreatePipelineRecord", mock.Anything, mock.Anything)
+
+	assert.True(t, server.notifyAllowed("https://ci.example.com:8443/done"))
+	assert.False(t, server.notifyAllowed("https://example.com/done"))
+}
+
+func TestHandleSubmitPipelineRedisFailure(t *testing.T) {
+	server, metricsMock, redisMock := newJobsTestServer(t)
+	redisMock.On("CreatePipelineRecord", mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+	metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+
+	rr := postPipeline(server, testPipelineBody)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	redisMock.AssertNotCalled(t, "EnqueueJob", mock.Anything, mock.Anything)
+}
+
+func TestHandleGetPipeline(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	record := model.PipelineRecord{
+		ID:    "p1",
+		State: model.PipelineRunning,
+		Steps: []model.PipelineStepStatus{
+			{Name: "encode", State: model.StepSucceeded, JobID: "j1", Output: "/media/out.mp4"},
+			{Name: "thumbs", State: model.StepQueued, JobID: "j2"},
+			{Name: "audio", State: model.StepQueued, JobID: "j3"},
+		},
+	}
+	redisMock.On("GetPipelineRecord", mock.Anything, "p1").Return(record, nil)
+	redisMock.On("GetPipelineRecord", mock.Anything, "missing").Return(model.PipelineRecord{}, redis.ErrPipelineNotFound)
+	redisMock.On("GetJobRecord", mock.Anything, "j2").Return(model.JobRecord{ID: "j2", State: model.JobStateRunning}, nil)
+	redisMock.On("GetJobRecord", mock.Anything, "j3").Return(model.JobRecord{ID: "j3", State: model.JobStateQueued}, nil)
+
+	rr := serveRoutes(server, "GET", "/pipelines/p1")
+	require.Equal(t, http.StatusOK, rr.Code)
+	var got model.PipelineRecord
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, []model.StepState{model.StepSucceeded, model.StepRunning, model.StepQueued},
+		[]model.StepState{got.Steps[0].State, got.Steps[1].State, got.Steps[2].State})
+
+	rr = serveRoutes(server, "GET", "/pipelines/missing")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandleRetryPipelineStep(t *testing.T) {
+	server, _, redisMock := newJobsTestServer(t)
+	redisMock.On("GetJobRecord", mock.Anything, "abc").Return(model.JobRecord{
+		ID:    "abc",
+		State: model.JobStateFailed,
+		Job:   model.Job{ID: "abc", Pipeline: "p1", Step: "encode"},
+	}, nil)
+
+	rr := serveRoutes(server, "POST", "/jobs/abc/retry")
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	redisMock.AssertNotCalled(t, "UpdateJobRecord", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// APIKeyHeader is the request header used to identify API clients
+const APIKeyHeader = "X-API-Key"
+
+// clientIdentity returns the key used for rate limiting and quotas. API keys
+// are hashed so they never end up in Redis key names; otherwise the remote IP
+// is used.
+func clientIdentity(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// rateLimit wraps a handler with a Redis-backed token bucket per client
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	if s.limits.RequestsPerSecond <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+		defer cancel()
+
+		client := clientIdentity(r)
+		allowed, retryAfter, err := s.services.Redis.AllowRequest(ctx, client, s.limits.RequestsPerSecond, s.limits.Burst)
+		if err != nil {
+			// Fail open: an unavailable limiter should not take the API down with it
+			requestLogger(r).Error("System error: Rate limiter unavailable", zap.Error(err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !allowed {
+			requestLogger(r).Warn("Request rate limited", zap.String("client", client))
+			s.services.Metrics.IncrementThrottledRequestCounter("rate_limit")
+			writeTooManyRequests(w, r, retryAfter, ErrCodeRateLimited, "Rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeTooManyRequests responds with 429 and a Retry-After header in whole seconds
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, code, msg string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeError(w, r, http.StatusTooManyRequests, code, msg)
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIdentity(t *testing.T) {
+	req := httptest.NewRequest("POST", "/submit", nil)
+	req.RemoteAddr = "10.0.0.7:51234"
+	assert.Equal(t, "ip:10.0.0.7", clientIdentity(req))
+
+	req.Header.Set(APIKeyHeader, "secret-key")
+	id := clientIdentity(req)
+	assert.Contains(t, id, "key:")
+	assert.NotContains(t, id, "secret-key", "API keys must not be stored in plain text")
+}
+
+func TestRateLimitRejectsWhenBucketEmpty(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+
+	metricsMock.On("IncrementThrottledRequestCounter", "rate_limit").Return()
+	redisMock.On("AllowRequest", mock.Anything, "ip:192.0.2.1", 5.0, 10).
+		Return(false, 1500*time.Millisecond, nil)
+
+	server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server)
+	server.limits = config.RateLimitConfig{RequestsPerSecond: 5, Burst: 10}
+
+	called := false
+	handler := server.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+
+	req := httptest.NewRequest("POST", "/submit", nil)
+	req.RemoteAddr = "192.0.2.1:4000"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.False(t, called, "handler should not run when rate limited")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+}
+
+func TestRateLimitFailsOpenOnRedisError(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+
+	redisMock.On("AllowRequest", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(false, time.Duration(0), errors.New("redis down"))
+
+	server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server)
+	server.limits = config.RateLimitConfig{RequestsPerSecond: 1, Burst: 1}
+
+	handler := server.rateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+}
+
+func TestHandleSubmitJobQuotaExceeded(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+
+	metricsMock.On("IncrementThrottledRequestCounter", "quota").Return()
+	metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+	redisMock.On("ReserveSubmitterSlot", mock.Anything, "ip:192.0.2.1", int64(3)).Return(false, nil)
+
+	server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server)
+	server.limits = config.RateLimitConfig{MaxActiveJobs: 3, QuotaRetryAfter: 30 * time.Second}
+
+	jobJSON, err := json.Marshal(model.Job{InputFilePath: "input.mp4", OutputFilePath: "output.mp4"})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("POST", "/submit", bytes.NewBuffer(jobJSON))
+	req.RemoteAddr = "192.0.2.1:4000"
+	rr := httptest.NewRecorder()
+	server.handleSubmitJob(rr, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "30", rr.Header().Get("Retry-After"))
+	redisMock.AssertNotCalled(t, "EnqueueJob", mock.Anything, mock.Anything)
+}
+
+func TestHandleSubmitJobQuotaReleasedOnEnqueueFailure(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+
+	metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+	redisMock.On("ReserveSubmitterSlot", mock.Anything, mock.Anything, int64(3)).Return(true, nil)
+	redisMock.On("CreateJobRecord", mock.Anything, mock.Anything).Return(nil)
+	redisMock.On("EnqueueJob", mock.Anything, mock.AnythingOfType("string")).Return(errors.New("redis connection error"))
+	redisMock.On("UpdateJobRecord", mock.Anything, mock.Anything, mock.Anything).Return(model.JobRecord{}, nil)
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, mock.Anything).Return(nil)
+
+	server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server)
+	server.limits = config.RateLimitConfig{MaxActiveJobs: 3}
+
+	jobJSON, err := json.Marshal(model.Job{InputFilePath: "input.mp4", OutputFilePath: "output.mp4"})
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	server.handleSubmitJob(rr, httptest.NewRequest("POST", "/submit", bytes.NewBuffer(jobJSON)))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	redisMock.AssertCalled(t, "ReleaseSubmitterSlot", mock.Anything, mock.Anything)
+}
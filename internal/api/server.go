@@ -3,51 +3,72 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
-	"os"
+	"strconv"
 	"time"
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/health"
 	"transcodeflow/internal/model"
+	"transcodeflow/internal/pipeline"
+	"transcodeflow/internal/planner"
 	"transcodeflow/internal/service"
 	"transcodeflow/internal/telemetry"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
+// maxRequestBodyBytes bounds the size of a job submission
+const maxRequestBodyBytes = 1 << 20
+
+// QueueDepthSampleInterval is how often queue depths are published as metrics
+var QueueDepthSampleInterval = 15 * time.Second
+
 // Server encapsulates the HTTP server functionality
 type Server struct {
 	services *service.Services
 	port     string
-	server   *http.Server
+	limits   config.RateLimitConfig
+	adminKey string
+	planner  *planner.Planner
+	// pipelines queues the first steps of submitted pipelines
+	pipelines *pipeline.Orchestrator
+	server    *http.Server
+	// notifyHosts are the hosts a pipeline's notify_url may name; empty
+	// allows any
+	notifyHosts []string
 }
 
 // NewServer creates a new API server with the provided services
-func NewServer(svc *service.Services) *Server {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
+func NewServer(svc *service.Services, cfg config.ServerConfig) *Server {
 	return &Server{
-		services: svc,
-		port:     port,
+		services:    svc,
+		port:        strconv.Itoa(cfg.Port),
+		limits:      cfg.RateLimit,
+		adminKey:    cfg.AdminAPIKey,
+		planner:     planner.New(planner.FFprobe{}, svc.Redis),
+		pipelines:   pipeline.New(svc.Redis),
+		notifyHosts: splitHosts(cfg.NotifyHosts),
 	}
 }
 
 // Start initializes routes and starts the HTTP server
 func (s *Server) Start(ctx context.Context) error {
-	// Create router and register routes
-	mux := http.NewServeMux()
-	mux.HandleFunc("/submit", s.handleSubmitJob)
+	handler := s.routes()
 
 	// Create server with context support
 	s.server = &http.Server{
 		Addr:         ":" + s.port,
-		Handler:      mux,
+		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	go s.sampleQueueDepths(ctx)
+
 	// Channel to capture server errors
 	errCh := make(chan error, 1)
 
@@ -73,78 +94,187 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 }
 
-// handleSubmitJob processes job submission requests
-func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var job model.Job
+// sampleQueueDepths periodically publishes the depth of every queue until ctx
+// is cancelled. Only the API server samples so replicas of the worker do not
+// all poll Redis for the same numbers.
+func (s *Server) sampleQueueDepths(ctx context.Context) {
+	ticker := time.NewTicker(QueueDepthSampleInterval)
+	defer ticker.Stop()
 
-	// Decode job from request body
-	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
-		// Check if the error is due to a type mismatch (e.g., complex128)
-		if _, ok := err.(*json.UnmarshalTypeError); ok {
-			telemetry.Logger.Error("System error: Failed to decode job from request due to type mismatch",
-				zap.Any("request_body", r.Body), zap.Error(err))
-			s.services.Metrics.IncrementServerRequestCounter("failed")
-			http.Error(w, "Server error", http.StatusInternalServerError)
-		} else if _, ok := err.(*json.UnmarshalTypeError); ok {
-			telemetry.Logger.Error("System error: Failed to decode job from request due to type mismatch",
-				zap.Any("request_body", r.Body), zap.Error(err))
-			s.services.Metrics.IncrementServerRequestCounter("failed")
-			http.Error(w, "Server error", http.StatusInternalServerError)
+	for {
+		depths, err := s.services.Redis.QueueDepths(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				telemetry.Logger.Warn("Failed to sample queue depths", zap.Error(err))
+			}
 		} else {
-			telemetry.Logger.Error("User error: Failed to decode job from request",
-				zap.Any("request_body", r.Body), zap.Error(err))
-			s.services.Metrics.IncrementServerRequestCounter("failed")
-			http.Error(w, "Invalid job format", http.StatusBadRequest)
+			for queue, depth := range depths {
+				s.services.Metrics.SetQueueDepth(queue, depth)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-		return
 	}
+}
 
-	// Validate required fields
-	if job.InputFilePath == "" || job.OutputFilePath == "" {
-		telemetry.Logger.Error("User error: Missing required job fields",
-			zap.String("input_file_path", job.InputFilePath),
-			zap.String("output_file_path", job.OutputFilePath))
-		s.services.Metrics.IncrementServerRequestCounter("failed")
-		http.Error(w, "Missing required job fields", http.StatusBadRequest)
+// routes builds the HTTP handler with every endpoint and middleware
+func (s *Server) routes() http.Handler {
+	// Create router and register routes
+	routes := http.NewServeMux()
+	routes.HandleFunc("/submit", s.handleSubmitJob)
+	routes.HandleFunc("/openapi.json", s.handleOpenAPI)
+	routes.HandleFunc("/jobs", s.handleListJobs)
+	routes.HandleFunc("/jobs/plan", s.handlePlanJob)
+	routes.HandleFunc("/jobs/{id}", s.handleGetJob)
+	routes.HandleFunc("/jobs/{id}/logs", s.handleJobLogs)
+	routes.HandleFunc("/jobs/{id}/cancel", s.handleCancelJob)
+	routes.HandleFunc("/jobs/{id}/retry", s.handleRetryJob)
+	routes.HandleFunc("/pipelines", s.handleSubmitPipeline)
+	routes.HandleFunc("/pipelines/{id}", s.handleGetPipeline)
+	routes.Handle("/admin/", s.adminRoutes())
+
+	// Health endpoints are exempt from rate limiting so probes never get throttled
+	mux := http.NewServeMux()
+	health.NewHandler(s.services, false).Register(mux)
+	mux.Handle("/", s.rateLimit(routes))
+
+	return withRequestID(mux)
+}
+
+// handleSubmitJob processes job submission requests
+func (s *Server) handleSubmitJob(w http.ResponseWriter, r *http.Request) {
+	r, span := startRequestSpan(r, "submit job")
+	defer span.End()
+	log := requestLogger(r)
+
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method Not Allowed")
 		return
 	}
 
-	// Convert job to JSON string
-	jobBytes, err := json.Marshal(job)
-	if err != nil {
-		telemetry.Logger.Error("System error: Failed to marshal job into JSON string", zap.Error(err))
+	job, ok := s.decodeJob(w, r, log)
+	if !ok {
 		s.services.Metrics.IncrementServerRequestCounter("failed")
-		http.Error(w, "Server error", http.StatusInternalServerError)
 		return
 	}
-	jobStr := string(jobBytes)
+
+	// Assign an ID and record who submitted the job so it counts against their quota
+	job.ID = model.NewJobID()
+	job.Submitter = clientIdentity(r)
+	span.SetAttributes(attribute.String("job.id", job.ID), attribute.String("job.submitter", job.Submitter))
 
 	// Create a context for Redis operations
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	// Enqueue the job into Redis
-	if err := s.services.Redis.EnqueueJob(ctx, jobStr); err != nil {
-		telemetry.Logger.Error("System error: Failed to enqueue job", zap.Error(err))
+	// Enforce the submitter's quota of queued plus running jobs
+	if !s.reserveSlot(ctx, w, r, job.Submitter) {
+		return
+	}
+
+	// Track the job so clients can follow it after submission
+	record := model.JobRecord{
+		ID:          job.ID,
+		State:       model.JobStateQueued,
+		Job:         job,
+		SubmittedAt: time.Now().UTC(),
+		Attempts:    1,
+	}
+	if err := s.services.Redis.CreateJobRecord(ctx, record); err != nil {
+		log.Error("System error: Failed to create job record", zap.Error(err))
+		s.releaseSlot(ctx, log, job.Submitter)
 		s.services.Metrics.IncrementServerRequestCounter("failed")
-		http.Error(w, "Failed to enqueue job", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to enqueue job")
+		return
+	}
+
+	// Enqueue the job into Redis
+	job.Attempt = record.Attempts
+	if err := s.pushJob(ctx, log, job); err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to enqueue job")
 		return
 	}
 
 	// Log job submission
-	logJob(job)
+	logJob(log, job)
 
 	s.services.Metrics.IncrementQueuePushCounter("job_pushed")
 	s.services.Metrics.IncrementServerRequestCounter("success")
-	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, r, http.StatusAccepted, SubmitResponse{ID: job.ID, State: record.State})
+}
+
+// decodeJob reads a job from the request body, checks it against the
+// OpenAPI schema and the required fields, and writes an error response when
+// it is unusable
+func (s *Server) decodeJob(w http.ResponseWriter, r *http.Request, log *zap.Logger) (model.Job, bool) {
+	var job model.Job
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+	if err != nil {
+		log.Error("User error: Failed to read request body", zap.Error(err))
+		status, code, msg, details := classifyDecodeError(err)
+		writeError(w, r, status, code, msg, details...)
+		return job, false
+	}
+
+	// Validate the request against the OpenAPI schema before decoding so
+	// clients get every problem at once
+	problems, err := validateRequest("Job", body)
+	if err != nil {
+		log.Error("User error: Failed to decode job from request", zap.Error(err))
+		status, code, msg, details := classifyDecodeError(err)
+		writeError(w, r, status, code, msg, details...)
+		return job, false
+	}
+	if len(problems) > 0 {
+		log.Error("User error: Job failed schema validation", zap.Any("problems", problems))
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Request body failed validation", problems...)
+		return job, false
+	}
+
+	// Decode job from request body
+	if err := json.Unmarshal(body, &job); err != nil {
+		log.Error("User error: Failed to decode job from request",
+			zap.ByteString("request_body", body), zap.Error(err))
+		status, code, msg, details := classifyDecodeError(err)
+		writeError(w, r, status, code, msg, details...)
+		return job, false
+	}
+
+	// Validate required fields; probe and verify jobs need not write anything
+	needsOutput := job.NeedsOutputPath()
+	if job.InputFilePath == "" || (needsOutput && job.OutputFilePath == "") {
+		log.Error("User error: Missing required job fields",
+			zap.String("input_file_path", job.InputFilePath),
+			zap.String("output_file_path", job.OutputFilePath))
+		var details []FieldError
+		if job.InputFilePath == "" {
+			details = append(details, FieldError{"input_file_path", "must not be empty"})
+		}
+		if needsOutput && job.OutputFilePath == "" {
+			details = append(details, FieldError{"output_file_path", "must not be empty"})
+		}
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Missing required job fields", details...)
+		return job, false
+	}
+
+	// Reject option combinations ffmpeg cannot carry out
+	var invalid *model.ValidationError
+	if err := job.Validate(); errors.As(err, &invalid) {
+		log.Error("User error: Job options are incompatible", zap.Error(err))
+		writeError(w, r, http.StatusBadRequest, ErrCodeValidation, "Request body failed validation",
+			FieldError{invalid.Field, invalid.Message})
+		return job, false
+	}
+
+	return job, true
 }
 
-func logJob(job model.Job) {
+func logJob(log *zap.Logger, job model.Job) {
 	// Prepare safe values for potentially nil fields
 	inputContainerType := job.InputContainerType
 	outputContainerType := job.OutputContainerType
@@ -153,7 +283,8 @@ func logJob(job model.Job) {
 	// Log job submission with appropriate fields based on job type
 	if job.IsAdvancedMode() {
 		// Advanced mode logging
-		telemetry.Logger.Info("Advanced job submitted successfully",
+		log.Info("Advanced job submitted successfully",
+			zap.String("job_id", job.ID),
 			zap.String("input_file_path", job.InputFilePath),
 			zap.String("output_file_path", job.OutputFilePath),
 			zap.String("input_container_type", inputContainerType),
@@ -186,7 +317,8 @@ func logJob(job model.Job) {
 			keepOriginalResolution = false
 		}
 
-		telemetry.Logger.Info("Simple job submitted successfully",
+		log.Info("Simple job submitted successfully",
+			zap.String("job_id", job.ID),
 			zap.String("input_file_path", job.InputFilePath),
 			zap.String("output_file_path", job.OutputFilePath),
 			zap.String("input_container_type", inputContainerType),
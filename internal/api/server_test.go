@@ -9,10 +9,10 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"testing"
 	"time"
 
+	"transcodeflow/internal/config"
 	"transcodeflow/internal/model"
 	"transcodeflow/internal/service"
 	"transcodeflow/test/mocks"
@@ -28,6 +28,10 @@ func TestStart(t *testing.T) {
 	metricsMock := mocks.NewMetricsClient(t)
 	redisMock := mocks.NewRedisClient(t)
 
+	// Queue depths are published as soon as the server starts
+	redisMock.On("QueueDepths", mock.Anything).Return(map[string]int64{"jobs": 3}, nil)
+	metricsMock.On("SetQueueDepth", "jobs", int64(3)).Return()
+
 	// Create services container
 	svc := &service.Services{
 		Metrics: metricsMock,
@@ -40,12 +44,10 @@ func TestStart(t *testing.T) {
 	port := listener.Addr().(*net.TCPAddr).Port
 	listener.Close()
 
-	// Set port using environment variable
-	os.Setenv("PORT", fmt.Sprintf("%d", port))
-	defer os.Unsetenv("PORT")
-
-	// Create server
-	server := NewServer(svc)
+	// Create server on the free port
+	cfg := config.Default().Server
+	cfg.Port = port
+	server := NewServer(svc, cfg)
 
 	// Create context with cancellation for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
@@ -66,6 +68,12 @@ func TestStart(t *testing.T) {
 		resp.Body.Close()
 	}
 
+	// Health endpoints are served alongside the API
+	resp, err = client.Get(fmt.Sprintf("http://localhost:%d/healthz", port))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
 	// Trigger graceful shutdown
 	cancel()
 
@@ -86,8 +94,11 @@ func TestStartServerError(t *testing.T) {
 		Redis:   redisMock,
 	}
 
+	// The queue depth sampler may or may not get to run
+	redisMock.On("QueueDepths", mock.Anything).Return(nil, context.Canceled).Maybe()
+
 	// Create server
-	server := NewServer(svc)
+	server := NewServer(svc, config.Default().Server)
 
 	// Use context that's already cancelled to simulate immediate error
 	ctx, cancel := context.WithCancel(context.Background())
@@ -109,6 +120,7 @@ func TestHandleSubmitJob(t *testing.T) {
 	metricsMock.On("IncrementServerRequestCounter", "success").Return()
 
 	// Set expected behavior on the redis mock
+	redisMock.On("CreateJobRecord", mock.Anything, mock.AnythingOfType("model.JobRecord")).Return(nil)
 	redisMock.On("EnqueueJob", mock.Anything, mock.AnythingOfType("string")).Return(nil)
 
 	// Create services container with mocks
@@ -118,7 +130,7 @@ func TestHandleSubmitJob(t *testing.T) {
 	}
 
 	// Create the server instance with mock services
-	server := NewServer(svc)
+	server := NewServer(svc, config.Default().Server)
 
 	// Create a sample job payload with CORRECT field names
 	job := model.Job{
@@ -126,7 +138,7 @@ func TestHandleSubmitJob(t *testing.T) {
 		OutputFilePath:      "output.mp4",
 		InputContainerType:  "mp4",
 		OutputContainerType: "mp4",
-		DryRun:              "false",
+		DryRun:              false,
 		GlobalArguments:     "--dry-run",
 	}
 
@@ -146,6 +158,12 @@ func TestHandleSubmitJob(t *testing.T) {
 	// Validate the HTTP response code
 	assert.Equal(t, http.StatusAccepted, rr.Code, "expected HTTP 202 Accepted status")
 
+	// The response identifies the queued job
+	var resp SubmitResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.NotEmpty(t, resp.ID)
+	assert.Equal(t, model.JobStateQueued, resp.State)
+
 	// Assert that the expected calls on the mocks were made
 	metricsMock.AssertExpectations(t)
 	redisMock.AssertExpectations(t)
@@ -166,7 +184,7 @@ func TestHandleSubmitJobInvalidJSON(t *testing.T) {
 		Redis:   redisMock,
 	}
 
-	server := NewServer(svc)
+	server := NewServer(svc, config.Default().Server)
 
 	// Create invalid JSON request
 	req, err := http.NewRequest("POST", "/submit", bytes.NewBufferString("{invalid json}"))
@@ -192,7 +210,7 @@ func TestHandleSubmitJobMethodNotAllowed(t *testing.T) {
 		Redis:   redisMock,
 	}
 
-	server := NewServer(svc)
+	server := NewServer(svc, config.Default().Server)
 
 	// Test several non-POST methods
 	for _, method := range []string{"GET", "PUT", "DELETE", "PATCH"} {
@@ -215,9 +233,11 @@ func TestHandleSubmitJobRedisFailure(t *testing.T) {
 
 	// Configure the Redis mock to return an error
 	metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+	redisMock.On("CreateJobRecord", mock.Anything, mock.AnythingOfType("model.JobRecord")).Return(nil)
 	redisMock.On("EnqueueJob", mock.Anything, mock.AnythingOfType("string")).Return(
 		errors.New("redis connection error"),
 	)
+	redisMock.On("UpdateJobRecord", mock.Anything, mock.AnythingOfType("string"), mock.Anything).Return(model.JobRecord{}, nil)
 
 	// Create services with mocks
 	svc := &service.Services{
@@ -225,7 +245,7 @@ func TestHandleSubmitJobRedisFailure(t *testing.T) {
 		Redis:   redisMock,
 	}
 
-	server := NewServer(svc)
+	server := NewServer(svc, config.Default().Server)
 
 	// Create a valid job
 	job := model.Job{
@@ -264,7 +284,7 @@ func TestHandleSubmitJobEmptyRequiredFields(t *testing.T) {
 		Redis:   redisMock,
 	}
 
-	server := NewServer(svc)
+	server := NewServer(svc, config.Default().Server)
 
 	// Create job with empty required fields
 	job := model.Job{
@@ -283,3 +303,56 @@ func TestHandleSubmitJobEmptyRequiredFields(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 	metricsMock.AssertExpectations(t)
 }
+
+func TestHandleSubmitJobIncompatibleCodec(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	redisMock := mocks.NewRedisClient(t)
+	metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+
+	server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server)
+
+	body := `{"input_file_path":"in.mkv","output_file_path":"out.webm","simple_options":{"video_codec":"h264"}}`
+	rr := httptest.NewRecorder()
+	server.handleSubmitJob(rr, httptest.NewRequest("POST", "/submit", bytes.NewBufferString(body)))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var resp ErrorResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.Error.Details, 1)
+	assert.Equal(t, FieldError{"simple_options.video_codec", "h264 cannot be stored in webm; use one of av1, vp9"}, resp.Error.Details[0])
+	redisMock.AssertNotCalled(t, "EnqueueJob", mock.Anything, mock.Anything)
+}
+
+func TestHandleSubmitJobOutputPathByType(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"Transcode without an output", `{"input_file_path":"in.mkv"}`, http.StatusBadRequest},
+		{"Remux with an empty output", `{"type":"remux","input_file_path":"in.mkv","output_file_path":""}`, http.StatusBadRequest},
+		{"Probe without an output", `{"type":"probe","input_file_path":"in.mkv"}`, http.StatusAccepted},
+		{"Verify without an output", `{"type":"verify","input_file_path":"in.mkv"}`, http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metricsMock := mocks.NewMetricsClient(t)
+			redisMock := mocks.NewRedisClient(t)
+			if tt.want == http.StatusAccepted {
+				metricsMock.On("IncrementQueuePushCounter", "job_pushed").Return()
+				metricsMock.On("IncrementServerRequestCounter", "success").Return()
+				redisMock.On("CreateJobRecord", mock.Anything, mock.AnythingOfType("model.JobRecord")).Return(nil)
+				redisMock.On("EnqueueJob", mock.Anything, mock.AnythingOfType("string")).Return(nil)
+			} else {
+				metricsMock.On("IncrementServerRequestCounter", "failed").Return()
+			}
+
+			server := NewServer(&service.Services{Metrics: metricsMock, Redis: redisMock}, config.Default().Server)
+			rr := httptest.NewRecorder()
+			server.handleSubmitJob(rr, httptest.NewRequest("POST", "/submit", bytes.NewBufferString(tt.body)))
+
+			assert.Equal(t, tt.want, rr.Code, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"transcodeflow/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startRequestSpan starts a server span for r, continuing any trace the
+// client sent. The returned request carries the span so responses and log
+// lines written for it are tied to the trace.
+func startRequestSpan(r *http.Request, name string) (*http.Request, trace.Span) {
+	ctx := telemetry.ExtractHTTPTraceContext(r.Context(), r.Header)
+	ctx, span := telemetry.Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("request_id", requestID(r)),
+		),
+	)
+	return r.WithContext(ctx), span
+}
+
+// recordResponseStatus notes the response status on the request's span.
+// Only server errors mark the span as failed.
+func recordResponseStatus(r *http.Request, status int, message string) {
+	span := trace.SpanFromContext(r.Context())
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, message)
+	}
+}
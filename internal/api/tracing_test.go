@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/telemetry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSubmitJobPropagatesTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := telemetry.NewTracerProvider(exporter, config.Default().Tracing, "server")
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	server, metricsMock, redisMock := newJobsTestServer(t)
+	metricsMock.On("IncrementQueuePushCounter", "job_pushed").Return()
+	metricsMock.On("IncrementServerRequestCounter", "success").Return()
+	redisMock.On("CreateJobRecord", mock.Anything, mock.Anything).Return(nil)
+	var queued model.Job
+	redisMock.On("EnqueueJob", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		require.NoError(t, json.Unmarshal([]byte(args.String(1)), &queued))
+	}).Return(nil)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	body := `{"input_file_path":"in.mkv","output_file_path":"out.mp4"}`
+	req := httptest.NewRequest(http.MethodPost, "/submit", bytes.NewBufferString(body))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	server.routes().ServeHTTP(rr, req)
+
+	require.Equal(t, http.StatusAccepted, rr.Code)
+	require.NoError(t, provider.ForceFlush(context.Background()))
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	require.Contains(t, spans, "submit job")
+	require.Contains(t, spans, "enqueue job")
+	submit, enqueue := spans["submit job"], spans["enqueue job"]
+	assert.Equal(t, traceID, submit.SpanContext.TraceID().String(), "the client's trace should be continued")
+	assert.Equal(t, submit.SpanContext.SpanID(), enqueue.Parent.SpanID())
+
+	// The worker picks the trace up from the queued payload
+	ctx := telemetry.ExtractTraceContext(context.Background(), queued.TraceContext)
+	fields := telemetry.TraceFields(ctx)
+	require.Len(t, fields, 2)
+	assert.Equal(t, traceID, fields[0].String)
+	assert.Equal(t, enqueue.SpanContext.SpanID().String(), fields[1].String)
+}
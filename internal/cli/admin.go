@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"transcodeflow/internal/client"
+	"transcodeflow/internal/model"
+)
+
+// AdminKeyEnv overrides APIKeyEnv for admin commands
+const AdminKeyEnv = "TRANSCODEFLOW_ADMIN_KEY"
+
+var adminCommands = map[string]command{
+	"queues":         {"Show the depth of every queue", runAdminQueues},
+	"inspect":        {"List the jobs waiting in a queue", runAdminInspect},
+	"purge":          {"Delete everything in a queue", runAdminPurge},
+	"move":           {"Move jobs from one queue to another", runAdminMove},
+	"requeue-failed": {"Queue the jobs of all failed results again", runAdminRequeueFailed},
+	"workers":        {"List registered workers", runAdminWorkers},
+	"drain":          {"Stop a worker taking new jobs", runAdminDrain(true)},
+	"undrain":        {"Let a drained worker take jobs again", runAdminDrain(false)},
+	"pause":          {"Pause dispatching on every worker", runAdminPause(true)},
+	"resume":         {"Resume dispatching", runAdminPause(false)},
+}
+
+func runAdmin(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printAdminUsage(e)
+		if len(args) == 0 {
+			return errUsage
+		}
+		return nil
+	}
+
+	cmd, ok := adminCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "unknown admin command %q\n\n", args[0])
+		printAdminUsage(e)
+		return errUsage
+	}
+	e.admin = true
+	return cmd.run(ctx, e, args[1:])
+}
+
+func printAdminUsage(e *env) {
+	fmt.Fprintln(e.stderr, "Usage: transcodeflow admin <command> [flags]")
+	fmt.Fprintln(e.stderr)
+	fmt.Fprintln(e.stderr, "Commands:")
+
+	names := make([]string, 0, len(adminCommands))
+	for name := range adminCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(e.stderr, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, adminCommands[name].summary)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(e.stderr)
+	fmt.Fprintf(e.stderr, "Admin commands authenticate with %s, falling back to %s.\n", AdminKeyEnv, APIKeyEnv)
+}
+
+func runAdminQueues(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("admin queues", "")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+
+	status, err := e.client.Queues(ctx)
+	if err != nil {
+		return err
+	}
+	if e.output == "json" {
+		return writeJSON(e.stdout, status)
+	}
+
+	names := make([]string, 0, len(status.Queues))
+	for name := range status.Queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "QUEUE\tDEPTH")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%d\n", name, status.Queues[name])
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if status.Paused {
+		fmt.Fprintln(e.stdout, "\nDispatching is paused")
+	}
+	return nil
+}
+
+func runAdminInspect(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("admin inspect", "<queue>")
+	offset := fs.Int64("offset", 0, "skip this many entries")
+	limit := fs.Int64("limit", 0, "maximum number of entries to show (server default when 0)")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(e.stderr, "exactly one queue name is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	contents, err := e.client.InspectQueue(ctx, fs.Arg(0), *offset, *limit)
+	if err != nil {
+		return err
+	}
+	if e.output == "json" {
+		return writeJSON(e.stdout, contents)
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POS\tID\tINPUT\tOUTPUT\tPRESET\tSUBMITTER\tERROR")
+	for _, item := range contents.Items {
+		if item.Job == nil {
+			fmt.Fprintf(tw, "%d\t-\t(undecodable) %.40s\t\t\t\t\n", item.Position, item.Raw)
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", item.Position, orDash(item.Job.ID),
+			item.Job.InputFilePath, item.Job.OutputFilePath, orDash(string(item.Job.QualityPreset)),
+			orDash(item.Job.Submitter), firstLine(item.Error))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "\nShowing %d of %d entries in %s\n", len(contents.Items), contents.Total, contents.Queue)
+	return nil
+}
+
+func runAdminPurge(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("admin purge", "<queue>")
+	yes := fs.Bool("yes", false, "confirm that the queue should be emptied")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(e.stderr, "exactly one queue name is required")
+		fs.Usage()
+		return errUsage
+	}
+	if !*yes {
+		fmt.Fprintf(e.stderr, "purging %s deletes every entry in it; rerun with -yes to confirm\n", fs.Arg(0))
+		return errUsage
+	}
+
+	result, err := e.client.PurgeQueue(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return e.printOpResult(result, fmt.Sprintf("Removed %d entries from %s", result.Count, fs.Arg(0)))
+}
+
+func runAdminMove(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("admin move", "<from-queue> <to-queue>")
+	limit := fs.Int64("limit", 0, "maximum number of entries to move (all when 0)")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(e.stderr, "source and destination queues are required")
+		fs.Usage()
+		return errUsage
+	}
+
+	result, err := e.client.MoveQueue(ctx, fs.Arg(0), fs.Arg(1), *limit)
+	if err != nil {
+		return err
+	}
+	return e.printOpResult(result, fmt.Sprintf("Moved %d entries from %s to %s", result.Count, fs.Arg(0), fs.Arg(1)))
+}
+
+func runAdminRequeueFailed(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("admin requeue-failed", "")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+
+	result, err := e.client.RequeueFailed(ctx)
+	if err != nil {
+		return err
+	}
+	return e.printOpResult(result, fmt.Sprintf("Requeued %d failed jobs", result.Count))
+}
+
+func runAdminWorkers(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("admin workers", "")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+
+	workers, err := e.client.Workers(ctx)
+	if err != nil {
+		return err
+	}
+	if e.output == "json" {
+		return writeJSON(e.stdout, workers)
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tHOST\tIN FLIGHT\tMAX\tHARDWARE\tDRAINING\tLAST SEEN")
+	for _, w := range workers {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\t%s\n", w.ID, orDash(w.Hostname), w.InFlight,
+			w.MaxParallelization, hardwareSummary(w), strconv.FormatBool(w.Draining), time.Since(w.LastSeen).Round(time.Second))
+	}
+	return tw.Flush()
+}
+
+// hardwareSummary names a worker's backend and the codecs it encodes in
+// hardware, such as "qsv: h264,av1"
+func hardwareSummary(w model.WorkerInfo) string {
+	if w.Capabilities == nil || len(w.Capabilities.HardwareEncode) == 0 {
+		return "-"
+	}
+	codecs := make([]string, len(w.Capabilities.HardwareEncode))
+	for i, codec := range w.Capabilities.HardwareEncode {
+		codecs[i] = string(codec)
+	}
+	return string(w.Capabilities.HardwareBackend) + ": " + strings.Join(codecs, ",")
+}
+
+func runAdminDrain(draining bool) func(context.Context, *env, []string) error {
+	name := "admin undrain"
+	if draining {
+		name = "admin drain"
+	}
+	return func(ctx context.Context, e *env, args []string) error {
+		fs, server := e.newFlagSet(name, "<worker-id>")
+		if err := e.parse(fs, server, args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			fmt.Fprintln(e.stderr, "exactly one worker ID is required")
+			fs.Usage()
+			return errUsage
+		}
+
+		worker, err := e.client.SetWorkerDraining(ctx, fs.Arg(0), draining)
+		if err != nil {
+			return err
+		}
+		if e.output == "json" {
+			return writeJSON(e.stdout, worker)
+		}
+		if draining {
+			fmt.Fprintf(e.stdout, "Worker %s is draining; it will finish %d running jobs and take no more\n", worker.ID, worker.InFlight)
+		} else {
+			fmt.Fprintf(e.stdout, "Worker %s is taking jobs again\n", worker.ID)
+		}
+		return nil
+	}
+}
+
+func runAdminPause(paused bool) func(context.Context, *env, []string) error {
+	name := "admin resume"
+	if paused {
+		name = "admin pause"
+	}
+	return func(ctx context.Context, e *env, args []string) error {
+		fs, server := e.newFlagSet(name, "")
+		if err := e.parse(fs, server, args); err != nil {
+			return err
+		}
+
+		state, err := e.client.SetDispatchPaused(ctx, paused)
+		if err != nil {
+			return err
+		}
+		if e.output == "json" {
+			return writeJSON(e.stdout, state)
+		}
+		if paused {
+			fmt.Fprintln(e.stdout, "Dispatching paused; running jobs will finish")
+		} else {
+			fmt.Fprintln(e.stdout, "Dispatching resumed")
+		}
+		return nil
+	}
+}
+
+// printOpResult reports the outcome of a purge, move or requeue
+func (e *env) printOpResult(result client.QueueOpResult, msg string) error {
+	if e.output == "json" {
+		return writeJSON(e.stdout, result)
+	}
+	_, err := fmt.Fprintln(e.stdout, msg)
+	return err
+}
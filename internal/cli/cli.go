@@ -0,0 +1,501 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"transcodeflow/internal/client"
+	"transcodeflow/internal/model"
+)
+
+// Environment variables read by the CLI
+const (
+	ServerEnv = "TRANSCODEFLOW_SERVER"
+	APIKeyEnv = "TRANSCODEFLOW_API_KEY"
+)
+
+// DefaultServer is used when neither -server nor TRANSCODEFLOW_SERVER is set
+const DefaultServer = "http://localhost:8080"
+
+// errUsage signals a bad invocation; the flag package has already printed why
+var errUsage = errors.New("usage error")
+
+// command is a single CLI subcommand
+type command struct {
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"submit":   {"Submit one job, or a batch from a file", runSubmit},
+	"status":   {"Show the state of one or more jobs", runStatus},
+	"list":     {"List recent jobs", runList},
+	"cancel":   {"Cancel a queued or running job", runCancel},
+	"retry":    {"Queue a failed or cancelled job again", runRetry},
+	"logs":     {"Print the output captured while a job ran", runLogs},
+	"watch":    {"Follow a job until it finishes", runWatch},
+	"admin":    {"Inspect and manage queues and workers", runAdmin},
+	"pipeline": {"Submit and follow pipelines of dependent jobs", runPipeline},
+}
+
+// IsCommand reports whether name is a CLI subcommand
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// env holds the state shared by every subcommand
+type env struct {
+	stdout io.Writer
+	stderr io.Writer
+	client *client.Client
+	output string
+	// admin selects the admin API key
+	admin bool
+}
+
+// Run executes the subcommand named by args[0] and returns the process exit
+// code: 0 on success, 1 on failure and 2 for invalid usage
+func Run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		printUsage(stderr)
+		return 2
+	}
+
+	e := &env{stdout: stdout, stderr: stderr}
+	err := cmd.run(ctx, e, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: transcodeflow <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands[name].summary)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'transcodeflow <command> -h' for the flags of a command.")
+}
+
+// newFlagSet creates a flag set with the connection and output flags every
+// subcommand accepts
+func (e *env) newFlagSet(name, args string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: transcodeflow %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+
+	server := os.Getenv(ServerEnv)
+	if server == "" {
+		server = DefaultServer
+	}
+	serverFlag := fs.String("server", server, "API server URL (env "+ServerEnv+")")
+	fs.StringVar(&e.output, "o", "table", "output format: table or json")
+	return fs, serverFlag
+}
+
+// parse parses the flags and connects to the server
+func (e *env) parse(fs *flag.FlagSet, server *string, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if e.output != "table" && e.output != "json" {
+		fmt.Fprintf(e.stderr, "invalid output format %q: must be table or json\n", e.output)
+		return errUsage
+	}
+	key := os.Getenv(APIKeyEnv)
+	if adminKey := os.Getenv(AdminKeyEnv); e.admin && adminKey != "" {
+		key = adminKey
+	}
+	e.client = client.New(*server, key)
+	return nil
+}
+
+// jobIDs returns the positional job ID arguments, requiring at least one
+func (e *env) jobIDs(fs *flag.FlagSet) ([]string, error) {
+	if fs.NArg() == 0 {
+		fmt.Fprintln(e.stderr, "at least one job ID is required")
+		fs.Usage()
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+// jobTypeNames lists the registered job types for flag help
+func jobTypeNames() string {
+	var names []string
+	for _, h := range model.JobHandlers() {
+		names = append(names, string(h.Type))
+	}
+	return strings.Join(names, ", ")
+}
+
+func runSubmit(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("submit", "")
+	var job model.Job
+	var opts model.SimpleOptions
+	var preset, codec, jobType string
+	var dryRun bool
+	file := fs.String("file", "", "read jobs from a JSON array or JSON lines file instead of flags")
+	fs.StringVar(&job.InputFilePath, "input", "", "input file path")
+	fs.StringVar(&job.OutputFilePath, "output", "", "output file path")
+	fs.StringVar(&job.InputContainerType, "input-container", "", "input container type")
+	fs.StringVar(&job.OutputContainerType, "output-container", "", "output container type, e.g. mp4 or mkv")
+	fs.BoolVar(&dryRun, "dry-run", false, "plan the job instead of encoding it")
+	fs.StringVar(&jobType, "type", "", "job type: "+jobTypeNames()+"; types other than transcode use their default options")
+	fs.StringVar(&preset, "preset", "", "quality preset: ultrafast, fast, balanced, quality, slow, ultraslow")
+	fs.StringVar(&codec, "codec", "", "video codec: h264, hevc, av1, vp9 or copy")
+	fs.StringVar(&opts.Resolution, "resolution", "", "output resolution: 480p, 720p, 1080p, 4k, original or W:H")
+	fs.BoolVar(&opts.KeepOriginalResolution, "keep-resolution", false, "keep the input resolution")
+	fs.BoolVar(&opts.UseHardwareAcceleration, "hwaccel", false, "use hardware acceleration")
+	fs.StringVar(&opts.TrimFrom, "trim-from", "", "start time, e.g. 00:01:30")
+	fs.StringVar(&opts.TrimDuration, "trim-duration", "", "duration to keep, e.g. 00:10:00")
+	fs.StringVar(&opts.AudioQuality, "audio-quality", "", "audio quality: low, medium, high")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+
+	var jobs []model.Job
+	if *file != "" {
+		if job.InputFilePath != "" || job.OutputFilePath != "" {
+			fmt.Fprintln(e.stderr, "-file cannot be combined with -input or -output")
+			return errUsage
+		}
+		var err error
+		if jobs, err = readJobs(*file); err != nil {
+			return err
+		}
+	} else {
+		job.Type = model.JobType(jobType)
+		if job.InputFilePath == "" || (job.OutputFilePath == "" && job.NeedsOutputPath()) {
+			fmt.Fprintln(e.stderr, "-input and -output are required")
+			fs.Usage()
+			return errUsage
+		}
+		if dryRun {
+			job.DryRun = true
+		}
+		opts.QualityPreset = model.QualityPreset(preset)
+		opts.VideoCodec = model.VideoCodec(codec)
+		if opts != (model.SimpleOptions{}) {
+			job.SimpleOptions = &opts
+		}
+		jobs = []model.Job{job}
+	}
+
+	// Submit everything we can; one rejected job should not stop a batch
+	type submitted struct {
+		Input string `json:"input_file_path"`
+		ID    string `json:"id,omitempty"`
+		State string `json:"state,omitempty"`
+		Error string `json:"error,omitempty"`
+	}
+	results := make([]submitted, 0, len(jobs))
+	failed := 0
+	for _, j := range jobs {
+		resp, err := e.client.Submit(ctx, j)
+		if err != nil {
+			failed++
+			results = append(results, submitted{Input: j.InputFilePath, Error: err.Error()})
+			continue
+		}
+		results = append(results, submitted{Input: j.InputFilePath, ID: resp.ID, State: string(resp.State)})
+	}
+
+	if e.output == "json" {
+		if err := writeJSON(e.stdout, results); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATE\tINPUT\tERROR")
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", orDash(r.ID), orDash(r.State), r.Input, firstLine(r.Error))
+		}
+		tw.Flush()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs were rejected", failed, len(jobs))
+	}
+	return nil
+}
+
+// readJobs loads jobs from a file holding either a JSON array or one JSON
+// object per line
+func readJobs(path string) ([]model.Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var jobs []model.Job
+		if err := json.Unmarshal(data, &jobs); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		return jobs, nil
+	}
+
+	var jobs []model.Job
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var job model.Job
+		err := dec.Decode(&job)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: job %d: %w", path, len(jobs)+1, err)
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("%s contains no jobs", path)
+	}
+	return jobs, nil
+}
+
+func runStatus(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("status", "<job-id>...")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	ids, err := e.jobIDs(fs)
+	if err != nil {
+		return err
+	}
+
+	records := make([]model.JobRecord, 0, len(ids))
+	for _, id := range ids {
+		record, err := e.client.Get(ctx, id)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", id, err)
+		}
+		records = append(records, record)
+	}
+	return e.printRecords(records)
+}
+
+func runList(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("list", "")
+	state := fs.String("state", "", "only list jobs in this state: queued, running, succeeded, failed, cancelled, skipped")
+	limit := fs.Int("limit", 0, "maximum number of jobs to list (server default when 0)")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+
+	records, err := e.client.List(ctx, model.JobState(*state), *limit)
+	if err != nil {
+		return err
+	}
+	return e.printRecords(records)
+}
+
+func runCancel(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("cancel", "<job-id>...")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	ids, err := e.jobIDs(fs)
+	if err != nil {
+		return err
+	}
+
+	records := make([]model.JobRecord, 0, len(ids))
+	for _, id := range ids {
+		record, err := e.client.Cancel(ctx, id)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", id, err)
+		}
+		records = append(records, record)
+	}
+	return e.printRecords(records)
+}
+
+func runRetry(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("retry", "<job-id>...")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	ids, err := e.jobIDs(fs)
+	if err != nil {
+		return err
+	}
+
+	responses := make([]client.SubmitResponse, 0, len(ids))
+	for _, id := range ids {
+		resp, err := e.client.Retry(ctx, id)
+		if err != nil {
+			return fmt.Errorf("job %s: %w", id, err)
+		}
+		responses = append(responses, resp)
+	}
+
+	if e.output == "json" {
+		return writeJSON(e.stdout, responses)
+	}
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE")
+	for _, r := range responses {
+		fmt.Fprintf(tw, "%s\t%s\n", r.ID, r.State)
+	}
+	return tw.Flush()
+}
+
+func runLogs(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("logs", "<job-id>")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(e.stderr, "exactly one job ID is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	logs, err := e.client.Logs(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if e.output == "json" {
+		return writeJSON(e.stdout, map[string]string{"id": fs.Arg(0), "logs": logs})
+	}
+	_, err = io.WriteString(e.stdout, logs)
+	return err
+}
+
+func runWatch(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("watch", "<job-id>")
+	interval := fs.Duration("interval", 2*time.Second, "how often to poll the job")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(e.stderr, "exactly one job ID is required")
+		fs.Usage()
+		return errUsage
+	}
+	id := fs.Arg(0)
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	var last model.JobState
+	for {
+		record, err := e.client.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		// Only report changes so a long job does not flood the terminal
+		if record.State != last {
+			last = record.State
+			if e.output == "json" {
+				// One object per line so the stream can be piped to jq
+				b, _ := json.Marshal(record)
+				fmt.Fprintln(e.stdout, string(b))
+			} else {
+				fmt.Fprintf(e.stdout, "%s  %s  %s\n", time.Now().Format(time.TimeOnly), record.ID, record.State)
+			}
+		}
+
+		if record.State.IsTerminal() {
+			if record.State != model.JobStateSucceeded {
+				if record.Error != "" {
+					return fmt.Errorf("job %s %s: %s", id, record.State, record.Error)
+				}
+				return fmt.Errorf("job %s %s", id, record.State)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// printRecords writes job records as a table or JSON
+func (e *env) printRecords(records []model.JobRecord) error {
+	if e.output == "json" {
+		if records == nil {
+			records = []model.JobRecord{}
+		}
+		return writeJSON(e.stdout, records)
+	}
+
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATE\tATTEMPTS\tSUBMITTED\tWORKER\tINPUT\tOUTPUT")
+	for _, r := range records {
+		submitted := "-"
+		if !r.SubmittedAt.IsZero() {
+			submitted = r.SubmittedAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			r.ID, r.State, r.Attempts, submitted, orDash(r.WorkerID), r.Job.InputFilePath, r.Job.OutputFilePath)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// firstLine keeps table rows to a single line when an error has details
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,306 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"transcodeflow/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// run invokes the CLI against srv and returns the exit code and output
+func run(t *testing.T, srv *httptest.Server, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	full := append([]string{args[0], "-server", srv.URL}, args[1:]...)
+	code := Run(context.Background(), full, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestSubmitFromFlags(t *testing.T) {
+	var got model.Job
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/submit", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"abc","state":"queued"}`)
+	}))
+	defer srv.Close()
+
+	code, stdout, stderr := run(t, srv, "submit",
+		"-input", "in.mkv", "-output", "out.mp4", "-output-container", "mp4",
+		"-preset", "fast", "-codec", "h264", "-resolution", "720p", "-hwaccel", "-dry-run")
+
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "abc")
+	assert.Equal(t, "in.mkv", got.InputFilePath)
+	assert.Equal(t, "mp4", got.OutputContainerType)
+	assert.True(t, got.DryRun)
+	require.NotNil(t, got.SimpleOptions)
+	assert.Equal(t, model.PresetFast, got.SimpleOptions.QualityPreset)
+	assert.Equal(t, model.VideoCodecH264, got.SimpleOptions.VideoCodec)
+	assert.Equal(t, "720p", got.SimpleOptions.Resolution)
+	assert.True(t, got.SimpleOptions.UseHardwareAcceleration)
+}
+
+func TestSubmitWithoutOptionsOmitsSimpleOptions(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"abc","state":"queued"}`)
+	}))
+	defer srv.Close()
+
+	code, _, stderr := run(t, srv, "submit", "-input", "in.mkv", "-output", "out.mp4")
+
+	require.Equal(t, 0, code, stderr)
+	assert.NotContains(t, got, "simple_options")
+	assert.NotContains(t, got, "dry_run")
+}
+
+func TestSubmitBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"JSON array", `[{"input_file_path":"a.mkv","output_file_path":"a.mp4"},{"input_file_path":"b.mkv","output_file_path":"b.mp4"}]`},
+		{"JSON lines", "{\"input_file_path\":\"a.mkv\",\"output_file_path\":\"a.mp4\"}\n{\"input_file_path\":\"b.mkv\",\"output_file_path\":\"b.mp4\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var submitted atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				submitted.Add(1)
+				w.WriteHeader(http.StatusAccepted)
+				io.WriteString(w, `{"id":"abc","state":"queued"}`)
+			}))
+			defer srv.Close()
+
+			path := filepath.Join(t.TempDir(), "jobs.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o644))
+
+			code, stdout, stderr := run(t, srv, "submit", "-file", path, "-o", "json")
+
+			require.Equal(t, 0, code, stderr)
+			assert.Equal(t, int32(2), submitted.Load())
+			var results []map[string]string
+			require.NoError(t, json.Unmarshal([]byte(stdout), &results))
+			assert.Len(t, results, 2)
+		})
+	}
+}
+
+func TestSubmitBatchReportsRejectedJobs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var job model.Job
+		json.NewDecoder(r.Body).Decode(&job)
+		if job.InputFilePath == "bad.mkv" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":{"code":"validation_failed","message":"Request body failed validation"}}`)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"abc","state":"queued"}`)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	content := "{\"input_file_path\":\"good.mkv\",\"output_file_path\":\"a.mp4\"}\n{\"input_file_path\":\"bad.mkv\",\"output_file_path\":\"b.mp4\"}\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	code, stdout, stderr := run(t, srv, "submit", "-file", path)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout, "good.mkv")
+	assert.Contains(t, stdout, "Request body failed validation")
+	assert.Contains(t, stderr, "1 of 2 jobs were rejected")
+}
+
+func TestSubmitRequiresInputAndOutput(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	code, _, stderr := run(t, srv, "submit", "-input", "in.mkv")
+
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "-input and -output are required")
+}
+
+func TestSubmitProbeWithoutOutput(t *testing.T) {
+	var got model.Job
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"abc","state":"queued"}`)
+	}))
+	defer srv.Close()
+
+	code, _, stderr := run(t, srv, "submit", "-type", "probe", "-input", "in.mkv")
+
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, model.JobTypeProbe, got.Type)
+	assert.Empty(t, got.OutputFilePath)
+}
+
+func TestListTable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "running", r.URL.Query().Get("state"))
+		io.WriteString(w, `{"jobs":[{"id":"abc","state":"running","worker_id":"host-1","job":{"input_file_path":"in.mkv","output_file_path":"out.mp4"}}]}`)
+	}))
+	defer srv.Close()
+
+	code, stdout, stderr := run(t, srv, "list", "-state", "running")
+
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "ID")
+	assert.Contains(t, stdout, "host-1")
+	assert.Contains(t, stdout, "in.mkv")
+}
+
+func TestStatusNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":{"code":"not_found","message":"Job not found","request_id":"req-1"}}`)
+	}))
+	defer srv.Close()
+
+	code, _, stderr := run(t, srv, "status", "missing")
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "Job not found")
+	assert.Contains(t, stderr, "req-1")
+}
+
+func TestWatchUntilFinished(t *testing.T) {
+	var polls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch polls.Add(1) {
+		case 1:
+			io.WriteString(w, `{"id":"abc","state":"queued"}`)
+		case 2, 3:
+			io.WriteString(w, `{"id":"abc","state":"running"}`)
+		default:
+			io.WriteString(w, `{"id":"abc","state":"failed","error":"exit status 1"}`)
+		}
+	}))
+	defer srv.Close()
+
+	code, stdout, stderr := run(t, srv, "watch", "-interval", "1ms", "abc")
+
+	assert.Equal(t, 1, code)
+	assert.Equal(t, 3, bytes.Count([]byte(stdout), []byte("\n")), "only state changes should be printed")
+	assert.Contains(t, stderr, "exit status 1")
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), []string{"explode"}, &stdout, &stderr)
+
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "unknown command")
+}
+
+func TestAdminPurgeRequiresConfirmation(t *testing.T) {
+	var called atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+		io.WriteString(w, `{"count":3}`)
+	}))
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), []string{"admin", "purge", "-server", srv.URL, "jobs"}, &stdout, &stderr)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "-yes")
+	assert.False(t, called.Load())
+
+	code = Run(context.Background(), []string{"admin", "purge", "-server", srv.URL, "-yes", "jobs"}, &stdout, io.Discard)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "Removed 3 entries from jobs")
+}
+
+func TestAdminUsesAdminKey(t *testing.T) {
+	t.Setenv(APIKeyEnv, "user-key")
+	t.Setenv(AdminKeyEnv, "admin-key")
+
+	var gotKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-API-Key")
+		assert.Equal(t, "/admin/queues/held/move", r.URL.Path)
+		assert.Equal(t, "jobs", r.URL.Query().Get("to"))
+		io.WriteString(w, `{"count":2}`)
+	}))
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), []string{"admin", "move", "-server", srv.URL, "held", "jobs"}, &stdout, &stderr)
+
+	require.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "admin-key", gotKey)
+	assert.Contains(t, stdout.String(), "Moved 2 entries from held to jobs")
+}
+
+func TestAdminInspect(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/admin/queues/results", r.URL.Path)
+		io.WriteString(w, `{"queue":"results","total":7,"offset":0,"items":[
+			{"position":0,"job":{"id":"abc","input_file_path":"in.mkv","output_file_path":"out.mp4"},"error":"exit status 1"},
+			{"position":1,"raw":"garbage"}]}`)
+	}))
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), []string{"admin", "inspect", "-server", srv.URL, "results"}, &stdout, &stderr)
+
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "exit status 1")
+	assert.Contains(t, stdout.String(), "(undecodable) garbage")
+	assert.Contains(t, stdout.String(), "Showing 2 of 7 entries in results")
+}
+
+func TestPipelineSubmit(t *testing.T) {
+	var got model.Pipeline
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/pipelines", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"p1","state":"running","steps":[
+			{"name":"encode","state":"queued","job_id":"j1"},
+			{"name":"thumbs","state":"pending"}]}`)
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "pipeline.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"steps": [
+		{"name": "encode", "job": {"input_file_path": "in.mkv", "output_file_path": "out.mp4"}},
+		{"name": "thumbs", "job": {"type": "thumbnails", "input_file_path": "{{steps.encode.output}}", "output_file_path": "thumbs"}}
+	]}`), 0o644))
+
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), []string{"pipeline", "submit", "-server", srv.URL, path}, &stdout, &stderr)
+
+	require.Equal(t, 0, code, stderr.String())
+	require.Len(t, got.Steps, 2)
+	assert.Equal(t, model.StepOutputRef("encode"), got.Steps[1].Job.InputFilePath)
+	assert.Contains(t, stdout.String(), "Pipeline p1  running")
+	assert.Regexp(t, `thumbs\s+pending\s+-`, stdout.String())
+}
+
+func TestPipelineRequiresCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), []string{"pipeline"}, &stdout, &stderr)
+
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "transcodeflow pipeline <command>")
+}
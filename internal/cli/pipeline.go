@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"transcodeflow/internal/model"
+)
+
+var pipelineCommands = map[string]command{
+	"submit": {"Submit a pipeline of dependent jobs from a file", runPipelineSubmit},
+	"status": {"Show the state of a pipeline and its steps", runPipelineStatus},
+}
+
+func runPipeline(ctx context.Context, e *env, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printPipelineUsage(e)
+		if len(args) == 0 {
+			return errUsage
+		}
+		return nil
+	}
+
+	cmd, ok := pipelineCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(e.stderr, "unknown pipeline command %q\n\n", args[0])
+		printPipelineUsage(e)
+		return errUsage
+	}
+	return cmd.run(ctx, e, args[1:])
+}
+
+func printPipelineUsage(e *env) {
+	fmt.Fprintln(e.stderr, "Usage: transcodeflow pipeline <command> [flags]")
+	fmt.Fprintln(e.stderr)
+	fmt.Fprintln(e.stderr, "Commands:")
+
+	names := make([]string, 0, len(pipelineCommands))
+	for name := range pipelineCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(e.stderr, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, pipelineCommands[name].summary)
+	}
+	tw.Flush()
+}
+
+func runPipelineSubmit(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("pipeline submit", "<file>")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(e.stderr, "exactly one pipeline file is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var pipeline model.Pipeline
+	if err := json.Unmarshal(data, &pipeline); err != nil {
+		return fmt.Errorf("parsing %s: %w", fs.Arg(0), err)
+	}
+
+	record, err := e.client.SubmitPipeline(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return e.printPipeline(record)
+}
+
+func runPipelineStatus(ctx context.Context, e *env, args []string) error {
+	fs, server := e.newFlagSet("pipeline status", "<pipeline-id>")
+	if err := e.parse(fs, server, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(e.stderr, "exactly one pipeline ID is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	record, err := e.client.GetPipeline(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return e.printPipeline(record)
+}
+
+// printPipeline writes a pipeline record as a table of its steps or JSON
+func (e *env) printPipeline(record model.PipelineRecord) error {
+	if e.output == "json" {
+		return writeJSON(e.stdout, record)
+	}
+
+	fmt.Fprintf(e.stdout, "Pipeline %s  %s\n", record.ID, record.State)
+	tw := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tSTATE\tJOB\tERROR")
+	for _, s := range record.Steps {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", s.Name, s.State, orDash(s.JobID), orDash(firstLine(s.Error)))
+	}
+	return tw.Flush()
+}
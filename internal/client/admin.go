@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"transcodeflow/internal/model"
+)
+
+// QueueStatus is the depth of every queue and whether dispatching is paused
+type QueueStatus struct {
+	Queues map[string]int64 `json:"queues"`
+	Paused bool             `json:"paused"`
+}
+
+// JobSummary identifies a job sitting in a queue
+type JobSummary struct {
+	ID                  string              `json:"id,omitempty"`
+	Type                model.JobType       `json:"type,omitempty"`
+	InputFilePath       string              `json:"input_file_path"`
+	OutputFilePath      string              `json:"output_file_path"`
+	OutputContainerType string              `json:"output_container_type,omitempty"`
+	QualityPreset       model.QualityPreset `json:"quality_preset,omitempty"`
+	Submitter           string              `json:"submitter,omitempty"`
+}
+
+// QueueItem is one queue entry. Raw is set instead of Job when the entry
+// could not be decoded.
+type QueueItem struct {
+	Position int64       `json:"position"`
+	Job      *JobSummary `json:"job,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Raw      string      `json:"raw,omitempty"`
+}
+
+// QueueContents is a page of entries from a queue in dispatch order
+type QueueContents struct {
+	Queue  string      `json:"queue"`
+	Total  int64       `json:"total"`
+	Offset int64       `json:"offset"`
+	Items  []QueueItem `json:"items"`
+}
+
+// QueueOpResult reports how many entries an admin operation affected
+type QueueOpResult struct {
+	Count  int64    `json:"count"`
+	JobIDs []string `json:"job_ids,omitempty"`
+}
+
+// Queues returns the depth of every queue
+func (c *Client) Queues(ctx context.Context) (QueueStatus, error) {
+	var status QueueStatus
+	err := c.do(ctx, http.MethodGet, "/admin/queues", nil, &status)
+	return status, err
+}
+
+// InspectQueue returns up to limit entries of a queue, skipping the first
+// offset. A zero limit uses the server default.
+func (c *Client) InspectQueue(ctx context.Context, queue string, offset, limit int64) (QueueContents, error) {
+	query := url.Values{}
+	if offset > 0 {
+		query.Set("offset", strconv.FormatInt(offset, 10))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.FormatInt(limit, 10))
+	}
+	path := "/admin/queues/" + url.PathEscape(queue)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var contents QueueContents
+	err := c.do(ctx, http.MethodGet, path, nil, &contents)
+	return contents, err
+}
+
+// PurgeQueue deletes every entry in a queue
+func (c *Client) PurgeQueue(ctx context.Context, queue string) (QueueOpResult, error) {
+	var result QueueOpResult
+	err := c.do(ctx, http.MethodPost, "/admin/queues/"+url.PathEscape(queue)+"/purge", nil, &result)
+	return result, err
+}
+
+// MoveQueue moves up to limit entries, oldest first, from one queue to
+// another. A zero limit moves everything.
+func (c *Client) MoveQueue(ctx context.Context, from, to string, limit int64) (QueueOpResult, error) {
+	query := url.Values{"to": {to}}
+	if limit > 0 {
+		query.Set("limit", strconv.FormatInt(limit, 10))
+	}
+
+	var result QueueOpResult
+	err := c.do(ctx, http.MethodPost, "/admin/queues/"+url.PathEscape(from)+"/move?"+query.Encode(), nil, &result)
+	return result, err
+}
+
+// RequeueFailed queues the job of every failed result again
+func (c *Client) RequeueFailed(ctx context.Context) (QueueOpResult, error) {
+	var result QueueOpResult
+	err := c.do(ctx, http.MethodPost, "/admin/results/requeue", nil, &result)
+	return result, err
+}
+
+// Workers lists registered workers
+func (c *Client) Workers(ctx context.Context) ([]model.WorkerInfo, error) {
+	var resp struct {
+		Workers []model.WorkerInfo `json:"workers"`
+	}
+	err := c.do(ctx, http.MethodGet, "/admin/workers", nil, &resp)
+	return resp.Workers, err
+}
+
+// SetWorkerDraining drains a worker so it takes no new jobs, or undoes it
+func (c *Client) SetWorkerDraining(ctx context.Context, id string, draining bool) (model.WorkerInfo, error) {
+	action := "/undrain"
+	if draining {
+		action = "/drain"
+	}
+
+	var worker model.WorkerInfo
+	err := c.do(ctx, http.MethodPost, "/admin/workers/"+url.PathEscape(id)+action, nil, &worker)
+	return worker, err
+}
+
+// SetDispatchPaused pauses or resumes dispatching on every worker
+func (c *Client) SetDispatchPaused(ctx context.Context, paused bool) (model.DispatchState, error) {
+	action := "/admin/dispatch/resume"
+	if paused {
+		action = "/admin/dispatch/pause"
+	}
+
+	var state model.DispatchState
+	err := c.do(ctx, http.MethodPost, action, nil, &state)
+	return state, err
+}
@@ -0,0 +1,218 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"transcodeflow/internal/model"
+)
+
+// Headers understood by the API server
+const (
+	apiKeyHeader    = "X-API-Key"
+	requestIDHeader = "X-Request-ID"
+)
+
+// Client talks to the transcodeflow HTTP API
+type Client struct {
+	BaseURL    string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// SubmitResponse is returned when the server accepts a job
+type SubmitResponse struct {
+	ID    string         `json:"id"`
+	State model.JobState `json:"state"`
+}
+
+// FieldError describes a single invalid field in a rejected request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is returned for any non-2xx response. It mirrors the server's error
+// envelope so callers can inspect the code and field details.
+type Error struct {
+	StatusCode int           `json:"-"`
+	Code       string        `json:"code"`
+	Message    string        `json:"message"`
+	Details    []FieldError  `json:"details,omitempty"`
+	RequestID  string        `json:"request_id,omitempty"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (HTTP %d", e.Message, e.StatusCode)
+	if e.Code != "" {
+		fmt.Fprintf(&b, ", %s", e.Code)
+	}
+	b.WriteString(")")
+	for _, d := range e.Details {
+		fmt.Fprintf(&b, "\n  %s: %s", d.Field, d.Message)
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, "\n  request ID: %s", e.RequestID)
+	}
+	return b.String()
+}
+
+// New creates a client for the server at baseURL
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Submit queues a job
+func (c *Client) Submit(ctx context.Context, job model.Job) (SubmitResponse, error) {
+	var resp SubmitResponse
+	err := c.do(ctx, http.MethodPost, "/submit", job, &resp)
+	return resp, err
+}
+
+// Get returns the record for a job
+func (c *Client) Get(ctx context.Context, id string) (model.JobRecord, error) {
+	var record model.JobRecord
+	err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, &record)
+	return record, err
+}
+
+// List returns recent jobs, newest first. An empty state lists all jobs and
+// a zero limit uses the server default.
+func (c *Client) List(ctx context.Context, state model.JobState, limit int) ([]model.JobRecord, error) {
+	query := url.Values{}
+	if state != "" {
+		query.Set("state", string(state))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/jobs"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var resp struct {
+		Jobs []model.JobRecord `json:"jobs"`
+	}
+	err := c.do(ctx, http.MethodGet, path, nil, &resp)
+	return resp.Jobs, err
+}
+
+// Cancel stops a queued or running job
+func (c *Client) Cancel(ctx context.Context, id string) (model.JobRecord, error) {
+	var record model.JobRecord
+	err := c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(id)+"/cancel", nil, &record)
+	return record, err
+}
+
+// Retry queues a failed or cancelled job again
+func (c *Client) Retry(ctx context.Context, id string) (SubmitResponse, error) {
+	var resp SubmitResponse
+	err := c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(id)+"/retry", nil, &resp)
+	return resp, err
+}
+
+// Logs returns the output captured while a job ran
+func (c *Client) Logs(ctx context.Context, id string) (string, error) {
+	var buf bytes.Buffer
+	err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id)+"/logs", nil, &buf)
+	return buf.String(), err
+}
+
+// SubmitPipeline starts a pipeline of dependent jobs
+func (c *Client) SubmitPipeline(ctx context.Context, pipeline model.Pipeline) (model.PipelineRecord, error) {
+	var record model.PipelineRecord
+	err := c.do(ctx, http.MethodPost, "/pipelines", pipeline, &record)
+	return record, err
+}
+
+// GetPipeline returns the record for a pipeline
+func (c *Client) GetPipeline(ctx context.Context, id string) (model.PipelineRecord, error) {
+	var record model.PipelineRecord
+	err := c.do(ctx, http.MethodGet, "/pipelines/"+url.PathEscape(id), nil, &record)
+	return record, err
+}
+
+// do sends a request and decodes the response into out. A *bytes.Buffer out
+// receives the raw body instead.
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encoding request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.APIKey != "" {
+		req.Header.Set(apiKeyHeader, c.APIKey)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+
+	if buf, ok := out.(*bytes.Buffer); ok {
+		_, err = io.Copy(buf, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// decodeError turns an error response into an *Error, falling back to the
+// raw body when the server did not send the JSON envelope
+func decodeError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	apiErr := &Error{}
+	if json.Unmarshal(raw, &envelope) == nil && envelope.Error != nil {
+		apiErr = envelope.Error
+	} else {
+		apiErr.Message = strings.TrimSpace(string(raw))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+
+	apiErr.StatusCode = resp.StatusCode
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get(requestIDHeader)
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return apiErr
+}
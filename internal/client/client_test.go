@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"transcodeflow/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/submit", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("X-API-Key"))
+
+		var job model.Job
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&job))
+		assert.Equal(t, "in.mp4", job.InputFilePath)
+
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"id":"abc","state":"queued"}`)
+	}))
+	defer srv.Close()
+
+	resp, err := New(srv.URL+"/", "secret").Submit(context.Background(), model.Job{InputFilePath: "in.mp4", OutputFilePath: "out.mp4"})
+
+	require.NoError(t, err)
+	assert.Equal(t, SubmitResponse{ID: "abc", State: model.JobStateQueued}, resp)
+}
+
+func TestList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/jobs", r.URL.Path)
+		assert.Equal(t, "failed", r.URL.Query().Get("state"))
+		assert.Equal(t, "5", r.URL.Query().Get("limit"))
+		io.WriteString(w, `{"jobs":[{"id":"abc","state":"failed"}]}`)
+	}))
+	defer srv.Close()
+
+	jobs, err := New(srv.URL, "").List(context.Background(), model.JobStateFailed, 5)
+
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal(t, "abc", jobs[0].ID)
+}
+
+func TestLogs(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/jobs/abc/logs", r.URL.Path)
+		io.WriteString(w, "frame=100\n")
+	}))
+	defer srv.Close()
+
+	logs, err := New(srv.URL, "").Logs(context.Background(), "abc")
+
+	require.NoError(t, err)
+	assert.Equal(t, "frame=100\n", logs)
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"code":"quota_exceeded","message":"Job quota exceeded","request_id":"req-1"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "").Retry(context.Background(), "abc")
+
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, "quota_exceeded", apiErr.Code)
+	assert.Equal(t, "req-1", apiErr.RequestID)
+	assert.Equal(t, 30*time.Second, apiErr.RetryAfter)
+}
+
+func TestErrorWithoutEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "req-2")
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, "").Get(context.Background(), "abc")
+
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "bad gateway", apiErr.Message)
+	assert.Equal(t, "req-2", apiErr.RequestID)
+}
+
+func TestGetPipeline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/pipelines/p1", r.URL.Path)
+		io.WriteString(w, `{"id":"p1","state":"failed","steps":[{"name":"encode","state":"failed","error":"exit status 1"}]}`)
+	}))
+	defer srv.Close()
+
+	record, err := New(srv.URL, "").GetPipeline(context.Background(), "p1")
+
+	require.NoError(t, err)
+	assert.Equal(t, model.PipelineFailed, record.State)
+	require.Len(t, record.Steps, 1)
+	assert.Equal(t, "exit status 1", record.Steps[0].Error)
+}
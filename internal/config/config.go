@@ -0,0 +1,458 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the config file path
+const FileEnv = "TRANSCODEFLOW_CONFIG"
+
+// Redacted replaces secret values when the config is printed
+const Redacted = "<redacted>"
+
+// Config is the complete application configuration. Values are layered:
+// defaults, then the YAML file, then environment variables (the env tag),
+// then command-line flags (named after the YAML path, e.g. -redis.addr).
+// Fields tagged secret are never printed.
+type Config struct {
+	Redis   RedisConfig   `yaml:"redis"`
+	Server  ServerConfig  `yaml:"server"`
+	Worker  WorkerConfig  `yaml:"worker"`
+	Metrics MetricsConfig `yaml:"metrics"`
+	Tracing TracingConfig `yaml:"tracing"`
+	Logging LoggingConfig `yaml:"logging"`
+}
+
+// RedisConfig controls the connection shared by every mode
+type RedisConfig struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR" help:"Redis address as host:port"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD" secret:"true" help:"Redis password"`
+	DB       int    `yaml:"db" env:"REDIS_DB" help:"Redis database number"`
+}
+
+// ServerConfig controls the API server
+type ServerConfig struct {
+	Port        int             `yaml:"port" env:"PORT" help:"API listen port"`
+	AdminAPIKey string          `yaml:"admin_api_key" env:"ADMIN_API_KEY" secret:"true" help:"key required by /admin endpoints; empty disables them"`
+	RateLimit   RateLimitConfig `yaml:"rate_limit"`
+	// NotifyHosts limits where pipelines may ask for a completion POST
+	NotifyHosts string `yaml:"notify_hosts" env:"NOTIFY_HOSTS" help:"comma-separated hosts a pipeline's notify_url may name; empty allows any"`
+}
+
+// RateLimitConfig controls per-client request throttling and job quotas.
+// A zero value for a limit disables it.
+type RateLimitConfig struct {
+	// Sustained requests per second allowed for a single client
+	RequestsPerSecond float64 `yaml:"requests_per_second" env:"RATE_LIMIT_RPS" help:"sustained requests per second per client"`
+	// Maximum number of requests a client can burst above the sustained rate
+	Burst int `yaml:"burst" env:"RATE_LIMIT_BURST" help:"requests a client may burst above the sustained rate"`
+	// Maximum number of queued plus running jobs per submitter
+	MaxActiveJobs int64 `yaml:"max_active_jobs" env:"JOB_QUOTA_PER_SUBMITTER" help:"maximum queued plus running jobs per client"`
+	// Retry-After sent to clients that exceed their job quota
+	QuotaRetryAfter time.Duration `yaml:"quota_retry_after" env:"JOB_QUOTA_RETRY_AFTER" help:"Retry-After sent when the job quota is exceeded"`
+}
+
+// WorkerConfig controls transcoding workers
+type WorkerConfig struct {
+	MaxParallelization int `yaml:"max_parallelization" env:"WORKER_PARALLELISM" help:"jobs a worker runs at once"`
+	HealthPort         int `yaml:"health_port" env:"HEALTH_PORT" help:"worker health endpoint port"`
+	// AV1Encoder is used for software AV1 jobs that do not pick an encoder
+	AV1Encoder string `yaml:"av1_encoder" env:"WORKER_AV1_ENCODER" help:"AV1 software encoder for jobs that do not pick one: libaom-av1 or libsvtav1"`
+	// HardwareBackend encodes jobs that ask for hardware acceleration
+	HardwareBackend string `yaml:"hardware_backend" env:"WORKER_HARDWARE_BACKEND" help:"hardware acceleration API: qsv, vaapi, nvenc, amf or software"`
+	// HardwareDevice overrides the backend's default -init_hw_device value
+	HardwareDevice string `yaml:"hardware_device" env:"WORKER_HARDWARE_DEVICE" help:"-init_hw_device value for the hardware backend; empty uses its default"`
+	// HardwareSessions is advertised as the number of concurrent hardware
+	// encodes the device allows; 0 means max_parallelization
+	HardwareSessions int `yaml:"hardware_sessions" env:"WORKER_HARDWARE_SESSIONS" help:"concurrent hardware encodes the device allows; 0 uses max_parallelization"`
+}
+
+// MetricsConfig controls the Prometheus endpoint
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" env:"METRICS_ENABLED" help:"serve Prometheus metrics"`
+	Port    int    `yaml:"port" env:"METRICS_PORT" help:"metrics listen port"`
+	Path    string `yaml:"path" env:"METRICS_PATH" help:"metrics endpoint path"`
+}
+
+// TracingConfig controls OpenTelemetry trace export
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled" env:"TRACING_ENABLED" help:"export traces over OTLP"`
+	Endpoint    string  `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" help:"OTLP/HTTP traces URL"`
+	ServiceName string  `yaml:"service_name" env:"OTEL_SERVICE_NAME" help:"service name attached to spans"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" help:"fraction of new traces recorded, from 0 to 1"`
+}
+
+// LoggingConfig controls application logs and the output kept for each job
+type LoggingConfig struct {
+	Level   string       `yaml:"level" env:"LOG_LEVEL" help:"minimum level logged: debug, info, warn or error"`
+	Format  string       `yaml:"format" env:"LOG_FORMAT" help:"log encoding: json or console"`
+	Output  string       `yaml:"output" env:"LOG_OUTPUT" help:"where logs are written: stdout, stderr or a file path"`
+	JobLogs JobLogConfig `yaml:"job_logs"`
+	Loki    LokiConfig   `yaml:"loki"`
+}
+
+// JobLogConfig controls where the ffmpeg output of each job is kept
+type JobLogConfig struct {
+	Store    string `yaml:"store" env:"JOB_LOG_STORE" help:"where job output is kept: redis or file"`
+	Dir      string `yaml:"dir" env:"JOB_LOG_DIR" help:"directory for job output when the store is file"`
+	MaxBytes int    `yaml:"max_bytes" env:"JOB_LOG_MAX_BYTES" help:"output kept per job; the start and end are kept when it is longer"`
+}
+
+// LokiConfig controls pushing logs straight to Loki, for hosts without a
+// log shipping agent. An empty URL disables it.
+type LokiConfig struct {
+	URL        string        `yaml:"url" env:"LOKI_URL" help:"Loki push URL, e.g. http://loki:3100/loki/api/v1/push; empty disables pushing"`
+	TenantID   string        `yaml:"tenant_id" env:"LOKI_TENANT_ID" secret:"true" help:"tenant sent as X-Scope-OrgID to multi-tenant Loki"`
+	BatchSize  int           `yaml:"batch_size" env:"LOKI_BATCH_SIZE" help:"most entries sent in one push"`
+	BatchWait  time.Duration `yaml:"batch_wait" env:"LOKI_BATCH_WAIT" help:"longest an entry waits before it is pushed"`
+	BufferSize int           `yaml:"buffer_size" env:"LOKI_BUFFER_SIZE" help:"entries held while Loki is slow; more are dropped"`
+	MaxRetries int           `yaml:"max_retries" env:"LOKI_MAX_RETRIES" help:"retries of a failed push before its entries are dropped"`
+	MaxBackoff time.Duration `yaml:"max_backoff" env:"LOKI_MAX_BACKOFF" help:"longest wait between retries"`
+}
+
+// Default returns the configuration used when nothing overrides it
+func Default() Config {
+	return Config{
+		Redis: RedisConfig{
+			Addr: "redis:6379",
+		},
+		Server: ServerConfig{
+			Port: 8080,
+			RateLimit: RateLimitConfig{
+				QuotaRetryAfter: 60 * time.Second,
+			},
+		},
+		Worker: WorkerConfig{
+			MaxParallelization: 4,
+			HealthPort:         8081,
+			AV1Encoder:         "libaom-av1",
+			HardwareBackend:    "qsv",
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+			Port:    9090,
+			Path:    "/metrics",
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "transcodeflow",
+			SampleRatio: 1,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+			Output: "stdout",
+			JobLogs: JobLogConfig{
+				Store:    "redis",
+				Dir:      "logs/jobs",
+				MaxBytes: 256 << 10,
+			},
+			Loki: LokiConfig{
+				BatchSize:  500,
+				BatchWait:  time.Second,
+				BufferSize: 10000,
+				MaxRetries: 5,
+				MaxBackoff: 30 * time.Second,
+			},
+		},
+	}
+}
+
+// Loader builds a Config from its layers. Register its flags on a FlagSet
+// before parsing, then call Load.
+type Loader struct {
+	path  string
+	flags map[string]*flagValue
+	// Getenv is replaceable for tests
+	Getenv func(string) string
+}
+
+// NewLoader creates a loader that reads the environment
+func NewLoader() *Loader {
+	return &Loader{flags: map[string]*flagValue{}, Getenv: os.Getenv}
+}
+
+// RegisterFlags adds -config plus one flag per config field to fs
+func (l *Loader) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&l.path, "config", "", "path to a YAML config file (env "+FileEnv+")")
+
+	defaults := Default()
+	walk(reflect.ValueOf(&defaults).Elem(), "", func(f field) {
+		fv := &flagValue{}
+		l.flags[f.path] = fv
+		usage := f.help
+		if f.env != "" {
+			usage += " (env " + f.env + ")"
+		}
+		if !f.secret {
+			usage += fmt.Sprintf(" (default %v)", f.value.Interface())
+		}
+		fs.Var(fv, f.path, usage)
+	})
+}
+
+// Load merges defaults, the config file, the environment and any flags that
+// were set, then validates the result
+func (l *Loader) Load() (Config, error) {
+	cfg := Default()
+
+	path := l.path
+	if path == "" {
+		path = l.Getenv(FileEnv)
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	var errs []error
+	walk(reflect.ValueOf(&cfg).Elem(), "", func(f field) {
+		if f.env != "" {
+			if raw := l.Getenv(f.env); raw != "" {
+				if err := setValue(f.value, raw); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+				}
+			}
+		}
+		if fv := l.flags[f.path]; fv != nil && fv.set {
+			if err := setValue(f.value, fv.raw); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", f.path, err))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return cfg, errors.Join(errs...)
+	}
+
+	cfg.applyDerivedDefaults()
+	return cfg, cfg.Validate()
+}
+
+// loadFile decodes a YAML file over cfg, rejecting unknown keys so typos are
+// not silently ignored
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyDerivedDefaults fills in values that depend on other settings
+func (c *Config) applyDerivedDefaults() {
+	// A bucket must hold at least one token to ever admit a request
+	if c.Server.RateLimit.RequestsPerSecond > 0 && c.Server.RateLimit.Burst == 0 {
+		c.Server.RateLimit.Burst = int(math.Max(1, math.Ceil(c.Server.RateLimit.RequestsPerSecond)))
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Redis.Addr != "", "redis.addr must not be empty")
+	check(c.Redis.DB >= 0, "redis.db must not be negative")
+	check(validPort(c.Server.Port), "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.RateLimit.RequestsPerSecond >= 0, "server.rate_limit.requests_per_second must not be negative")
+	check(c.Server.RateLimit.Burst >= 0, "server.rate_limit.burst must not be negative")
+	check(c.Server.RateLimit.MaxActiveJobs >= 0, "server.rate_limit.max_active_jobs must not be negative")
+	check(c.Server.RateLimit.QuotaRetryAfter > 0, "server.rate_limit.quota_retry_after must be positive")
+	check(c.Worker.MaxParallelization >= 1, "worker.max_parallelization must be at least 1, got %d", c.Worker.MaxParallelization)
+	check(validPort(c.Worker.HealthPort), "worker.health_port must be between 1 and 65535, got %d", c.Worker.HealthPort)
+	check(oneOf(c.Worker.AV1Encoder, "libaom-av1", "libsvtav1"), "worker.av1_encoder must be libaom-av1 or libsvtav1, got %q", c.Worker.AV1Encoder)
+	check(c.Worker.HardwareSessions >= 0, "worker.hardware_sessions must not be negative")
+	check(oneOf(c.Worker.HardwareBackend, "qsv", "vaapi", "nvenc", "amf", "software"), "worker.hardware_backend must be qsv, vaapi, nvenc, amf or software, got %q", c.Worker.HardwareBackend)
+	if c.Metrics.Enabled {
+		check(validPort(c.Metrics.Port), "metrics.port must be between 1 and 65535, got %d", c.Metrics.Port)
+		check(strings.HasPrefix(c.Metrics.Path, "/"), "metrics.path must start with /, got %q", c.Metrics.Path)
+		check(c.Metrics.Port != c.Server.Port, "metrics.port and server.port must differ")
+		check(c.Metrics.Port != c.Worker.HealthPort, "metrics.port and worker.health_port must differ")
+	}
+	if c.Tracing.Enabled {
+		check(c.Tracing.Endpoint != "", "tracing.endpoint must not be empty")
+		check(c.Tracing.ServiceName != "", "tracing.service_name must not be empty")
+		check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	check(oneOf(c.Logging.Level, "debug", "info", "warn", "error"), "logging.level must be debug, info, warn or error, got %q", c.Logging.Level)
+	check(oneOf(c.Logging.Format, "json", "console"), "logging.format must be json or console, got %q", c.Logging.Format)
+	check(c.Logging.Output != "", "logging.output must not be empty")
+	check(oneOf(c.Logging.JobLogs.Store, "redis", "file"), "logging.job_logs.store must be redis or file, got %q", c.Logging.JobLogs.Store)
+	if c.Logging.JobLogs.Store == "file" {
+		check(c.Logging.JobLogs.Dir != "", "logging.job_logs.dir must not be empty")
+	}
+	check(c.Logging.JobLogs.MaxBytes >= 1024, "logging.job_logs.max_bytes must be at least 1024, got %d", c.Logging.JobLogs.MaxBytes)
+	if loki := c.Logging.Loki; loki.URL != "" {
+		u, err := url.Parse(loki.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "logging.loki.url must be an http or https URL, got %q", loki.URL)
+		check(loki.BatchSize >= 1, "logging.loki.batch_size must be at least 1, got %d", loki.BatchSize)
+		check(loki.BatchWait > 0, "logging.loki.batch_wait must be positive")
+		check(loki.BufferSize >= 1, "logging.loki.buffer_size must be at least 1, got %d", loki.BufferSize)
+		check(loki.MaxRetries >= 0, "logging.loki.max_retries must not be negative")
+		check(loki.MaxBackoff > 0, "logging.loki.max_backoff must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+func validPort(port int) bool {
+	return port >= 1 && port <= 65535
+}
+
+// Print writes the config as YAML with secrets redacted
+func (c Config) Print(w io.Writer) error {
+	redacted := c
+	walk(reflect.ValueOf(&redacted).Elem(), "", func(f field) {
+		switch {
+		case f.secret && !f.value.IsZero():
+			f.value.SetString(Redacted)
+		case f.value.Kind() == reflect.String:
+			f.value.SetString(redactUserinfo(f.value.String()))
+		}
+	})
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(redacted); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// redactUserinfo hides the credentials in URLs such as the Loki push URL,
+// which may carry basic auth. Redacted is not valid userinfo, so a plain
+// placeholder keeps the printed URL loadable.
+func redactUserinfo(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = url.User("redacted")
+	return u.String()
+}
+
+// field is a leaf setting found by walk
+type field struct {
+	path   string
+	env    string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+// walk calls fn for every leaf field of the struct v, descending into nested
+// structs. Paths join YAML names with dots.
+func walk(v reflect.Value, prefix string, fn func(field)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			walk(fv, path, fn)
+			continue
+		}
+		fn(field{
+			path:   path,
+			env:    sf.Tag.Get("env"),
+			help:   sf.Tag.Get("help"),
+			secret: sf.Tag.Get("secret") == "true",
+			value:  fv,
+		})
+	}
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses raw into v according to its type
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// flagValue records a flag's raw value so it can be applied after the
+// environment, and only if it was actually set
+type flagValue struct {
+	raw string
+	set bool
+}
+
+func (f *flagValue) String() string { return f.raw }
+
+func (f *flagValue) Set(s string) error {
+	f.raw, f.set = s, true
+	return nil
+}
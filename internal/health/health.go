@@ -0,0 +1,130 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"time"
+	"transcodeflow/internal/service"
+	"transcodeflow/internal/telemetry"
+
+	"go.uber.org/zap"
+)
+
+// FFmpegBinary is the executable checked by the readiness probe in worker mode
+var FFmpegBinary = "ffmpeg"
+
+// Handler serves liveness, readiness and queue status endpoints
+type Handler struct {
+	services *service.Services
+	// Whether readiness also requires a runnable ffmpeg binary (worker mode)
+	requireFFmpeg bool
+	// Replaceable for tests
+	checkFFmpeg func(ctx context.Context) error
+}
+
+// Status is the payload returned by /status
+type Status struct {
+	Queues   map[string]int64 `json:"queues"`
+	Workers  int              `json:"workers"`
+	InFlight int              `json:"in_flight"`
+}
+
+// NewHandler creates health endpoints. Workers should set requireFFmpeg so
+// they are not marked ready on a node without a usable ffmpeg.
+func NewHandler(svc *service.Services, requireFFmpeg bool) *Handler {
+	return &Handler{
+		services:      svc,
+		requireFFmpeg: requireFFmpeg,
+		checkFFmpeg:   runFFmpegVersion,
+	}
+}
+
+// Register adds the health routes to the given mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", h.handleLiveness)
+	mux.HandleFunc("/readyz", h.handleReadiness)
+	mux.HandleFunc("/status", h.handleStatus)
+}
+
+// handleLiveness reports that the process is up and serving requests
+func (h *Handler) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadiness reports whether the dependencies needed to do work are available
+func (h *Handler) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	checks := map[string]string{}
+	ready := true
+
+	if err := h.services.Redis.Ping(ctx); err != nil {
+		telemetry.Logger.Warn("Readiness check failed: Redis unreachable", zap.Error(err))
+		checks["redis"] = err.Error()
+		ready = false
+	} else {
+		checks["redis"] = "ok"
+	}
+
+	if h.requireFFmpeg {
+		if err := h.checkFFmpeg(ctx); err != nil {
+			telemetry.Logger.Warn("Readiness check failed: ffmpeg not runnable", zap.Error(err))
+			checks["ffmpeg"] = err.Error()
+			ready = false
+		} else {
+			checks["ffmpeg"] = "ok"
+		}
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+}
+
+// handleStatus returns queue depths and worker activity
+func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	depths, err := h.services.Redis.QueueDepths(ctx)
+	if err != nil {
+		telemetry.Logger.Error("System error: Failed to read queue depths", zap.Error(err))
+		http.Error(w, "Failed to read queue status", http.StatusServiceUnavailable)
+		return
+	}
+
+	workers, err := h.services.Redis.ListWorkers(ctx)
+	if err != nil {
+		telemetry.Logger.Error("System error: Failed to list workers", zap.Error(err))
+		http.Error(w, "Failed to read worker status", http.StatusServiceUnavailable)
+		return
+	}
+
+	status := Status{Queues: depths, Workers: len(workers)}
+	for _, worker := range workers {
+		status.InFlight += worker.InFlight
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// runFFmpegVersion verifies the ffmpeg binary exists and can execute
+func runFFmpegVersion(ctx context.Context) error {
+	path, err := exec.LookPath(FFmpegBinary)
+	if err != nil {
+		return err
+	}
+	return exec.CommandContext(ctx, path, "-version").Run()
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		telemetry.Logger.Error("System error: Failed to write health response", zap.Error(err))
+	}
+}
@@ -0,0 +1,105 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T, requireFFmpeg bool) (*Handler, *mocks.RedisClient) {
+	redisMock := mocks.NewRedisClient(t)
+	svc := &service.Services{
+		Metrics: mocks.NewMetricsClient(t),
+		Redis:   redisMock,
+	}
+	return NewHandler(svc, requireFFmpeg), redisMock
+}
+
+func serve(h *Handler, path string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	h.Register(mux)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+	return rr
+}
+
+func TestLiveness(t *testing.T) {
+	h, _ := newTestHandler(t, false)
+
+	rr := serve(h, "/healthz")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestReadinessAPIMode(t *testing.T) {
+	h, redisMock := newTestHandler(t, false)
+	redisMock.On("Ping", mock.Anything).Return(nil)
+	h.checkFFmpeg = func(context.Context) error {
+		t.Fatal("API mode should not check ffmpeg")
+		return nil
+	}
+
+	rr := serve(h, "/readyz")
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status":"ready","checks":{"redis":"ok"}}`, rr.Body.String())
+}
+
+func TestReadinessWorkerMissingFFmpeg(t *testing.T) {
+	h, redisMock := newTestHandler(t, true)
+	redisMock.On("Ping", mock.Anything).Return(nil)
+	h.checkFFmpeg = func(context.Context) error { return errors.New("executable file not found") }
+
+	rr := serve(h, "/readyz")
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status":"not_ready","checks":{"redis":"ok","ffmpeg":"executable file not found"}}`, rr.Body.String())
+}
+
+func TestReadinessRedisDown(t *testing.T) {
+	h, redisMock := newTestHandler(t, true)
+	redisMock.On("Ping", mock.Anything).Return(errors.New("connection refused"))
+	h.checkFFmpeg = func(context.Context) error { return nil }
+
+	rr := serve(h, "/readyz")
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "connection refused")
+}
+
+func TestStatus(t *testing.T) {
+	h, redisMock := newTestHandler(t, false)
+	redisMock.On("QueueDepths", mock.Anything).Return(map[string]int64{"jobs": 12, "results": 3}, nil)
+	redisMock.On("ListWorkers", mock.Anything).Return([]model.WorkerInfo{
+		{ID: "a", InFlight: 2},
+		{ID: "b", InFlight: 1},
+	}, nil)
+
+	rr := serve(h, "/status")
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var status Status
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.Equal(t, Status{Queues: map[string]int64{"jobs": 12, "results": 3}, Workers: 2, InFlight: 3}, status)
+}
+
+func TestStatusRedisError(t *testing.T) {
+	h, redisMock := newTestHandler(t, false)
+	redisMock.On("QueueDepths", mock.Anything).Return(nil, errors.New("connection refused"))
+
+	rr := serve(h, "/status")
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+}
@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+	"transcodeflow/internal/service"
+	"transcodeflow/internal/telemetry"
+
+	"go.uber.org/zap"
+)
+
+// Server exposes the health endpoints for processes without an API server,
+// such as workers
+type Server struct {
+	handler *Handler
+	port    string
+	server  *http.Server
+}
+
+// NewServer creates a standalone health server listening on port
+func NewServer(svc *service.Services, requireFFmpeg bool, port int) *Server {
+	return &Server{
+		handler: NewHandler(svc, requireFFmpeg),
+		port:    strconv.Itoa(port),
+	}
+}
+
+// Start serves health endpoints until the context is cancelled
+func (s *Server) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	s.handler.Register(mux)
+
+	s.server = &http.Server{
+		Addr:         ":" + s.port,
+		Handler:      mux,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		telemetry.Logger.Info("Starting health server", zap.String("port", s.port))
+		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return s.server.Shutdown(shutdownCtx)
+	case err := <-errCh:
+		return err
+	}
+}
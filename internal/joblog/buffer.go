@@ -0,0 +1,56 @@
+package joblog
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Buffer collects a job's output up to a limit in bytes. Once the limit is
+// reached it keeps the first quarter and the most recent output, since ffmpeg
+// describes its inputs at the start and reports why it failed at the end. It
+// is safe for concurrent writes, so stdout and stderr can share one.
+type Buffer struct {
+	mu      sync.Mutex
+	limit   int
+	head    []byte
+	tail    []byte
+	omitted int64
+}
+
+// NewBuffer creates a buffer keeping at most limit bytes of output
+func NewBuffer(limit int) *Buffer {
+	return &Buffer{limit: limit}
+}
+
+// Write always accepts all of p; output beyond the limit is dropped from the
+// middle
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	headLimit := b.limit / 4
+	if room := headLimit - len(b.head); room > 0 {
+		take := min(room, len(p))
+		b.head = append(b.head, p[:take]...)
+		p = p[take:]
+	}
+
+	b.tail = append(b.tail, p...)
+	if excess := len(b.tail) - (b.limit - headLimit); excess > 0 {
+		b.omitted += int64(excess)
+		b.tail = append(b.tail[:0], b.tail[excess:]...)
+	}
+	return n, nil
+}
+
+// String returns the kept output, marking where output was dropped
+func (b *Buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.omitted == 0 {
+		return string(b.head) + string(b.tail)
+	}
+	return fmt.Sprintf("%s\n[... %d bytes omitted ...]\n%s", b.head, b.omitted, b.tail)
+}
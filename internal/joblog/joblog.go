@@ -0,0 +1,108 @@
+// Package joblog keeps the output captured while each job runs so clients
+// can read it once the job has finished
+package joblog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/repository/redis"
+)
+
+// ErrNotFound is returned when no output was stored for a job
+var ErrNotFound = errors.New("job log not found")
+
+// Stores accepted by logging.job_logs.store
+const (
+	StoreRedis = "redis"
+	StoreFile  = "file"
+)
+
+// Store keeps the captured output of jobs
+type Store interface {
+	Save(ctx context.Context, jobID string, log string) error
+	Load(ctx context.Context, jobID string) (string, error)
+}
+
+// NewStore creates the store selected by cfg. File stores must be on a
+// volume shared by the workers and the API server.
+func NewStore(cfg config.JobLogConfig, redisClient redis.RedisClient) (Store, error) {
+	switch cfg.Store {
+	case StoreRedis:
+		return &redisStore{client: redisClient}, nil
+	case StoreFile:
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("creating job log directory: %w", err)
+		}
+		return &fileStore{dir: cfg.Dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown job log store %q", cfg.Store)
+	}
+}
+
+// redisStore keeps job output in Redis alongside the job records
+type redisStore struct {
+	client redis.RedisClient
+}
+
+func (s *redisStore) Save(ctx context.Context, jobID string, log string) error {
+	return s.client.SaveJobLog(ctx, jobID, log)
+}
+
+func (s *redisStore) Load(ctx context.Context, jobID string) (string, error) {
+	log, err := s.client.GetJobLog(ctx, jobID)
+	if errors.Is(err, redis.ErrJobNotFound) {
+		return "", ErrNotFound
+	}
+	return log, err
+}
+
+// fileStore keeps the output of each job in <dir>/<job ID>.log
+type fileStore struct {
+	dir string
+}
+
+func (s *fileStore) path(jobID string) (string, error) {
+	// Job IDs come from clients on the read side; keep them inside dir
+	if jobID == "" || jobID != filepath.Base(jobID) || jobID == "." || jobID == ".." {
+		return "", fmt.Errorf("invalid job ID %q", jobID)
+	}
+	return filepath.Join(s.dir, jobID+".log"), nil
+}
+
+func (s *fileStore) Save(_ context.Context, jobID string, log string) error {
+	path, err := s.path(jobID)
+	if err != nil {
+		return err
+	}
+
+	// Write then rename so readers never see a partial log
+	tmp, err := os.CreateTemp(s.dir, jobID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(log); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *fileStore) Load(_ context.Context, jobID string) (string, error) {
+	path, err := s.path(jobID)
+	if err != nil {
+		return "", ErrNotFound
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	return string(data), err
+}
@@ -0,0 +1,75 @@
+package joblog
+
+import (
+	"context"
+	"testing"
+	"transcodeflow/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		writes []string
+		want   string
+	}{
+		{
+			name:   "under the limit",
+			limit:  16,
+			writes: []string{"frame=1\n", "frame=2\n"},
+			want:   "frame=1\nframe=2\n",
+		},
+		{
+			name:   "keeps the start and end",
+			limit:  8,
+			writes: []string{"ab", "cdefgh", "ijkl"},
+			want:   "ab\n[... 4 bytes omitted ...]\nghijkl",
+		},
+		{
+			name:   "single large write",
+			limit:  8,
+			writes: []string{"abcdefghijklmnop"},
+			want:   "ab\n[... 8 bytes omitted ...]\nklmnop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := NewBuffer(tt.limit)
+			for _, w := range tt.writes {
+				n, err := buf.Write([]byte(w))
+				require.NoError(t, err)
+				assert.Equal(t, len(w), n)
+			}
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewStore(config.JobLogConfig{Store: StoreFile, Dir: t.TempDir()}, nil)
+	require.NoError(t, err)
+
+	_, err = store.Load(ctx, "abc")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, store.Save(ctx, "abc", "first attempt"))
+	require.NoError(t, store.Save(ctx, "abc", "second attempt"))
+	log, err := store.Load(ctx, "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "second attempt", log)
+
+	assert.Error(t, store.Save(ctx, "../escape", "x"))
+	_, err = store.Load(ctx, "..")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNewStoreRejectsUnknownStore(t *testing.T) {
+	_, err := NewStore(config.JobLogConfig{Store: "s3"}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "s3")
+}
@@ -0,0 +1,333 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StreamingFormat is a packaging format for adaptive bitrate output
+type StreamingFormat string
+
+const (
+	// StreamingHLS writes an HLS master playlist and a media playlist per rendition
+	StreamingHLS StreamingFormat = "hls"
+	// StreamingDASH writes a DASH manifest with fragmented MP4 segments
+	StreamingDASH StreamingFormat = "dash"
+)
+
+const (
+	// DefaultSegmentSeconds is the target segment length when none is set
+	DefaultSegmentSeconds = 6
+	// maxSegmentSeconds bounds segment_seconds; longer segments defeat
+	// adaptive switching
+	maxSegmentSeconds = 60
+	// DefaultABRAudioBitrate is the AAC bitrate of renditions that do not set one
+	DefaultABRAudioBitrate = "128k"
+
+	// MasterPlaylistName and ManifestName are the files players open
+	MasterPlaylistName = "master.m3u8"
+	ManifestName       = "manifest.mpd"
+)
+
+// abrEncoders are the software encoders used for each codec a ladder may
+// use. Renditions are bitrate targeted, so the encoders run at their
+// default speed rather than a quality preset.
+var abrEncoders = map[VideoCodec]string{
+	VideoCodecH264: "libx264",
+	VideoCodecHEVC: "libx265",
+	VideoCodecAV1:  "libsvtav1",
+}
+
+// ABROptions describe an adaptive bitrate ladder. A job with a ladder
+// treats its output path as a directory, which receives the playlists or
+// manifest and the segments of every rendition. All renditions are encoded
+// by one ffmpeg process that decodes the input once.
+type ABROptions struct {
+	// Formats lists the packaging to write; HLS when empty. Asking for both
+	// writes CMAF segments shared by the DASH manifest and HLS playlists.
+	Formats []StreamingFormat `json:"formats,omitempty"`
+	// VideoCodec is "h264" (default), "hevc" or "av1"
+	VideoCodec VideoCodec `json:"video_codec,omitempty"`
+	// SegmentSeconds is the target segment length; keyframes are forced on
+	// segment boundaries so every rendition switches at the same points
+	SegmentSeconds int `json:"segment_seconds,omitempty"`
+	// NoAudio drops audio, for inputs without an audio stream
+	NoAudio bool `json:"no_audio,omitempty"`
+	// Renditions are listed from the highest quality down
+	Renditions []Rendition `json:"renditions"`
+}
+
+// UnmarshalJSON accepts no_audio as a boolean or in the legacy string forms
+func (o *ABROptions) UnmarshalJSON(data []byte) error {
+	type ABROptionsAlias ABROptions
+	aux := struct {
+		*ABROptionsAlias
+		NoAudio json.RawMessage `json:"no_audio"`
+	}{ABROptionsAlias: (*ABROptionsAlias)(o)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	o.NoAudio, err = decodeFlag("no_audio", aux.NoAudio)
+	return err
+}
+
+// Rendition is one rung of a ladder
+type Rendition struct {
+	// Name is the directory the rendition's HLS segments are written to;
+	// the resolution when empty
+	Name string `json:"name,omitempty"`
+	// Resolution is a height such as "1080p", "720p" or "4k". The width
+	// follows the input's aspect ratio.
+	Resolution string `json:"resolution"`
+	// VideoBitrate is the average video bitrate, e.g. "5000k" or "5M"
+	VideoBitrate string `json:"video_bitrate"`
+	// AudioBitrate is the AAC bitrate, 128k when empty
+	AudioBitrate string `json:"audio_bitrate,omitempty"`
+}
+
+var (
+	renditionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	bitratePattern       = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([kKmM]?)$`)
+)
+
+// IsValidStreamingFormat checks if the given packaging format is supported
+func IsValidStreamingFormat(format StreamingFormat) bool {
+	return format == StreamingHLS || format == StreamingDASH
+}
+
+// parseBitrate reads an ffmpeg bitrate such as 800000, 800k or 5M as bits
+// per second
+func parseBitrate(s string) (int64, bool) {
+	m := bitratePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	switch strings.ToLower(m[2]) {
+	case "k":
+		v *= 1e3
+	case "m":
+		v *= 1e6
+	}
+	if v < 1 {
+		return 0, false
+	}
+	return int64(v), true
+}
+
+// height returns the rendition's height in pixels
+func (r Rendition) height() (int, bool) {
+	res := strings.ToLower(r.Resolution)
+	if res == "4k" {
+		return 2160, true
+	}
+	h, err := strconv.Atoi(strings.TrimSuffix(res, "p"))
+	if !strings.HasSuffix(res, "p") || err != nil || h <= 0 || h%2 != 0 {
+		return 0, false
+	}
+	return h, true
+}
+
+// name returns the rendition's directory name
+func (r Rendition) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return strings.ToLower(r.Resolution)
+}
+
+// codec returns the ladder's video codec, or H.264
+func (o *ABROptions) codec() VideoCodec {
+	if o.VideoCodec == "" {
+		return VideoCodecH264
+	}
+	return o.VideoCodec
+}
+
+// segmentSeconds returns the target segment length
+func (o *ABROptions) segmentSeconds() int {
+	if o.SegmentSeconds == 0 {
+		return DefaultSegmentSeconds
+	}
+	return o.SegmentSeconds
+}
+
+// writes reports whether the ladder is packaged in the given format
+func (o *ABROptions) writes(format StreamingFormat) bool {
+	if len(o.Formats) == 0 {
+		return format == StreamingHLS
+	}
+	for _, f := range o.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Entrypoints returns the files under dir that players open: the HLS master
+// playlist and the DASH manifest, as the ladder writes them
+func (o *ABROptions) Entrypoints(dir string) []string {
+	var files []string
+	if o.writes(StreamingHLS) {
+		files = append(files, filepath.Join(dir, MasterPlaylistName))
+	}
+	if o.writes(StreamingDASH) {
+		files = append(files, filepath.Join(dir, ManifestName))
+	}
+	return files
+}
+
+// outputArgs returns the arguments encoding and packaging every rendition
+// into dir, output paths included
+func (o *ABROptions) outputArgs(dir string) []string {
+	n := len(o.Renditions)
+	encoder := abrEncoders[o.codec()]
+
+	// Decode once, then split and scale for each rendition
+	splits := make([]string, n)
+	scales := make([]string, n)
+	for i, r := range o.Renditions {
+		h, _ := r.height()
+		splits[i] = fmt.Sprintf("[v%d]", i)
+		scales[i] = fmt.Sprintf("[v%d]scale=-2:%d[v%dout]", i, h, i)
+	}
+	graph := fmt.Sprintf("[0:v]split=%d%s;%s", n, strings.Join(splits, ""), strings.Join(scales, ";"))
+	args := []string{"-filter_complex", graph}
+
+	for i, r := range o.Renditions {
+		bitrate, _ := parseBitrate(r.VideoBitrate)
+		args = append(args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), encoder,
+			fmt.Sprintf("-b:v:%d", i), r.VideoBitrate,
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", bitrate*107/100/1000),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", bitrate*3/2/1000))
+		if o.codec() == VideoCodecHEVC {
+			args = append(args, fmt.Sprintf("-tag:v:%d", i), "hvc1")
+		}
+	}
+	if !o.NoAudio {
+		for i, r := range o.Renditions {
+			bitrate := r.AudioBitrate
+			if bitrate == "" {
+				bitrate = DefaultABRAudioBitrate
+			}
+			args = append(args, "-map", "0:a:0", fmt.Sprintf("-c:a:%d", i), "aac", fmt.Sprintf("-b:a:%d", i), bitrate)
+		}
+		args = append(args, "-ac", "2")
+	}
+
+	// Renditions must have keyframes at the same times to switch between them
+	seconds := o.segmentSeconds()
+	args = append(args, "-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", seconds))
+
+	if o.writes(StreamingDASH) {
+		// DASH writes fragmented MP4 segments; HLS playlists can share them
+		sets := "id=0,streams=v"
+		if !o.NoAudio {
+			sets += " id=1,streams=a"
+		}
+		args = append(args, "-f", "dash",
+			"-seg_duration", strconv.Itoa(seconds),
+			"-use_template", "1", "-use_timeline", "1",
+			"-adaptation_sets", sets)
+		if o.writes(StreamingHLS) {
+			// The DASH muxer names its HLS master playlist master.m3u8
+			args = append(args, "-hls_playlist", "1")
+		}
+		return append(args, filepath.Join(dir, ManifestName))
+	}
+
+	streams := make([]string, n)
+	for i, r := range o.Renditions {
+		if o.NoAudio {
+			streams[i] = fmt.Sprintf("v:%d,name:%s", i, r.name())
+		} else {
+			streams[i] = fmt.Sprintf("v:%d,a:%d,name:%s", i, i, r.name())
+		}
+	}
+	// MPEG-TS segments only carry H.264 in every player; other codecs use
+	// fragmented MP4
+	segment := "segment_%05d.ts"
+	args = append(args, "-f", "hls",
+		"-hls_time", strconv.Itoa(seconds),
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments")
+	if o.codec() != VideoCodecH264 {
+		segment = "segment_%05d.m4s"
+		args = append(args, "-hls_segment_type", "fmp4")
+	}
+	return append(args,
+		"-master_pl_name", MasterPlaylistName,
+		"-hls_segment_filename", filepath.Join(dir, "%v", segment),
+		"-var_stream_map", strings.Join(streams, " "),
+		filepath.Join(dir, "%v", "index.m3u8"))
+}
+
+// validateABR checks that a ladder can be encoded: it has renditions with
+// real resolutions, bitrates and distinct names, and a codec and formats
+// it can be packaged with. Ladders are rendered from their own options, so
+// simple options and output arguments cannot be combined with one.
+func (j *Job) validateABR() error {
+	o := j.ABR
+	if j.SimpleOptions != nil {
+		return &ValidationError{"abr", "cannot be combined with simple_options"}
+	}
+	if j.OutputArguments != "" {
+		return &ValidationError{"abr", "cannot be combined with output_arguments"}
+	}
+
+	seen := make(map[StreamingFormat]bool)
+	for i, format := range o.Formats {
+		field := fmt.Sprintf("abr.formats[%d]", i)
+		if !IsValidStreamingFormat(format) {
+			return &ValidationError{field, fmt.Sprintf("must be one of %s, %s", StreamingHLS, StreamingDASH)}
+		}
+		if seen[format] {
+			return &ValidationError{field, fmt.Sprintf("lists %s twice", format)}
+		}
+		seen[format] = true
+	}
+	if _, ok := abrEncoders[o.codec()]; !ok {
+		return &ValidationError{"abr.video_codec", fmt.Sprintf("must be one of %s, %s, %s", VideoCodecH264, VideoCodecHEVC, VideoCodecAV1)}
+	}
+	if o.SegmentSeconds < 0 || o.SegmentSeconds > maxSegmentSeconds {
+		return &ValidationError{"abr.segment_seconds", fmt.Sprintf("must be between 1 and %d", maxSegmentSeconds)}
+	}
+
+	if len(o.Renditions) == 0 {
+		return &ValidationError{"abr.renditions", "must list at least one rendition"}
+	}
+	names := make(map[string]bool)
+	for i, r := range o.Renditions {
+		field := fmt.Sprintf("abr.renditions[%d]", i)
+		if _, ok := r.height(); !ok {
+			return &ValidationError{field + ".resolution", fmt.Sprintf("%q is not an even height such as 720p", r.Resolution)}
+		}
+		if _, ok := parseBitrate(r.VideoBitrate); !ok {
+			return &ValidationError{field + ".video_bitrate", fmt.Sprintf("%q is not a bitrate such as 5000k", r.VideoBitrate)}
+		}
+		if _, ok := parseBitrate(r.AudioBitrate); r.AudioBitrate != "" && !ok {
+			return &ValidationError{field + ".audio_bitrate", fmt.Sprintf("%q is not a bitrate such as 128k", r.AudioBitrate)}
+		}
+		name := r.name()
+		if !renditionNamePattern.MatchString(name) {
+			return &ValidationError{field + ".name", fmt.Sprintf("%q must be letters, digits, '.', '_' or '-'", name)}
+		}
+		if names[name] {
+			return &ValidationError{field + ".name", fmt.Sprintf("%q is used by another rendition", name)}
+		}
+		names[name] = true
+	}
+	return nil
+}
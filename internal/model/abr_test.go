@@ -0,0 +1,169 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testLadder = []Rendition{
+	{Resolution: "1080p", VideoBitrate: "5000k", AudioBitrate: "192k"},
+	{Resolution: "720p", VideoBitrate: "2800k"},
+	{Name: "sd", Resolution: "480p", VideoBitrate: "1.4M"},
+}
+
+func TestABRCommand(t *testing.T) {
+	job := Job{InputFilePath: "in.mkv", OutputFilePath: "/out/show", ABR: &ABROptions{Renditions: testLadder}}
+
+	want := []string{
+		"-y", "-hide_banner", "-i", "in.mkv",
+		"-filter_complex", "[0:v]split=3[v0][v1][v2];[v0]scale=-2:1080[v0out];[v1]scale=-2:720[v1out];[v2]scale=-2:480[v2out]",
+		"-map", "[v0out]", "-c:v:0", "libx264", "-b:v:0", "5000k", "-maxrate:v:0", "5350k", "-bufsize:v:0", "7500k",
+		"-map", "[v1out]", "-c:v:1", "libx264", "-b:v:1", "2800k", "-maxrate:v:1", "2996k", "-bufsize:v:1", "4200k",
+		"-map", "[v2out]", "-c:v:2", "libx264", "-b:v:2", "1.4M", "-maxrate:v:2", "1498k", "-bufsize:v:2", "2100k",
+		"-map", "0:a:0", "-c:a:0", "aac", "-b:a:0", "192k",
+		"-map", "0:a:0", "-c:a:1", "aac", "-b:a:1", "128k",
+		"-map", "0:a:0", "-c:a:2", "aac", "-b:a:2", "128k",
+		"-ac", "2",
+		"-force_key_frames", "expr:gte(t,n_forced*6)",
+		"-f", "hls", "-hls_time", "6", "-hls_playlist_type", "vod", "-hls_flags", "independent_segments",
+		"-master_pl_name", "master.m3u8",
+		"-hls_segment_filename", "/out/show/%v/segment_%05d.ts",
+		"-var_stream_map", "v:0,a:0,name:1080p v:1,a:1,name:720p v:2,a:2,name:sd",
+		"/out/show/%v/index.m3u8",
+	}
+	if got := job.GetFFmpegCommand(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFFmpegCommand() =\n%v\nwant\n%v", got, want)
+	}
+	if got := job.VideoEncoder(); got != "libx264" {
+		t.Errorf("VideoEncoder() = %q, want libx264", got)
+	}
+}
+
+func TestABRPackaging(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        ABROptions
+		contains    []string
+		output      string
+		entrypoints []string
+	}{
+		{
+			name:        "HEVC HLS uses fragmented MP4",
+			opts:        ABROptions{VideoCodec: VideoCodecHEVC, SegmentSeconds: 4, Renditions: testLadder[:1]},
+			contains:    []string{"-c:v:0 libx265", "-tag:v:0 hvc1", "-hls_time 4", "-hls_segment_type fmp4", "/out/%v/segment_%05d.m4s"},
+			output:      "/out/%v/index.m3u8",
+			entrypoints: []string{"/out/master.m3u8"},
+		},
+		{
+			name:        "DASH",
+			opts:        ABROptions{Formats: []StreamingFormat{StreamingDASH}, NoAudio: true, Renditions: testLadder[:1]},
+			contains:    []string{"-f dash", "-seg_duration 6", "-adaptation_sets id=0,streams=v"},
+			output:      "/out/manifest.mpd",
+			entrypoints: []string{"/out/manifest.mpd"},
+		},
+		{
+			name:        "CMAF for HLS and DASH",
+			opts:        ABROptions{Formats: []StreamingFormat{StreamingHLS, StreamingDASH}, Renditions: testLadder},
+			contains:    []string{"-f dash", "-adaptation_sets id=0,streams=v id=1,streams=a", "-hls_playlist 1"},
+			output:      "/out/manifest.mpd",
+			entrypoints: []string{"/out/master.m3u8", "/out/manifest.mpd"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := Job{InputFilePath: "in.mkv", OutputFilePath: "/out", ABR: &tt.opts}
+			args := job.GetFFmpegCommand()
+			cmd := strings.Join(args, " ")
+			for _, part := range tt.contains {
+				if !strings.Contains(cmd, part) {
+					t.Errorf("command %q does not contain %q", cmd, part)
+				}
+			}
+			if tt.opts.NoAudio && strings.Contains(cmd, "0:a:0") {
+				t.Errorf("command %q maps audio", cmd)
+			}
+			if got := args[len(args)-1]; got != tt.output {
+				t.Errorf("output = %q, want %q", got, tt.output)
+			}
+			if got := tt.opts.Entrypoints("/out"); !reflect.DeepEqual(got, tt.entrypoints) {
+				t.Errorf("Entrypoints() = %v, want %v", got, tt.entrypoints)
+			}
+		})
+	}
+}
+
+func TestValidateABR(t *testing.T) {
+	ladder := func(opts ABROptions) Job {
+		if opts.Renditions == nil {
+			opts.Renditions = testLadder
+		}
+		return Job{OutputFilePath: "/out", ABR: &opts}
+	}
+	withSimple := ladder(ABROptions{})
+	withSimple.SimpleOptions = &SimpleOptions{}
+
+	tests := []struct {
+		name      string
+		job       Job
+		wantField string
+	}{
+		{"Ladder", ladder(ABROptions{Formats: []StreamingFormat{StreamingHLS, StreamingDASH}, VideoCodec: VideoCodecAV1}), ""},
+		{"4K rung", ladder(ABROptions{Renditions: []Rendition{{Resolution: "4K", VideoBitrate: "16M"}}}), ""},
+		{"With simple options", withSimple, "abr"},
+		{"No renditions", ladder(ABROptions{Renditions: []Rendition{}}), "abr.renditions"},
+		{"Unknown format", ladder(ABROptions{Formats: []StreamingFormat{"smooth"}}), "abr.formats[0]"},
+		{"Repeated format", ladder(ABROptions{Formats: []StreamingFormat{StreamingHLS, StreamingHLS}}), "abr.formats[1]"},
+		{"VP9", ladder(ABROptions{VideoCodec: VideoCodecVP9}), "abr.video_codec"},
+		{"Long segments", ladder(ABROptions{SegmentSeconds: 90}), "abr.segment_seconds"},
+		{"Odd height", ladder(ABROptions{Renditions: []Rendition{{Resolution: "719p", VideoBitrate: "1M"}}}), "abr.renditions[0].resolution"},
+		{"Width and height", ladder(ABROptions{Renditions: []Rendition{{Resolution: "1280:720", VideoBitrate: "1M"}}}), "abr.renditions[0].resolution"},
+		{"Bad bitrate", ladder(ABROptions{Renditions: []Rendition{{Resolution: "720p", VideoBitrate: "fast"}}}), "abr.renditions[0].video_bitrate"},
+		{"Bad audio bitrate", ladder(ABROptions{Renditions: []Rendition{{Resolution: "720p", VideoBitrate: "1M", AudioBitrate: "0k"}}}), "abr.renditions[0].audio_bitrate"},
+		{"Path in name", ladder(ABROptions{Renditions: []Rendition{{Name: "../hd", Resolution: "720p", VideoBitrate: "1M"}}}), "abr.renditions[0].name"},
+		{"Repeated name", ladder(ABROptions{Renditions: []Rendition{{Resolution: "720p", VideoBitrate: "2M"}, {Resolution: "720p", VideoBitrate: "1M"}}}), "abr.renditions[1].name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.job.Validate()
+			if tt.wantField == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			invalid, ok := err.(*ValidationError)
+			if !ok || invalid.Field != tt.wantField {
+				t.Errorf("Validate() = %v, want an error for %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestABRNoAudioFlag(t *testing.T) {
+	for body, want := range map[string]bool{
+		`{"abr":{"no_audio":true}}`:  true,
+		`{"abr":{"no_audio":"yes"}}`: true,
+		`{"abr":{"no_audio":"off"}}`: false,
+		`{"abr":{}}`:                 false,
+	} {
+		var job Job
+		if err := json.Unmarshal([]byte(body), &job); err != nil {
+			t.Fatalf("json.Unmarshal(%s) error = %v", body, err)
+		}
+		if got := job.ABR.NoAudio; got != want {
+			t.Errorf("json.Unmarshal(%s) no_audio = %v, want %v", body, got, want)
+		}
+	}
+
+	var job Job
+	var typeErr *json.UnmarshalTypeError
+	body := `{"abr":{"no_audio":"maybe"}}`
+	if err := json.Unmarshal([]byte(body), &job); !errors.As(err, &typeErr) || typeErr.Field != "abr.no_audio" {
+		t.Errorf("json.Unmarshal(%s) error = %v, want a type error for abr.no_audio", body, err)
+	}
+}
@@ -0,0 +1,430 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AudioOptions choose the audio tracks of a simple transcode and how each
+// is encoded. Tracks are chosen from the probed input; when it cannot be
+// probed ffmpeg picks one track and the codec and channel settings apply
+// to it.
+type AudioOptions struct {
+	// Languages are ISO 639-2 codes in order of preference. Tracks in them
+	// are kept, the most preferred first and marked as the default; when
+	// none is, the input's first track is kept. Every track when empty.
+	Languages []string `json:"languages,omitempty"`
+	// KeepCommentary keeps commentary tracks, which are dropped by default
+	KeepCommentary bool `json:"keep_commentary,omitempty"`
+	// Codec of the kept tracks: "opus" (default), "aac", "eac3" or "copy"
+	Codec string `json:"codec,omitempty"`
+	// Channels is "preserve" (default) to keep each track's layout, up to
+	// 7.1 or the 5.1 E-AC-3 allows, or "stereo" to downmix every track
+	Channels string `json:"channels,omitempty"`
+	// StereoDownmix adds a stereo track after each surround track,
+	// encoded with DownmixCodec: Codec by default, or aac when Codec is copy
+	StereoDownmix bool   `json:"stereo_downmix,omitempty"`
+	DownmixCodec  string `json:"downmix_codec,omitempty"`
+}
+
+// UnmarshalJSON accepts keep_commentary and stereo_downmix as booleans or in
+// the legacy string forms
+func (o *AudioOptions) UnmarshalJSON(data []byte) error {
+	type AudioOptionsAlias AudioOptions
+	aux := struct {
+		*AudioOptionsAlias
+		KeepCommentary json.RawMessage `json:"keep_commentary"`
+		StereoDownmix  json.RawMessage `json:"stereo_downmix"`
+	}{AudioOptionsAlias: (*AudioOptionsAlias)(o)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	if o.KeepCommentary, err = decodeFlag("keep_commentary", aux.KeepCommentary); err != nil {
+		return err
+	}
+	if o.StereoDownmix, err = decodeFlag("stereo_downmix", aux.StereoDownmix); err != nil {
+		return err
+	}
+	return nil
+}
+
+// audioCodec is an encoder audio options choose
+type audioCodec struct {
+	encoder string
+	// stereoKbps is the bitrate of a stereo track at each audio_quality:
+	// low, medium and high. Other layouts scale it by their channel count.
+	stereoKbps [3]int
+	// maxChannels is the most channels the encoder takes
+	maxChannels int
+}
+
+// audioCodecs are the codecs audio options encode with
+var audioCodecs = map[string]audioCodec{
+	"opus": {"libopus", [3]int{64, 128, 256}, 8},
+	"aac":  {"aac", [3]int{96, 160, 256}, 8},
+	"eac3": {"eac3", [3]int{96, 192, 256}, 6},
+}
+
+// channelLayouts are the layouts tracks are converted to for each channel
+// count. Surround layouts are in the Vorbis channel order libopus takes;
+// others, such as 5.1(side), are converted to them.
+var channelLayouts = map[int]string{
+	1: "mono", 2: "stereo", 3: "3.0", 4: "quad", 5: "5.0", 6: "5.1", 7: "6.1", 8: "7.1",
+}
+
+// audioOutput is an audio stream of a transcode's output
+type audioOutput struct {
+	// track is the index among the input's audio streams the stream is
+	// encoded from, or -1 for the track ffmpeg picks
+	track int
+	// codec is a key of audioCodecs, copy, or empty when output_arguments
+	// encode the stream
+	codec   string
+	bitrate string
+	// layout is the channel layout the stream is converted to, if any
+	layout      string
+	title       string
+	disposition string
+}
+
+// filtered reports whether an output stream is decoded and filtered, which
+// copied streams are not
+func (a audioOutput) filtered() bool {
+	return a.codec != "copy"
+}
+
+// audioTrack is one of the input's audio streams
+type audioTrack struct {
+	stream ProbeStream
+	// n is the index among the input's audio streams, as 0:a:N takes it
+	n int
+}
+
+func (t audioTrack) channels() int {
+	if t.stream.Channels == 0 {
+		// Unknown layouts are assumed to be stereo
+		return 2
+	}
+	return t.stream.Channels
+}
+
+// commentary reports whether a track is a commentary: flagged as one, or
+// titled so
+func (s ProbeStream) commentary() bool {
+	return s.Comment || strings.Contains(strings.ToLower(s.Title), "commentary")
+}
+
+// codec returns the codec of the kept tracks, or opus
+func (o *AudioOptions) codec() string {
+	if o.Codec == "" {
+		return "opus"
+	}
+	return strings.ToLower(o.Codec)
+}
+
+// downmixCodec returns the codec of added stereo tracks
+func (o *AudioOptions) downmixCodec() string {
+	switch {
+	case o.DownmixCodec != "":
+		return strings.ToLower(o.DownmixCodec)
+	case o.codec() == "copy":
+		return "aac"
+	}
+	return o.codec()
+}
+
+// stereo reports whether every track is downmixed to stereo
+func (o *AudioOptions) stereo() bool {
+	return strings.EqualFold(o.Channels, "stereo")
+}
+
+// preference returns the position of a track's language among Languages,
+// or -1 when it is not one of them
+func (o *AudioOptions) preference(s ProbeStream) int {
+	for i, lang := range o.Languages {
+		if strings.EqualFold(lang, s.Language) {
+			return i
+		}
+	}
+	return -1
+}
+
+// validate checks audio options against the container they are stored in
+func (o *AudioOptions) validate(container string) error {
+	if o == nil {
+		return nil
+	}
+	for _, lang := range o.Languages {
+		if !languageCodePattern.MatchString(lang) {
+			return &ValidationError{"simple_options.audio.languages", fmt.Sprintf("%q is not an ISO 639-2 code such as eng", lang)}
+		}
+	}
+	if _, ok := audioCodecs[o.codec()]; !ok && o.codec() != "copy" {
+		return &ValidationError{"simple_options.audio.codec", "must be one of opus, aac, eac3, copy"}
+	}
+	switch {
+	case o.DownmixCodec != "" && !o.StereoDownmix:
+		return &ValidationError{"simple_options.audio.downmix_codec", "only applies when stereo_downmix is set"}
+	case o.DownmixCodec != "":
+		if _, ok := audioCodecs[o.downmixCodec()]; !ok {
+			return &ValidationError{"simple_options.audio.downmix_codec", "must be one of opus, aac, eac3"}
+		}
+	}
+
+	switch strings.ToLower(o.Channels) {
+	case "", "preserve":
+	case "stereo":
+		if o.codec() == "copy" {
+			return &ValidationError{"simple_options.audio.channels", "cannot be stereo when codec is copy"}
+		}
+		if o.StereoDownmix {
+			return &ValidationError{"simple_options.audio.stereo_downmix", "cannot be combined with channels stereo"}
+		}
+	default:
+		return &ValidationError{"simple_options.audio.channels", "must be preserve or stereo"}
+	}
+
+	// WebM holds Opus and Vorbis only
+	if container == "webm" {
+		if c := o.codec(); c == "aac" || c == "eac3" {
+			return &ValidationError{"simple_options.audio.codec", fmt.Sprintf("%s cannot be stored in webm; use opus", c)}
+		}
+		if c := o.downmixCodec(); o.StereoDownmix && c != "opus" {
+			return &ValidationError{"simple_options.audio.downmix_codec", fmt.Sprintf("%s cannot be stored in webm; use opus", c)}
+		}
+	}
+	return nil
+}
+
+// audioOptions returns the job's audio options, or nil when it leaves
+// audio to ffmpeg and audio_quality
+func (j *Job) audioOptions() *AudioOptions {
+	if j.SimpleOptions == nil || j.ABR != nil {
+		return nil
+	}
+	return j.SimpleOptions.Audio
+}
+
+// audioTracks returns the probed input's audio tracks a job keeps, most
+// preferred language first. Commentary is left out unless it is kept. So
+// that the output is never silent, the first track that is not commentary
+// is kept when no track is in the preferred languages.
+func (j *Job) audioTracks() []audioTrack {
+	o := j.audioOptions()
+	streams := j.probe.StreamsOf("audio")
+
+	var tracks []audioTrack
+	for n, s := range streams {
+		if (o.KeepCommentary || !s.commentary()) && (len(o.Languages) == 0 || o.preference(s) >= 0) {
+			tracks = append(tracks, audioTrack{stream: s, n: n})
+		}
+	}
+	sort.SliceStable(tracks, func(a, b int) bool {
+		return o.preference(tracks[a].stream) < o.preference(tracks[b].stream)
+	})
+
+	if len(tracks) == 0 && len(streams) > 0 {
+		fallback := audioTrack{stream: streams[0]}
+		for n, s := range streams {
+			if !s.commentary() {
+				fallback = audioTrack{stream: s, n: n}
+				break
+			}
+		}
+		tracks = append(tracks, fallback)
+	}
+	return tracks
+}
+
+// audioBitrate is the bitrate of a track with the given channels, scaled
+// from the stereo bitrate of the job's audio_quality
+func (j *Job) audioBitrate(codec audioCodec, channels int) string {
+	tier := 1
+	switch strings.ToLower(j.SimpleOptions.AudioQuality) {
+	case "low":
+		tier = 0
+	case "high":
+		tier = 2
+	}
+	return fmt.Sprintf("%dk", codec.stereoKbps[tier]*channels/2)
+}
+
+// encodeTrack describes the output stream that encodes a track with codec,
+// downmixed to at most channels
+func (j *Job) encodeTrack(t audioTrack, codec string, channels int) audioOutput {
+	a := audioOutput{track: t.n, codec: codec}
+	if codec == "copy" {
+		return a
+	}
+	c := audioCodecs[codec]
+	target := min(t.channels(), channels, c.maxChannels)
+	a.bitrate = j.audioBitrate(c, target)
+	// libopus only takes surround in the Vorbis channel order
+	if target != t.channels() || (codec == "opus" && target > 2) {
+		a.layout = channelLayouts[target]
+	}
+	return a
+}
+
+// audioOutputs describe the audio streams a transcode writes: the tracks
+// its audio options keep, each followed by its stereo downmix, or the
+// track ffmpeg picks when the input is not probed. Jobs without audio
+// options write the track ffmpeg picks, encoded by output_arguments, and
+// describe it only when it is normalised.
+func (j *Job) audioOutputs() []audioOutput {
+	o := j.audioOptions()
+	if o == nil {
+		if j.loudnessOptions() != nil && (j.probe == nil || len(j.probe.StreamsOf("audio")) > 0) {
+			return []audioOutput{{track: -1}}
+		}
+		return nil
+	}
+	channels := 8
+	if o.stereo() {
+		channels = 2
+	}
+
+	if j.probe == nil {
+		// The layout is unknown, so bitrates are those of stereo
+		a := j.encodeTrack(audioTrack{}, o.codec(), channels)
+		a.track = -1
+		if o.stereo() {
+			a.layout = "stereo"
+		}
+		return []audioOutput{a}
+	}
+
+	var outputs []audioOutput
+	for i, t := range j.audioTracks() {
+		a := j.encodeTrack(t, o.codec(), channels)
+		switch {
+		case i == 0:
+			a.disposition = "default"
+		case t.stream.commentary():
+			a.disposition = "comment"
+		default:
+			a.disposition = "0"
+		}
+		outputs = append(outputs, a)
+
+		if o.StereoDownmix && t.channels() > 2 {
+			downmix := j.encodeTrack(t, o.downmixCodec(), 2)
+			downmix.title, downmix.disposition = "Stereo", "0"
+			outputs = append(outputs, downmix)
+		}
+	}
+	return outputs
+}
+
+// audioArgs map the audio streams a transcode writes and encode each, and
+// report whether they mapped any
+func (j *Job) audioArgs() ([]string, bool) {
+	var args []string
+	mapped := false
+	measured := 0
+	for out, a := range j.audioOutputs() {
+		// Options for the track ffmpeg picks apply to every audio stream
+		spec := fmt.Sprintf(":a:%d", out)
+		if a.track < 0 {
+			spec = ":a"
+		} else {
+			args = append(args, "-map", fmt.Sprintf("0:a:%d", a.track))
+			mapped = true
+		}
+
+		if a.codec != "" {
+			encoder := a.codec
+			if c, ok := audioCodecs[a.codec]; ok {
+				encoder = c.encoder
+			}
+			args = append(args, "-c"+spec, encoder)
+		}
+		if a.bitrate != "" {
+			args = append(args, "-b"+spec, a.bitrate)
+		}
+		if a.filtered() {
+			if filter := j.audioFilter(a, measured, false); filter != "" {
+				args = append(args, "-filter"+spec, filter)
+			}
+			measured++
+		}
+		if a.title != "" {
+			args = append(args, "-metadata:s"+spec, "title="+a.title)
+		}
+		if a.disposition != "" {
+			args = append(args, "-disposition"+spec, a.disposition)
+		}
+	}
+	return args, mapped
+}
+
+// audioFilter returns the filter chain of an output audio stream: its
+// layout conversion, then loudness normalisation when the job asks for it.
+// m is the stream's position among the filtered streams, whose loudness
+// the analysis pass measures in order.
+func (j *Job) audioFilter(a audioOutput, m int, analysis bool) string {
+	var filters []string
+	if a.layout != "" {
+		filters = append(filters, "aformat=channel_layouts="+a.layout)
+	}
+	if l := j.loudnessOptions(); l != nil {
+		if filter := j.loudnormFilter(l, m, analysis); filter != "" {
+			filters = append(filters, filter)
+		}
+	}
+	return strings.Join(filters, ",")
+}
+
+// audioWarnings report audio a job asked for that the probed input lacks
+func (j *Job) audioWarnings() []string {
+	o := j.audioOptions()
+	if o == nil || j.probe == nil || len(o.Languages) == 0 {
+		return nil
+	}
+	tracks := j.audioTracks()
+	if len(tracks) == 1 && o.preference(tracks[0].stream) < 0 {
+		return []string{fmt.Sprintf("no audio track is in the preferred languages; audio track %d (%s) is kept instead",
+			tracks[0].n, orUndetermined(tracks[0].stream.Language))}
+	}
+	return nil
+}
+
+// orUndetermined returns a language tag, or und for untagged streams
+func orUndetermined(lang string) string {
+	if lang == "" {
+		return "und"
+	}
+	return lang
+}
+
+// streamArgs choose the streams of a transcode with audio or subtitle
+// options and set how each is stored or drawn. Once any stream is mapped
+// ffmpeg no longer picks one of each kind, so the video and every audio
+// and subtitle track kept are mapped here together. They are built with
+// the command rather than kept in output_arguments, whose string form
+// cannot carry the input path a burn filter names.
+func (j *Job) streamArgs() []string {
+	args, video := j.burnArgs()
+	audio, audioMapped := j.audioArgs()
+	subtitles := j.subtitleMaps()
+
+	if video != "" || audioMapped || subtitles != nil {
+		if video == "" {
+			video = "0:V:0?"
+		}
+		args = append(args, "-map", video)
+		if !audioMapped {
+			args = append(args, "-map", "0:a?")
+		}
+	}
+	args = append(args, audio...)
+	args = append(args, subtitles...)
+	if j.dropsSubtitles() {
+		args = append(args, "-sn")
+	}
+	return args
+}
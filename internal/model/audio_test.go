@@ -0,0 +1,174 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var audioProbe = &ProbeResult{Streams: []ProbeStream{
+	{Index: 0, CodecType: "video", CodecName: "h264", Height: 1080},
+	{Index: 1, CodecType: "audio", CodecName: "dts", Channels: 6, Language: "eng"},
+	{Index: 2, CodecType: "audio", CodecName: "aac", Channels: 2, Language: "eng", Title: "Director's Commentary"},
+	{Index: 3, CodecType: "audio", CodecName: "ac3", Channels: 2, Language: "fre"},
+	{Index: 4, CodecType: "audio", CodecName: "truehd", Channels: 8, Language: "ger"},
+}}
+
+func audioJob(output string, audio AudioOptions, probe *ProbeResult) Job {
+	job := Job{
+		InputFilePath:  "/media/in.mkv",
+		OutputFilePath: output,
+		SimpleOptions:  &SimpleOptions{QualityPreset: PresetFast, VideoCodec: VideoCodecH264, Audio: &audio},
+	}
+	job.convertSimpleOptionsToArguments()
+	job.ApplyProbe(probe)
+	return job
+}
+
+func TestAudioStreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		job      Job
+		want     []string
+		warnings []string
+	}{
+		{
+			name: "Preferred languages in order without commentary",
+			job:  audioJob("/out/movie.mkv", AudioOptions{Languages: []string{"fre", "eng"}}, audioProbe),
+			want: []string{"-map", "0:V:0?",
+				"-map", "0:a:2", "-c:a:0", "libopus", "-b:a:0", "128k", "-disposition:a:0", "default",
+				"-map", "0:a:0", "-c:a:1", "libopus", "-b:a:1", "384k", "-filter:a:1", "aformat=channel_layouts=5.1", "-disposition:a:1", "0"},
+		},
+		{
+			name: "Commentary and a stereo downmix",
+			job: audioJob("/out/movie.mp4", AudioOptions{Languages: []string{"eng"}, KeepCommentary: true, Codec: "copy", StereoDownmix: true},
+				audioProbe),
+			want: []string{"-map", "0:V:0?",
+				"-map", "0:a:0", "-c:a:0", "copy", "-disposition:a:0", "default",
+				"-map", "0:a:0", "-c:a:1", "aac", "-b:a:1", "160k", "-filter:a:1", "aformat=channel_layouts=stereo", "-metadata:s:a:1", "title=Stereo", "-disposition:a:1", "0",
+				"-map", "0:a:1", "-c:a:2", "copy", "-disposition:a:2", "comment"},
+		},
+		{
+			name: "E-AC-3 takes at most 5.1",
+			job:  audioJob("/out/movie.mp4", AudioOptions{Languages: []string{"ger"}, Codec: "eac3"}, audioProbe),
+			want: []string{"-map", "0:V:0?",
+				"-map", "0:a:3", "-c:a:0", "eac3", "-b:a:0", "576k", "-filter:a:0", "aformat=channel_layouts=5.1", "-disposition:a:0", "default"},
+		},
+		{
+			name: "Stereo downmixes every track",
+			job:  audioJob("/out/movie.mkv", AudioOptions{Languages: []string{"eng"}, Codec: "aac", Channels: "stereo"}, audioProbe),
+			want: []string{"-map", "0:V:0?",
+				"-map", "0:a:0", "-c:a:0", "aac", "-b:a:0", "160k", "-filter:a:0", "aformat=channel_layouts=stereo", "-disposition:a:0", "default"},
+		},
+		{
+			name: "No preferred language keeps the first track",
+			job:  audioJob("/out/movie.mkv", AudioOptions{Languages: []string{"jpn"}, Channels: "stereo"}, audioProbe),
+			want: []string{"-map", "0:V:0?",
+				"-map", "0:a:0", "-c:a:0", "libopus", "-b:a:0", "128k", "-filter:a:0", "aformat=channel_layouts=stereo", "-disposition:a:0", "default"},
+			warnings: []string{"no audio track is in the preferred languages; audio track 0 (eng) is kept instead"},
+		},
+		{
+			name: "Without a probe the codec applies to ffmpeg's pick",
+			job:  audioJob("/out/movie.mkv", AudioOptions{Codec: "aac", Channels: "stereo"}, nil),
+			want: []string{"-c:a", "aac", "-b:a", "160k", "-filter:a", "aformat=channel_layouts=stereo"},
+		},
+		{
+			name: "Subtitles are kept alongside",
+			job: audioJob("/out/movie.mp4", AudioOptions{Languages: []string{"fre"}}, &ProbeResult{Streams: []ProbeStream{
+				{CodecType: "video", CodecName: "h264"},
+				{CodecType: "audio", CodecName: "aac", Channels: 1, Language: "fre"},
+				{CodecType: "subtitle", CodecName: "subrip", Language: "fre"},
+			}}),
+			want: []string{"-map", "0:V:0?",
+				"-map", "0:a:0", "-c:a:0", "libopus", "-b:a:0", "64k", "-disposition:a:0", "default",
+				"-map", "0:s:0", "-c:s:0", "mov_text"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.job.streamArgs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("streamArgs() =\n%v\nwant\n%v", got, tt.want)
+			}
+			if got := tt.job.StreamWarnings(); !reflect.DeepEqual(got, tt.warnings) {
+				t.Errorf("StreamWarnings() = %q, want %q", got, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestAudioOptionsReplaceAudioQuality(t *testing.T) {
+	job := audioJob("/out/movie.mkv", AudioOptions{}, audioProbe)
+	job.SimpleOptions.AudioQuality = "high"
+	job.convertSimpleOptionsToArguments()
+
+	if strings.Contains(job.OutputArguments, "-c:a") {
+		t.Errorf("OutputArguments = %q, want the audio encoded per track", job.OutputArguments)
+	}
+	cmd := strings.Join(job.GetFFmpegCommand(), " ")
+	if !strings.Contains(cmd, "-map 0:a:0 -c:a:0 libopus -b:a:0 768k") || !strings.Contains(cmd, "-map 0:a:3 -c:a:2 libopus -b:a:2 1024k") {
+		t.Errorf("GetFFmpegCommand() = %s, want bitrates scaled from 256k stereo", cmd)
+	}
+}
+
+func TestValidateAudio(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		audio  AudioOptions
+		field  string
+	}{
+		{"Defaults", "out.mkv", AudioOptions{}, ""},
+		{"Downmix", "out.mp4", AudioOptions{Codec: "eac3", StereoDownmix: true, DownmixCodec: "aac"}, ""},
+		{"Unknown codec", "out.mkv", AudioOptions{Codec: "mp3"}, "simple_options.audio.codec"},
+		{"Two-letter language", "out.mkv", AudioOptions{Languages: []string{"de"}}, "simple_options.audio.languages"},
+		{"Downmix codec without downmix", "out.mkv", AudioOptions{DownmixCodec: "aac"}, "simple_options.audio.downmix_codec"},
+		{"Copied downmix", "out.mkv", AudioOptions{StereoDownmix: true, DownmixCodec: "copy"}, "simple_options.audio.downmix_codec"},
+		{"Unknown layout", "out.mkv", AudioOptions{Channels: "mono"}, "simple_options.audio.channels"},
+		{"Copied stereo", "out.mkv", AudioOptions{Codec: "copy", Channels: "stereo"}, "simple_options.audio.channels"},
+		{"Stereo with downmix", "out.mkv", AudioOptions{Channels: "stereo", StereoDownmix: true}, "simple_options.audio.stereo_downmix"},
+		{"AAC in WebM", "out.webm", AudioOptions{Codec: "aac"}, "simple_options.audio.codec"},
+		{"Copied audio downmixed to AAC in WebM", "out.webm", AudioOptions{Codec: "copy", StereoDownmix: true}, "simple_options.audio.downmix_codec"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := Job{InputFilePath: "in.mkv", OutputFilePath: tt.output, SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecVP9, Audio: &tt.audio}}
+			err := job.Validate()
+			var field string
+			if v, ok := err.(*ValidationError); ok {
+				field = v.Field
+			} else if err != nil {
+				t.Fatalf("Validate() = %v, want a ValidationError", err)
+			}
+			if field != tt.field {
+				t.Errorf("Validate() = %v, want an error on %q", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestAudioFlags(t *testing.T) {
+	var job Job
+	body := `{"simple_options":{"audio":{"keep_commentary":"yes","stereo_downmix":"0","codec":"aac"}}}`
+	if err := json.Unmarshal([]byte(body), &job); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	want := AudioOptions{KeepCommentary: true, Codec: "aac"}
+	if got := *job.SimpleOptions.Audio; !reflect.DeepEqual(got, want) {
+		t.Errorf("json.Unmarshal() audio = %+v, want %+v", got, want)
+	}
+
+	for body, field := range map[string]string{
+		`{"simple_options":{"audio":{"keep_commentary":"maybe"}}}`: "simple_options.audio.keep_commentary",
+		`{"simple_options":{"audio":{"stereo_downmix":2}}}`:        "simple_options.audio.stereo_downmix",
+	} {
+		var job Job
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal([]byte(body), &job); !errors.As(err, &typeErr) || typeErr.Field != field {
+			t.Errorf("json.Unmarshal(%s) error = %v, want a type error for %s", body, err, field)
+		}
+	}
+}
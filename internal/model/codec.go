@@ -0,0 +1,333 @@
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// VideoCodec selects the video format a simple job produces
+type VideoCodec string
+
+const (
+	// VideoCodecH264 plays almost everywhere, including older devices
+	VideoCodecH264 VideoCodec = "h264"
+	// VideoCodecHEVC halves H.264's bitrate at similar quality
+	VideoCodecHEVC VideoCodec = "hevc"
+	// VideoCodecAV1 compresses best but needs recent decoders
+	VideoCodecAV1 VideoCodec = "av1"
+	// VideoCodecVP9 is the royalty-free choice for WebM
+	VideoCodecVP9 VideoCodec = "vp9"
+	// VideoCodecCopy remuxes the input's video without re-encoding it
+	VideoCodecCopy VideoCodec = "copy"
+)
+
+// DefaultVideoCodec is the codec used when none is specified
+const DefaultVideoCodec = VideoCodecAV1
+
+// IsValidVideoCodec checks if the given codec is known
+func IsValidVideoCodec(codec VideoCodec) bool {
+	switch codec {
+	case VideoCodecH264, VideoCodecHEVC, VideoCodecAV1, VideoCodecVP9, VideoCodecCopy:
+		return true
+	default:
+		return false
+	}
+}
+
+// AV1Encoder selects the software encoder for AV1
+type AV1Encoder string
+
+const (
+	// AV1EncoderAOM is the reference encoder: efficient but very slow
+	AV1EncoderAOM AV1Encoder = "libaom-av1"
+	// AV1EncoderSVT is several times faster on CPU-only hosts at similar
+	// quality, and supports film grain synthesis
+	AV1EncoderSVT AV1Encoder = "libsvtav1"
+)
+
+// DefaultAV1Encoder is used when neither the job nor the worker picks one
+const DefaultAV1Encoder = AV1EncoderAOM
+
+// IsValidAV1Encoder checks if the given encoder is known
+func IsValidAV1Encoder(encoder AV1Encoder) bool {
+	return encoder == AV1EncoderAOM || encoder == AV1EncoderSVT
+}
+
+// SVT-AV1 tune values, passed to the encoder as tune=0, 1 or 2
+const (
+	TuneVisualQuality = "vq"
+	TunePSNR          = "psnr"
+	TuneSSIM          = "ssim"
+)
+
+// maxFilmGrain is the strongest film grain synthesis SVT-AV1 supports
+const maxFilmGrain = 50
+
+// svtAV1Args maps each preset to SVT-AV1 preset and CRF values. Lower SVT
+// presets are slower and better.
+var svtAV1Args = map[QualityPreset]string{
+	PresetUltraFast: "-c:v libsvtav1 -preset 12 -crf 35",
+	PresetFast:      "-c:v libsvtav1 -preset 10 -crf 32",
+	PresetBalanced:  "-c:v libsvtav1 -preset 8 -crf 30",
+	PresetQuality:   "-c:v libsvtav1 -preset 6 -crf 28",
+	PresetSlow:      "-c:v libsvtav1 -preset 4 -crf 26",
+	PresetUltraSlow: "-c:v libsvtav1 -preset 2 -crf 22",
+}
+
+// GetSVTAV1Args returns SVT-AV1 arguments for a preset. filmGrain (0-50)
+// enables film grain synthesis, which keeps grainy sources from costing bits
+// or turning to smear; tune is one of the Tune constants or empty for the
+// encoder's default.
+func GetSVTAV1Args(preset QualityPreset, filmGrain int, tune string) string {
+	if !IsValidQualityPreset(preset) {
+		preset = DefaultQualityPreset
+	}
+	args := svtAV1Args[preset]
+
+	var params []string
+	switch tune {
+	case TuneVisualQuality:
+		params = append(params, "tune=0")
+	case TunePSNR:
+		params = append(params, "tune=1")
+	case TuneSSIM:
+		params = append(params, "tune=2")
+	}
+	if filmGrain > 0 {
+		// The encoder's own denoising would undo the grain it then resynthesises
+		params = append(params, fmt.Sprintf("film-grain=%d", min(filmGrain, maxFilmGrain)), "film-grain-denoise=0")
+	}
+	if len(params) > 0 {
+		args += " -svtav1-params " + strings.Join(params, ":")
+	}
+	return args
+}
+
+// softwareVideoArgs maps each codec and preset to software encoder arguments
+var softwareVideoArgs = map[VideoCodec]map[QualityPreset]string{
+	VideoCodecH264: {
+		PresetUltraFast: "-c:v libx264 -preset ultrafast -crf 28",
+		PresetFast:      "-c:v libx264 -preset veryfast -crf 24",
+		PresetBalanced:  "-c:v libx264 -preset medium -crf 23",
+		PresetQuality:   "-c:v libx264 -preset slow -crf 20",
+		PresetSlow:      "-c:v libx264 -preset slower -crf 19",
+		PresetUltraSlow: "-c:v libx264 -preset veryslow -crf 18",
+	},
+	VideoCodecHEVC: {
+		PresetUltraFast: "-c:v libx265 -preset ultrafast -crf 32",
+		PresetFast:      "-c:v libx265 -preset veryfast -crf 30",
+		PresetBalanced:  "-c:v libx265 -preset medium -crf 28",
+		PresetQuality:   "-c:v libx265 -preset slow -crf 24",
+		PresetSlow:      "-c:v libx265 -preset slower -crf 22",
+		PresetUltraSlow: "-c:v libx265 -preset veryslow -crf 20",
+	},
+	VideoCodecAV1: {
+		PresetUltraFast: "-c:v libaom-av1 -crf 30 -b:v 0 -cpu-used 8 -row-mt 1",
+		PresetFast:      "-c:v libaom-av1 -crf 30 -b:v 0 -cpu-used 6 -row-mt 1",
+		PresetBalanced:  "-c:v libaom-av1 -crf 30 -b:v 0 -cpu-used 4 -row-mt 1",
+		PresetQuality:   "-c:v libaom-av1 -crf 28 -b:v 0 -cpu-used 2 -row-mt 1",
+		PresetSlow:      "-c:v libaom-av1 -crf 25 -b:v 0 -cpu-used 1 -row-mt 1",
+		PresetUltraSlow: "-c:v libaom-av1 -crf 20 -b:v 0 -cpu-used 0 -row-mt 1 -tiles 2x2",
+	},
+	VideoCodecVP9: {
+		PresetUltraFast: "-c:v libvpx-vp9 -crf 36 -b:v 0 -deadline realtime -cpu-used 8 -row-mt 1",
+		PresetFast:      "-c:v libvpx-vp9 -crf 34 -b:v 0 -deadline good -cpu-used 5 -row-mt 1",
+		PresetBalanced:  "-c:v libvpx-vp9 -crf 32 -b:v 0 -deadline good -cpu-used 2 -row-mt 1",
+		PresetQuality:   "-c:v libvpx-vp9 -crf 30 -b:v 0 -deadline good -cpu-used 1 -row-mt 1",
+		PresetSlow:      "-c:v libvpx-vp9 -crf 28 -b:v 0 -deadline good -cpu-used 0 -row-mt 1",
+		PresetUltraSlow: "-c:v libvpx-vp9 -crf 24 -b:v 0 -deadline best -cpu-used 0 -row-mt 1",
+	},
+}
+
+// GetVideoCodecArgs returns FFmpeg video arguments for a codec and quality
+// preset, using the default hardware backend when useHardwareAccel is set.
+// Invalid codecs and presets fall back to the defaults; copy ignores both the
+// preset and hardware acceleration.
+func GetVideoCodecArgs(codec VideoCodec, preset QualityPreset, useHardwareAccel bool) string {
+	if codec == VideoCodecCopy {
+		return "-c:v copy"
+	}
+	if !IsValidVideoCodec(codec) {
+		codec = DefaultVideoCodec
+	}
+	if !IsValidQualityPreset(preset) {
+		preset = DefaultQualityPreset
+	}
+
+	if useHardwareAccel {
+		return backends[DefaultHardwareBackend].Encoders[codec][preset]
+	}
+	return softwareVideoArgs[codec][preset]
+}
+
+// containerVideoCodecs lists the codecs each known output container can
+// hold. Containers not listed are left to ffmpeg.
+var containerVideoCodecs = map[string][]VideoCodec{
+	"mp4":      {VideoCodecH264, VideoCodecHEVC, VideoCodecAV1, VideoCodecVP9},
+	"m4v":      {VideoCodecH264, VideoCodecHEVC},
+	"mov":      {VideoCodecH264, VideoCodecHEVC},
+	"mkv":      {VideoCodecH264, VideoCodecHEVC, VideoCodecAV1, VideoCodecVP9},
+	"matroska": {VideoCodecH264, VideoCodecHEVC, VideoCodecAV1, VideoCodecVP9},
+	"webm":     {VideoCodecAV1, VideoCodecVP9},
+	"ts":       {VideoCodecH264, VideoCodecHEVC},
+	"mpegts":   {VideoCodecH264, VideoCodecHEVC},
+	"flv":      {VideoCodecH264},
+}
+
+// EncoderDefaults are worker settings for simple jobs that leave them unset
+type EncoderDefaults struct {
+	AV1Encoder AV1Encoder
+
+	// HardwareBackend and HardwareDevice describe the worker's hardware for
+	// jobs that ask for acceleration; HardwareDevice overrides the backend's
+	// default -init_hw_device value
+	HardwareBackend HardwareBackend
+	HardwareDevice  string
+}
+
+// ApplyDefaults fills in encoder settings the job's simple options leave
+// unset, selects the worker's hardware backend and regenerates the arguments
+// derived from them. Arguments the submitter wrote by hand are left alone.
+func (j *Job) ApplyDefaults(defaults EncoderDefaults) {
+	opts := j.SimpleOptions
+	if opts == nil || !j.argumentsDerived() {
+		return
+	}
+
+	if opts.AV1Encoder == "" {
+		opts.AV1Encoder = defaults.AV1Encoder
+	}
+	// Only the worker knows which hardware it has. Its device goes with its
+	// backend, since one the submitter named may belong to other hardware.
+	if defaults.HardwareBackend != "" {
+		j.HardwareBackend = defaults.HardwareBackend
+		j.HardwareDevice = defaults.HardwareDevice
+	}
+	if _, ok := j.hardwareBackend(); !ok {
+		j.HardwareDevice = ""
+	}
+	j.convertSimpleOptionsToArguments()
+}
+
+// argumentsDerived reports whether the job's arguments are the ones its
+// simple options generate, rather than written by hand
+func (j *Job) argumentsDerived() bool {
+	if j.SimpleOptions == nil {
+		return false
+	}
+	derived := *j
+	derived.convertSimpleOptionsToArguments()
+	return derived.GlobalArguments == j.GlobalArguments && derived.InputArguments == j.InputArguments &&
+		derived.OutputArguments == j.OutputArguments
+}
+
+// appleContainers need HEVC tagged as hvc1 for QuickTime and iOS to play it
+var appleContainers = map[string]bool{"mp4": true, "m4v": true, "mov": true}
+
+// OutputContainer returns the container the output is written in:
+// OutputContainerType when set, otherwise the output file's extension
+func (j *Job) OutputContainer() string {
+	if j.OutputContainerType != "" {
+		return strings.ToLower(j.OutputContainerType)
+	}
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(j.OutputFilePath), "."))
+}
+
+// ValidationError reports a job field whose value cannot work
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Validate checks that a job's requirements name real codecs, that its type
+// and the options for it make sense, that its ladder can be packaged, and
+// that its simple options can produce a working command: the codec is
+// known, the output container can hold it, and copied video is not scaled.
+// Advanced arguments are passed to ffmpeg as given.
+func (j *Job) Validate() error {
+	if req := j.Requirements; req != nil {
+		for _, codec := range req.HardwareEncode {
+			if codec == VideoCodecCopy || !IsValidVideoCodec(codec) {
+				return &ValidationError{"requirements.hardware_encode", fmt.Sprintf("%q is not a codec that can be encoded", codec)}
+			}
+		}
+	}
+	return j.validateType()
+}
+
+// validateTranscode checks a transcode's ladder or simple options
+func (j *Job) validateTranscode() error {
+	if j.ABR != nil {
+		return j.validateABR()
+	}
+
+	opts := j.SimpleOptions
+	if opts == nil {
+		return nil
+	}
+	if opts.VideoCodec != "" && !IsValidVideoCodec(opts.VideoCodec) {
+		return &ValidationError{"simple_options.video_codec", fmt.Sprintf("%q is not a known codec", opts.VideoCodec)}
+	}
+
+	if opts.AV1Encoder != "" && !IsValidAV1Encoder(opts.AV1Encoder) {
+		return &ValidationError{"simple_options.av1_encoder", fmt.Sprintf("%q is not a known AV1 encoder", opts.AV1Encoder)}
+	}
+	if opts.FilmGrain < 0 || opts.FilmGrain > maxFilmGrain {
+		return &ValidationError{"simple_options.film_grain", fmt.Sprintf("must be between 0 and %d", maxFilmGrain)}
+	}
+	switch opts.Tune {
+	case "", TuneVisualQuality, TunePSNR, TuneSSIM:
+	default:
+		return &ValidationError{"simple_options.tune", fmt.Sprintf("must be one of %s, %s, %s", TuneVisualQuality, TunePSNR, TuneSSIM)}
+	}
+	if err := opts.Subtitles.validate(opts); err != nil {
+		return err
+	}
+	if err := opts.Audio.validate(j.OutputContainer()); err != nil {
+		return err
+	}
+	if err := opts.Loudness.validate(opts); err != nil {
+		return err
+	}
+
+	codec := opts.codec()
+	if codec == VideoCodecCopy {
+		if opts.scales() {
+			return &ValidationError{"simple_options.resolution", "cannot be changed when video_codec is copy"}
+		}
+		return nil
+	}
+
+	container := j.OutputContainer()
+	allowed, known := containerVideoCodecs[container]
+	if !known {
+		return nil
+	}
+	names := make([]string, len(allowed))
+	for i, c := range allowed {
+		if c == codec {
+			return nil
+		}
+		names[i] = string(c)
+	}
+	return &ValidationError{"simple_options.video_codec",
+		fmt.Sprintf("%s cannot be stored in %s; use one of %s", codec, container, strings.Join(names, ", "))}
+}
+
+// codec returns the selected video codec, or the default
+func (o *SimpleOptions) codec() VideoCodec {
+	if o.VideoCodec == "" {
+		return DefaultVideoCodec
+	}
+	return o.VideoCodec
+}
+
+// scales reports whether the options resize the video
+func (o *SimpleOptions) scales() bool {
+	return !o.KeepOriginalResolution && o.Resolution != "" && !strings.EqualFold(o.Resolution, "original")
+}
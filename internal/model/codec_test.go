@@ -0,0 +1,209 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGetVideoCodecArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		codec   VideoCodec
+		preset  QualityPreset
+		hwAccel bool
+		want    string
+	}{
+		{"H.264 balanced", VideoCodecH264, PresetBalanced, false, "-c:v libx264 -preset medium -crf 23"},
+		{"H.264 ultrafast", VideoCodecH264, PresetUltraFast, false, "-c:v libx264 -preset ultrafast -crf 28"},
+		{"H.264 hardware", VideoCodecH264, PresetQuality, true, "-c:v h264_qsv -preset slow -global_quality 21"},
+		{"HEVC slow", VideoCodecHEVC, PresetSlow, false, "-c:v libx265 -preset slower -crf 22"},
+		{"HEVC hardware", VideoCodecHEVC, PresetFast, true, "-c:v hevc_qsv -preset faster -global_quality 27"},
+		{"AV1 matches the preset args", VideoCodecAV1, PresetQuality, false, GetFFmpegPresetArgs(PresetQuality, false)},
+		{"VP9 ultraslow", VideoCodecVP9, PresetUltraSlow, false, "-c:v libvpx-vp9 -crf 24 -b:v 0 -deadline best -cpu-used 0 -row-mt 1"},
+		{"VP9 hardware", VideoCodecVP9, PresetBalanced, true, "-c:v vp9_qsv -preset medium -global_quality 32"},
+		{"Copy ignores preset and hardware", VideoCodecCopy, PresetSlow, true, "-c:v copy"},
+		{"Unknown codec falls back to AV1", "mpeg2", PresetBalanced, false, GetFFmpegPresetArgs(PresetBalanced, false)},
+		{"Unknown preset falls back to balanced", VideoCodecH264, "insane", false, "-c:v libx264 -preset medium -crf 23"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetVideoCodecArgs(tt.codec, tt.preset, tt.hwAccel); got != tt.want {
+				t.Errorf("GetVideoCodecArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEveryCodecHasEveryPreset(t *testing.T) {
+	presets := []QualityPreset{PresetUltraFast, PresetFast, PresetBalanced, PresetQuality, PresetSlow, PresetUltraSlow}
+	for _, codec := range []VideoCodec{VideoCodecH264, VideoCodecHEVC, VideoCodecAV1, VideoCodecVP9} {
+		for _, preset := range presets {
+			for _, hw := range []bool{false, true} {
+				if args := GetVideoCodecArgs(codec, preset, hw); !strings.HasPrefix(args, "-c:v ") {
+					t.Errorf("GetVideoCodecArgs(%s, %s, %v) = %q", codec, preset, hw, args)
+				}
+			}
+		}
+	}
+}
+
+func TestSimpleOptionsVideoCodec(t *testing.T) {
+	tests := []struct {
+		name       string
+		job        Job
+		wantOutput string
+	}{
+		{
+			name:       "HEVC in MP4 is tagged for Apple players",
+			job:        Job{OutputFilePath: "out.mp4", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecHEVC, QualityPreset: PresetBalanced}},
+			wantOutput: "-c:v libx265 -preset medium -crf 28 -tag:v hvc1 -c:a libopus -b:a 128k",
+		},
+		{
+			name:       "HEVC in Matroska is not tagged",
+			job:        Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecHEVC, QualityPreset: PresetBalanced}},
+			wantOutput: "-c:v libx265 -preset medium -crf 28 -c:a libopus -b:a 128k",
+		},
+		{
+			name:       "Copy skips scaling",
+			job:        Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecCopy, Resolution: "720p", QualityPreset: PresetBalanced}},
+			wantOutput: "-c:v copy -c:a libopus -b:a 128k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.job.convertSimpleOptionsToArguments()
+			if tt.job.OutputArguments != tt.wantOutput {
+				t.Errorf("OutputArguments = %q, want %q", tt.job.OutputArguments, tt.wantOutput)
+			}
+		})
+	}
+
+	copyJob := Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecCopy, UseHardwareAcceleration: true}}
+	if args := copyJob.addHardwareDeviceArgs(nil); len(args) != 0 {
+		t.Errorf("addHardwareDeviceArgs() = %v, want no device for copied video", args)
+	}
+	if got := copyJob.VideoEncoder(); got != "copy" {
+		t.Errorf("VideoEncoder() = %q, want copy", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		job       Job
+		wantField string
+	}{
+		{"Advanced job", Job{OutputFilePath: "out.flv", OutputArguments: "-c:v libaom-av1"}, ""},
+		{"Default codec in MP4", Job{OutputFilePath: "out.mp4", SimpleOptions: &SimpleOptions{}}, ""},
+		{"H.264 in MP4", Job{OutputFilePath: "out.mp4", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecH264}}, ""},
+		{"VP9 in WebM", Job{OutputFilePath: "out.webm", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecVP9}}, ""},
+		{"Unlisted container", Job{OutputFilePath: "out.nut", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecVP9}}, ""},
+		{"Copy into any container", Job{OutputFilePath: "out.webm", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecCopy}}, ""},
+		{"H.264 in WebM", Job{OutputFilePath: "out.webm", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecH264}}, "simple_options.video_codec"},
+		{"Default codec in MOV", Job{OutputFilePath: "out.mov", SimpleOptions: &SimpleOptions{}}, "simple_options.video_codec"},
+		{"Container type wins over extension", Job{OutputFilePath: "out.mkv", OutputContainerType: "FLV", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecHEVC}}, "simple_options.video_codec"},
+		{"Unknown codec", Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{VideoCodec: "mpeg2"}}, "simple_options.video_codec"},
+		{"SVT-AV1 with film grain", Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{AV1Encoder: AV1EncoderSVT, FilmGrain: 8, Tune: TuneVisualQuality}}, ""},
+		{"Unknown AV1 encoder", Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{AV1Encoder: "rav1e"}}, "simple_options.av1_encoder"},
+		{"Film grain out of range", Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{FilmGrain: 51}}, "simple_options.film_grain"},
+		{"Unknown tune", Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{Tune: "grain"}}, "simple_options.tune"},
+		{"Scaled copy", Job{OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{VideoCodec: VideoCodecCopy, Resolution: "720p"}}, "simple_options.resolution"},
+		{"Hardware requirement", Job{OutputFilePath: "out.mkv", Requirements: &JobRequirements{HardwareEncode: []VideoCodec{VideoCodecAV1}}}, ""},
+		{"Hardware copy requirement", Job{OutputFilePath: "out.mkv", Requirements: &JobRequirements{HardwareEncode: []VideoCodec{VideoCodecCopy}}}, "requirements.hardware_encode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.job.Validate()
+			var invalid *ValidationError
+			switch {
+			case tt.wantField == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantField != "" && (!errors.As(err, &invalid) || invalid.Field != tt.wantField):
+				t.Errorf("Validate() = %v, want an error for %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestGetSVTAV1Args(t *testing.T) {
+	tests := []struct {
+		name      string
+		preset    QualityPreset
+		filmGrain int
+		tune      string
+		want      string
+	}{
+		{"Ultrafast", PresetUltraFast, 0, "", "-c:v libsvtav1 -preset 12 -crf 35"},
+		{"Fast", PresetFast, 0, "", "-c:v libsvtav1 -preset 10 -crf 32"},
+		{"Balanced", PresetBalanced, 0, "", "-c:v libsvtav1 -preset 8 -crf 30"},
+		{"Quality", PresetQuality, 0, "", "-c:v libsvtav1 -preset 6 -crf 28"},
+		{"Slow", PresetSlow, 0, "", "-c:v libsvtav1 -preset 4 -crf 26"},
+		{"Ultraslow", PresetUltraSlow, 0, "", "-c:v libsvtav1 -preset 2 -crf 22"},
+		{"Invalid preset", "insane", 0, "", "-c:v libsvtav1 -preset 8 -crf 30"},
+		{"Film grain", PresetQuality, 8, "", "-c:v libsvtav1 -preset 6 -crf 28 -svtav1-params film-grain=8:film-grain-denoise=0"},
+		{"Film grain is capped", PresetQuality, 80, "", "-c:v libsvtav1 -preset 6 -crf 28 -svtav1-params film-grain=50:film-grain-denoise=0"},
+		{"Tune", PresetBalanced, 0, TuneVisualQuality, "-c:v libsvtav1 -preset 8 -crf 30 -svtav1-params tune=0"},
+		{"Tune and film grain", PresetSlow, 12, TuneSSIM, "-c:v libsvtav1 -preset 4 -crf 26 -svtav1-params tune=2:film-grain=12:film-grain-denoise=0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetSVTAV1Args(tt.preset, tt.filmGrain, tt.tune); got != tt.want {
+				t.Errorf("GetSVTAV1Args() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSVTAV1Command(t *testing.T) {
+	var job Job
+	body := `{"input_file_path":"in.mkv","output_file_path":"out.mkv",
+		"simple_options":{"av1_encoder":"libsvtav1","quality_preset":"quality","film_grain":10,"tune":"psnr"}}`
+	if err := json.Unmarshal([]byte(body), &job); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	want := []string{"-y", "-hide_banner", "-i", "in.mkv",
+		"-c:v", "libsvtav1", "-preset", "6", "-crf", "28", "-svtav1-params", "tune=1:film-grain=10:film-grain-denoise=0",
+		"-c:a", "libopus", "-b:a", "128k", "out.mkv"}
+	if got := job.GetFFmpegCommand(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFFmpegCommand() = %v, want %v", got, want)
+	}
+
+	// Hardware encoding ignores the software encoder choice
+	job.SimpleOptions.UseHardwareAcceleration = true
+	if got := job.simpleVideoArgs(); !strings.HasPrefix(got, "-c:v av1_qsv") {
+		t.Errorf("simpleVideoArgs() = %q, want av1_qsv", got)
+	}
+}
+
+func TestApplyDefaults(t *testing.T) {
+	svt := EncoderDefaults{AV1Encoder: AV1EncoderSVT}
+
+	var simple Job
+	json.Unmarshal([]byte(`{"input_file_path":"in.mkv","output_file_path":"out.mkv","simple_options":{}}`), &simple)
+	simple.ApplyDefaults(svt)
+	if simple.SimpleOptions.AV1Encoder != AV1EncoderSVT || simple.VideoEncoder() != "libsvtav1" {
+		t.Errorf("ApplyDefaults() left encoder %q, command %v", simple.SimpleOptions.AV1Encoder, simple.GetFFmpegCommand())
+	}
+
+	var chosen Job
+	json.Unmarshal([]byte(`{"input_file_path":"in.mkv","output_file_path":"out.mkv","simple_options":{"av1_encoder":"libaom-av1"}}`), &chosen)
+	chosen.ApplyDefaults(svt)
+	if chosen.VideoEncoder() != "libaom-av1" {
+		t.Errorf("ApplyDefaults() overrode the job's encoder: %v", chosen.GetFFmpegCommand())
+	}
+
+	var custom Job
+	json.Unmarshal([]byte(`{"input_file_path":"in.mkv","output_file_path":"out.mkv","simple_options":{},"output_arguments":"-c:v libaom-av1 -crf 18"}`), &custom)
+	custom.ApplyDefaults(svt)
+	if custom.OutputArguments != "-c:v libaom-av1 -crf 18" {
+		t.Errorf("ApplyDefaults() replaced hand-written arguments with %q", custom.OutputArguments)
+	}
+}
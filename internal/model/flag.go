@@ -0,0 +1,66 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// decodeFlag reads a flag-like field. Besides JSON booleans it accepts the
+// strings "true"/"false", "yes"/"no", "on"/"off" and "1"/"0" in any case:
+// older clients sent dry_run as a string, and jobs queued by older servers
+// still carry it that way. A missing field, null or an empty string is false.
+// Other values produce a type error naming field.
+func decodeFlag(field string, raw json.RawMessage) (bool, error) {
+	if len(raw) == 0 {
+		return false, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return false, err
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true", "yes", "on", "1":
+			return true, nil
+		case "false", "no", "off", "0", "":
+			return false, nil
+		}
+		return false, &json.UnmarshalTypeError{Value: "string " + string(raw), Type: reflect.TypeOf(true), Field: field}
+	case float64:
+		return false, &json.UnmarshalTypeError{Value: "number", Type: reflect.TypeOf(true), Field: field}
+	default:
+		return false, &json.UnmarshalTypeError{Value: "object", Type: reflect.TypeOf(true), Field: field}
+	}
+}
+
+// decodeObject decodes a nested object that decodes itself, so type errors
+// inside it keep their full path. A missing object or null is nil.
+func decodeObject[T any](field string, raw json.RawMessage) (*T, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	v := new(T)
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, prefixField(field, err)
+	}
+	return v, nil
+}
+
+// prefixField qualifies the field named by a type error from a nested
+// object, which encoding/json leaves unqualified when the object decodes
+// itself
+func prefixField(prefix string, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		typeErr.Field = strings.TrimSuffix(prefix+"."+typeErr.Field, ".")
+	}
+	return err
+}
@@ -0,0 +1,422 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HardwareBackend names the hardware acceleration API a worker encodes with
+type HardwareBackend string
+
+const (
+	// BackendSoftware encodes on the CPU even when a job asks for hardware
+	BackendSoftware HardwareBackend = "software"
+	// BackendVAAPI drives Intel and AMD GPUs through VA-API on Linux
+	BackendVAAPI HardwareBackend = "vaapi"
+	// BackendQSV drives Intel GPUs through Quick Sync Video
+	BackendQSV HardwareBackend = "qsv"
+	// BackendNVENC drives NVIDIA GPUs, decoding and scaling through CUDA
+	BackendNVENC HardwareBackend = "nvenc"
+	// BackendAMF drives AMD GPUs through the Advanced Media Framework
+	BackendAMF HardwareBackend = "amf"
+)
+
+// DefaultHardwareBackend is used when the worker does not configure one
+const DefaultHardwareBackend = BackendQSV
+
+// Backend describes how ffmpeg uses one hardware acceleration API: how the
+// device is opened, how frames are decoded into and moved between device
+// and system memory, how they are scaled and which encoders produce each
+// codec
+type Backend struct {
+	Name HardwareBackend
+
+	// Device is the default -init_hw_device value. The name it gives the
+	// device is also used for decoding and filtering. Empty when the
+	// encoders open the device themselves.
+	Device string
+
+	// Hwaccel and HwaccelFormat decode into device memory, so frames reach
+	// the encoder without a round trip through system memory
+	Hwaccel       string
+	HwaccelFormat string
+
+	// Upload moves frames into device memory and passes through frames that
+	// are already there, such as when the input cannot be decoded in
+	// hardware. Download moves frames back for filters that only run on the
+	// CPU. Both are empty when the encoders take frames from system memory.
+	Upload   string
+	Download string
+
+	// Scale is the device scaling filter, formatted with the width and
+	// height. Empty scales on the CPU.
+	Scale string
+
+	// Encoders maps each codec and preset to encoder arguments. Codecs the
+	// hardware cannot encode are missing.
+	Encoders map[VideoCodec]map[QualityPreset]string
+}
+
+// qsvVideoArgs maps each codec and preset to Intel Quick Sync encoder
+// arguments
+var qsvVideoArgs = map[VideoCodec]map[QualityPreset]string{
+	VideoCodecH264: {
+		PresetUltraFast: "-c:v h264_qsv -preset veryfast -global_quality 28",
+		PresetFast:      "-c:v h264_qsv -preset faster -global_quality 25",
+		PresetBalanced:  "-c:v h264_qsv -preset medium -global_quality 23",
+		PresetQuality:   "-c:v h264_qsv -preset slow -global_quality 21",
+		PresetSlow:      "-c:v h264_qsv -preset slower -global_quality 20",
+		PresetUltraSlow: "-c:v h264_qsv -preset veryslow -global_quality 18",
+	},
+	VideoCodecHEVC: {
+		PresetUltraFast: "-c:v hevc_qsv -preset veryfast -global_quality 30",
+		PresetFast:      "-c:v hevc_qsv -preset faster -global_quality 27",
+		PresetBalanced:  "-c:v hevc_qsv -preset medium -global_quality 25",
+		PresetQuality:   "-c:v hevc_qsv -preset slow -global_quality 23",
+		PresetSlow:      "-c:v hevc_qsv -preset slower -global_quality 22",
+		PresetUltraSlow: "-c:v hevc_qsv -preset veryslow -global_quality 20",
+	},
+	VideoCodecAV1: {
+		PresetUltraFast: "-c:v av1_qsv -preset veryfast -look_ahead_depth 8",
+		PresetFast:      "-c:v av1_qsv -preset faster -look_ahead_depth 16",
+		PresetBalanced:  "-c:v av1_qsv -preset slow -look_ahead_depth 30",
+		PresetQuality:   "-c:v av1_qsv -preset slow -look_ahead_depth 40",
+		PresetSlow:      "-c:v av1_qsv -preset slower -look_ahead_depth 60",
+		PresetUltraSlow: "-c:v av1_qsv -preset veryslow -look_ahead_depth 120",
+	},
+	VideoCodecVP9: {
+		PresetUltraFast: "-c:v vp9_qsv -preset veryfast -global_quality 36",
+		PresetFast:      "-c:v vp9_qsv -preset faster -global_quality 34",
+		PresetBalanced:  "-c:v vp9_qsv -preset medium -global_quality 32",
+		PresetQuality:   "-c:v vp9_qsv -preset slow -global_quality 30",
+		PresetSlow:      "-c:v vp9_qsv -preset slower -global_quality 28",
+		PresetUltraSlow: "-c:v vp9_qsv -preset veryslow -global_quality 24",
+	},
+}
+
+// vaapiVideoArgs maps each codec and preset to VA-API encoder arguments.
+// AV1 and VP9 quantisers use the 0-255 range.
+var vaapiVideoArgs = map[VideoCodec]map[QualityPreset]string{
+	VideoCodecH264: {
+		PresetUltraFast: "-c:v h264_vaapi -rc_mode CQP -qp 28 -compression_level 7",
+		PresetFast:      "-c:v h264_vaapi -rc_mode CQP -qp 25 -compression_level 6",
+		PresetBalanced:  "-c:v h264_vaapi -rc_mode CQP -qp 23 -compression_level 4",
+		PresetQuality:   "-c:v h264_vaapi -rc_mode CQP -qp 21 -compression_level 2",
+		PresetSlow:      "-c:v h264_vaapi -rc_mode CQP -qp 20 -compression_level 1",
+		PresetUltraSlow: "-c:v h264_vaapi -rc_mode CQP -qp 18 -compression_level 1",
+	},
+	VideoCodecHEVC: {
+		PresetUltraFast: "-c:v hevc_vaapi -rc_mode CQP -qp 30 -compression_level 7",
+		PresetFast:      "-c:v hevc_vaapi -rc_mode CQP -qp 27 -compression_level 6",
+		PresetBalanced:  "-c:v hevc_vaapi -rc_mode CQP -qp 25 -compression_level 4",
+		PresetQuality:   "-c:v hevc_vaapi -rc_mode CQP -qp 23 -compression_level 2",
+		PresetSlow:      "-c:v hevc_vaapi -rc_mode CQP -qp 22 -compression_level 1",
+		PresetUltraSlow: "-c:v hevc_vaapi -rc_mode CQP -qp 20 -compression_level 1",
+	},
+	VideoCodecAV1: {
+		PresetUltraFast: "-c:v av1_vaapi -rc_mode CQP -qp 160 -compression_level 7",
+		PresetFast:      "-c:v av1_vaapi -rc_mode CQP -qp 140 -compression_level 6",
+		PresetBalanced:  "-c:v av1_vaapi -rc_mode CQP -qp 120 -compression_level 4",
+		PresetQuality:   "-c:v av1_vaapi -rc_mode CQP -qp 100 -compression_level 2",
+		PresetSlow:      "-c:v av1_vaapi -rc_mode CQP -qp 90 -compression_level 1",
+		PresetUltraSlow: "-c:v av1_vaapi -rc_mode CQP -qp 80 -compression_level 1",
+	},
+	VideoCodecVP9: {
+		PresetUltraFast: "-c:v vp9_vaapi -rc_mode CQP -qp 160 -compression_level 7",
+		PresetFast:      "-c:v vp9_vaapi -rc_mode CQP -qp 140 -compression_level 6",
+		PresetBalanced:  "-c:v vp9_vaapi -rc_mode CQP -qp 120 -compression_level 4",
+		PresetQuality:   "-c:v vp9_vaapi -rc_mode CQP -qp 100 -compression_level 2",
+		PresetSlow:      "-c:v vp9_vaapi -rc_mode CQP -qp 90 -compression_level 1",
+		PresetUltraSlow: "-c:v vp9_vaapi -rc_mode CQP -qp 80 -compression_level 1",
+	},
+}
+
+// nvencVideoArgs maps each codec and preset to NVENC encoder arguments.
+// NVENC has no VP9 encoder.
+var nvencVideoArgs = map[VideoCodec]map[QualityPreset]string{
+	VideoCodecH264: {
+		PresetUltraFast: "-c:v h264_nvenc -preset p1 -tune hq -rc vbr -cq 28 -b:v 0",
+		PresetFast:      "-c:v h264_nvenc -preset p3 -tune hq -rc vbr -cq 25 -b:v 0",
+		PresetBalanced:  "-c:v h264_nvenc -preset p4 -tune hq -rc vbr -cq 23 -b:v 0",
+		PresetQuality:   "-c:v h264_nvenc -preset p5 -tune hq -rc vbr -cq 21 -b:v 0",
+		PresetSlow:      "-c:v h264_nvenc -preset p6 -tune hq -rc vbr -cq 20 -b:v 0",
+		PresetUltraSlow: "-c:v h264_nvenc -preset p7 -tune hq -rc vbr -cq 18 -b:v 0",
+	},
+	VideoCodecHEVC: {
+		PresetUltraFast: "-c:v hevc_nvenc -preset p1 -tune hq -rc vbr -cq 30 -b:v 0",
+		PresetFast:      "-c:v hevc_nvenc -preset p3 -tune hq -rc vbr -cq 27 -b:v 0",
+		PresetBalanced:  "-c:v hevc_nvenc -preset p4 -tune hq -rc vbr -cq 25 -b:v 0",
+		PresetQuality:   "-c:v hevc_nvenc -preset p5 -tune hq -rc vbr -cq 23 -b:v 0",
+		PresetSlow:      "-c:v hevc_nvenc -preset p6 -tune hq -rc vbr -cq 22 -b:v 0",
+		PresetUltraSlow: "-c:v hevc_nvenc -preset p7 -tune hq -rc vbr -cq 20 -b:v 0",
+	},
+	VideoCodecAV1: {
+		PresetUltraFast: "-c:v av1_nvenc -preset p1 -tune hq -rc vbr -cq 36 -b:v 0",
+		PresetFast:      "-c:v av1_nvenc -preset p3 -tune hq -rc vbr -cq 33 -b:v 0",
+		PresetBalanced:  "-c:v av1_nvenc -preset p4 -tune hq -rc vbr -cq 30 -b:v 0",
+		PresetQuality:   "-c:v av1_nvenc -preset p5 -tune hq -rc vbr -cq 28 -b:v 0",
+		PresetSlow:      "-c:v av1_nvenc -preset p6 -tune hq -rc vbr -cq 26 -b:v 0",
+		PresetUltraSlow: "-c:v av1_nvenc -preset p7 -tune hq -rc vbr -cq 24 -b:v 0",
+	},
+}
+
+// amfVideoArgs maps each codec and preset to AMF encoder arguments. AMF has
+// no VP9 encoder, and AV1 quantisers use the 0-255 range.
+var amfVideoArgs = map[VideoCodec]map[QualityPreset]string{
+	VideoCodecH264: {
+		PresetUltraFast: "-c:v h264_amf -quality speed -rc cqp -qp_i 28 -qp_p 28",
+		PresetFast:      "-c:v h264_amf -quality speed -rc cqp -qp_i 25 -qp_p 25",
+		PresetBalanced:  "-c:v h264_amf -quality balanced -rc cqp -qp_i 23 -qp_p 23",
+		PresetQuality:   "-c:v h264_amf -quality quality -rc cqp -qp_i 21 -qp_p 21",
+		PresetSlow:      "-c:v h264_amf -quality quality -rc cqp -qp_i 20 -qp_p 20",
+		PresetUltraSlow: "-c:v h264_amf -quality quality -rc cqp -qp_i 18 -qp_p 18",
+	},
+	VideoCodecHEVC: {
+		PresetUltraFast: "-c:v hevc_amf -quality speed -rc cqp -qp_i 30 -qp_p 30",
+		PresetFast:      "-c:v hevc_amf -quality speed -rc cqp -qp_i 27 -qp_p 27",
+		PresetBalanced:  "-c:v hevc_amf -quality balanced -rc cqp -qp_i 25 -qp_p 25",
+		PresetQuality:   "-c:v hevc_amf -quality quality -rc cqp -qp_i 23 -qp_p 23",
+		PresetSlow:      "-c:v hevc_amf -quality quality -rc cqp -qp_i 22 -qp_p 22",
+		PresetUltraSlow: "-c:v hevc_amf -quality quality -rc cqp -qp_i 20 -qp_p 20",
+	},
+	VideoCodecAV1: {
+		PresetUltraFast: "-c:v av1_amf -quality speed -rc cqp -qp_i 160 -qp_p 160",
+		PresetFast:      "-c:v av1_amf -quality speed -rc cqp -qp_i 140 -qp_p 140",
+		PresetBalanced:  "-c:v av1_amf -quality balanced -rc cqp -qp_i 120 -qp_p 120",
+		PresetQuality:   "-c:v av1_amf -quality quality -rc cqp -qp_i 100 -qp_p 100",
+		PresetSlow:      "-c:v av1_amf -quality high_quality -rc cqp -qp_i 90 -qp_p 90",
+		PresetUltraSlow: "-c:v av1_amf -quality high_quality -rc cqp -qp_i 80 -qp_p 80",
+	},
+}
+
+// backends holds every supported hardware backend by name
+var backends = map[HardwareBackend]*Backend{
+	BackendSoftware: {
+		Name:     BackendSoftware,
+		Encoders: softwareVideoArgs,
+	},
+	BackendVAAPI: {
+		Name:          BackendVAAPI,
+		Device:        "vaapi=va:/dev/dri/renderD128",
+		Hwaccel:       "vaapi",
+		HwaccelFormat: "vaapi",
+		Upload:        "format=nv12|vaapi,hwupload",
+		Download:      "hwdownload,format=nv12",
+		Scale:         "scale_vaapi=w=%s:h=%s",
+		Encoders:      vaapiVideoArgs,
+	},
+	BackendQSV: {
+		Name:          BackendQSV,
+		Device:        "qsv=qs:hw_any,child_device=/dev/dri/renderD128",
+		Hwaccel:       "qsv",
+		HwaccelFormat: "qsv",
+		Upload:        "format=nv12|qsv,hwupload=extra_hw_frames=64",
+		Download:      "hwdownload,format=nv12",
+		Scale:         "vpp_qsv=w=%s:h=%s",
+		Encoders:      qsvVideoArgs,
+	},
+	BackendNVENC: {
+		Name:          BackendNVENC,
+		Device:        "cuda=cu:0",
+		Hwaccel:       "cuda",
+		HwaccelFormat: "cuda",
+		Upload:        "hwupload_cuda",
+		Download:      "hwdownload,format=nv12",
+		Scale:         "scale_cuda=w=%s:h=%s",
+		Encoders:      nvencVideoArgs,
+	},
+	// AMF encoders upload system memory frames themselves, so decoding and
+	// scaling stay on the CPU
+	BackendAMF: {
+		Name:     BackendAMF,
+		Encoders: amfVideoArgs,
+	},
+}
+
+// IsValidHardwareBackend checks if the given backend is known
+func IsValidHardwareBackend(name HardwareBackend) bool {
+	_, ok := backends[name]
+	return ok
+}
+
+// LookupBackend returns the named backend, or the default one when name is
+// empty
+func LookupBackend(name HardwareBackend) (*Backend, bool) {
+	if name == "" {
+		name = DefaultHardwareBackend
+	}
+	b, ok := backends[name]
+	return b, ok
+}
+
+// IsSoftware reports whether the backend encodes on the CPU
+func (b *Backend) IsSoftware() bool {
+	return b.Name == BackendSoftware
+}
+
+// DeviceArgs returns the global arguments that open the device. device
+// overrides the backend's default -init_hw_device value.
+func (b *Backend) DeviceArgs(device string) []string {
+	if device == "" {
+		device = b.Device
+	}
+	if device == "" {
+		return nil
+	}
+	args := []string{"-init_hw_device", device}
+	if name := deviceName(device); name != "" {
+		args = append(args, "-filter_hw_device", name)
+	}
+	return args
+}
+
+// DecodeArgs returns the input arguments that decode on the device opened
+// by DeviceArgs(device)
+func (b *Backend) DecodeArgs(device string) []string {
+	if b.Hwaccel == "" {
+		return nil
+	}
+	if device == "" {
+		device = b.Device
+	}
+	args := []string{"-hwaccel", b.Hwaccel}
+	if name := deviceName(device); name != "" {
+		args = append(args, "-hwaccel_device", name)
+	}
+	if b.HwaccelFormat != "" {
+		args = append(args, "-hwaccel_output_format", b.HwaccelFormat)
+	}
+	return args
+}
+
+// EncoderArgs returns the encoder arguments for a codec and preset, and
+// false when the backend cannot encode the codec. Invalid presets fall back
+// to the default.
+func (b *Backend) EncoderArgs(codec VideoCodec, preset QualityPreset) (string, bool) {
+	presets, ok := b.Encoders[codec]
+	if !ok {
+		return "", false
+	}
+	if !IsValidQualityPreset(preset) {
+		preset = DefaultQualityPreset
+	}
+	return presets[preset], true
+}
+
+// Encoder returns the name of the encoder the backend uses for a codec, or
+// an empty string when it has none
+func (b *Backend) Encoder(codec VideoCodec) string {
+	args, ok := b.EncoderArgs(codec, DefaultQualityPreset)
+	if !ok {
+		return ""
+	}
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+// ScaleFilter returns the filter that scales to a "width:height" dimension.
+// A missing height keeps the aspect ratio.
+func (b *Backend) ScaleFilter(dimension string) string {
+	if b.Scale == "" {
+		return "scale=" + dimension
+	}
+	width, height, _ := strings.Cut(dimension, ":")
+	if height == "" {
+		height = "-2"
+	}
+	return fmt.Sprintf(b.Scale, width, height)
+}
+
+// VideoFilter returns the filter chain placing frames on the device for the
+// encoder, scaled to dimension unless it is empty
+func (b *Backend) VideoFilter(dimension string) string {
+	var filters []string
+	if b.Upload != "" {
+		filters = append(filters, b.Upload)
+	}
+	if dimension != "" {
+		filters = append(filters, b.ScaleFilter(dimension))
+	}
+	return strings.Join(filters, ",")
+}
+
+// CPUFilter wraps a filter that only runs on the CPU so it can sit between
+// device frames: frames are downloaded before it and uploaded again after
+func (b *Backend) CPUFilter(filter string) string {
+	if b.Download == "" {
+		return filter
+	}
+	return b.Download + "," + filter + "," + b.Upload
+}
+
+// deviceName returns the name an -init_hw_device value gives its device,
+// such as "va" for "vaapi=va:/dev/dri/renderD128"
+func deviceName(device string) string {
+	_, rest, ok := strings.Cut(device, "=")
+	if !ok {
+		return ""
+	}
+	name, _, _ := strings.Cut(rest, ":")
+	// "qsv=qs@va" derives qs from the device named va
+	name, _, _ = strings.Cut(name, "@")
+	return name
+}
+
+// Encoding records how a job's video was encoded, and why a job that asked
+// for hardware ended up in software
+type Encoding struct {
+	// Backend is the hardware backend that encoded the video, or software
+	Backend HardwareBackend `json:"backend"`
+	// Encoder is the ffmpeg video encoder, empty when ffmpeg picked one
+	Encoder string `json:"encoder,omitempty"`
+	// FallbackReason is set when a job asking for hardware acceleration was
+	// encoded in software
+	FallbackReason string `json:"fallback_reason,omitempty"`
+}
+
+// Encoding describes how the generated command encodes the job's video.
+// Hand-written arguments are attributed to the backend owning their
+// encoder.
+func (j *Job) Encoding() Encoding {
+	encoding := Encoding{Backend: BackendSoftware, Encoder: j.VideoEncoder()}
+	for _, b := range backends {
+		if b.IsSoftware() {
+			continue
+		}
+		for codec := range b.Encoders {
+			if b.Encoder(codec) == encoding.Encoder {
+				encoding.Backend = b.Name
+			}
+		}
+	}
+	return encoding
+}
+
+// RequestsHardware reports whether the job's simple options ask for
+// hardware acceleration
+func (j *Job) RequestsHardware() bool {
+	return j.SimpleOptions != nil && j.SimpleOptions.UseHardwareAcceleration
+}
+
+// AllowsSoftwareFallback reports whether the job may be encoded in software
+// when the hardware it asks for is missing or fails
+func (j *Job) AllowsSoftwareFallback() bool {
+	return j.Requirements != nil && j.Requirements.SoftwareFallback
+}
+
+// WithSoftwareEncoding returns a copy of the job that encodes on the CPU
+// with the software equivalent of its preset. It returns false when the job
+// does not encode in hardware or its arguments were written by hand, since
+// those cannot be translated.
+func (j Job) WithSoftwareEncoding() (Job, bool) {
+	if _, ok := j.hardwareBackend(); !ok || !j.argumentsDerived() {
+		return j, false
+	}
+	j.HardwareBackend = BackendSoftware
+	j.HardwareDevice = ""
+	j.convertSimpleOptionsToArguments()
+	return j, true
+}
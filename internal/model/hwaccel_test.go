@@ -0,0 +1,222 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBackendCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend HardwareBackend
+		device  string
+		codec   VideoCodec
+		want    []string
+	}{
+		{
+			name:    "VAAPI",
+			backend: BackendVAAPI,
+			codec:   VideoCodecHEVC,
+			want: []string{
+				"-init_hw_device", "vaapi=va:/dev/dri/renderD128", "-filter_hw_device", "va",
+				"-y", "-hide_banner",
+				"-hwaccel", "vaapi", "-hwaccel_device", "va", "-hwaccel_output_format", "vaapi",
+				"-i", "in.mkv",
+				"-c:v", "hevc_vaapi", "-rc_mode", "CQP", "-qp", "25", "-compression_level", "4",
+				"-vf", "format=nv12|vaapi,hwupload,scale_vaapi=w=1280:h=720",
+				"-c:a", "libopus", "-b:a", "128k",
+				"out.mkv",
+			},
+		},
+		{
+			name:    "QSV",
+			backend: BackendQSV,
+			codec:   VideoCodecAV1,
+			want: []string{
+				"-init_hw_device", "qsv=qs:hw_any,child_device=/dev/dri/renderD128", "-filter_hw_device", "qs",
+				"-y", "-hide_banner",
+				"-hwaccel", "qsv", "-hwaccel_device", "qs", "-hwaccel_output_format", "qsv",
+				"-i", "in.mkv",
+				"-c:v", "av1_qsv", "-preset", "slow", "-look_ahead_depth", "30",
+				"-vf", "format=nv12|qsv,hwupload=extra_hw_frames=64,vpp_qsv=w=1280:h=720",
+				"-c:a", "libopus", "-b:a", "128k",
+				"out.mkv",
+			},
+		},
+		{
+			name:    "NVENC on a second GPU",
+			backend: BackendNVENC,
+			device:  "cuda=gpu1:1",
+			codec:   VideoCodecH264,
+			want: []string{
+				"-init_hw_device", "cuda=gpu1:1", "-filter_hw_device", "gpu1",
+				"-y", "-hide_banner",
+				"-hwaccel", "cuda", "-hwaccel_device", "gpu1", "-hwaccel_output_format", "cuda",
+				"-i", "in.mkv",
+				"-c:v", "h264_nvenc", "-preset", "p4", "-tune", "hq", "-rc", "vbr", "-cq", "23", "-b:v", "0",
+				"-vf", "hwupload_cuda,scale_cuda=w=1280:h=720",
+				"-c:a", "libopus", "-b:a", "128k",
+				"out.mkv",
+			},
+		},
+		{
+			name:    "AMF scales on the CPU",
+			backend: BackendAMF,
+			codec:   VideoCodecHEVC,
+			want: []string{
+				"-y", "-hide_banner",
+				"-i", "in.mkv",
+				"-c:v", "hevc_amf", "-quality", "balanced", "-rc", "cqp", "-qp_i", "25", "-qp_p", "25",
+				"-vf", "scale=1280:720",
+				"-c:a", "libopus", "-b:a", "128k",
+				"out.mkv",
+			},
+		},
+		{
+			name:    "Codec the backend cannot encode falls back to software",
+			backend: BackendNVENC,
+			codec:   VideoCodecVP9,
+			want: []string{
+				"-y", "-hide_banner",
+				"-i", "in.mkv",
+				"-c:v", "libvpx-vp9", "-crf", "32", "-b:v", "0", "-deadline", "good", "-cpu-used", "2", "-row-mt", "1",
+				"-vf", "scale=1280:720",
+				"-c:a", "libopus", "-b:a", "128k",
+				"out.mkv",
+			},
+		},
+		{
+			name:    "Software backend",
+			backend: BackendSoftware,
+			codec:   VideoCodecH264,
+			want: []string{
+				"-y", "-hide_banner",
+				"-i", "in.mkv",
+				"-c:v", "libx264", "-preset", "medium", "-crf", "23",
+				"-vf", "scale=1280:720",
+				"-c:a", "libopus", "-b:a", "128k",
+				"out.mkv",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := Job{
+				InputFilePath:  "in.mkv",
+				OutputFilePath: "out.mkv",
+				SimpleOptions: &SimpleOptions{
+					VideoCodec:              tt.codec,
+					Resolution:              "720p",
+					UseHardwareAcceleration: true,
+				},
+			}
+			// As submitted through the API, then picked up by the worker
+			job.convertSimpleOptionsToArguments()
+			job.ApplyDefaults(EncoderDefaults{HardwareBackend: tt.backend, HardwareDevice: tt.device})
+
+			if got := job.GetFFmpegCommand(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFFmpegCommand() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyDefaultsSelectsBackend(t *testing.T) {
+	var job Job
+	json.Unmarshal([]byte(`{"input_file_path":"in.mkv","output_file_path":"out.mkv","simple_options":{"use_hardware_acceleration":true}}`), &job)
+	job.ApplyDefaults(EncoderDefaults{HardwareBackend: BackendVAAPI, HardwareDevice: "vaapi=va:/dev/dri/renderD129"})
+
+	if job.HardwareBackend != BackendVAAPI || job.VideoEncoder() != "av1_vaapi" {
+		t.Errorf("ApplyDefaults() left backend %q, command %v", job.HardwareBackend, job.GetFFmpegCommand())
+	}
+	if job.HardwareDevice != "vaapi=va:/dev/dri/renderD129" {
+		t.Errorf("HardwareDevice = %q, want the worker's device", job.HardwareDevice)
+	}
+
+	// A device the submitter named is replaced with the worker's
+	var named Job
+	json.Unmarshal([]byte(`{"input_file_path":"in.mkv","output_file_path":"out.mkv","hardware_device":"vaapi=va:/dev/dri/renderD128",
+		"simple_options":{"use_hardware_acceleration":true}}`), &named)
+	named.ApplyDefaults(EncoderDefaults{HardwareBackend: BackendNVENC})
+	if named.HardwareDevice != "" || strings.Contains(strings.Join(named.GetFFmpegCommand(), " "), "vaapi") {
+		t.Errorf("ApplyDefaults() kept device %q for NVENC, command %v", named.HardwareDevice, named.GetFFmpegCommand())
+	}
+
+	var software Job
+	json.Unmarshal([]byte(`{"input_file_path":"in.mkv","output_file_path":"out.mkv","simple_options":{}}`), &software)
+	software.ApplyDefaults(EncoderDefaults{HardwareBackend: BackendVAAPI, HardwareDevice: "vaapi=va:/dev/dri/renderD129"})
+	if software.HardwareDevice != "" {
+		t.Errorf("ApplyDefaults() gave a software job device %q", software.HardwareDevice)
+	}
+}
+
+func TestBackendFilters(t *testing.T) {
+	vaapi, _ := LookupBackend(BackendVAAPI)
+	if got, want := vaapi.CPUFilter("drawtext=text=hi"), "hwdownload,format=nv12,drawtext=text=hi,format=nv12|vaapi,hwupload"; got != want {
+		t.Errorf("CPUFilter() = %q, want %q", got, want)
+	}
+	if got, want := vaapi.ScaleFilter("1280"), "scale_vaapi=w=1280:h=-2"; got != want {
+		t.Errorf("ScaleFilter() = %q, want %q", got, want)
+	}
+
+	amf, _ := LookupBackend(BackendAMF)
+	if got := amf.CPUFilter("drawtext=text=hi"); got != "drawtext=text=hi" {
+		t.Errorf("CPUFilter() = %q, want the filter unchanged", got)
+	}
+	if got := amf.Encoder(VideoCodecVP9); got != "" {
+		t.Errorf("Encoder(vp9) = %q, want none", got)
+	}
+
+	if b, ok := LookupBackend(""); !ok || b.Name != DefaultHardwareBackend {
+		t.Errorf("LookupBackend(\"\") = %v, want the default backend", b)
+	}
+	if _, ok := LookupBackend("glide"); ok {
+		t.Error("LookupBackend() accepted an unknown backend")
+	}
+}
+
+func TestDeviceName(t *testing.T) {
+	tests := map[string]string{
+		"vaapi=va:/dev/dri/renderD128": "va",
+		"qsv=qs@va":                    "qs",
+		"cuda=cu":                      "cu",
+		"vaapi":                        "",
+	}
+	for device, want := range tests {
+		if got := deviceName(device); got != want {
+			t.Errorf("deviceName(%q) = %q, want %q", device, got, want)
+		}
+	}
+}
+
+func TestWithSoftwareEncoding(t *testing.T) {
+	var job Job
+	json.Unmarshal([]byte(`{"input_file_path":"in.mkv","output_file_path":"out.mkv","simple_options":{"quality_preset":"fast","use_hardware_acceleration":true}}`), &job)
+	job.ApplyDefaults(EncoderDefaults{HardwareBackend: BackendVAAPI, HardwareDevice: "vaapi=va:/dev/dri/renderD129"})
+
+	if got := job.Encoding(); got.Backend != BackendVAAPI || got.Encoder != "av1_vaapi" {
+		t.Errorf("Encoding() = %+v, want vaapi/av1_vaapi", got)
+	}
+
+	software, ok := job.WithSoftwareEncoding()
+	if !ok {
+		t.Fatal("WithSoftwareEncoding() = false for a hardware job")
+	}
+	if got := software.Encoding(); got.Backend != BackendSoftware || got.Encoder != "libaom-av1" {
+		t.Errorf("Encoding() after fallback = %+v, want software/libaom-av1", got)
+	}
+	if cmd := strings.Join(software.GetFFmpegCommand(), " "); strings.Contains(cmd, "vaapi") {
+		t.Errorf("software command still uses the device: %s", cmd)
+	}
+	if job.HardwareBackend != BackendVAAPI {
+		t.Error("WithSoftwareEncoding() changed the original job")
+	}
+
+	job.OutputArguments = "-c:v av1_vaapi -qp 20"
+	if _, ok := job.WithSoftwareEncoding(); ok {
+		t.Error("WithSoftwareEncoding() rewrote hand-written arguments")
+	}
+}
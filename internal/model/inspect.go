@@ -0,0 +1,34 @@
+package model
+
+// probeHandler reports the input's format and streams as ffprobe JSON
+var probeHandler = JobHandler{
+	Type:        JobTypeProbe,
+	Description: "Report the input's format and streams as ffprobe JSON, written to output_file_path when set and to the job's log otherwise",
+	Program:     "ffprobe",
+	// ffprobe has no -y; it overwrites its output file regardless
+	GlobalArgs: []string{"-hide_banner"},
+	InputArgs: func(*Job) []string {
+		return []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams"}
+	},
+	OutputArgs: func(j *Job) []string {
+		if j.OutputFilePath == "" {
+			return nil
+		}
+		return []string{"-o", j.OutputFilePath}
+	},
+	Output: fixedOutput(OutputOptional),
+}
+
+// verifyHandler decodes the whole input without writing anything, failing
+// at the first decoding error
+var verifyHandler = JobHandler{
+	Type:        JobTypeVerify,
+	Description: "Decode the whole input and fail on the first error; nothing is written",
+	InputArgs: func(*Job) []string {
+		return []string{"-v", "error", "-xerror"}
+	},
+	OutputArgs: func(*Job) []string {
+		return []string{"-map", "0:v?", "-map", "0:a?", "-f", "null", "-"}
+	},
+	Output: fixedOutput(OutputNone),
+}
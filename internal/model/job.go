@@ -62,8 +62,15 @@ type SimpleOptions struct {
 	QualityPreset QualityPreset `json:"quality_preset,omitempty"`
 
 	// Video options
-	Resolution             string `json:"resolution,omitempty"` // "720p", "1080p", "4k", or "original"
-	KeepOriginalResolution bool   `json:"keep_original_resolution,omitempty"`
+	VideoCodec             VideoCodec `json:"video_codec,omitempty"` // "h264", "hevc", "av1" (default), "vp9" or "copy"
+	Resolution             string     `json:"resolution,omitempty"`  // "720p", "1080p", "4k", or "original"
+	KeepOriginalResolution bool       `json:"keep_original_resolution,omitempty"`
+
+	// AV1 software encoder; the worker's default applies when unset.
+	// FilmGrain (0-50) and Tune ("vq", "psnr", "ssim") apply to libsvtav1 only.
+	AV1Encoder AV1Encoder `json:"av1_encoder,omitempty"` // "libaom-av1" or "libsvtav1"
+	FilmGrain  int        `json:"film_grain,omitempty"`
+	Tune       string     `json:"tune,omitempty"`
 
 	// Hardware acceleration
 	UseHardwareAcceleration bool `json:"use_hardware_acceleration,omitempty"`
@@ -72,29 +79,88 @@ type SimpleOptions struct {
 	TrimFrom     string `json:"trim_from,omitempty"`     // e.g. "00:01:30"
 	TrimDuration string `json:"trim_duration,omitempty"` // e.g. "00:10:00"
 
-	// Audio options
-	AudioQuality string `json:"audio_quality,omitempty"` // "low", "medium", "high"
+	// Audio options. AudioQuality sets the bitrate of stereo tracks;
+	// Audio chooses the tracks, their codec and layout.
+	AudioQuality string        `json:"audio_quality,omitempty"` // "low", "medium", "high"
+	Audio        *AudioOptions `json:"audio,omitempty"`
+
+	// Subtitle tracks: kept, dropped, burnt in or extracted
+	Subtitles *SubtitleOptions `json:"subtitles,omitempty"`
+
+	// Loudness normalises the audio to EBU R128 targets in two passes
+	Loudness *LoudnessOptions `json:"loudness,omitempty"`
 }
 
 // Job represents a transcoding job with complete FFmpeg argument control.
 type Job struct {
+	// ID is assigned by the API server when the job is submitted
+	ID string `json:"id,omitempty"`
+
 	// Basic job properties
 	InputFilePath       string `json:"input_file_path"`
 	OutputFilePath      string `json:"output_file_path"`
 	InputContainerType  string `json:"input_container_type,omitempty"`
 	OutputContainerType string `json:"output_container_type,omitempty"`
-	DryRun              string `json:"dry_run,omitempty"`
+	DryRun              bool   `json:"dry_run,omitempty"`
+	// SkipUnneeded lets the planning rules skip the job when its input
+	// needs no work. Without it only dry runs and plans consult them.
+	SkipUnneeded bool `json:"skip_unneeded,omitempty"`
 
 	// Simple options for novice users (used externally)
 	SimpleOptions *SimpleOptions `json:"simple_options,omitempty"`
 
+	// Type selects what the job produces; transcode when empty
+	Type JobType `json:"type,omitempty"`
+
+	// ABR packages the input as an adaptive bitrate ladder into the
+	// directory at OutputFilePath instead of writing a single file
+	ABR *ABROptions `json:"abr,omitempty"`
+
+	// Options for the other job types; defaults apply when unset
+	AudioExtract    *AudioExtractOptions    `json:"audio_extract,omitempty"`
+	SubtitleExtract *SubtitleExtractOptions `json:"subtitle_extract,omitempty"`
+	Thumbnails      *ThumbnailOptions       `json:"thumbnails,omitempty"`
+	Sprite          *SpriteOptions          `json:"sprite,omitempty"`
+	Preview         *PreviewOptions         `json:"preview,omitempty"`
+
+	// Requirements restrict which workers may run the job
+	Requirements *JobRequirements `json:"requirements,omitempty"`
+
 	// Advanced FFmpeg control (for power users)
 	GlobalArguments string `json:"global_arguments,omitempty"`
 	InputArguments  string `json:"input_arguments,omitempty"`
 	OutputArguments string `json:"output_arguments,omitempty"`
 
 	// Hardware device configuration (set by worker service)
-	HardwareDevice string `json:"hardware_device,omitempty"`
+	HardwareDevice  string          `json:"hardware_device,omitempty"`
+	HardwareBackend HardwareBackend `json:"hardware_backend,omitempty"`
+
+	// Submitter identifies the client that queued the job (set by API server)
+	Submitter string `json:"submitter,omitempty"`
+
+	// Attempt is the attempt of the job's record a queued copy runs, so
+	// workers can drop copies a cancel and retry left behind (set by API
+	// server and pipelines)
+	Attempt int `json:"attempt,omitempty"`
+
+	// Pipeline and Step name the pipeline step the job runs, for jobs a
+	// pipeline queued (set by API server and workers)
+	Pipeline string `json:"pipeline,omitempty"`
+	Step     string `json:"step,omitempty"`
+
+	// TraceContext carries the submitting request's trace to the worker as
+	// W3C traceparent/baggage entries (set by API server)
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+
+	// probe is what ffprobe found in the input, from which simple options
+	// choose the streams to keep; nil until ApplyProbe
+	probe *ProbeResult
+
+	// loudness is what the loudness analysis pass measured of each
+	// normalised audio stream; nil until ApplyLoudness. analysis is set on
+	// the job LoudnessAnalysis returns, which runs that pass.
+	loudness []loudnessMeasurement
+	analysis bool
 }
 
 // IsValidQualityPreset checks if the given preset is valid
@@ -128,55 +194,48 @@ func GetPresetDescription(preset QualityPreset) string {
 	}
 }
 
-// GetFFmpegPresetArgs returns FFmpeg arguments for the given quality preset and codec
+// GetFFmpegPresetArgs returns FFmpeg arguments for the given quality preset
+// using the default AV1 encoders
 func GetFFmpegPresetArgs(preset QualityPreset, useHardwareAccel bool) string {
-	// Default to balanced if preset is invalid
-	if !IsValidQualityPreset(preset) {
-		preset = DefaultQualityPreset
-	}
-
-	// For hardware acceleration
-	if useHardwareAccel {
-		switch preset {
-		case PresetUltraFast:
-			return "-c:v av1_qsv -preset veryfast -look_ahead_depth 8"
-		case PresetFast:
-			return "-c:v av1_qsv -preset faster -look_ahead_depth 16"
-		case PresetQuality:
-			return "-c:v av1_qsv -preset slow -look_ahead_depth 40"
-		case PresetSlow:
-			return "-c:v av1_qsv -preset slower -look_ahead_depth 60"
-		case PresetUltraSlow:
-			return "-c:v av1_qsv -preset veryslow -look_ahead_depth 120"
-		default: // Balanced
-			return "-c:v av1_qsv -preset slow -look_ahead_depth 30"
-		}
-	}
-
-	// For software encoding using AV1
-	switch preset {
-	case PresetUltraFast:
-		return "-c:v libaom-av1 -crf 30 -b:v 0 -cpu-used 8 -row-mt 1"
-	case PresetFast:
-		return "-c:v libaom-av1 -crf 30 -b:v 0 -cpu-used 6 -row-mt 1"
-	case PresetQuality:
-		return "-c:v libaom-av1 -crf 28 -b:v 0 -cpu-used 2 -row-mt 1"
-	case PresetSlow:
-		return "-c:v libaom-av1 -crf 25 -b:v 0 -cpu-used 1 -row-mt 1"
-	case PresetUltraSlow:
-		return "-c:v libaom-av1 -crf 20 -b:v 0 -cpu-used 0 -row-mt 1 -tiles 2x2"
-	default: // Balanced
-		return "-c:v libaom-av1 -crf 30 -b:v 0 -cpu-used 4 -row-mt 1"
-	}
+	return GetVideoCodecArgs(DefaultVideoCodec, preset, useHardwareAccel)
 }
 
-// UnmarshalJSON provides custom unmarshaling logic
+// UnmarshalJSON provides custom unmarshaling logic. dry_run and
+// skip_unneeded are accepted as booleans or in the legacy string forms; they
+// always marshal as booleans.
 func (j *Job) UnmarshalJSON(data []byte) error {
 	// Use an alias to avoid recursion in UnmarshalJSON
 	type JobAlias Job
-	aux := (*JobAlias)(j)
+	aux := struct {
+		*JobAlias
+		DryRun        json.RawMessage `json:"dry_run"`
+		SkipUnneeded  json.RawMessage `json:"skip_unneeded"`
+		SimpleOptions json.RawMessage `json:"simple_options"`
+		Requirements  json.RawMessage `json:"requirements"`
+		ABR           json.RawMessage `json:"abr"`
+	}{JobAlias: (*JobAlias)(j)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	dryRun, err := decodeFlag("dry_run", aux.DryRun)
+	if err != nil {
+		return err
+	}
+	j.DryRun = dryRun
+	if j.SkipUnneeded, err = decodeFlag("skip_unneeded", aux.SkipUnneeded); err != nil {
+		return err
+	}
 
-	if err := json.Unmarshal(data, aux); err != nil {
+	// Objects with flags are decoded separately so type errors inside them
+	// keep their full path
+	if j.SimpleOptions, err = decodeObject[SimpleOptions]("simple_options", aux.SimpleOptions); err != nil {
+		return err
+	}
+	if j.Requirements, err = decodeObject[JobRequirements]("requirements", aux.Requirements); err != nil {
+		return err
+	}
+	if j.ABR, err = decodeObject[ABROptions]("abr", aux.ABR); err != nil {
 		return err
 	}
 
@@ -202,7 +261,34 @@ func (j *Job) IsAdvancedMode() bool {
 
 // IsDryRun checks if this is a dry run job
 func (j *Job) IsDryRun() bool {
-	return strings.ToLower(j.DryRun) == "true"
+	return j.DryRun
+}
+
+// UnmarshalJSON accepts the boolean options as booleans or in the legacy
+// string forms
+func (o *SimpleOptions) UnmarshalJSON(data []byte) error {
+	type SimpleOptionsAlias SimpleOptions
+	aux := struct {
+		*SimpleOptionsAlias
+		KeepOriginalResolution  json.RawMessage `json:"keep_original_resolution"`
+		UseHardwareAcceleration json.RawMessage `json:"use_hardware_acceleration"`
+		Audio                   json.RawMessage `json:"audio"`
+	}{SimpleOptionsAlias: (*SimpleOptionsAlias)(o)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	if o.Audio, err = decodeObject[AudioOptions]("audio", aux.Audio); err != nil {
+		return err
+	}
+	if o.KeepOriginalResolution, err = decodeFlag("keep_original_resolution", aux.KeepOriginalResolution); err != nil {
+		return err
+	}
+	if o.UseHardwareAcceleration, err = decodeFlag("use_hardware_acceleration", aux.UseHardwareAcceleration); err != nil {
+		return err
+	}
+	return nil
 }
 
 // convertSimpleOptionsToArguments translates user-friendly options to FFmpeg arguments
@@ -215,8 +301,14 @@ func (j *Job) convertSimpleOptionsToArguments() {
 	// Set reasonable global arguments
 	j.GlobalArguments = "-y -hide_banner"
 
-	// Handle trimming (these are input arguments)
+	// Decode on the device when encoding on it
 	var inputArgs []string
+	backend, hardware := j.hardwareBackend()
+	if hardware {
+		inputArgs = append(inputArgs, backend.DecodeArgs(j.HardwareDevice)...)
+	}
+
+	// Handle trimming (these are input arguments)
 	if opts.TrimFrom != "" {
 		inputArgs = append(inputArgs, fmt.Sprintf("-ss %s", opts.TrimFrom))
 		if opts.TrimDuration != "" {
@@ -228,36 +320,26 @@ func (j *Job) convertSimpleOptionsToArguments() {
 	// Handle output arguments (video and audio encoding)
 	var outputArgs []string
 
-	// Use the new helper function for preset arguments
-	presetArgs := GetFFmpegPresetArgs(opts.QualityPreset, opts.UseHardwareAcceleration)
-	outputArgs = append(outputArgs, presetArgs)
-
-	// Handle resolution
-	if !opts.KeepOriginalResolution && opts.Resolution != "" &&
-		opts.Resolution != "original" {
-		// Convert common terms to actual dimensions
-		var dimension string
-		switch strings.ToLower(opts.Resolution) {
-		case "480p":
-			dimension = "854:480"
-		case "720p":
-			dimension = "1280:720"
-		case "1080p":
-			dimension = "1920:1080"
-		case "4k", "2160p":
-			dimension = "3840:2160"
-		default:
-			dimension = opts.Resolution // Assume it's already in the right format
-		}
+	outputArgs = append(outputArgs, j.simpleVideoArgs())
 
+	// Hardware encoders take frames from the device, scaled there too.
+	// Burnt-in subtitles are drawn before scaling, in the same filter.
+	dimension := opts.dimension()
+	if hardware {
+		if filter := backend.VideoFilter(dimension); filter != "" {
+			outputArgs = append(outputArgs, "-vf "+filter)
+		}
+	} else if dimension != "" && !opts.burnsSubtitles() {
 		outputArgs = append(outputArgs, fmt.Sprintf("-vf scale=%s", dimension))
 	}
 
 	// Handle audio quality
-	switch strings.ToLower(opts.AudioQuality) {
-	case "low":
+	switch quality := strings.ToLower(opts.AudioQuality); {
+	case opts.Audio != nil:
+		// Audio options encode each track when the command is built
+	case quality == "low":
 		outputArgs = append(outputArgs, "-c:a libopus -b:a 64k")
-	case "high":
+	case quality == "high":
 		outputArgs = append(outputArgs, "-c:a libopus -b:a 256k")
 	default: // medium or unspecified
 		outputArgs = append(outputArgs, "-c:a libopus -b:a 128k")
@@ -266,33 +348,151 @@ func (j *Job) convertSimpleOptionsToArguments() {
 	j.OutputArguments = strings.Join(outputArgs, " ")
 }
 
-// GetFFmpegCommand generates the complete FFmpeg command for this job
+// dimension returns the WIDTH:HEIGHT the options scale to, or "" when the
+// video keeps its size. Copied video cannot be scaled.
+func (o *SimpleOptions) dimension() string {
+	if !o.scales() || o.codec() == VideoCodecCopy {
+		return ""
+	}
+	// Convert common terms to actual dimensions
+	switch strings.ToLower(o.Resolution) {
+	case "480p":
+		return "854:480"
+	case "720p":
+		return "1280:720"
+	case "1080p":
+		return "1920:1080"
+	case "4k", "2160p":
+		return "3840:2160"
+	}
+	return o.Resolution // Assume it's already in the right format
+}
+
+// ApplyProbe gives the job what ffprobe found in its input. Simple options
+// choose the audio tracks to keep and the subtitle tracks to keep, draw or
+// extract from it; jobs that are not probed leave stream selection to
+// ffmpeg.
+func (j *Job) ApplyProbe(probe *ProbeResult) {
+	j.probe = probe
+}
+
+// UsesProbe reports whether the job's command depends on what ffprobe finds
+// in its input: simple options choosing audio or subtitle tracks, or
+// normalising loudness
+func (j *Job) UsesProbe() bool {
+	return j.audioOptions() != nil || j.subtitleOptions() != nil || j.loudnessOptions() != nil
+}
+
+// StreamWarnings report the streams a job's simple options asked for that
+// it cannot keep from the probed input
+func (j *Job) StreamWarnings() []string {
+	return append(j.audioWarnings(), j.subtitleWarnings()...)
+}
+
+// simpleVideoArgs returns the video encoder arguments for the job's simple
+// options
+func (j *Job) simpleVideoArgs() string {
+	opts := j.SimpleOptions
+	codec := opts.codec()
+	var args string
+	if backend, ok := j.hardwareBackend(); ok {
+		args, _ = backend.EncoderArgs(codec, opts.QualityPreset)
+	} else if codec == VideoCodecAV1 && opts.AV1Encoder == AV1EncoderSVT {
+		args = GetSVTAV1Args(opts.QualityPreset, opts.FilmGrain, opts.Tune)
+	} else {
+		args = GetVideoCodecArgs(codec, opts.QualityPreset, false)
+	}
+	if codec == VideoCodecHEVC && appleContainers[j.OutputContainer()] {
+		args += " -tag:v hvc1"
+	}
+	return args
+}
+
+// GetFFmpegCommand generates the complete command for this job, without
+// the program its type runs
 func (j *Job) GetFFmpegCommand() []string {
 	var args []string
 
 	args = j.addHardwareDeviceArgs(args)
 	args = j.addGlobalArgs(args)
-	args = j.addInputArgs(args)
+	args = append(args, j.InputArgs()...)
 	args = j.addInputFile(args)
-	args = j.addOutputArgs(args)
-	args = j.addOutputFile(args)
+	args = append(args, j.OutputArgs()...)
+
+	return args
+}
+
+// GlobalArgs returns the arguments the generated command places before the
+// input, including any hardware device setup
+func (j *Job) GlobalArgs() []string {
+	return j.addGlobalArgs(j.addHardwareDeviceArgs(nil))
+}
 
+// InputArgs returns the arguments the generated command applies to the input
+func (j *Job) InputArgs() []string {
+	args := j.addInputArgs(nil)
+	if inputArgs := j.handler().InputArgs; inputArgs != nil {
+		args = append(args, inputArgs(j)...)
+	}
 	return args
 }
 
+// OutputArgs returns the arguments the generated command applies to the
+// outputs, output paths included
+func (j *Job) OutputArgs() []string {
+	return j.handler().OutputArgs(j)
+}
+
+// VideoEncoder returns the video encoder the generated command selects, or
+// an empty string when ffmpeg is left to pick one
+func (j *Job) VideoEncoder() string {
+	if j.ABR != nil {
+		return abrEncoders[j.ABR.codec()]
+	}
+	args := j.GetFFmpegCommand()
+	encoder := ""
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "-c:v", "-codec:v", "-vcodec":
+			// ffmpeg applies the last occurrence
+			encoder = args[i+1]
+		}
+	}
+	return encoder
+}
+
 func (j *Job) addOutputFile(args []string) []string {
 	return append(args, j.OutputFilePath)
 }
 
 func (j *Job) addHardwareDeviceArgs(args []string) []string {
+	if backend, ok := j.hardwareBackend(); ok {
+		return append(args, backend.DeviceArgs(j.HardwareDevice)...)
+	}
 	if j.HardwareDevice != "" {
 		args = append(args, "-init_hw_device", j.HardwareDevice)
-	} else if j.SimpleOptions != nil && j.SimpleOptions.UseHardwareAcceleration {
-		args = append(args, "-init_hw_device", "vaapi=va:/dev/dri/renderD128")
 	}
 	return args
 }
 
+// hardwareBackend returns the backend a simple job encodes with, and false
+// when it encodes on the CPU: it did not ask for acceleration, copies its
+// video, or the worker's backend is software or cannot encode the codec
+func (j *Job) hardwareBackend() (*Backend, bool) {
+	opts := j.SimpleOptions
+	if opts == nil || !opts.UseHardwareAcceleration || opts.codec() == VideoCodecCopy {
+		return nil, false
+	}
+	backend, ok := LookupBackend(j.HardwareBackend)
+	if !ok || backend.IsSoftware() {
+		return nil, false
+	}
+	if _, ok := backend.Encoders[opts.codec()]; !ok {
+		return nil, false
+	}
+	return backend, true
+}
+
 func (j *Job) addGlobalArgs(args []string) []string {
 	// Add any explicitly provided global arguments first
 	if j.GlobalArguments != "" {
@@ -301,9 +501,13 @@ func (j *Job) addGlobalArgs(args []string) []string {
 		}
 	}
 
-	// Apply standard global args if none specified
+	// Apply the type's standard global args if none specified
 	if j.GlobalArguments == "" {
-		args = append(args, "-y", "-hide_banner")
+		if global := j.handler().GlobalArgs; global != nil {
+			args = append(args, global...)
+		} else {
+			args = append(args, "-y", "-hide_banner")
+		}
 	}
 
 	return args
@@ -333,8 +537,10 @@ func (j *Job) addOutputArgs(args []string) []string {
 	}
 
 	if j.SimpleOptions != nil {
-		presetArgs := GetFFmpegPresetArgs(j.SimpleOptions.QualityPreset, j.SimpleOptions.UseHardwareAcceleration)
-		args = append(args, strings.Fields(presetArgs)...)
+		args = append(args, strings.Fields(j.simpleVideoArgs())...)
+		if backend, ok := j.hardwareBackend(); ok && backend.Upload != "" {
+			args = append(args, "-vf", backend.VideoFilter(""))
+		}
 		args = append(args, "-c:a", "libopus", "-b:a", "256k")
 	} else {
 		// Default fallback if SimpleOptions is nil
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// JobState is the lifecycle state of a submitted job
+type JobState string
+
+const (
+	JobStateQueued    JobState = "queued"
+	JobStateRunning   JobState = "running"
+	JobStateSucceeded JobState = "succeeded"
+	JobStateFailed    JobState = "failed"
+	JobStateCancelled JobState = "cancelled"
+	// JobStateSkipped means a planning rule decided the input needs no work
+	JobStateSkipped JobState = "skipped"
+)
+
+// IsTerminal reports whether a job in this state will not change again
+// without being retried
+func (s JobState) IsTerminal() bool {
+	switch s {
+	case JobStateSucceeded, JobStateFailed, JobStateCancelled, JobStateSkipped:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsValidJobState checks if the given state is known
+func IsValidJobState(s JobState) bool {
+	switch s {
+	case JobStateQueued, JobStateRunning, JobStateSucceeded, JobStateFailed, JobStateCancelled, JobStateSkipped:
+		return true
+	default:
+		return false
+	}
+}
+
+// JobRecord tracks a job from submission to completion so clients can query it
+type JobRecord struct {
+	ID          string     `json:"id"`
+	State       JobState   `json:"state"`
+	Job         Job        `json:"job"`
+	SubmittedAt time.Time  `json:"submitted_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	WorkerID    string     `json:"worker_id,omitempty"`
+	Attempts    int        `json:"attempts"`
+	Error       string     `json:"error,omitempty"`
+	// Plan is set for dry runs and for jobs a planning rule skipped
+	Plan *JobPlan `json:"plan,omitempty"`
+	// Encoding records how the video was encoded, for jobs that ran ffmpeg
+	Encoding *Encoding `json:"encoding,omitempty"`
+	// Created lists the files and directories a succeeded job created at
+	// its output path, each directory before its contents
+	Created []string `json:"created,omitempty"`
+}
+
+// NewJobID returns a random identifier for a job
+func NewJobID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic("failed to generate job ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -1,7 +1,20 @@
 package model
 
 type JobResult struct {
-	Job    `json:"job,omitempty"`
+	// Job is a named field rather than embedded so that Job's UnmarshalJSON
+	// is not promoted and used to decode the whole result
+	Job    Job    `json:"job,omitempty"`
 	Output string `json:"output,omitempty"`
-	Error  error  `json:"error,omitempty"`
+	// Error is the failure message; empty when the job succeeded. Stored as a
+	// string because error values do not survive JSON encoding.
+	Error string `json:"error,omitempty"`
+	// Plan is set for dry runs and for jobs a planning rule skipped
+	Plan *JobPlan `json:"plan,omitempty"`
+	// Encoding records how the video was encoded, for jobs that ran ffmpeg
+	Encoding *Encoding `json:"encoding,omitempty"`
+}
+
+// Failed reports whether the job ended with an error
+func (r JobResult) Failed() bool {
+	return r.Error != ""
 }
@@ -2,6 +2,7 @@ package model
 
 import (
 	"encoding/json"
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -295,49 +296,79 @@ func TestIsAdvancedMode(t *testing.T) {
 
 func TestIsDryRun(t *testing.T) {
 	tests := []struct {
-		name string
-		job  Job
-		want bool
+		name    string
+		dryRun  string
+		want    bool
+		wantErr bool
 	}{
-		{
-			name: "Not dry run",
-			job: Job{
-				DryRun: "false",
-			},
-			want: false,
-		},
-		{
-			name: "Dry run",
-			job: Job{
-				DryRun: "true",
-			},
-			want: true,
-		},
-		{
-			name: "Dry run with different casing",
-			job: Job{
-				DryRun: "TrUe",
-			},
-			want: true,
-		},
-		{
-			name: "Empty dry run",
-			job: Job{
-				DryRun: "",
-			},
-			want: false,
-		},
+		{name: "Boolean true", dryRun: `true`, want: true},
+		{name: "Boolean false", dryRun: `false`, want: false},
+		{name: "Legacy string", dryRun: `"true"`, want: true},
+		{name: "Legacy string with different casing", dryRun: `"TrUe"`, want: true},
+		{name: "Legacy false string", dryRun: `"false"`, want: false},
+		{name: "Yes", dryRun: `"yes"`, want: true},
+		{name: "Off", dryRun: `"off"`, want: false},
+		{name: "One", dryRun: `"1"`, want: true},
+		{name: "Empty string", dryRun: `""`, want: false},
+		{name: "Null", dryRun: `null`, want: false},
+		{name: "Unknown string", dryRun: `"maybe"`, wantErr: true},
+		{name: "Number", dryRun: `1`, wantErr: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := tt.job.IsDryRun(); got != tt.want {
+			var job Job
+			err := json.Unmarshal([]byte(`{"input_file_path":"/in.mkv","output_file_path":"/out.mkv","dry_run":`+tt.dryRun+`}`), &job)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("json.Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var typeErr *json.UnmarshalTypeError
+				if !errors.As(err, &typeErr) || typeErr.Field != "dry_run" {
+					t.Errorf("json.Unmarshal() error = %#v, want a type error for dry_run", err)
+				}
+				return
+			}
+			if got := job.IsDryRun(); got != tt.want {
 				t.Errorf("Job.IsDryRun() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func TestSimpleOptionsTypeErrorsKeepPath(t *testing.T) {
+	for body, field := range map[string]string{
+		`{"simple_options":{"use_hardware_acceleration":"maybe"}}`: "simple_options.use_hardware_acceleration",
+		`{"simple_options":{"resolution":1080}}`:                   "simple_options.resolution",
+	} {
+		var job Job
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal([]byte(body), &job); !errors.As(err, &typeErr) || typeErr.Field != field {
+			t.Errorf("json.Unmarshal(%s) error = %v, want a type error for %s", body, err, field)
+		}
+	}
+}
+
+func TestFlagsMarshalAsBooleans(t *testing.T) {
+	var job Job
+	legacy := `{"input_file_path":"/in.mkv","output_file_path":"/out.mkv","dry_run":"TRUE","skip_unneeded":"on",
+		"simple_options":{"use_hardware_acceleration":"yes","keep_original_resolution":"0"}}`
+	if err := json.Unmarshal([]byte(legacy), &job); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !job.DryRun || !job.SkipUnneeded || !job.SimpleOptions.UseHardwareAcceleration || job.SimpleOptions.KeepOriginalResolution {
+		t.Fatalf("flags decoded as %v, %v, %v", job.DryRun, job.SimpleOptions.UseHardwareAcceleration, job.SimpleOptions.KeepOriginalResolution)
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"dry_run":true`) || !strings.Contains(string(data), `"use_hardware_acceleration":true`) {
+		t.Errorf("json.Marshal() = %s, want boolean flags", data)
+	}
+}
+
 func TestConvertSimpleOptionsToArguments(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -353,8 +384,8 @@ func TestConvertSimpleOptionsToArguments(t *testing.T) {
 				UseHardwareAcceleration: true,
 			},
 			wantGlobal: "-y -hide_banner",
-			wantInput:  "",
-			wantOutput: "-c:v av1_qsv -preset slow -look_ahead_depth 30 -c:a libopus -b:a 128k",
+			wantInput:  "-hwaccel qsv -hwaccel_device qs -hwaccel_output_format qsv",
+			wantOutput: "-c:v av1_qsv -preset slow -look_ahead_depth 30 -vf format=nv12|qsv,hwupload=extra_hw_frames=64 -c:a libopus -b:a 128k",
 		},
 		{
 			name: "Trim options",
@@ -378,8 +409,8 @@ func TestConvertSimpleOptionsToArguments(t *testing.T) {
 				AudioQuality:            "high",
 			},
 			wantGlobal: "-y -hide_banner",
-			wantInput:  "",
-			wantOutput: "-c:v av1_qsv -preset slow -look_ahead_depth 40 -vf scale=1920:1080 -c:a libopus -b:a 256k",
+			wantInput:  "-hwaccel qsv -hwaccel_device qs -hwaccel_output_format qsv",
+			wantOutput: "-c:v av1_qsv -preset slow -look_ahead_depth 40 -vf format=nv12|qsv,hwupload=extra_hw_frames=64,vpp_qsv=w=1920:h=1080 -c:a libopus -b:a 256k",
 		},
 	}
 
@@ -438,7 +469,8 @@ func TestGetFFmpegCommand(t *testing.T) {
 				},
 			},
 			wantContains: []string{
-				"-init_hw_device", "vaapi=va:/dev/dri/renderD128",
+				"-init_hw_device", "qsv=qs:hw_any,child_device=/dev/dri/renderD128",
+				"-filter_hw_device", "qs",
 				"-y", "-hide_banner",
 				"-i", "/input.mp4",
 				"av1_qsv", "slow",
@@ -515,7 +547,28 @@ func TestAddHardwareDeviceArgs(t *testing.T) {
 					UseHardwareAcceleration: true,
 				},
 			},
-			want: []string{"-init_hw_device", "vaapi=va:/dev/dri/renderD128"},
+			want: []string{"-init_hw_device", "qsv=qs:hw_any,child_device=/dev/dri/renderD128", "-filter_hw_device", "qs"},
+		},
+		{
+			name: "Worker backend and device",
+			job: Job{
+				HardwareBackend: BackendVAAPI,
+				HardwareDevice:  "vaapi=gpu:/dev/dri/renderD129",
+				SimpleOptions: &SimpleOptions{
+					UseHardwareAcceleration: true,
+				},
+			},
+			want: []string{"-init_hw_device", "vaapi=gpu:/dev/dri/renderD129", "-filter_hw_device", "gpu"},
+		},
+		{
+			name: "Software backend",
+			job: Job{
+				HardwareBackend: BackendSoftware,
+				SimpleOptions: &SimpleOptions{
+					UseHardwareAcceleration: true,
+				},
+			},
+			want: []string{},
 		},
 		{
 			name: "No hardware acceleration",
@@ -575,3 +628,25 @@ func TestAddOutputArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestVideoEncoder(t *testing.T) {
+	tests := []struct {
+		name string
+		job  Job
+		want string
+	}{
+		{"Default", Job{}, "libaom-av1"},
+		{"Hardware", Job{SimpleOptions: &SimpleOptions{QualityPreset: PresetFast, UseHardwareAcceleration: true}}, "av1_qsv"},
+		{"Advanced", Job{OutputArguments: "-c:v libx264 -crf 23"}, "libx264"},
+		{"LastWins", Job{OutputArguments: "-vcodec libx264 -c:v libx265"}, "libx265"},
+		{"Unspecified", Job{OutputArguments: "-crf 23"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.job.VideoEncoder(); got != tt.want {
+				t.Errorf("VideoEncoder() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
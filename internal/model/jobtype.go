@@ -0,0 +1,251 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JobType selects what a job produces from its input
+type JobType string
+
+const (
+	// JobTypeTranscode encodes the input into a new file or ladder (default)
+	JobTypeTranscode JobType = "transcode"
+	// JobTypeRemux copies every stream into another container
+	JobTypeRemux JobType = "remux"
+	// JobTypeAudioExtract writes one audio stream to its own file
+	JobTypeAudioExtract JobType = "audio_extract"
+	// JobTypeSubtitleExtract writes one text subtitle stream to its own file
+	JobTypeSubtitleExtract JobType = "subtitle_extract"
+	// JobTypeThumbnails extracts still frames at intervals or scene changes
+	JobTypeThumbnails JobType = "thumbnails"
+	// JobTypeSprite tiles frames into sprite sheets with a WebVTT index for
+	// seek-bar previews
+	JobTypeSprite JobType = "sprite"
+	// JobTypePreview cuts a short animated preview clip
+	JobTypePreview JobType = "preview"
+	// JobTypeProbe reports the input's format and streams without writing media
+	JobTypeProbe JobType = "probe"
+	// JobTypeVerify decodes the whole input and fails on any error
+	JobTypeVerify JobType = "verify"
+)
+
+// OutputKind describes what a job writes at its output path
+type OutputKind int
+
+const (
+	// OutputFile is a single file at the output path
+	OutputFile OutputKind = iota
+	// OutputDirectory is a directory of files, created when missing
+	OutputDirectory
+	// OutputOptional is a file written only when an output path is given
+	OutputOptional
+	// OutputNone ignores the output path
+	OutputNone
+)
+
+// JobHandler defines a job type: the options it takes, how they are checked
+// and the command that carries it out. The API, planner and workers look
+// handlers up by type, so adding a type means registering a handler.
+type JobHandler struct {
+	Type JobType
+	// Description is published with the type in the API document
+	Description string
+
+	// Options is the JSON name of the job field holding the type's options,
+	// and Schema that field's JSON schema, which the API validates
+	// submissions against. Both are empty for types without options.
+	Options string
+	Schema  string
+
+	// Program is the executable workers run; ffmpeg when empty
+	Program string
+	// GlobalArgs replace -y -hide_banner for jobs without global_arguments
+	GlobalArgs []string
+	// InputArgs are placed before the input, after the job's
+	// input_arguments; OutputArgs follow the input and name the outputs
+	InputArgs  func(j *Job) []string
+	OutputArgs func(j *Job) []string
+	// Output says what the job writes at its output path
+	Output func(j *Job) OutputKind
+
+	// Validate checks a job's options; nil accepts any
+	Validate func(j *Job) error
+	// Finish completes the output after the program succeeds, given its
+	// log; nil when the program's output is complete
+	Finish func(j *Job, log string) error
+}
+
+// jobHandlers are the registered job types in the order they are listed
+var jobHandlers = []*JobHandler{
+	&transcodeHandler,
+	&remuxHandler,
+	&audioExtractHandler,
+	&subtitleExtractHandler,
+	&thumbnailsHandler,
+	&spriteHandler,
+	&previewHandler,
+	&probeHandler,
+	&verifyHandler,
+}
+
+// RegisterJobType adds a job type, replacing any handler of the same type.
+// Types must be registered before the API server or workers start.
+func RegisterJobType(h *JobHandler) {
+	for i, existing := range jobHandlers {
+		if existing.Type == h.Type {
+			jobHandlers[i] = h
+			return
+		}
+	}
+	jobHandlers = append(jobHandlers, h)
+}
+
+// LookupJobType returns the handler of a job type
+func LookupJobType(t JobType) (*JobHandler, bool) {
+	for _, h := range jobHandlers {
+		if h.Type == t {
+			return h, true
+		}
+	}
+	return nil, false
+}
+
+// JobHandlers returns every registered job type in the order they are listed
+func JobHandlers() []*JobHandler {
+	return append([]*JobHandler(nil), jobHandlers...)
+}
+
+// IsValidJobType checks if the given job type is registered
+func IsValidJobType(t JobType) bool {
+	_, ok := LookupJobType(t)
+	return ok
+}
+
+// fixedOutput returns an Output function for types that always write the
+// same kind of output
+func fixedOutput(kind OutputKind) func(*Job) OutputKind {
+	return func(*Job) OutputKind { return kind }
+}
+
+// Kind returns the job's type; jobs without one transcode
+func (j *Job) Kind() JobType {
+	if j.Type == "" {
+		return JobTypeTranscode
+	}
+	return j.Type
+}
+
+// handler returns the handler of the job's type. Jobs of unknown types,
+// which validation rejects, are rendered as transcodes.
+func (j *Job) handler() *JobHandler {
+	if h, ok := LookupJobType(j.Kind()); ok {
+		return h
+	}
+	return &transcodeHandler
+}
+
+// Program returns the executable that runs the job
+func (j *Job) Program() string {
+	if p := j.handler().Program; p != "" {
+		return p
+	}
+	return "ffmpeg"
+}
+
+// Output returns what the job writes at its output path
+func (j *Job) Output() OutputKind {
+	return j.handler().Output(j)
+}
+
+// OutputIsDirectory reports whether the job writes several files into the
+// directory at OutputFilePath rather than a single file
+func (j *Job) OutputIsDirectory() bool {
+	return j.Output() == OutputDirectory
+}
+
+// NeedsOutputPath reports whether the job's type requires output_file_path
+func (j *Job) NeedsOutputPath() bool {
+	kind := j.Output()
+	return kind == OutputFile || kind == OutputDirectory
+}
+
+// Finish completes a job's output once its program has succeeded
+func (j *Job) Finish(log string) error {
+	if finish := j.handler().Finish; finish != nil {
+		return finish(j, log)
+	}
+	return nil
+}
+
+// validateType checks that the job's type is registered and that only its
+// own options are set. Transcoding options and output arguments are for
+// transcodes alone: other types render their output from their options.
+func (j *Job) validateType() error {
+	kind := j.Kind()
+	h, ok := LookupJobType(kind)
+	if !ok {
+		names := make([]string, len(jobHandlers))
+		for i, h := range jobHandlers {
+			names[i] = string(h.Type)
+		}
+		return &ValidationError{"type", "must be one of " + strings.Join(names, ", ")}
+	}
+	for _, other := range jobHandlers {
+		if other.Type != kind && other.Options != "" && j.optionsSet(other.Options) {
+			return &ValidationError{other.Options, fmt.Sprintf("cannot be used by %s jobs", kind)}
+		}
+	}
+	if kind != JobTypeTranscode {
+		switch {
+		case j.SimpleOptions != nil:
+			return &ValidationError{"simple_options", fmt.Sprintf("cannot be used by %s jobs", kind)}
+		case j.ABR != nil:
+			return &ValidationError{"abr", fmt.Sprintf("cannot be used by %s jobs", kind)}
+		case j.OutputArguments != "":
+			return &ValidationError{"output_arguments", fmt.Sprintf("cannot be used by %s jobs", kind)}
+		}
+	}
+	if h.Validate != nil {
+		return h.Validate(j)
+	}
+	return nil
+}
+
+// optionsSet reports whether the job field with the given JSON name is set
+func (j *Job) optionsSet(name string) bool {
+	v := reflect.ValueOf(j).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); tag == name {
+			return !v.Field(i).IsZero()
+		}
+	}
+	return false
+}
+
+// transcodeHandler encodes the input with the job's simple options, ladder
+// or hand-written arguments
+var transcodeHandler = JobHandler{
+	Type:        JobTypeTranscode,
+	Description: "Encode the input into a new file, or an adaptive bitrate ladder with abr",
+	OutputArgs: func(j *Job) []string {
+		if j.ABR != nil {
+			// The ladder's arguments name its own outputs
+			return j.ABR.outputArgs(j.OutputFilePath)
+		}
+		if j.analysis {
+			return j.loudnessAnalysisArgs()
+		}
+		args := j.addOutputFile(append(j.addOutputArgs(nil), j.streamArgs()...))
+		return append(args, j.sidecarArgs()...)
+	},
+	Output: func(j *Job) OutputKind {
+		if j.ABR != nil {
+			return OutputDirectory
+		}
+		return OutputFile
+	},
+	Validate: (*Job).validateTranscode,
+}
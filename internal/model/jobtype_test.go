@@ -0,0 +1,163 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJobTypeCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     Job
+		program string
+		want    []string
+	}{
+		{
+			name:    "Remux into MP4",
+			job:     Job{Type: JobTypeRemux, InputFilePath: "in.mkv", OutputFilePath: "out.mp4"},
+			program: "ffmpeg",
+			want:    []string{"-y", "-hide_banner", "-i", "in.mkv", "-map", "0", "-c", "copy", "-movflags", "+faststart", "out.mp4"},
+		},
+		{
+			name:    "Remux into Matroska",
+			job:     Job{Type: JobTypeRemux, InputFilePath: "in.mp4", OutputFilePath: "out.mkv"},
+			program: "ffmpeg",
+			want:    []string{"-y", "-hide_banner", "-i", "in.mp4", "-map", "0", "-c", "copy", "out.mkv"},
+		},
+		{
+			name:    "Copied audio",
+			job:     Job{Type: JobTypeAudioExtract, InputFilePath: "in.mkv", OutputFilePath: "out.mka"},
+			program: "ffmpeg",
+			want:    []string{"-y", "-hide_banner", "-i", "in.mkv", "-map", "0:a:0", "-c:a", "copy", "out.mka"},
+		},
+		{
+			name: "Second audio stream as MP3",
+			job: Job{Type: JobTypeAudioExtract, InputFilePath: "in.mkv", OutputFilePath: "commentary.mp3",
+				AudioExtract: &AudioExtractOptions{Stream: 1, Codec: "mp3", Bitrate: "192k"}},
+			program: "ffmpeg",
+			want:    []string{"-y", "-hide_banner", "-i", "in.mkv", "-map", "0:a:1", "-c:a", "libmp3lame", "-b:a", "192k", "commentary.mp3"},
+		},
+		{
+			name: "Subtitles as WebVTT",
+			job: Job{Type: JobTypeSubtitleExtract, InputFilePath: "in.mkv", OutputFilePath: "en.vtt",
+				SubtitleExtract: &SubtitleExtractOptions{Stream: 2}},
+			program: "ffmpeg",
+			want:    []string{"-y", "-hide_banner", "-i", "in.mkv", "-map", "0:s:2", "-c:s", "webvtt", "en.vtt"},
+		},
+		{
+			name:    "Probe to a file",
+			job:     Job{Type: JobTypeProbe, InputFilePath: "in.mkv", OutputFilePath: "in.json"},
+			program: "ffprobe",
+			want: []string{"-hide_banner", "-v", "error", "-print_format", "json", "-show_format", "-show_streams",
+				"-i", "in.mkv", "-o", "in.json"},
+		},
+		{
+			name:    "Probe to the log",
+			job:     Job{Type: JobTypeProbe, InputFilePath: "in.mkv"},
+			program: "ffprobe",
+			want:    []string{"-hide_banner", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", "-i", "in.mkv"},
+		},
+		{
+			name:    "Verify",
+			job:     Job{Type: JobTypeVerify, InputFilePath: "in.mkv", OutputFilePath: "ignored.mkv"},
+			program: "ffmpeg",
+			want:    []string{"-y", "-hide_banner", "-v", "error", "-xerror", "-i", "in.mkv", "-map", "0:v?", "-map", "0:a?", "-f", "null", "-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.job.Program(); got != tt.program {
+				t.Errorf("Program() = %q, want %q", got, tt.program)
+			}
+			if got := tt.job.GetFFmpegCommand(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFFmpegCommand() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsOutputPath(t *testing.T) {
+	tests := []struct {
+		job  Job
+		want bool
+	}{
+		{Job{}, true},
+		{Job{Type: JobTypeRemux}, true},
+		{Job{Type: JobTypeSprite}, true},
+		{Job{Type: JobTypeProbe}, false},
+		{Job{Type: JobTypeVerify}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.job.NeedsOutputPath(); got != tt.want {
+			t.Errorf("NeedsOutputPath() for %q = %v, want %v", tt.job.Kind(), got, tt.want)
+		}
+	}
+}
+
+func TestValidateJobTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		job       Job
+		wantField string
+	}{
+		{"Remux", Job{Type: JobTypeRemux, OutputFilePath: "out.mp4"}, ""},
+		{"AAC audio", Job{Type: JobTypeAudioExtract, OutputFilePath: "out.m4a", AudioExtract: &AudioExtractOptions{Codec: "aac", Bitrate: "160k"}}, ""},
+		{"Unknown audio codec", Job{Type: JobTypeAudioExtract, OutputFilePath: "out.ogg", AudioExtract: &AudioExtractOptions{Codec: "vorbis"}}, "audio_extract.codec"},
+		{"Bitrate of copied audio", Job{Type: JobTypeAudioExtract, OutputFilePath: "out.mka", AudioExtract: &AudioExtractOptions{Bitrate: "128k"}}, "audio_extract.bitrate"},
+		{"Bad bitrate", Job{Type: JobTypeAudioExtract, OutputFilePath: "out.opus", AudioExtract: &AudioExtractOptions{Codec: "opus", Bitrate: "loud"}}, "audio_extract.bitrate"},
+		{"Negative audio stream", Job{Type: JobTypeAudioExtract, OutputFilePath: "out.mka", AudioExtract: &AudioExtractOptions{Stream: -1}}, "audio_extract.stream"},
+		{"SRT subtitles", Job{Type: JobTypeSubtitleExtract, OutputFilePath: "en.srt"}, ""},
+		{"Bitmap subtitle container", Job{Type: JobTypeSubtitleExtract, OutputFilePath: "en.sup"}, "output_file_path"},
+		{"Audio options on a remux", Job{Type: JobTypeRemux, OutputFilePath: "out.mkv", AudioExtract: &AudioExtractOptions{}}, "audio_extract"},
+		{"Simple options on a probe", Job{Type: JobTypeProbe, SimpleOptions: &SimpleOptions{}}, "simple_options"},
+		{"Verify", Job{Type: JobTypeVerify}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.job.Validate()
+			if tt.wantField == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			invalid, ok := err.(*ValidationError)
+			if !ok || invalid.Field != tt.wantField {
+				t.Errorf("Validate() = %v, want an error for %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestRegisterJobType(t *testing.T) {
+	saved := jobHandlers
+	jobHandlers = append([]*JobHandler(nil), jobHandlers...)
+	defer func() { jobHandlers = saved }()
+
+	RegisterJobType(&JobHandler{
+		Type: "waveform",
+		OutputArgs: func(j *Job) []string {
+			return []string{"-filter_complex", "showwavespic", "-frames:v", "1", j.OutputFilePath}
+		},
+		Output: fixedOutput(OutputFile),
+	})
+
+	job := Job{Type: "waveform", InputFilePath: "in.wav", OutputFilePath: "wave.png"}
+	if err := job.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	want := []string{"-y", "-hide_banner", "-i", "in.wav", "-filter_complex", "showwavespic", "-frames:v", "1", "wave.png"}
+	if got := job.GetFFmpegCommand(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFFmpegCommand() = %v, want %v", got, want)
+	}
+
+	RegisterJobType(&JobHandler{Type: JobTypeVerify, OutputArgs: verifyHandler.OutputArgs, Output: fixedOutput(OutputNone), Program: "verifier"})
+	if got := (&Job{Type: JobTypeVerify}).Program(); got != "verifier" {
+		t.Errorf("Program() after replacing verify = %q", got)
+	}
+	if len(jobHandlers) != len(saved)+1 {
+		t.Errorf("registry has %d types, want %d", len(jobHandlers), len(saved)+1)
+	}
+}
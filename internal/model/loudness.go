@@ -0,0 +1,192 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// EBU R128 targets loudness normalisation uses by default
+const (
+	DefaultTargetLUFS = -23.0
+	DefaultTruePeak   = -1.0
+	DefaultLRA        = 7.0
+)
+
+// LoudnessOptions normalise a simple transcode's audio to EBU R128 targets
+// with ffmpeg's loudnorm filter. Workers measure each audio stream in a
+// first pass and normalise it linearly in the encode; loudnorm falls back
+// to dynamic normalisation when a linear gain would break the true peak or
+// loudness range targets. Targets left unset take the EBU R128 defaults.
+type LoudnessOptions struct {
+	// TargetLUFS is the integrated loudness, -70 to -5; -23 by default
+	TargetLUFS *float64 `json:"target_lufs,omitempty"`
+	// TruePeak is the highest true peak in dBTP, -9 to 0; -1 by default
+	TruePeak *float64 `json:"true_peak,omitempty"`
+	// LRA is the loudness range in LU, 1 to 20; 7 by default
+	LRA *float64 `json:"lra,omitempty"`
+}
+
+// loudnessMeasurement is what loudnorm's analysis pass reports about one
+// audio stream
+type loudnessMeasurement struct {
+	I, TP, LRA, Thresh, Offset float64
+}
+
+// loudnormReportPattern matches the JSON report loudnorm prints to stderr
+// when its filter closes
+var loudnormReportPattern = regexp.MustCompile(`(?s)\{\s*"input_i".*?\}`)
+
+// targets returns the integrated loudness, true peak and loudness range,
+// with defaults for those left unset
+func (o *LoudnessOptions) targets() (lufs, peak, lra float64) {
+	lufs, peak, lra = DefaultTargetLUFS, DefaultTruePeak, DefaultLRA
+	if o.TargetLUFS != nil {
+		lufs = *o.TargetLUFS
+	}
+	if o.TruePeak != nil {
+		peak = *o.TruePeak
+	}
+	if o.LRA != nil {
+		lra = *o.LRA
+	}
+	return lufs, peak, lra
+}
+
+// validate checks loudness options against the simple options holding them
+func (o *LoudnessOptions) validate(opts *SimpleOptions) error {
+	if o == nil {
+		return nil
+	}
+	lufs, peak, lra := o.targets()
+	switch {
+	case lufs < -70 || lufs > -5:
+		return &ValidationError{"simple_options.loudness.target_lufs", "must be between -70 and -5"}
+	case peak < -9 || peak > 0:
+		return &ValidationError{"simple_options.loudness.true_peak", "must be between -9 and 0"}
+	case lra < 1 || lra > 20:
+		return &ValidationError{"simple_options.loudness.lra", "must be between 1 and 20"}
+	case opts.Audio != nil && opts.Audio.codec() == "copy":
+		return &ValidationError{"simple_options.loudness", "cannot be used when audio.codec is copy"}
+	}
+	return nil
+}
+
+// loudnessOptions returns the job's loudness options, or nil when it
+// leaves loudness alone
+func (j *Job) loudnessOptions() *LoudnessOptions {
+	if j.SimpleOptions == nil || j.ABR != nil {
+		return nil
+	}
+	return j.SimpleOptions.Loudness
+}
+
+// loudnormFilter returns the loudnorm filter of the m-th filtered audio
+// stream. The analysis pass prints what it measures; the encode applies
+// the measurement linearly and resamples loudnorm's 192 kHz output back to
+// 48 kHz. Until the stream is measured it normalises dynamically in one
+// pass, and streams measured as silent are left alone.
+func (j *Job) loudnormFilter(o *LoudnessOptions, m int, analysis bool) string {
+	lufs, peak, lra := o.targets()
+	filter := fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", lufs, peak, lra)
+	switch {
+	case analysis:
+		return filter + ":print_format=json"
+	case m >= len(j.loudness):
+		return filter + ",aresample=48000"
+	}
+	measured := j.loudness[m]
+	if math.IsInf(measured.I, 0) || math.IsNaN(measured.I) {
+		return ""
+	}
+	return fmt.Sprintf("%s:measured_I=%g:measured_TP=%g:measured_LRA=%g:measured_thresh=%g:offset=%g:linear=true,aresample=48000",
+		filter, measured.I, measured.TP, measured.LRA, measured.Thresh, measured.Offset)
+}
+
+// measuredStreams returns how many audio streams the analysis pass
+// measures: every stream of the output that is filtered
+func (j *Job) measuredStreams() int {
+	n := 0
+	for _, a := range j.audioOutputs() {
+		if a.filtered() {
+			n++
+		}
+	}
+	return n
+}
+
+// NeedsLoudnessAnalysis reports whether the job normalises loudness and
+// has yet to run its analysis pass
+func (j *Job) NeedsLoudnessAnalysis() bool {
+	return j.loudnessOptions() != nil && j.loudness == nil && j.measuredStreams() > 0
+}
+
+// LoudnessAnalysis returns the first pass of a job that normalises
+// loudness. It decodes only the audio streams the job writes, filtered as
+// the encode filters them, and prints what loudnorm measures instead of
+// writing a file. It runs in software, since it decodes no video.
+func (j Job) LoudnessAnalysis() Job {
+	if software, ok := j.WithSoftwareEncoding(); ok {
+		j = software
+	}
+	j.analysis = true
+	return j
+}
+
+// loudnessAnalysisArgs are the output arguments of the analysis pass
+func (j *Job) loudnessAnalysisArgs() []string {
+	args := []string{"-vn", "-sn", "-dn"}
+	m := 0
+	for out, a := range j.audioOutputs() {
+		spec := fmt.Sprintf(":a:%d", out)
+		if a.track < 0 {
+			spec = ":a"
+		} else {
+			args = append(args, "-map", fmt.Sprintf("0:a:%d", a.track))
+		}
+		if !a.filtered() {
+			continue
+		}
+		args = append(args, "-filter"+spec, j.audioFilter(a, m, true))
+		m++
+	}
+	return append(args, "-f", "null", "-")
+}
+
+// ApplyLoudness reads what the analysis pass measured from its log, which
+// holds a loudnorm report for each measured stream in order, so the
+// encode can normalise them
+func (j *Job) ApplyLoudness(log string) error {
+	reports := loudnormReportPattern.FindAllString(log, -1)
+	if want := j.measuredStreams(); len(reports) != want {
+		return fmt.Errorf("loudness analysis reported %d audio streams, want %d", len(reports), want)
+	}
+
+	measurements := make([]loudnessMeasurement, len(reports))
+	for i, report := range reports {
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(report), &fields); err != nil {
+			return fmt.Errorf("parsing loudness analysis: %w", err)
+		}
+		for _, f := range []struct {
+			name  string
+			value *float64
+		}{
+			{"input_i", &measurements[i].I},
+			{"input_tp", &measurements[i].TP},
+			{"input_lra", &measurements[i].LRA},
+			{"input_thresh", &measurements[i].Thresh},
+			{"target_offset", &measurements[i].Offset},
+		} {
+			v, err := strconv.ParseFloat(fields[f.name], 64)
+			if err != nil {
+				return fmt.Errorf("parsing loudness analysis: %s: %w", f.name, err)
+			}
+			*f.value = v
+		}
+	}
+	j.loudness = measurements
+	return nil
+}
@@ -0,0 +1,185 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loudnormReport is what loudnorm prints for one stream at the end of an
+// analysis pass
+func loudnormReport(inputI string) string {
+	return `[Parsed_loudnorm_1 @ 0x55d4]
+{
+	"input_i" : "` + inputI + `",
+	"input_tp" : "-4.91",
+	"input_lra" : "11.30",
+	"input_thresh" : "-37.82",
+	"output_i" : "-23.02",
+	"output_tp" : "-6.45",
+	"output_lra" : "9.80",
+	"output_thresh" : "-33.19",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.02"
+}
+`
+}
+
+// level returns a pointer to a loudness target
+func level(v float64) *float64 {
+	return &v
+}
+
+func loudnessJob(loudness LoudnessOptions, audio *AudioOptions, probe *ProbeResult) Job {
+	job := Job{
+		InputFilePath:  "/media/in.mkv",
+		OutputFilePath: "/out/movie.mkv",
+		SimpleOptions:  &SimpleOptions{QualityPreset: PresetFast, VideoCodec: VideoCodecH264, Audio: audio, Loudness: &loudness},
+	}
+	job.convertSimpleOptionsToArguments()
+	job.ApplyProbe(probe)
+	return job
+}
+
+func TestLoudnessAnalysis(t *testing.T) {
+	job := loudnessJob(LoudnessOptions{TargetLUFS: level(-16), TruePeak: level(-1.5), LRA: level(11)}, &AudioOptions{StereoDownmix: true}, audioProbe)
+	if !job.NeedsLoudnessAnalysis() {
+		t.Fatal("NeedsLoudnessAnalysis() = false, want true")
+	}
+
+	analysis := job.LoudnessAnalysis()
+	want := []string{"-vn", "-sn", "-dn",
+		"-map", "0:a:0", "-filter:a:0", "aformat=channel_layouts=5.1,loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json",
+		"-map", "0:a:0", "-filter:a:1", "aformat=channel_layouts=stereo,loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json",
+		"-map", "0:a:2", "-filter:a:2", "loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json",
+		"-map", "0:a:3", "-filter:a:3", "aformat=channel_layouts=7.1,loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json",
+		"-map", "0:a:3", "-filter:a:4", "aformat=channel_layouts=stereo,loudnorm=I=-16:TP=-1.5:LRA=11:print_format=json",
+		"-f", "null", "-"}
+	if got := analysis.OutputArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("OutputArgs() =\n%v\nwant\n%v", got, want)
+	}
+	if cmd := strings.Join(job.GetFFmpegCommand(), " "); strings.Contains(cmd, "print_format") || !strings.HasSuffix(cmd, "/out/movie.mkv") {
+		t.Errorf("GetFFmpegCommand() = %s, want the encode unchanged by the analysis", cmd)
+	}
+
+	log := "size=N/A time=01:30:00.00 bitrate=N/A speed= 310x\n" + loudnormReport("-27.61") +
+		loudnormReport("-26.40") + loudnormReport("-19.02") + loudnormReport("-inf") + loudnormReport("-30.10")
+	if err := job.ApplyLoudness(log); err != nil {
+		t.Fatalf("ApplyLoudness() = %v", err)
+	}
+	if job.NeedsLoudnessAnalysis() {
+		t.Error("NeedsLoudnessAnalysis() = true after ApplyLoudness")
+	}
+
+	args := job.streamArgs()
+	filters := map[string]string{}
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-filter:a:") {
+			filters[arg] = args[i+1]
+		}
+	}
+	wantFilters := map[string]string{
+		"-filter:a:0": "aformat=channel_layouts=5.1,loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-27.61:measured_TP=-4.91:measured_LRA=11.3:measured_thresh=-37.82:offset=0.02:linear=true,aresample=48000",
+		"-filter:a:1": "aformat=channel_layouts=stereo,loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-26.4:measured_TP=-4.91:measured_LRA=11.3:measured_thresh=-37.82:offset=0.02:linear=true,aresample=48000",
+		"-filter:a:2": "loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-19.02:measured_TP=-4.91:measured_LRA=11.3:measured_thresh=-37.82:offset=0.02:linear=true,aresample=48000",
+		// Silence is left alone
+		"-filter:a:3": "aformat=channel_layouts=7.1",
+		"-filter:a:4": "aformat=channel_layouts=stereo,loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-30.1:measured_TP=-4.91:measured_LRA=11.3:measured_thresh=-37.82:offset=0.02:linear=true,aresample=48000",
+	}
+	if !reflect.DeepEqual(filters, wantFilters) {
+		t.Errorf("streamArgs() filters =\n%v\nwant\n%v", filters, wantFilters)
+	}
+}
+
+func TestLoudnessWithoutAudioOptions(t *testing.T) {
+	job := loudnessJob(LoudnessOptions{}, nil, nil)
+	want := []string{"-vn", "-sn", "-dn", "-filter:a", "loudnorm=I=-23:TP=-1:LRA=7:print_format=json", "-f", "null", "-"}
+	analysis := job.LoudnessAnalysis()
+	if got := analysis.OutputArgs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoudnessAnalysis().OutputArgs() = %v, want %v", got, want)
+	}
+
+	// Until it is measured the encode normalises in a single pass
+	if got, want := job.streamArgs(), []string{"-filter:a", "loudnorm=I=-23:TP=-1:LRA=7,aresample=48000"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("streamArgs() = %v, want %v", got, want)
+	}
+
+	silent := loudnessJob(LoudnessOptions{}, nil, &ProbeResult{Streams: []ProbeStream{{CodecType: "video", CodecName: "h264"}}})
+	if silent.NeedsLoudnessAnalysis() {
+		t.Error("NeedsLoudnessAnalysis() = true for an input without audio")
+	}
+}
+
+func TestApplyLoudnessErrors(t *testing.T) {
+	job := loudnessJob(LoudnessOptions{}, &AudioOptions{Languages: []string{"eng"}}, audioProbe)
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{"No report", "Conversion failed!"},
+		{"Too many reports", loudnormReport("-20") + loudnormReport("-21")},
+		{"Unparsable value", strings.Replace(loudnormReport("-20"), `"-4.91"`, `"loud"`, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := job.ApplyLoudness(tt.log); err == nil {
+				t.Error("ApplyLoudness() = nil, want an error")
+			}
+			if !job.NeedsLoudnessAnalysis() {
+				t.Error("a failed ApplyLoudness left the job measured")
+			}
+		})
+	}
+}
+
+func TestValidateLoudness(t *testing.T) {
+	tests := []struct {
+		name     string
+		loudness LoudnessOptions
+		audio    *AudioOptions
+		field    string
+	}{
+		{"Defaults", LoudnessOptions{}, nil, ""},
+		{"Streaming targets", LoudnessOptions{TargetLUFS: level(-14), TruePeak: level(-2), LRA: level(9)}, nil, ""},
+		{"Target too loud", LoudnessOptions{TargetLUFS: level(0.5)}, nil, "simple_options.loudness.target_lufs"},
+		{"Zero true peak", LoudnessOptions{TruePeak: level(0)}, nil, ""},
+		{"Positive true peak", LoudnessOptions{TruePeak: level(1)}, nil, "simple_options.loudness.true_peak"},
+		{"Loudness range too wide", LoudnessOptions{LRA: level(25)}, nil, "simple_options.loudness.lra"},
+		{"Zero loudness range", LoudnessOptions{LRA: level(0)}, nil, "simple_options.loudness.lra"},
+		{"Copied audio", LoudnessOptions{}, &AudioOptions{Codec: "copy"}, "simple_options.loudness"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := Job{InputFilePath: "in.mkv", OutputFilePath: "out.mkv", SimpleOptions: &SimpleOptions{Audio: tt.audio, Loudness: &tt.loudness}}
+			err := job.Validate()
+			var field string
+			if v, ok := err.(*ValidationError); ok {
+				field = v.Field
+			} else if err != nil {
+				t.Fatalf("Validate() = %v, want a ValidationError", err)
+			}
+			if field != tt.field {
+				t.Errorf("Validate() = %v, want an error on %q", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestLoudnessZeroTruePeak(t *testing.T) {
+	var job Job
+	body := `{"input_file_path":"/media/in.mkv","output_file_path":"/out/movie.mkv","simple_options":{"loudness":{"true_peak":0}}}`
+	if err := json.Unmarshal([]byte(body), &job); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if err := job.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	want := "loudnorm=I=-23:TP=0:LRA=7:print_format=json"
+	analysis := job.LoudnessAnalysis()
+	if args := analysis.OutputArgs(); !strings.Contains(strings.Join(args, " "), want) {
+		t.Errorf("LoudnessAnalysis().OutputArgs() = %v, want %s", args, want)
+	}
+}
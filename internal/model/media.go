@@ -0,0 +1,388 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SpriteIndexName is the WebVTT index written next to a job's sprite sheets
+const SpriteIndexName = "sprite.vtt"
+
+// ThumbnailOptions control thumbnail extraction. Thumbnails are written to
+// the directory at OutputFilePath as thumb_0001.jpg, thumb_0002.jpg and so on.
+type ThumbnailOptions struct {
+	// IntervalSeconds is the time between thumbnails; 10 when unset
+	IntervalSeconds float64 `json:"interval_seconds,omitempty"`
+	// SceneThreshold, between 0 and 1, takes a thumbnail at every scene
+	// change scoring above it instead of at intervals. 0.3 to 0.4 suits
+	// most content.
+	SceneThreshold float64 `json:"scene_threshold,omitempty"`
+	// OffsetSeconds skips the start of the input, such as a black lead-in
+	OffsetSeconds float64 `json:"offset_seconds,omitempty"`
+	// Count stops after this many thumbnails; unlimited when unset. A
+	// poster frame is a count of 1.
+	Count int `json:"count,omitempty"`
+	// Width of each thumbnail in pixels; 320 when unset. The height follows
+	// the input's aspect ratio.
+	Width int `json:"width,omitempty"`
+	// Format is "jpg" (default), "png" or "webp"
+	Format string `json:"format,omitempty"`
+}
+
+// SpriteOptions control sprite sheets. Sheets are written to the directory
+// at OutputFilePath as sprite_001.jpg, sprite_002.jpg and so on, with an
+// index mapping each interval of the input to its tile in sprite.vtt.
+type SpriteOptions struct {
+	// IntervalSeconds is the time each tile covers; 10 when unset
+	IntervalSeconds float64 `json:"interval_seconds,omitempty"`
+	// Width and Height of each tile in pixels; 160x90 when unset. Frames
+	// are letterboxed to fit.
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Columns and Rows of tiles on each sheet; 10x10 when unset
+	Columns int `json:"columns,omitempty"`
+	Rows    int `json:"rows,omitempty"`
+}
+
+// PreviewOptions control animated previews. The output file's extension
+// picks the format: gif, webp or mp4.
+type PreviewOptions struct {
+	// StartSeconds is where the preview starts in the input
+	StartSeconds float64 `json:"start_seconds,omitempty"`
+	// DurationSeconds is the preview's length; 5 when unset
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	// Width in pixels; 480 when unset. The height follows the input's
+	// aspect ratio.
+	Width int `json:"width,omitempty"`
+	// FPS is the preview's frame rate; 12 when unset
+	FPS int `json:"fps,omitempty"`
+}
+
+const (
+	defaultMediaInterval   = 10
+	defaultThumbnailWidth  = 320
+	defaultThumbnailFormat = "jpg"
+	defaultTileWidth       = 160
+	defaultTileHeight      = 90
+	defaultSpriteGrid      = 10
+	defaultPreviewDuration = 5
+	defaultPreviewWidth    = 480
+	defaultPreviewFPS      = 12
+	// maxPreviewSeconds bounds previews, which are held in memory as images
+	maxPreviewSeconds = 60
+)
+
+// thumbnailEncoders are the ffmpeg encoders for each thumbnail format
+var thumbnailEncoders = map[string][]string{
+	"jpg":  {"-c:v", "mjpeg", "-q:v", "3"},
+	"png":  {"-c:v", "png"},
+	"webp": {"-c:v", "libwebp", "-quality", "80"},
+}
+
+// previewEncoders are the ffmpeg arguments for each preview container. GIFs
+// build a palette from the clip itself, which the filter graph provides.
+var previewEncoders = map[string][]string{
+	"gif":  {"-c:v", "gif", "-loop", "0"},
+	"webp": {"-c:v", "libwebp", "-loop", "0", "-quality", "75"},
+	"mp4":  {"-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart"},
+}
+
+// orDefault returns v, or def when v is unset
+func orDefault[T int | float64](v, def T) T {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// formatSeconds writes seconds the way ffmpeg reads them
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64)
+}
+
+// format returns the thumbnail image format
+func (o *ThumbnailOptions) format() string {
+	if o.Format == "" {
+		return defaultThumbnailFormat
+	}
+	return strings.ToLower(o.Format)
+}
+
+// thumbnailsHandler extracts still frames into the output directory
+var thumbnailsHandler = JobHandler{
+	Type:        JobTypeThumbnails,
+	Description: "Extract still frames at intervals or scene changes into the output directory",
+	Options:     "thumbnails",
+	Schema: `{
+		"type": "object",
+		"additionalProperties": false,
+		"description": "Options for thumbnails jobs, written as thumb_0001.jpg and so on",
+		"properties": {
+			"interval_seconds": {"type": "number", "description": "Time between thumbnails; 10 when unset"},
+			"scene_threshold": {"type": "number", "description": "Take a thumbnail at scene changes scoring above this, between 0 and 1, instead of at intervals"},
+			"offset_seconds": {"type": "number", "description": "Skip this much of the input first"},
+			"count": {"type": "integer", "description": "Stop after this many thumbnails; 1 for a poster frame"},
+			"width": {"type": "integer", "description": "Width in pixels; 320 when unset"},
+			"format": {"type": "string", "enum": ["jpg", "png", "webp"]}
+		}
+	}`,
+	InputArgs: func(j *Job) []string {
+		if o := j.Thumbnails; o != nil && o.OffsetSeconds > 0 {
+			return []string{"-ss", formatSeconds(o.OffsetSeconds)}
+		}
+		return nil
+	},
+	OutputArgs: func(j *Job) []string {
+		o := j.Thumbnails
+		if o == nil {
+			o = &ThumbnailOptions{}
+		}
+		width := orDefault(o.Width, defaultThumbnailWidth)
+		var args []string
+		if o.SceneThreshold > 0 {
+			// Commas inside a filter's arguments are escaped from the graph
+			args = append(args, "-vf", fmt.Sprintf("select=gt(scene\\,%s),scale=%d:-2", formatSeconds(o.SceneThreshold), width),
+				"-fps_mode", "vfr")
+		} else {
+			args = append(args, "-vf", fmt.Sprintf("fps=1/%s,scale=%d:-2", formatSeconds(orDefault(o.IntervalSeconds, defaultMediaInterval)), width))
+		}
+		if o.Count > 0 {
+			args = append(args, "-frames:v", strconv.Itoa(o.Count))
+		}
+		args = append(args, thumbnailEncoders[o.format()]...)
+		return append(args, "-an", filepath.Join(j.OutputFilePath, "thumb_%04d."+o.format()))
+	},
+	Output: fixedOutput(OutputDirectory),
+	Validate: func(j *Job) error {
+		o := j.Thumbnails
+		if o == nil {
+			return nil
+		}
+		switch {
+		case o.IntervalSeconds < 0:
+			return &ValidationError{"thumbnails.interval_seconds", "must not be negative"}
+		case o.SceneThreshold < 0 || o.SceneThreshold >= 1:
+			return &ValidationError{"thumbnails.scene_threshold", "must be between 0 and 1"}
+		case o.OffsetSeconds < 0:
+			return &ValidationError{"thumbnails.offset_seconds", "must not be negative"}
+		case o.Count < 0:
+			return &ValidationError{"thumbnails.count", "must not be negative"}
+		case o.Width < 0:
+			return &ValidationError{"thumbnails.width", "must not be negative"}
+		}
+		if _, ok := thumbnailEncoders[o.format()]; !ok {
+			return &ValidationError{"thumbnails.format", "must be one of jpg, png, webp"}
+		}
+		return nil
+	},
+}
+
+// spriteHandler tiles frames into sprite sheets and indexes them
+var spriteHandler = JobHandler{
+	Type:        JobTypeSprite,
+	Description: "Tile frames into sprite sheets with a WebVTT index for seek-bar previews",
+	Options:     "sprite",
+	Schema: `{
+		"type": "object",
+		"additionalProperties": false,
+		"description": "Options for sprite jobs, written as sprite_001.jpg and so on with a sprite.vtt index",
+		"properties": {
+			"interval_seconds": {"type": "number", "description": "Time each tile covers; 10 when unset"},
+			"width": {"type": "integer", "description": "Tile width in pixels; 160 when unset"},
+			"height": {"type": "integer", "description": "Tile height in pixels; 90 when unset"},
+			"columns": {"type": "integer", "description": "Tiles across each sheet; 10 when unset"},
+			"rows": {"type": "integer", "description": "Tiles down each sheet; 10 when unset"}
+		}
+	}`,
+	OutputArgs: func(j *Job) []string {
+		o := j.spriteOptions()
+		filter := fmt.Sprintf("fps=1/%s,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+			formatSeconds(o.IntervalSeconds), o.Width, o.Height, o.Width, o.Height, o.Columns, o.Rows)
+		args := []string{"-vf", filter}
+		args = append(args, thumbnailEncoders["jpg"]...)
+		return append(args, "-an", filepath.Join(j.OutputFilePath, "sprite_%03d.jpg"))
+	},
+	Output: fixedOutput(OutputDirectory),
+	Validate: func(j *Job) error {
+		o := j.Sprite
+		if o == nil {
+			return nil
+		}
+		switch {
+		case o.IntervalSeconds < 0:
+			return &ValidationError{"sprite.interval_seconds", "must not be negative"}
+		case o.Width < 0 || o.Width%2 != 0:
+			return &ValidationError{"sprite.width", "must be an even number of pixels"}
+		case o.Height < 0 || o.Height%2 != 0:
+			return &ValidationError{"sprite.height", "must be an even number of pixels"}
+		case o.Columns < 0:
+			return &ValidationError{"sprite.columns", "must not be negative"}
+		case o.Rows < 0:
+			return &ValidationError{"sprite.rows", "must not be negative"}
+		}
+		return nil
+	},
+	Finish: finishSprite,
+}
+
+// previewHandler cuts a short animated clip
+var previewHandler = JobHandler{
+	Type:        JobTypePreview,
+	Description: "Cut a short animated preview; the output file's extension picks gif, webp or mp4",
+	Options:     "preview",
+	Schema: `{
+		"type": "object",
+		"additionalProperties": false,
+		"description": "Options for preview jobs. The output file's extension picks gif, webp or mp4.",
+		"properties": {
+			"start_seconds": {"type": "number", "description": "Where the preview starts in the input"},
+			"duration_seconds": {"type": "number", "description": "Length of the preview, up to 60 seconds; 5 when unset"},
+			"width": {"type": "integer", "description": "Width in pixels; 480 when unset"},
+			"fps": {"type": "integer", "description": "Frame rate; 12 when unset"}
+		}
+	}`,
+	InputArgs: func(j *Job) []string {
+		o := j.previewOptions()
+		var args []string
+		if o.StartSeconds > 0 {
+			args = append(args, "-ss", formatSeconds(o.StartSeconds))
+		}
+		return append(args, "-t", formatSeconds(orDefault(o.DurationSeconds, defaultPreviewDuration)))
+	},
+	OutputArgs: func(j *Job) []string {
+		o := j.previewOptions()
+		container := j.OutputContainer()
+		filter := fmt.Sprintf("fps=%d,scale=%d:-2", orDefault(o.FPS, defaultPreviewFPS), orDefault(o.Width, defaultPreviewWidth))
+		if container == "gif" {
+			filter += ",split[a][b];[a]palettegen[p];[b][p]paletteuse"
+		}
+		args := []string{"-vf", filter}
+		args = append(args, previewEncoders[container]...)
+		return append(args, "-an", j.OutputFilePath)
+	},
+	Output: fixedOutput(OutputFile),
+	Validate: func(j *Job) error {
+		if _, ok := previewEncoders[j.OutputContainer()]; !ok {
+			return &ValidationError{"output_file_path", "must end in .gif, .webp or .mp4 for preview jobs"}
+		}
+		o := j.Preview
+		if o == nil {
+			return nil
+		}
+		switch {
+		case o.StartSeconds < 0:
+			return &ValidationError{"preview.start_seconds", "must not be negative"}
+		case o.DurationSeconds < 0 || o.DurationSeconds > maxPreviewSeconds:
+			return &ValidationError{"preview.duration_seconds", fmt.Sprintf("must be between 0 and %d", maxPreviewSeconds)}
+		case o.Width < 0:
+			return &ValidationError{"preview.width", "must not be negative"}
+		case o.FPS < 0:
+			return &ValidationError{"preview.fps", "must not be negative"}
+		}
+		return nil
+	},
+}
+
+// previewOptions returns the job's preview options, or the defaults
+func (j *Job) previewOptions() *PreviewOptions {
+	if j.Preview == nil {
+		return &PreviewOptions{}
+	}
+	return j.Preview
+}
+
+// spriteOptions returns the job's sprite options with defaults filled in
+func (j *Job) spriteOptions() SpriteOptions {
+	var o SpriteOptions
+	if j.Sprite != nil {
+		o = *j.Sprite
+	}
+	o.IntervalSeconds = orDefault(o.IntervalSeconds, defaultMediaInterval)
+	o.Width = orDefault(o.Width, defaultTileWidth)
+	o.Height = orDefault(o.Height, defaultTileHeight)
+	o.Columns = orDefault(o.Columns, defaultSpriteGrid)
+	o.Rows = orDefault(o.Rows, defaultSpriteGrid)
+	return o
+}
+
+// SpriteIndex returns the WebVTT index of a sprite job's sheets for an input
+// lasting the given number of seconds. Each cue covers one interval and
+// points at its tile with a media fragment, as seek-bar players expect.
+func (j *Job) SpriteIndex(duration float64) string {
+	o := j.spriteOptions()
+	perSheet := o.Columns * o.Rows
+	tiles := int(math.Ceil(duration / o.IntervalSeconds))
+
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; i < tiles; i++ {
+		start := float64(i) * o.IntervalSeconds
+		end := math.Min(start+o.IntervalSeconds, duration)
+		pos := i % perSheet
+		fmt.Fprintf(&b, "\n%s --> %s\nsprite_%03d.jpg#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), i/perSheet+1,
+			pos%o.Columns*o.Width, pos/o.Columns*o.Height, o.Width, o.Height)
+	}
+	return b.String()
+}
+
+// vttTimestamp formats seconds as a WebVTT HH:MM:SS.mmm timestamp
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// ffmpegDurationPattern matches the duration ffmpeg reports for its input
+var ffmpegDurationPattern = regexp.MustCompile(`Duration: ([0-9]+):([0-9]{2}):([0-9]{2}(?:\.[0-9]+)?)`)
+
+// parseFFmpegDuration returns the input duration in seconds from ffmpeg's
+// log, which reports the input before any output
+func parseFFmpegDuration(log string) (float64, bool) {
+	m := ffmpegDurationPattern.FindStringSubmatch(log)
+	if m == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(m[1])
+	minutes, _ := strconv.Atoi(m[2])
+	seconds, _ := strconv.ParseFloat(m[3], 64)
+	total := float64(hours*3600+minutes*60) + seconds
+	return total, total > 0
+}
+
+// ParseTimestamp reads the ffmpeg time formats used for trimming:
+// [HH:]MM:SS[.frac] or a number of seconds
+func ParseTimestamp(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, false
+	}
+	total := 0.0
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		total = total*60 + v
+	}
+	return total, true
+}
+
+// finishSprite writes the WebVTT index mapping the input's timeline onto
+// the tiles ffmpeg wrote, using the duration from ffmpeg's log
+func finishSprite(j *Job, log string) error {
+	duration, ok := parseFFmpegDuration(log)
+	if !ok {
+		return errors.New("ffmpeg did not report the input's duration; cannot index the sprite sheets")
+	}
+	return os.WriteFile(filepath.Join(j.OutputFilePath, SpriteIndexName), []byte(j.SpriteIndex(duration)), 0o644)
+}
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMediaCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		job  Job
+		want []string
+	}{
+		{
+			name: "Thumbnails at the default interval",
+			job:  Job{Type: JobTypeThumbnails, InputFilePath: "in.mkv", OutputFilePath: "/thumbs"},
+			want: []string{"-y", "-hide_banner", "-i", "in.mkv",
+				"-vf", "fps=1/10,scale=320:-2", "-c:v", "mjpeg", "-q:v", "3", "-an", "/thumbs/thumb_%04d.jpg"},
+		},
+		{
+			name: "Poster frame at scene changes",
+			job: Job{Type: JobTypeThumbnails, InputFilePath: "in.mkv", OutputFilePath: "/thumbs",
+				Thumbnails: &ThumbnailOptions{SceneThreshold: 0.4, OffsetSeconds: 30, Count: 1, Width: 1280, Format: "webp"}},
+			want: []string{"-y", "-hide_banner", "-ss", "30", "-i", "in.mkv",
+				"-vf", `select=gt(scene\,0.4),scale=1280:-2`, "-fps_mode", "vfr", "-frames:v", "1",
+				"-c:v", "libwebp", "-quality", "80", "-an", "/thumbs/thumb_%04d.webp"},
+		},
+		{
+			name: "Sprite sheets",
+			job: Job{Type: JobTypeSprite, InputFilePath: "in.mkv", OutputFilePath: "/sprites",
+				Sprite: &SpriteOptions{IntervalSeconds: 2.5, Columns: 5, Rows: 4}},
+			want: []string{"-y", "-hide_banner", "-i", "in.mkv",
+				"-vf", "fps=1/2.5,scale=160:90:force_original_aspect_ratio=decrease,pad=160:90:(ow-iw)/2:(oh-ih)/2,tile=5x4",
+				"-c:v", "mjpeg", "-q:v", "3", "-an", "/sprites/sprite_%03d.jpg"},
+		},
+		{
+			name: "GIF preview",
+			job: Job{Type: JobTypePreview, InputFilePath: "in.mkv", OutputFilePath: "/previews/in.gif",
+				Preview: &PreviewOptions{StartSeconds: 120, DurationSeconds: 3}},
+			want: []string{"-y", "-hide_banner", "-ss", "120", "-t", "3", "-i", "in.mkv",
+				"-vf", "fps=12,scale=480:-2,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+				"-c:v", "gif", "-loop", "0", "-an", "/previews/in.gif"},
+		},
+		{
+			name: "MP4 preview",
+			job:  Job{Type: JobTypePreview, InputFilePath: "in.mkv", OutputFilePath: "/previews/in.mp4"},
+			want: []string{"-y", "-hide_banner", "-t", "5", "-i", "in.mkv",
+				"-vf", "fps=12,scale=480:-2", "-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart",
+				"-an", "/previews/in.mp4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.job.GetFFmpegCommand(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetFFmpegCommand() =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpriteIndex(t *testing.T) {
+	job := Job{Type: JobTypeSprite, Sprite: &SpriteOptions{Columns: 2, Rows: 1}}
+
+	want := `WEBVTT
+
+00:00:00.000 --> 00:00:10.000
+sprite_001.jpg#xywh=0,0,160,90
+
+00:00:10.000 --> 00:00:20.000
+sprite_001.jpg#xywh=160,0,160,90
+
+00:00:20.000 --> 00:00:25.500
+sprite_002.jpg#xywh=0,0,160,90
+`
+	if got := job.SpriteIndex(25.5); got != want {
+		t.Errorf("SpriteIndex() =\n%s\nwant\n%s", got, want)
+	}
+	if got := vttTimestamp(3723.25); got != "01:02:03.250" {
+		t.Errorf("vttTimestamp() = %q", got)
+	}
+}
+
+func TestOutputIsDirectory(t *testing.T) {
+	tests := []struct {
+		job  Job
+		want bool
+	}{
+		{Job{}, false},
+		{Job{ABR: &ABROptions{}}, true},
+		{Job{Type: JobTypeThumbnails}, true},
+		{Job{Type: JobTypeSprite}, true},
+		{Job{Type: JobTypePreview}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.job.OutputIsDirectory(); got != tt.want {
+			t.Errorf("OutputIsDirectory() for %q = %v, want %v", tt.job.Kind(), got, tt.want)
+		}
+	}
+}
+
+func TestValidateMedia(t *testing.T) {
+	tests := []struct {
+		name      string
+		job       Job
+		wantField string
+	}{
+		{"Thumbnails", Job{Type: JobTypeThumbnails, OutputFilePath: "/t", Thumbnails: &ThumbnailOptions{SceneThreshold: 0.3, Format: "png"}}, ""},
+		{"Default sprite", Job{Type: JobTypeSprite, OutputFilePath: "/s"}, ""},
+		{"WebP preview", Job{Type: JobTypePreview, OutputFilePath: "/p/in.webp"}, ""},
+		{"Unknown type", Job{Type: "waveform", OutputFilePath: "/w"}, "type"},
+		{"Options of another type", Job{Type: JobTypeSprite, OutputFilePath: "/s", Thumbnails: &ThumbnailOptions{}}, "thumbnails"},
+		{"Options on a transcode", Job{OutputFilePath: "out.mkv", Preview: &PreviewOptions{}}, "preview"},
+		{"Simple options", Job{Type: JobTypeThumbnails, OutputFilePath: "/t", SimpleOptions: &SimpleOptions{}}, "simple_options"},
+		{"Output arguments", Job{Type: JobTypePreview, OutputFilePath: "/p/in.gif", OutputArguments: "-c:v gif"}, "output_arguments"},
+		{"Scene threshold", Job{Type: JobTypeThumbnails, OutputFilePath: "/t", Thumbnails: &ThumbnailOptions{SceneThreshold: 1.5}}, "thumbnails.scene_threshold"},
+		{"Thumbnail format", Job{Type: JobTypeThumbnails, OutputFilePath: "/t", Thumbnails: &ThumbnailOptions{Format: "bmp"}}, "thumbnails.format"},
+		{"Odd tile", Job{Type: JobTypeSprite, OutputFilePath: "/s", Sprite: &SpriteOptions{Width: 161}}, "sprite.width"},
+		{"Preview container", Job{Type: JobTypePreview, OutputFilePath: "/p/in.mkv"}, "output_file_path"},
+		{"Long preview", Job{Type: JobTypePreview, OutputFilePath: "/p/in.gif", Preview: &PreviewOptions{DurationSeconds: 600}}, "preview.duration_seconds"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.job.Validate()
+			if tt.wantField == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			invalid, ok := err.(*ValidationError)
+			if !ok || invalid.Field != tt.wantField {
+				t.Errorf("Validate() = %v, want an error for %s", err, tt.wantField)
+			}
+		})
+	}
+}
+
+const ffmpegInputLog = `Input #0, matroska,webm, from 'in.mkv':
+  Duration: 00:01:05.50, start: 0.000000, bitrate: 4120 kb/s
+  Stream #0:0: Video: h264 (High), yuv420p, 1920x1080, 24 fps
+frame=    7 fps=0.0 q=-0.0 Lsize=N/A time=00:01:05.50 bitrate=N/A speed=40.1x`
+
+func TestParseFFmpegDuration(t *testing.T) {
+	if duration, ok := parseFFmpegDuration(ffmpegInputLog); !ok || duration != 65.5 {
+		t.Errorf("parseFFmpegDuration() = %v, %v, want 65.5", duration, ok)
+	}
+	if _, ok := parseFFmpegDuration("  Duration: N/A, bitrate: N/A"); ok {
+		t.Error("parseFFmpegDuration() read an unknown duration")
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"00:01:30", 90, true},
+		{"01:30.5", 90.5, true},
+		{"45", 45, true},
+		{"1:00:00:00", 0, false},
+		{"soon", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := ParseTimestamp(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("ParseTimestamp(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFinishIndexesSprites(t *testing.T) {
+	dir := t.TempDir()
+	job := Job{Type: JobTypeSprite, OutputFilePath: dir}
+
+	if err := job.Finish(ffmpegInputLog); err != nil {
+		t.Fatalf("Finish() = %v", err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, SpriteIndexName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(index) != job.SpriteIndex(65.5) {
+		t.Errorf("Finish() wrote\n%s", index)
+	}
+
+	if err := job.Finish("no duration here"); err == nil {
+		t.Error("Finish() indexed sprites without a duration")
+	}
+	transcode := Job{OutputFilePath: dir}
+	if err := transcode.Finish(""); err != nil {
+		t.Errorf("Finish() of a transcode = %v, want nil", err)
+	}
+}
@@ -0,0 +1,407 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FailurePolicy decides what a pipeline does when one of its steps fails
+type FailurePolicy string
+
+const (
+	// FailureStop starts no further steps; steps already queued finish (default)
+	FailureStop FailurePolicy = "stop"
+	// FailureContinue keeps running every step that does not depend on the
+	// failed one
+	FailureContinue FailurePolicy = "continue"
+	// FailureCompensate stops like FailureStop, then removes what the steps
+	// that succeeded wrote, so a failed pipeline leaves no partial results
+	FailureCompensate FailurePolicy = "compensate"
+)
+
+// PipelineState is the aggregate state of a pipeline
+type PipelineState string
+
+const (
+	PipelineRunning   PipelineState = "running"
+	PipelineSucceeded PipelineState = "succeeded"
+	PipelineFailed    PipelineState = "failed"
+	// PipelineCompensating and PipelineCompensated follow a failure under
+	// FailureCompensate, while and once the outputs are removed
+	PipelineCompensating PipelineState = "compensating"
+	PipelineCompensated  PipelineState = "compensated"
+)
+
+// IsTerminal reports whether a pipeline in this state will not change again
+func (s PipelineState) IsTerminal() bool {
+	return s == PipelineSucceeded || s == PipelineFailed || s == PipelineCompensated
+}
+
+// StepState is the state of one step of a pipeline
+type StepState string
+
+const (
+	// StepPending steps wait for their parents
+	StepPending StepState = "pending"
+	// StepQueued steps have a queued job; StepRunning is reported while a
+	// worker runs it
+	StepQueued    StepState = "queued"
+	StepRunning   StepState = "running"
+	StepSucceeded StepState = "succeeded"
+	// StepSkipped steps had a job a planning rule skipped because its input
+	// needed no work. They count as succeeded and pass their input on.
+	StepSkipped StepState = "skipped"
+	StepFailed  StepState = "failed"
+	// StepNotRun steps were never started because a parent failed or the
+	// pipeline stopped
+	StepNotRun StepState = "not_run"
+	// StepCompensated steps succeeded and then had their output removed
+	StepCompensated StepState = "compensated"
+)
+
+// done reports whether a step finished in a way its children can build on
+func (s StepState) done() bool {
+	return s == StepSucceeded || s == StepSkipped
+}
+
+// settled reports whether a step will not change again before compensation
+func (s StepState) settled() bool {
+	return s != StepPending && s != StepQueued && s != StepRunning
+}
+
+// Pipeline is a set of jobs run in dependency order. Each step starts once
+// every step it depends on has succeeded, and may take a parent's output as
+// its input.
+type Pipeline struct {
+	Steps []PipelineStep `json:"steps"`
+	// OnFailure is "stop" (default), "continue" or "compensate"
+	OnFailure FailurePolicy `json:"on_failure,omitempty"`
+	// NotifyURL receives a POST of the pipeline's record once it finishes
+	NotifyURL string `json:"notify_url,omitempty"`
+}
+
+// PipelineStep is one job of a pipeline
+type PipelineStep struct {
+	// Name identifies the step to the steps depending on it
+	Name string `json:"name"`
+	// DependsOn lists the steps that must succeed before this one starts
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Job is run when the step starts. Its input_file_path may be a
+	// parent's output, written {{steps.NAME.output}}; the step then
+	// depends on that parent.
+	Job Job `json:"job"`
+}
+
+// PipelineStepStatus tracks one step of a submitted pipeline
+type PipelineStepStatus struct {
+	Name  string    `json:"name"`
+	State StepState `json:"state"`
+	// JobID is the step's job, once it has been queued
+	JobID string `json:"job_id,omitempty"`
+	// Output is the file the step passes to steps taking its output
+	Output string `json:"output,omitempty"`
+	// Created lists what the step's job created, which compensation removes
+	Created []string `json:"created,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// PipelineRecord tracks a pipeline from submission to completion
+type PipelineRecord struct {
+	ID          string               `json:"id"`
+	State       PipelineState        `json:"state"`
+	Pipeline    Pipeline             `json:"pipeline"`
+	Steps       []PipelineStepStatus `json:"steps"`
+	Submitter   string               `json:"submitter,omitempty"`
+	SubmittedAt time.Time            `json:"submitted_at"`
+	FinishedAt  *time.Time           `json:"finished_at,omitempty"`
+}
+
+var (
+	stepNamePattern  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+	stepInputPattern = regexp.MustCompile(`^\{\{\s*steps\.([^.}\s]+)\.output\s*\}\}$`)
+)
+
+// StepOutputRef returns the input_file_path taking the named step's output
+func StepOutputRef(step string) string {
+	return "{{steps." + step + ".output}}"
+}
+
+// InputFrom returns the step whose output is this step's input, if any
+func (s PipelineStep) InputFrom() (string, bool) {
+	m := stepInputPattern.FindStringSubmatch(s.Job.InputFilePath)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// parents returns the steps this step waits for: its dependencies and the
+// step it takes its input from
+func (s PipelineStep) parents() []string {
+	parents := s.DependsOn
+	if from, ok := s.InputFrom(); ok && !containsString(parents, from) {
+		parents = append(append([]string(nil), parents...), from)
+	}
+	return parents
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// policy returns the pipeline's failure policy, or FailureStop
+func (p *Pipeline) policy() FailurePolicy {
+	if p.OnFailure == "" {
+		return FailureStop
+	}
+	return p.OnFailure
+}
+
+// step returns the index of the named step, or -1
+func (p *Pipeline) step(name string) int {
+	for i, s := range p.Steps {
+		if s.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Validate checks that a pipeline can run: its steps have distinct names,
+// depend only on other steps without forming a cycle, take input only from
+// steps writing a single file, and have valid jobs
+func (p *Pipeline) Validate() error {
+	switch p.policy() {
+	case FailureStop, FailureContinue, FailureCompensate:
+	default:
+		return &ValidationError{"on_failure", fmt.Sprintf("must be one of %s, %s, %s", FailureStop, FailureContinue, FailureCompensate)}
+	}
+	if p.NotifyURL != "" {
+		u, err := url.Parse(p.NotifyURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return &ValidationError{"notify_url", "must be an http or https URL"}
+		}
+	}
+	if len(p.Steps) == 0 {
+		return &ValidationError{"steps", "must list at least one step"}
+	}
+
+	for i, s := range p.Steps {
+		field := fmt.Sprintf("steps[%d]", i)
+		if !stepNamePattern.MatchString(s.Name) {
+			return &ValidationError{field + ".name", fmt.Sprintf("%q must be letters, digits, '_' or '-'", s.Name)}
+		}
+		if j := p.step(s.Name); j != i {
+			return &ValidationError{field + ".name", fmt.Sprintf("%q is used by another step", s.Name)}
+		}
+	}
+
+	for i, s := range p.Steps {
+		field := fmt.Sprintf("steps[%d]", i)
+		for k, parent := range s.DependsOn {
+			if p.step(parent) < 0 || parent == s.Name {
+				return &ValidationError{fmt.Sprintf("%s.depends_on[%d]", field, k), fmt.Sprintf("%q is not another step", parent)}
+			}
+		}
+
+		job := s.Job
+		if from, ok := s.InputFrom(); ok {
+			parent := p.step(from)
+			if parent < 0 || from == s.Name {
+				return &ValidationError{field + ".job.input_file_path", fmt.Sprintf("%q is not another step", from)}
+			}
+			if p.Steps[parent].Job.Output() != OutputFile {
+				return &ValidationError{field + ".job.input_file_path", fmt.Sprintf("step %q does not write a single file", from)}
+			}
+		} else if strings.Contains(job.InputFilePath, "{{") {
+			return &ValidationError{field + ".job.input_file_path", "must be a path or {{steps.NAME.output}}"}
+		}
+		if job.NeedsOutputPath() && job.OutputFilePath == "" {
+			return &ValidationError{field + ".job.output_file_path", "must not be empty"}
+		}
+		if err := job.Validate(); err != nil {
+			if invalid, ok := err.(*ValidationError); ok {
+				return &ValidationError{field + ".job." + invalid.Field, invalid.Message}
+			}
+			return err
+		}
+	}
+
+	if cycle := p.cycle(); cycle != nil {
+		return &ValidationError{"steps", "depend on each other in a cycle: " + strings.Join(cycle, " -> ")}
+	}
+	return nil
+}
+
+// cycle returns the steps of a dependency cycle, or nil when there is none
+func (p *Pipeline) cycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make([]int, len(p.Steps))
+	var path []string
+	var visit func(i int) []string
+	visit = func(i int) []string {
+		marks[i] = visiting
+		path = append(path, p.Steps[i].Name)
+		for _, parent := range p.Steps[i].parents() {
+			j := p.step(parent)
+			switch marks[j] {
+			case visiting:
+				start := 0
+				for path[start] != parent {
+					start++
+				}
+				return append(append([]string(nil), path[start:]...), parent)
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		marks[i] = visited
+		return nil
+	}
+	for i := range p.Steps {
+		if marks[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// NewPipelineRecord returns the record of a newly submitted pipeline, with
+// every step pending
+func NewPipelineRecord(id string, p Pipeline, submitter string, now time.Time) PipelineRecord {
+	steps := make([]PipelineStepStatus, len(p.Steps))
+	for i, s := range p.Steps {
+		steps[i] = PipelineStepStatus{Name: s.Name, State: StepPending}
+	}
+	return PipelineRecord{ID: id, State: PipelineRunning, Pipeline: p, Steps: steps, Submitter: submitter, SubmittedAt: now}
+}
+
+// Schedule advances the pipeline after its steps have changed. Pending steps
+// whose parents have all succeeded are queued under new job IDs and
+// returned; steps that can no longer run are marked not run. Once every step
+// has settled the pipeline succeeds, fails, or starts compensating.
+func (r *PipelineRecord) Schedule(now time.Time) []int {
+	if r.State != PipelineRunning {
+		return nil
+	}
+	failed := false
+	for _, s := range r.Steps {
+		failed = failed || s.State == StepFailed
+	}
+	stop := failed && r.Pipeline.policy() != FailureContinue
+
+	var queued []int
+	// Steps are marked not run in dependency order, so one pass per level
+	// of the graph reaches every descendant of a failed step
+	for changed := true; changed; {
+		changed = false
+		for i, s := range r.Pipeline.Steps {
+			if r.Steps[i].State != StepPending {
+				continue
+			}
+			ready, blocked := true, stop
+			for _, parent := range s.parents() {
+				state := r.Steps[r.Pipeline.step(parent)].State
+				ready = ready && state.done()
+				blocked = blocked || (state.settled() && !state.done())
+			}
+			switch {
+			case blocked:
+				r.Steps[i].State = StepNotRun
+				changed = true
+			case ready:
+				r.Steps[i].State = StepQueued
+				r.Steps[i].JobID = NewJobID()
+				queued = append(queued, i)
+			}
+		}
+	}
+
+	for _, s := range r.Steps {
+		if !s.State.settled() {
+			return queued
+		}
+	}
+	switch {
+	case !failed:
+		r.State = PipelineSucceeded
+	case r.Pipeline.policy() == FailureCompensate:
+		r.State = PipelineCompensating
+		return queued
+	default:
+		r.State = PipelineFailed
+	}
+	r.FinishedAt = &now
+	return queued
+}
+
+// FinishStep records the outcome of a step's job. It reports false when the
+// job is not the step's current job, such as a job the pipeline has moved
+// on from, or has not finished.
+func (r *PipelineRecord) FinishStep(step string, job JobRecord) bool {
+	i := r.Pipeline.step(step)
+	if i < 0 || r.Steps[i].JobID != job.ID || r.Steps[i].State != StepQueued || !job.State.IsTerminal() {
+		return false
+	}
+	status := &r.Steps[i]
+	switch job.State {
+	case JobStateSucceeded:
+		status.State = StepSucceeded
+		status.Output = job.Job.OutputFilePath
+		status.Created = job.Created
+	case JobStateSkipped:
+		// The input already was what the step would have written
+		status.State = StepSkipped
+		status.Output = job.Job.InputFilePath
+	case JobStateCancelled:
+		status.State = StepFailed
+		status.Error = "job was cancelled"
+	default:
+		status.State = StepFailed
+		status.Error = job.Error
+	}
+	return true
+}
+
+// StepJob returns the job that runs a queued step, with its input resolved
+// from its parent's output
+func (r *PipelineRecord) StepJob(i int) Job {
+	step := r.Pipeline.Steps[i]
+	job := step.Job
+	job.ID = r.Steps[i].JobID
+	job.Pipeline = r.ID
+	job.Step = step.Name
+	if from, ok := step.InputFrom(); ok {
+		job.InputFilePath = r.Steps[r.Pipeline.step(from)].Output
+	}
+	return job
+}
+
+// Compensations returns the steps whose output compensation removes: those
+// that succeeded and created something, latest in the pipeline first
+func (r *PipelineRecord) Compensations() []int {
+	var steps []int
+	for i := len(r.Steps) - 1; i >= 0; i-- {
+		if r.Steps[i].State == StepSucceeded && len(r.Steps[i].Created) > 0 {
+			steps = append(steps, i)
+		}
+	}
+	return steps
+}
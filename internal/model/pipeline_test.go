@@ -0,0 +1,334 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testPipeline verifies a file, transcodes it, then cuts thumbnails from the
+// transcode and extracts its audio
+func testPipeline(policy FailurePolicy) Pipeline {
+	return Pipeline{
+		OnFailure: policy,
+		Steps: []PipelineStep{
+			{Name: "verify", Job: Job{Type: JobTypeVerify, InputFilePath: "in.mkv"}},
+			{Name: "encode", DependsOn: []string{"verify"}, Job: Job{InputFilePath: "in.mkv", OutputFilePath: "out.mp4"}},
+			{Name: "thumbs", Job: Job{Type: JobTypeThumbnails, InputFilePath: StepOutputRef("encode"), OutputFilePath: "thumbs"}},
+			{Name: "audio", Job: Job{Type: JobTypeAudioExtract, InputFilePath: StepOutputRef("encode"), OutputFilePath: "out.m4a"}},
+		},
+	}
+}
+
+func TestPipelineValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *Pipeline)
+		field  string
+	}{
+		{name: "Valid", modify: func(p *Pipeline) {}},
+		{
+			name:   "Unknown failure policy",
+			modify: func(p *Pipeline) { p.OnFailure = "retry" },
+			field:  "on_failure",
+		},
+		{
+			name:   "Notify URL without scheme",
+			modify: func(p *Pipeline) { p.NotifyURL = "example.com/hook" },
+			field:  "notify_url",
+		},
+		{
+			name:   "No steps",
+			modify: func(p *Pipeline) { p.Steps = nil },
+			field:  "steps",
+		},
+		{
+			name:   "Duplicate step name",
+			modify: func(p *Pipeline) { p.Steps[3].Name = "thumbs" },
+			field:  "steps[3].name",
+		},
+		{
+			name:   "Unknown dependency",
+			modify: func(p *Pipeline) { p.Steps[1].DependsOn = []string{"probe"} },
+			field:  "steps[1].depends_on[0]",
+		},
+		{
+			name:   "Input from an unknown step",
+			modify: func(p *Pipeline) { p.Steps[2].Job.InputFilePath = StepOutputRef("missing") },
+			field:  "steps[2].job.input_file_path",
+		},
+		{
+			name:   "Input from a step writing a directory",
+			modify: func(p *Pipeline) { p.Steps[3].Job.InputFilePath = StepOutputRef("thumbs") },
+			field:  "steps[3].job.input_file_path",
+		},
+		{
+			name:   "Malformed reference",
+			modify: func(p *Pipeline) { p.Steps[2].Job.InputFilePath = "{{steps.encode}}" },
+			field:  "steps[2].job.input_file_path",
+		},
+		{
+			name:   "Missing output path",
+			modify: func(p *Pipeline) { p.Steps[1].Job.OutputFilePath = "" },
+			field:  "steps[1].job.output_file_path",
+		},
+		{
+			name:   "Invalid job",
+			modify: func(p *Pipeline) { p.Steps[3].Job.SimpleOptions = &SimpleOptions{} },
+			field:  "steps[3].job.simple_options",
+		},
+		{
+			name:   "Cycle",
+			modify: func(p *Pipeline) { p.Steps[0].DependsOn = []string{"audio"} },
+			field:  "steps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testPipeline("")
+			tt.modify(&p)
+			err := p.Validate()
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			invalid, ok := err.(*ValidationError)
+			if !ok {
+				t.Fatalf("Validate() = %v, want a ValidationError for %s", err, tt.field)
+			}
+			if invalid.Field != tt.field {
+				t.Errorf("Validate() field = %q (%s), want %q", invalid.Field, invalid.Message, tt.field)
+			}
+		})
+	}
+}
+
+func TestPipelineCycleMessage(t *testing.T) {
+	p := testPipeline("")
+	p.Steps[0].DependsOn = []string{"audio"}
+	err := p.Validate()
+	want := "depend on each other in a cycle: verify -> audio -> encode -> verify"
+	if err == nil || err.(*ValidationError).Message != want {
+		t.Errorf("Validate() = %v, want %q", err, want)
+	}
+}
+
+// stepStates returns the state of every step of a record
+func stepStates(r PipelineRecord) []StepState {
+	states := make([]StepState, len(r.Steps))
+	for i, s := range r.Steps {
+		states[i] = s.State
+	}
+	return states
+}
+
+// finishStep finishes the job of a queued step in the given state
+func finishStep(t *testing.T, r *PipelineRecord, i int, state JobState) {
+	t.Helper()
+	job := JobRecord{ID: r.Steps[i].JobID, State: state, Job: r.StepJob(i)}
+	switch {
+	case state == JobStateFailed:
+		job.Error = "exit status 1"
+	case state == JobStateSucceeded && !job.Job.IsDryRun() && job.Job.Output() != OutputNone:
+		// What a worker records for the job's output file
+		job.Created = []string{job.Job.OutputFilePath}
+	}
+	if !r.FinishStep(r.Steps[i].Name, job) {
+		t.Fatalf("FinishStep(%s) = false", r.Steps[i].Name)
+	}
+}
+
+func TestPipelineScheduleSucceeds(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	r := NewPipelineRecord("p1", testPipeline(""), "client", now)
+
+	if got := r.Schedule(now); !reflect.DeepEqual(got, []int{0}) {
+		t.Fatalf("first Schedule() = %v, want [0]", got)
+	}
+	finishStep(t, &r, 0, JobStateSucceeded)
+	if got := r.Schedule(now); !reflect.DeepEqual(got, []int{1}) {
+		t.Fatalf("Schedule() after verify = %v, want [1]", got)
+	}
+	finishStep(t, &r, 1, JobStateSucceeded)
+	if got := r.Schedule(now); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Fatalf("Schedule() after encode = %v, want [2 3]", got)
+	}
+
+	job := r.StepJob(2)
+	if job.InputFilePath != "out.mp4" || job.Pipeline != "p1" || job.Step != "thumbs" || job.ID != r.Steps[2].JobID {
+		t.Errorf("StepJob(2) = input %q, pipeline %q, step %q, ID %q", job.InputFilePath, job.Pipeline, job.Step, job.ID)
+	}
+
+	finishStep(t, &r, 2, JobStateSucceeded)
+	r.Schedule(now)
+	if r.State != PipelineRunning {
+		t.Fatalf("State with a step queued = %s, want running", r.State)
+	}
+	finishStep(t, &r, 3, JobStateSucceeded)
+	r.Schedule(now)
+	if r.State != PipelineSucceeded || r.FinishedAt == nil {
+		t.Errorf("State = %s, FinishedAt = %v; want succeeded with a finish time", r.State, r.FinishedAt)
+	}
+}
+
+func TestPipelineSkippedStepPassesInputOn(t *testing.T) {
+	now := time.Now()
+	p := testPipeline("")
+	p.Steps[1].Job.InputFilePath = "already.mp4"
+	r := NewPipelineRecord("p1", p, "", now)
+	r.Schedule(now)
+	finishStep(t, &r, 0, JobStateSucceeded)
+	r.Schedule(now)
+	finishStep(t, &r, 1, JobStateSkipped)
+	r.Schedule(now)
+
+	if r.Steps[1].State != StepSkipped {
+		t.Errorf("encode state = %s, want skipped", r.Steps[1].State)
+	}
+	if got := r.StepJob(3).InputFilePath; got != "already.mp4" {
+		t.Errorf("audio input = %q, want the skipped step's input", got)
+	}
+}
+
+func TestPipelineFailurePolicies(t *testing.T) {
+	// A pipeline whose second root fails while the first has succeeded
+	pipeline := func(policy FailurePolicy) Pipeline {
+		p := testPipeline(policy)
+		p.Steps = append(p.Steps, PipelineStep{Name: "probe", Job: Job{Type: JobTypeProbe, InputFilePath: "in.mkv"}})
+		p.Steps[0].Job = Job{Type: JobTypeVerify, InputFilePath: "broken.mkv"}
+		return p
+	}
+
+	tests := []struct {
+		policy FailurePolicy
+		state  PipelineState
+		steps  []StepState
+	}{
+		{
+			policy: FailureStop,
+			state:  PipelineFailed,
+			steps:  []StepState{StepFailed, StepNotRun, StepNotRun, StepNotRun, StepSucceeded},
+		},
+		{
+			policy: FailureContinue,
+			state:  PipelineFailed,
+			steps:  []StepState{StepFailed, StepNotRun, StepNotRun, StepNotRun, StepSucceeded},
+		},
+		{
+			policy: FailureCompensate,
+			state:  PipelineCompensating,
+			steps:  []StepState{StepFailed, StepNotRun, StepNotRun, StepNotRun, StepSucceeded},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			now := time.Now()
+			r := NewPipelineRecord("p1", pipeline(tt.policy), "", now)
+			if got := r.Schedule(now); !reflect.DeepEqual(got, []int{0, 4}) {
+				t.Fatalf("first Schedule() = %v, want [0 4]", got)
+			}
+			finishStep(t, &r, 4, JobStateSucceeded)
+			r.Schedule(now)
+			finishStep(t, &r, 0, JobStateFailed)
+			if got := r.Schedule(now); got != nil {
+				t.Errorf("Schedule() after failure queued %v", got)
+			}
+			if r.State != tt.state {
+				t.Errorf("State = %s, want %s", r.State, tt.state)
+			}
+			if got := stepStates(r); !reflect.DeepEqual(got, tt.steps) {
+				t.Errorf("steps = %v, want %v", got, tt.steps)
+			}
+			if r.Steps[0].Error != "exit status 1" {
+				t.Errorf("failed step error = %q", r.Steps[0].Error)
+			}
+		})
+	}
+}
+
+func TestPipelineStopLetsQueuedStepsFinish(t *testing.T) {
+	now := time.Now()
+	p := testPipeline(FailureStop)
+	// Independent of verify, but queued alongside it
+	p.Steps[1].DependsOn = nil
+	r := NewPipelineRecord("p1", p, "", now)
+	r.Schedule(now)
+	finishStep(t, &r, 0, JobStateFailed)
+	r.Schedule(now)
+	if r.State != PipelineRunning || r.Steps[1].State != StepQueued {
+		t.Fatalf("State = %s with encode %s, want running with encode queued", r.State, r.Steps[1].State)
+	}
+
+	// encode succeeds, but stop starts nothing after the failure
+	finishStep(t, &r, 1, JobStateSucceeded)
+	if got := r.Schedule(now); got != nil {
+		t.Errorf("Schedule() queued %v after the pipeline stopped", got)
+	}
+	want := []StepState{StepFailed, StepSucceeded, StepNotRun, StepNotRun}
+	if got := stepStates(r); !reflect.DeepEqual(got, want) || r.State != PipelineFailed {
+		t.Errorf("steps = %v in %s, want %v in failed", got, r.State, want)
+	}
+}
+
+func TestPipelineContinueRunsIndependentSteps(t *testing.T) {
+	now := time.Now()
+	p := testPipeline(FailureContinue)
+	p.Steps[1].DependsOn = nil
+	r := NewPipelineRecord("p1", p, "", now)
+	r.Schedule(now)
+	finishStep(t, &r, 0, JobStateFailed)
+	r.Schedule(now)
+	finishStep(t, &r, 1, JobStateSucceeded)
+	if got := r.Schedule(now); !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("Schedule() = %v, want the steps taking encode's output", got)
+	}
+}
+
+func TestPipelineFinishStepIgnoresOtherJobs(t *testing.T) {
+	now := time.Now()
+	r := NewPipelineRecord("p1", testPipeline(""), "", now)
+	r.Schedule(now)
+
+	tests := []struct {
+		name string
+		step string
+		job  JobRecord
+	}{
+		{"Unknown step", "nope", JobRecord{ID: r.Steps[0].JobID, State: JobStateSucceeded}},
+		{"Another job", "verify", JobRecord{ID: "other", State: JobStateSucceeded}},
+		{"Still running", "verify", JobRecord{ID: r.Steps[0].JobID, State: JobStateRunning}},
+		{"Step not queued", "encode", JobRecord{ID: "", State: JobStateSucceeded}},
+	}
+	for _, tt := range tests {
+		if r.FinishStep(tt.step, tt.job) {
+			t.Errorf("%s: FinishStep() = true, want false", tt.name)
+		}
+	}
+}
+
+func TestPipelineCompensations(t *testing.T) {
+	now := time.Now()
+	p := testPipeline(FailureCompensate)
+	p.Steps[3].Job.DryRun = true
+	r := NewPipelineRecord("p1", p, "", now)
+	r.Schedule(now)
+	finishStep(t, &r, 0, JobStateSucceeded)
+	r.Schedule(now)
+	finishStep(t, &r, 1, JobStateSucceeded)
+	r.Schedule(now)
+	finishStep(t, &r, 3, JobStateSucceeded)
+	finishStep(t, &r, 2, JobStateFailed)
+	r.Schedule(now)
+
+	if r.State != PipelineCompensating {
+		t.Fatalf("State = %s, want compensating", r.State)
+	}
+	// verify writes nothing and audio was a dry run: only encode is undone
+	if got := r.Compensations(); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("Compensations() = %v, want [1]", got)
+	}
+}
@@ -0,0 +1,110 @@
+package model
+
+// PlanAction is what a plan decides to do with a job's input
+type PlanAction string
+
+const (
+	PlanActionEncode PlanAction = "encode"
+	PlanActionSkip   PlanAction = "skip"
+)
+
+// JobPlan describes what running a job would do, without encoding anything.
+// Dry runs produce one instead of an output file.
+type JobPlan struct {
+	Action  PlanAction `json:"action"`
+	Command []string   `json:"command"`
+	// AnalysisCommand measures the input's loudness before Command runs,
+	// for jobs that normalise it. Command then applies what it measured in
+	// place of the single-pass loudnorm filter shown.
+	AnalysisCommand []string       `json:"analysis_command,omitempty"`
+	Arguments       PlanArguments  `json:"arguments"`
+	Probe           *ProbeResult   `json:"probe,omitempty"`
+	Decisions       []RuleDecision `json:"decisions"`
+	Estimate        *PlanEstimate  `json:"estimate,omitempty"`
+	Warnings        []string       `json:"warnings,omitempty"`
+}
+
+// PlanArguments are the ffmpeg arguments a job resolves to, split the way
+// ffmpeg receives them
+type PlanArguments struct {
+	Global       []string `json:"global"`
+	Input        []string `json:"input"`
+	Output       []string `json:"output"`
+	VideoEncoder string   `json:"video_encoder,omitempty"`
+}
+
+// RuleDecision records the verdict of one planning rule
+type RuleDecision struct {
+	Rule   string     `json:"rule"`
+	Action PlanAction `json:"action"`
+	Reason string     `json:"reason"`
+}
+
+// PlanEstimate predicts a job's runtime and output size from earlier jobs
+// with the same profile
+type PlanEstimate struct {
+	Profile         string  `json:"profile"`
+	Samples         int64   `json:"samples"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	OutputBytes     int64   `json:"output_bytes"`
+}
+
+// ProbeResult is what ffprobe reports about a media file
+type ProbeResult struct {
+	FormatName      string        `json:"format_name"`
+	DurationSeconds float64       `json:"duration_seconds"`
+	SizeBytes       int64         `json:"size_bytes"`
+	BitRate         int64         `json:"bit_rate,omitempty"`
+	Streams         []ProbeStream `json:"streams"`
+}
+
+// ProbeStream describes one stream of a probed file
+type ProbeStream struct {
+	Index     int    `json:"index"`
+	CodecType string `json:"codec_type"`
+	CodecName string `json:"codec_name"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Channels  int    `json:"channels,omitempty"`
+	Language  string `json:"language,omitempty"`
+	Title     string `json:"title,omitempty"`
+	// Forced subtitles translate only foreign dialogue and signs
+	Forced bool `json:"forced,omitempty"`
+	// Comment marks commentary tracks
+	Comment bool `json:"comment,omitempty"`
+}
+
+// VideoStream returns the first video stream, or nil if there is none
+func (p *ProbeResult) VideoStream() *ProbeStream {
+	for i := range p.Streams {
+		if p.Streams[i].CodecType == "video" {
+			return &p.Streams[i]
+		}
+	}
+	return nil
+}
+
+// StreamsOf returns the streams of a type, e.g. "subtitle", in order; a
+// stream's position is its index in stream specifiers such as 0:s:N. A nil
+// result has no streams.
+func (p *ProbeResult) StreamsOf(codecType string) []ProbeStream {
+	if p == nil {
+		return nil
+	}
+	var streams []ProbeStream
+	for _, s := range p.Streams {
+		if s.CodecType == codecType {
+			streams = append(streams, s)
+		}
+	}
+	return streams
+}
+
+// Throughput summarises completed jobs that share a profile
+type Throughput struct {
+	Samples int64 `json:"samples"`
+	// Speed is the mean encoding speed as a multiple of real time
+	Speed float64 `json:"speed"`
+	// CompressionRatio is the mean input size divided by output size
+	CompressionRatio float64 `json:"compression_ratio"`
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AudioExtractOptions select the audio stream an audio_extract job writes
+// and how it is stored
+type AudioExtractOptions struct {
+	// Stream is the index among the input's audio streams; 0 is the first
+	Stream int `json:"stream,omitempty"`
+	// Codec is "copy" (default), "aac", "opus", "mp3" or "flac". Copied
+	// audio must fit the output file's container.
+	Codec string `json:"codec,omitempty"`
+	// Bitrate of lossy codecs, e.g. "192k"; the encoder's default when empty
+	Bitrate string `json:"bitrate,omitempty"`
+}
+
+// SubtitleExtractOptions select the subtitle stream a subtitle_extract job
+// writes. The output file's extension picks the format: srt, vtt or ass.
+type SubtitleExtractOptions struct {
+	// Stream is the index among the input's subtitle streams; 0 is the first
+	Stream int `json:"stream,omitempty"`
+}
+
+// audioEncoders are the ffmpeg encoders for each audio_extract codec
+var audioEncoders = map[string]string{
+	"copy": "copy",
+	"aac":  "aac",
+	"opus": "libopus",
+	"mp3":  "libmp3lame",
+	"flac": "flac",
+}
+
+// subtitleEncoders are the ffmpeg encoders for each subtitle container.
+// Only text subtitles convert between them; bitmap subtitles such as PGS
+// cannot be extracted this way.
+var subtitleEncoders = map[string]string{
+	"srt": "srt",
+	"vtt": "webvtt",
+	"ass": "ass",
+	"ssa": "ass",
+}
+
+// remuxHandler copies every stream into the output's container
+var remuxHandler = JobHandler{
+	Type:        JobTypeRemux,
+	Description: "Copy every stream into the container the output file's extension names, without re-encoding",
+	OutputArgs: func(j *Job) []string {
+		args := []string{"-map", "0", "-c", "copy"}
+		switch j.OutputContainer() {
+		case "mp4", "mov", "m4v":
+			args = append(args, "-movflags", "+faststart")
+		}
+		return append(args, j.OutputFilePath)
+	},
+	Output: fixedOutput(OutputFile),
+}
+
+// audioExtractHandler writes one audio stream to its own file
+var audioExtractHandler = JobHandler{
+	Type:        JobTypeAudioExtract,
+	Description: "Write one audio stream to its own file, copied or re-encoded",
+	Options:     "audio_extract",
+	Schema: `{
+		"type": "object",
+		"additionalProperties": false,
+		"description": "Options for audio_extract jobs",
+		"properties": {
+			"stream": {"type": "integer", "description": "Index among the input's audio streams; 0 is the first"},
+			"codec": {"type": "string", "enum": ["copy", "aac", "opus", "mp3", "flac"], "description": "copy when unset"},
+			"bitrate": {"type": "string", "pattern": "^[0-9]+(\\.[0-9]+)?[kKmM]?$", "description": "Bitrate of lossy codecs, e.g. 192k"}
+		}
+	}`,
+	OutputArgs: func(j *Job) []string {
+		o := j.audioExtractOptions()
+		args := []string{"-map", fmt.Sprintf("0:a:%d", o.Stream), "-c:a", audioEncoders[o.codec()]}
+		if o.Bitrate != "" {
+			args = append(args, "-b:a", o.Bitrate)
+		}
+		return append(args, j.OutputFilePath)
+	},
+	Output: fixedOutput(OutputFile),
+	Validate: func(j *Job) error {
+		o := j.audioExtractOptions()
+		codec := o.codec()
+		if _, ok := audioEncoders[codec]; !ok {
+			return &ValidationError{"audio_extract.codec", "must be one of copy, aac, opus, mp3, flac"}
+		}
+		switch {
+		case o.Stream < 0:
+			return &ValidationError{"audio_extract.stream", "must not be negative"}
+		case o.Bitrate == "":
+		case codec == "copy" || codec == "flac":
+			return &ValidationError{"audio_extract.bitrate", fmt.Sprintf("cannot be set when codec is %s", codec)}
+		default:
+			if _, ok := parseBitrate(o.Bitrate); !ok {
+				return &ValidationError{"audio_extract.bitrate", fmt.Sprintf("%q is not a bitrate such as 192k", o.Bitrate)}
+			}
+		}
+		return nil
+	},
+}
+
+// subtitleExtractHandler writes one subtitle stream to its own file
+var subtitleExtractHandler = JobHandler{
+	Type:        JobTypeSubtitleExtract,
+	Description: "Write one text subtitle stream to its own file; the output file's extension picks srt, vtt or ass",
+	Options:     "subtitle_extract",
+	Schema: `{
+		"type": "object",
+		"additionalProperties": false,
+		"description": "Options for subtitle_extract jobs",
+		"properties": {
+			"stream": {"type": "integer", "description": "Index among the input's subtitle streams; 0 is the first"}
+		}
+	}`,
+	OutputArgs: func(j *Job) []string {
+		var stream int
+		if j.SubtitleExtract != nil {
+			stream = j.SubtitleExtract.Stream
+		}
+		return []string{"-map", fmt.Sprintf("0:s:%d", stream), "-c:s", subtitleEncoders[j.OutputContainer()], j.OutputFilePath}
+	},
+	Output: fixedOutput(OutputFile),
+	Validate: func(j *Job) error {
+		if _, ok := subtitleEncoders[j.OutputContainer()]; !ok {
+			return &ValidationError{"output_file_path", "must end in .srt, .vtt or .ass for subtitle_extract jobs"}
+		}
+		if j.SubtitleExtract != nil && j.SubtitleExtract.Stream < 0 {
+			return &ValidationError{"subtitle_extract.stream", "must not be negative"}
+		}
+		return nil
+	},
+}
+
+// audioExtractOptions returns the job's audio_extract options, or the defaults
+func (j *Job) audioExtractOptions() *AudioExtractOptions {
+	if j.AudioExtract == nil {
+		return &AudioExtractOptions{}
+	}
+	return j.AudioExtract
+}
+
+// codec returns the audio codec, or copy
+func (o *AudioExtractOptions) codec() string {
+	if o.Codec == "" {
+		return "copy"
+	}
+	return strings.ToLower(o.Codec)
+}
@@ -0,0 +1,420 @@
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SubtitleMode selects what a simple transcode does with the input's
+// subtitle tracks
+type SubtitleMode string
+
+const (
+	// SubtitlesKeep stores the tracks in the output, converted to a format
+	// its container holds (default)
+	SubtitlesKeep SubtitleMode = "keep"
+	// SubtitlesDrop leaves every track out of the output
+	SubtitlesDrop SubtitleMode = "drop"
+	// SubtitlesBurn draws one track onto the video
+	SubtitlesBurn SubtitleMode = "burn"
+	// SubtitlesExtract writes the tracks to sidecar files next to the output
+	SubtitlesExtract SubtitleMode = "extract"
+)
+
+// SubtitleOptions control the subtitle tracks of a simple transcode.
+// Tracks are chosen from the probed input; when the input cannot be probed
+// ffmpeg's own stream selection applies.
+type SubtitleOptions struct {
+	Mode SubtitleMode `json:"mode,omitempty"`
+	// Languages keeps only tracks tagged with these ISO 639-2 codes, e.g.
+	// "eng"; every track when empty
+	Languages []string `json:"languages,omitempty"`
+	// Track is the track burn draws, as an index among the input's subtitle
+	// streams. By default burn draws the first forced track in Languages,
+	// or else the first track in Languages.
+	Track *int `json:"track,omitempty"`
+	// Format of extracted sidecars: "srt" (default), "vtt" or "ass". PGS
+	// tracks are extracted as .sup whatever the format.
+	Format string `json:"format,omitempty"`
+}
+
+// textSubtitleCodecs are the subtitle codecs ffmpeg converts between
+var textSubtitleCodecs = map[string]bool{
+	"subrip": true, "srt": true, "ass": true, "ssa": true, "webvtt": true, "mov_text": true, "text": true,
+}
+
+// bitmapSubtitleCodecs are drawn as images, so they can be copied or burnt
+// in but convert to no text format
+var bitmapSubtitleCodecs = map[string]bool{
+	"hdmv_pgs_subtitle": true, "dvd_subtitle": true, "dvb_subtitle": true, "xsub": true,
+}
+
+// languageCodePattern matches ISO 639-2 codes, the tags ffprobe reports
+var languageCodePattern = regexp.MustCompile(`^[A-Za-z]{3}$`)
+
+// subtitleTrack is one of the input's subtitle streams and what a job does
+// with it
+type subtitleTrack struct {
+	stream ProbeStream
+	// n is the index among the input's subtitle streams, as 0:s:N takes it
+	n int
+	// codec is the encoder that stores the track, "copy" when it fits as
+	// it is, or "" when it cannot be stored
+	codec string
+}
+
+func (t subtitleTrack) String() string {
+	s := fmt.Sprintf("subtitle track %d (%s", t.n, t.stream.CodecName)
+	if t.stream.Language != "" {
+		s += ", " + t.stream.Language
+	}
+	return s + ")"
+}
+
+// mode returns the subtitle mode, or keep
+func (o *SubtitleOptions) mode() SubtitleMode {
+	if o.Mode == "" {
+		return SubtitlesKeep
+	}
+	return SubtitleMode(strings.ToLower(string(o.Mode)))
+}
+
+// wants reports whether a track is in one of the kept languages
+func (o *SubtitleOptions) wants(s ProbeStream) bool {
+	if len(o.Languages) == 0 {
+		return true
+	}
+	for _, lang := range o.Languages {
+		if strings.EqualFold(lang, s.Language) {
+			return true
+		}
+	}
+	return false
+}
+
+// format returns the sidecar format, or srt
+func (o *SubtitleOptions) format() string {
+	if o.Format == "" {
+		return "srt"
+	}
+	return strings.ToLower(o.Format)
+}
+
+// validate checks subtitle options against the simple options holding them
+func (o *SubtitleOptions) validate(opts *SimpleOptions) error {
+	if o == nil {
+		return nil
+	}
+	mode := o.mode()
+	switch mode {
+	case SubtitlesKeep, SubtitlesDrop, SubtitlesBurn, SubtitlesExtract:
+	default:
+		return &ValidationError{"simple_options.subtitles.mode", "must be one of keep, drop, burn, extract"}
+	}
+	for _, lang := range o.Languages {
+		if !languageCodePattern.MatchString(lang) {
+			return &ValidationError{"simple_options.subtitles.languages", fmt.Sprintf("%q is not an ISO 639-2 code such as eng", lang)}
+		}
+	}
+
+	switch {
+	case o.Track != nil && mode != SubtitlesBurn:
+		return &ValidationError{"simple_options.subtitles.track", "only applies when mode is burn"}
+	case o.Track != nil && *o.Track < 0:
+		return &ValidationError{"simple_options.subtitles.track", "must not be negative"}
+	case o.Format != "" && mode != SubtitlesExtract:
+		return &ValidationError{"simple_options.subtitles.format", "only applies when mode is extract"}
+	}
+	if _, ok := subtitleEncoders[o.format()]; !ok {
+		return &ValidationError{"simple_options.subtitles.format", "must be one of srt, vtt, ass"}
+	}
+
+	if mode == SubtitlesBurn {
+		// Subtitles are drawn onto decoded frames on the CPU
+		if opts.codec() == VideoCodecCopy {
+			return &ValidationError{"simple_options.subtitles.mode", "burn cannot be used when video_codec is copy"}
+		}
+		if opts.UseHardwareAcceleration {
+			return &ValidationError{"simple_options.subtitles.mode", "burn cannot be used with use_hardware_acceleration"}
+		}
+	}
+	return nil
+}
+
+// burnsSubtitles reports whether the options draw a subtitle track onto the
+// video, which then scales in the same filter as the subtitles
+func (o *SimpleOptions) burnsSubtitles() bool {
+	return o.Subtitles != nil && o.Subtitles.mode() == SubtitlesBurn
+}
+
+// subtitleOptions returns the job's subtitle options, or nil when it
+// leaves subtitles to ffmpeg
+func (j *Job) subtitleOptions() *SubtitleOptions {
+	if j.SimpleOptions == nil || j.ABR != nil {
+		return nil
+	}
+	return j.SimpleOptions.Subtitles
+}
+
+// subtitleCodecFor returns the encoder that stores a subtitle codec in a
+// container, "copy" when it fits as it is, or "" when the container cannot
+// hold it
+func subtitleCodecFor(container, codec string) string {
+	text, bitmap := textSubtitleCodecs[codec], bitmapSubtitleCodecs[codec]
+	switch container {
+	case "mp4", "m4v", "mov":
+		if codec == "mov_text" {
+			return "copy"
+		}
+		if text {
+			return "mov_text"
+		}
+	case "mkv":
+		// Matroska holds every text and bitmap format but mov_text
+		if codec == "mov_text" {
+			return "srt"
+		}
+		if text || bitmap {
+			return "copy"
+		}
+	case "webm":
+		if codec == "webvtt" {
+			return "copy"
+		}
+		if text {
+			return "webvtt"
+		}
+	case "ts":
+		if codec == "dvb_subtitle" {
+			return "copy"
+		}
+	}
+	return ""
+}
+
+// subtitleTracks returns the probed input's subtitle tracks in the
+// languages o keeps, with the encoder that stores each in the output's
+// container
+func (j *Job) subtitleTracks(o *SubtitleOptions) []subtitleTrack {
+	var tracks []subtitleTrack
+	for n, s := range j.probe.StreamsOf("subtitle") {
+		if o.wants(s) {
+			tracks = append(tracks, subtitleTrack{stream: s, n: n, codec: subtitleCodecFor(j.OutputContainer(), s.CodecName)})
+		}
+	}
+	return tracks
+}
+
+// subtitleMaps map the subtitle tracks a transcode keeps and set the
+// encoder of each. They are nil when the job leaves subtitles to ffmpeg or
+// does not store them. Jobs that choose their audio tracks keep subtitles
+// as keep mode does, since their mapping stops ffmpeg picking any.
+func (j *Job) subtitleMaps() []string {
+	o := j.subtitleOptions()
+	if o == nil && j.audioOptions() != nil {
+		o = &SubtitleOptions{}
+	}
+	if o == nil || o.mode() != SubtitlesKeep {
+		return nil
+	}
+	var args []string
+	out := 0
+	for _, t := range j.subtitleTracks(o) {
+		if t.codec == "" {
+			continue
+		}
+		args = append(args, "-map", fmt.Sprintf("0:s:%d", t.n), fmt.Sprintf("-c:s:%d", out), t.codec)
+		out++
+	}
+	return args
+}
+
+// dropsSubtitles reports whether subtitle tracks stay out of the output:
+// they are dropped, drawn onto the video or written to sidecars
+func (j *Job) dropsSubtitles() bool {
+	o := j.subtitleOptions()
+	return o != nil && o.mode() != SubtitlesKeep
+}
+
+// burnTrack returns the track burn draws, and false when the probed input
+// has no such track. Unprobed inputs draw Track, or the first, as text.
+func (j *Job) burnTrack() (subtitleTrack, bool) {
+	o := j.subtitleOptions()
+	if j.probe == nil {
+		t := subtitleTrack{stream: ProbeStream{CodecType: "subtitle"}}
+		if o.Track != nil {
+			t.n = *o.Track
+		}
+		return t, true
+	}
+
+	subs := j.probe.StreamsOf("subtitle")
+	if o.Track != nil {
+		if *o.Track >= len(subs) {
+			return subtitleTrack{n: *o.Track}, false
+		}
+		return subtitleTrack{stream: subs[*o.Track], n: *o.Track}, true
+	}
+	tracks := j.subtitleTracks(o)
+	for _, t := range tracks {
+		if t.stream.Forced {
+			return t, true
+		}
+	}
+	if len(tracks) == 0 {
+		return subtitleTrack{}, false
+	}
+	return tracks[0], true
+}
+
+// burnArgs draw the burnt-in track onto the video before it is scaled, so
+// the subtitles scale with the picture. Text subtitles are rendered by
+// libass from the input file; bitmap subtitles are overlaid from their
+// stream, and video is the label of the overlaid video to map. Both are
+// empty unless the job burns in subtitles.
+func (j *Job) burnArgs() (args []string, video string) {
+	o := j.subtitleOptions()
+	if o == nil || o.mode() != SubtitlesBurn {
+		return nil, ""
+	}
+	var scale string
+	if dimension := j.SimpleOptions.dimension(); dimension != "" {
+		scale = "scale=" + dimension
+	}
+
+	t, ok := j.burnTrack()
+	if !ok {
+		// Nothing to draw; the video is still scaled
+		if scale == "" {
+			return nil, ""
+		}
+		return []string{"-vf", scale}, ""
+	}
+
+	if bitmapSubtitleCodecs[t.stream.CodecName] {
+		filter := fmt.Sprintf("[0:V:0][0:s:%d]overlay", t.n)
+		if scale != "" {
+			filter += "," + scale
+		}
+		return []string{"-filter_complex", filter + "[v]"}, "[v]"
+	}
+
+	filter := fmt.Sprintf("subtitles=filename=%s:si=%d", escapeFilterValue(j.InputFilePath), t.n)
+	// The subtitles filter reads the file from its start, so trimmed video
+	// is shifted back onto the input's timeline while it is drawn
+	if start, ok := ParseTimestamp(j.SimpleOptions.TrimFrom); ok && start > 0 {
+		filter = fmt.Sprintf("setpts=PTS+%g/TB,%s,setpts=PTS-STARTPTS", start, filter)
+	}
+	if scale != "" {
+		filter += "," + scale
+	}
+	return []string{"-vf", filter}, ""
+}
+
+// sidecar is an extracted subtitle track and the file it is written to
+type sidecar struct {
+	subtitleTrack
+	path string
+}
+
+// sidecars names the file each extracted track is written to: the output
+// file's name with the track's language and the format's extension, e.g.
+// movie.eng.srt or movie.eng.forced.srt. Later tracks that would share a
+// name are numbered: movie.eng.2.srt. PGS tracks are copied to .sup files;
+// other bitmap tracks cannot be extracted and are left out.
+func (j *Job) sidecars() []sidecar {
+	o := j.subtitleOptions()
+	if o == nil || o.mode() != SubtitlesExtract {
+		return nil
+	}
+	base := strings.TrimSuffix(j.OutputFilePath, filepath.Ext(j.OutputFilePath))
+
+	var files []sidecar
+	seen := map[string]int{}
+	for _, t := range j.subtitleTracks(o) {
+		ext, codec := o.format(), subtitleEncoders[o.format()]
+		switch {
+		case t.stream.CodecName == "hdmv_pgs_subtitle":
+			ext, codec = "sup", "copy"
+		case !textSubtitleCodecs[t.stream.CodecName]:
+			continue
+		}
+
+		name := base + "." + strings.ToLower(orUndetermined(t.stream.Language))
+		if t.stream.Forced {
+			name += ".forced"
+		}
+		seen[name+"."+ext]++
+		if n := seen[name+"."+ext]; n > 1 {
+			name = fmt.Sprintf("%s.%d", name, n)
+		}
+		t.codec = codec
+		files = append(files, sidecar{t, name + "." + ext})
+	}
+	return files
+}
+
+// sidecarArgs add an output for each extracted subtitle track after the
+// job's main output
+func (j *Job) sidecarArgs() []string {
+	var args []string
+	for _, s := range j.sidecars() {
+		args = append(args, "-map", fmt.Sprintf("0:s:%d", s.n), "-c:s", s.codec, s.path)
+	}
+	return args
+}
+
+// subtitleWarnings report the subtitle tracks a job asked for that it
+// cannot keep, draw or extract
+func (j *Job) subtitleWarnings() []string {
+	o := j.subtitleOptions()
+	if o == nil {
+		return nil
+	}
+	if j.probe == nil {
+		if o.mode() == SubtitlesExtract {
+			return []string{"no subtitles are extracted: the input's subtitle tracks are unknown"}
+		}
+		return nil
+	}
+
+	var warnings []string
+	switch o.mode() {
+	case SubtitlesKeep:
+		for _, t := range j.subtitleTracks(o) {
+			if t.codec == "" {
+				warnings = append(warnings, fmt.Sprintf("%s cannot be stored in %s and is dropped; burn it in or extract it instead", t, j.OutputContainer()))
+			}
+		}
+	case SubtitlesBurn:
+		t, ok := j.burnTrack()
+		switch {
+		case ok:
+		case o.Track != nil:
+			warnings = append(warnings, fmt.Sprintf("nothing is burnt in: the input has no subtitle track %d", t.n))
+		default:
+			warnings = append(warnings, "nothing is burnt in: no subtitle track is in the requested languages")
+		}
+	case SubtitlesExtract:
+		extracted := map[int]bool{}
+		for _, s := range j.sidecars() {
+			extracted[s.n] = true
+		}
+		for _, t := range j.subtitleTracks(o) {
+			if !extracted[t.n] {
+				warnings = append(warnings, fmt.Sprintf("%s is a bitmap format and cannot be extracted", t))
+			}
+		}
+	}
+	return warnings
+}
+
+// escapeFilterValue escapes a filter option value twice over, for the
+// filter's option parser and then the filtergraph parser, so that paths
+// with colons, quotes or commas reach the filter intact
+func escapeFilterValue(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(s)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(s)
+}
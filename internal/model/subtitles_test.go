@@ -0,0 +1,201 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var subtitleProbe = &ProbeResult{Streams: []ProbeStream{
+	{Index: 0, CodecType: "video", CodecName: "h264", Height: 1080},
+	{Index: 1, CodecType: "audio", CodecName: "aac", Language: "eng"},
+	{Index: 2, CodecType: "subtitle", CodecName: "subrip", Language: "eng"},
+	{Index: 3, CodecType: "subtitle", CodecName: "hdmv_pgs_subtitle", Language: "eng"},
+	{Index: 4, CodecType: "subtitle", CodecName: "subrip", Language: "fre", Forced: true},
+}}
+
+func subtitleJob(output string, subs SubtitleOptions, probe *ProbeResult) Job {
+	job := Job{
+		InputFilePath:  "/media/in.mkv",
+		OutputFilePath: output,
+		SimpleOptions:  &SimpleOptions{QualityPreset: PresetFast, VideoCodec: VideoCodecH264, Subtitles: &subs},
+	}
+	job.convertSimpleOptionsToArguments()
+	job.ApplyProbe(probe)
+	return job
+}
+
+func TestSubtitleStreams(t *testing.T) {
+	track := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		job      Job
+		want     []string
+		sidecars []string
+		warnings []string
+	}{
+		{
+			name: "Keep converts text tracks for MP4 and drops PGS",
+			job:  subtitleJob("/out/movie.mp4", SubtitleOptions{}, subtitleProbe),
+			want: []string{"-map", "0:V:0?", "-map", "0:a?",
+				"-map", "0:s:0", "-c:s:0", "mov_text", "-map", "0:s:2", "-c:s:1", "mov_text"},
+			warnings: []string{"subtitle track 1 (hdmv_pgs_subtitle, eng) cannot be stored in mp4 and is dropped; burn it in or extract it instead"},
+		},
+		{
+			name: "Keep copies PGS into Matroska",
+			job:  subtitleJob("/out/movie.mkv", SubtitleOptions{Languages: []string{"ENG"}}, subtitleProbe),
+			want: []string{"-map", "0:V:0?", "-map", "0:a?",
+				"-map", "0:s:0", "-c:s:0", "copy", "-map", "0:s:1", "-c:s:1", "copy"},
+		},
+		{
+			name: "Keep without a probe leaves selection to ffmpeg",
+			job:  subtitleJob("/out/movie.mp4", SubtitleOptions{}, nil),
+		},
+		{
+			name: "Drop",
+			job:  subtitleJob("/out/movie.mp4", SubtitleOptions{Mode: SubtitlesDrop}, subtitleProbe),
+			want: []string{"-sn"},
+		},
+		{
+			name: "Burn prefers a forced track",
+			job:  subtitleJob("/out/movie.mp4", SubtitleOptions{Mode: SubtitlesBurn}, subtitleProbe),
+			want: []string{"-vf", "subtitles=filename=/media/in.mkv:si=2", "-sn"},
+		},
+		{
+			name: "Burn overlays a bitmap track",
+			job:  subtitleJob("/out/movie.mp4", SubtitleOptions{Mode: SubtitlesBurn, Track: track(1)}, subtitleProbe),
+			want: []string{"-filter_complex", "[0:V:0][0:s:1]overlay[v]", "-map", "[v]", "-map", "0:a?", "-sn"},
+		},
+		{
+			name:     "Burn a missing track",
+			job:      subtitleJob("/out/movie.mp4", SubtitleOptions{Mode: SubtitlesBurn, Languages: []string{"spa"}}, subtitleProbe),
+			want:     []string{"-sn"},
+			warnings: []string{"nothing is burnt in: no subtitle track is in the requested languages"},
+		},
+		{
+			name: "Extract to sidecars",
+			job:  subtitleJob("/out/movie.mp4", SubtitleOptions{Mode: SubtitlesExtract, Format: "vtt"}, subtitleProbe),
+			want: []string{"-sn"},
+			sidecars: []string{
+				"-map", "0:s:0", "-c:s", "webvtt", "/out/movie.eng.vtt",
+				"-map", "0:s:1", "-c:s", "copy", "/out/movie.eng.sup",
+				"-map", "0:s:2", "-c:s", "webvtt", "/out/movie.fre.forced.vtt",
+			},
+		},
+		{
+			name:     "Extract without a probe",
+			job:      subtitleJob("/out/movie.mp4", SubtitleOptions{Mode: SubtitlesExtract}, nil),
+			want:     []string{"-sn"},
+			warnings: []string{"no subtitles are extracted: the input's subtitle tracks are unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.job.streamArgs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("streamArgs() = %v, want %v", got, tt.want)
+			}
+			if got := tt.job.sidecarArgs(); !reflect.DeepEqual(got, tt.sidecars) {
+				t.Errorf("sidecarArgs() = %v, want %v", got, tt.sidecars)
+			}
+			if got := tt.job.StreamWarnings(); !reflect.DeepEqual(got, tt.warnings) {
+				t.Errorf("StreamWarnings() = %q, want %q", got, tt.warnings)
+			}
+		})
+	}
+}
+
+func TestSubtitleCommand(t *testing.T) {
+	job := subtitleJob("/out/movie.mp4", SubtitleOptions{Mode: SubtitlesExtract}, subtitleProbe)
+	args := job.OutputArgs()
+	if i := indexOf(args, "/out/movie.mp4"); i < 0 || args[i-1] != "-sn" || args[i+1] != "-map" {
+		t.Errorf("OutputArgs() = %v, want the sidecars after the main output", args)
+	}
+
+	// Burnt-in subtitles are drawn before scaling, in a single filter
+	job = subtitleJob("/out/movie.mp4", SubtitleOptions{Mode: SubtitlesBurn}, nil)
+	job.SimpleOptions.Resolution = "720p"
+	job.SimpleOptions.TrimFrom = "00:01:30"
+	job.convertSimpleOptionsToArguments()
+	cmd := strings.Join(job.GetFFmpegCommand(), " ")
+	want := "-vf setpts=PTS+90/TB,subtitles=filename=/media/in.mkv:si=0,setpts=PTS-STARTPTS,scale=1280:720 -sn /out/movie.mp4"
+	if !strings.HasSuffix(cmd, want) || strings.Count(cmd, "-vf") != 1 {
+		t.Errorf("GetFFmpegCommand() = %s, want it to end %s", cmd, want)
+	}
+}
+
+func TestSidecarNamesAreUnique(t *testing.T) {
+	probe := &ProbeResult{Streams: []ProbeStream{
+		{CodecType: "subtitle", CodecName: "ass", Language: "eng"},
+		{CodecType: "subtitle", CodecName: "subrip", Language: "eng"},
+		{CodecType: "subtitle", CodecName: "dvd_subtitle", Language: "eng"},
+		{CodecType: "subtitle", CodecName: "webvtt"},
+	}}
+	job := subtitleJob("/out/movie.mkv", SubtitleOptions{Mode: SubtitlesExtract}, probe)
+
+	var paths []string
+	for _, s := range job.sidecars() {
+		paths = append(paths, s.path)
+	}
+	want := []string{"/out/movie.eng.srt", "/out/movie.eng.2.srt", "/out/movie.und.srt"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("sidecars() = %v, want %v", paths, want)
+	}
+	warnings := job.StreamWarnings()
+	if len(warnings) != 1 || warnings[0] != "subtitle track 2 (dvd_subtitle, eng) is a bitmap format and cannot be extracted" {
+		t.Errorf("StreamWarnings() = %q", warnings)
+	}
+}
+
+func TestEscapeFilterValue(t *testing.T) {
+	got := escapeFilterValue(`/media/it's: a [cut], 2.mkv`)
+	want := `/media/it\\\'s\\: a \[cut\]\, 2.mkv`
+	if got != want {
+		t.Errorf("escapeFilterValue() = %s, want %s", got, want)
+	}
+}
+
+func TestValidateSubtitles(t *testing.T) {
+	track := -1
+	tests := []struct {
+		name  string
+		opts  SimpleOptions
+		field string
+	}{
+		{"Keep", SimpleOptions{Subtitles: &SubtitleOptions{Languages: []string{"eng", "fre"}}}, ""},
+		{"Unknown mode", SimpleOptions{Subtitles: &SubtitleOptions{Mode: "hide"}}, "simple_options.subtitles.mode"},
+		{"Two-letter language", SimpleOptions{Subtitles: &SubtitleOptions{Languages: []string{"en"}}}, "simple_options.subtitles.languages"},
+		{"Negative track", SimpleOptions{Subtitles: &SubtitleOptions{Mode: SubtitlesBurn, Track: &track}}, "simple_options.subtitles.track"},
+		{"Track without burn", SimpleOptions{Subtitles: &SubtitleOptions{Track: new(int)}}, "simple_options.subtitles.track"},
+		{"Format without extract", SimpleOptions{Subtitles: &SubtitleOptions{Format: "vtt"}}, "simple_options.subtitles.format"},
+		{"Unknown format", SimpleOptions{Subtitles: &SubtitleOptions{Mode: SubtitlesExtract, Format: "sub"}}, "simple_options.subtitles.format"},
+		{"Burn into copied video", SimpleOptions{VideoCodec: VideoCodecCopy, Subtitles: &SubtitleOptions{Mode: SubtitlesBurn}}, "simple_options.subtitles.mode"},
+		{"Burn on hardware", SimpleOptions{UseHardwareAcceleration: true, Subtitles: &SubtitleOptions{Mode: SubtitlesBurn}}, "simple_options.subtitles.mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := Job{InputFilePath: "in.mkv", OutputFilePath: "out.mkv", SimpleOptions: &tt.opts}
+			err := job.Validate()
+			var field string
+			if v, ok := err.(*ValidationError); ok {
+				field = v.Field
+			} else if err != nil {
+				t.Fatalf("Validate() = %v, want a ValidationError", err)
+			}
+			if field != tt.field {
+				t.Errorf("Validate() = %v, want an error on %q", err, tt.field)
+			}
+		})
+	}
+}
+
+func indexOf(args []string, s string) int {
+	for i, a := range args {
+		if a == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WorkerInfo describes a running worker process as advertised in the registry
+type WorkerInfo struct {
+	ID                 string    `json:"id"`
+	Hostname           string    `json:"hostname,omitempty"`
+	StartedAt          time.Time `json:"started_at"`
+	LastSeen           time.Time `json:"last_seen"`
+	MaxParallelization int       `json:"max_parallelization"`
+	InFlight           int       `json:"in_flight"`
+	// Draining is set by an administrator, not by the worker itself
+	Draining bool `json:"draining,omitempty"`
+	// Capabilities is missing for workers that predate advertising them
+	Capabilities *WorkerCapabilities `json:"capabilities,omitempty"`
+}
+
+// DispatchState tells a worker whether it may take new jobs. Dispatching can
+// be paused for every worker, or a single worker drained so it finishes its
+// current jobs and takes no more.
+type DispatchState struct {
+	Paused   bool `json:"paused"`
+	Draining bool `json:"draining"`
+}
+
+// Accepting reports whether a worker may dequeue another job
+func (s DispatchState) Accepting() bool {
+	return !s.Paused && !s.Draining
+}
+
+// WorkerCapabilities describes what a worker can encode. Workers detect
+// them at startup and advertise them in the registry.
+type WorkerCapabilities struct {
+	// Encoders lists the encoders the worker's ffmpeg build provides
+	Encoders []string `json:"encoders,omitempty"`
+	// HardwareBackend is the acceleration API the worker is configured for
+	HardwareBackend HardwareBackend `json:"hardware_backend,omitempty"`
+	// HardwareEncode lists the codecs the worker can encode in hardware
+	HardwareEncode []VideoCodec `json:"hardware_encode,omitempty"`
+	// Devices lists the hardware devices present, such as /dev/dri/renderD128
+	Devices []string `json:"devices,omitempty"`
+	// MaxSessions is how many hardware encodes the worker runs at once
+	MaxSessions int `json:"max_sessions,omitempty"`
+	CPUs        int `json:"cpus"`
+}
+
+// JobRequirements restricts which workers may run a job
+type JobRequirements struct {
+	// HardwareEncode lists codecs the worker must encode in hardware
+	HardwareEncode []VideoCodec `json:"hardware_encode,omitempty"`
+	// Encoders lists encoders the worker's ffmpeg must provide, such as
+	// "libsvtav1"
+	Encoders []string `json:"encoders,omitempty"`
+	// SoftwareFallback lets the job be encoded in software when no live
+	// worker has the hardware or the hardware fails. Encoders stay required.
+	SoftwareFallback bool `json:"software_fallback,omitempty"`
+}
+
+// UnmarshalJSON accepts software_fallback as a boolean or in the legacy
+// string forms
+func (r *JobRequirements) UnmarshalJSON(data []byte) error {
+	type JobRequirementsAlias JobRequirements
+	aux := struct {
+		*JobRequirementsAlias
+		SoftwareFallback json.RawMessage `json:"software_fallback"`
+	}{JobRequirementsAlias: (*JobRequirementsAlias)(r)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var err error
+	r.SoftwareFallback, err = decodeFlag("software_fallback", aux.SoftwareFallback)
+	return err
+}
+
+// Satisfies reports whether a worker with these capabilities meets every
+// requirement. Jobs without requirements run anywhere.
+func (c *WorkerCapabilities) Satisfies(req *JobRequirements) bool {
+	if req == nil {
+		return true
+	}
+	return c.hasEncoders(req) && containsAll(c.HardwareEncode, req.HardwareEncode)
+}
+
+// SatisfiesInSoftware reports whether a worker with these capabilities may
+// run the job in software instead of on the hardware it asks for
+func (c *WorkerCapabilities) SatisfiesInSoftware(req *JobRequirements) bool {
+	return req != nil && req.SoftwareFallback && c.hasEncoders(req)
+}
+
+func (c *WorkerCapabilities) hasEncoders(req *JobRequirements) bool {
+	return containsAll(c.Encoders, req.Encoders)
+}
+
+// containsAll reports whether have includes every element of want
+func containsAll[T comparable](have, want []T) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestSatisfies(t *testing.T) {
+	arc := WorkerCapabilities{Encoders: []string{"av1_qsv", "libsvtav1"}, HardwareEncode: []VideoCodec{VideoCodecAV1}}
+	cpu := WorkerCapabilities{Encoders: []string{"libsvtav1"}}
+
+	tests := []struct {
+		name         string
+		req          *JobRequirements
+		wantARC      bool
+		wantCPU      bool
+		wantSoftware bool
+	}{
+		{"No requirements", nil, true, true, false},
+		{"Encoder", &JobRequirements{Encoders: []string{"libsvtav1"}}, true, true, false},
+		{"Hardware", &JobRequirements{HardwareEncode: []VideoCodec{VideoCodecAV1}}, true, false, false},
+		{"Hardware with fallback", &JobRequirements{HardwareEncode: []VideoCodec{VideoCodecAV1}, SoftwareFallback: true}, true, false, true},
+		{"Fallback keeps encoders required", &JobRequirements{Encoders: []string{"libx265"}, SoftwareFallback: true}, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := arc.Satisfies(tt.req); got != tt.wantARC {
+				t.Errorf("hardware worker Satisfies() = %v, want %v", got, tt.wantARC)
+			}
+			if got := cpu.Satisfies(tt.req); got != tt.wantCPU {
+				t.Errorf("CPU worker Satisfies() = %v, want %v", got, tt.wantCPU)
+			}
+			if got := cpu.SatisfiesInSoftware(tt.req); got != tt.wantSoftware {
+				t.Errorf("CPU worker SatisfiesInSoftware() = %v, want %v", got, tt.wantSoftware)
+			}
+		})
+	}
+}
+
+func TestRequirementsFlags(t *testing.T) {
+	for body, want := range map[string]bool{
+		`{"requirements":{"software_fallback":true}}`:  true,
+		`{"requirements":{"software_fallback":"yes"}}`: true,
+		`{"requirements":{"software_fallback":"0"}}`:   false,
+		`{"requirements":{"encoders":["libsvtav1"]}}`:  false,
+	} {
+		var job Job
+		if err := json.Unmarshal([]byte(body), &job); err != nil {
+			t.Fatalf("json.Unmarshal(%s) error = %v", body, err)
+		}
+		if got := job.Requirements.SoftwareFallback; got != want {
+			t.Errorf("json.Unmarshal(%s) software_fallback = %v, want %v", body, got, want)
+		}
+	}
+
+	var job Job
+	var typeErr *json.UnmarshalTypeError
+	body := `{"requirements":{"software_fallback":"maybe"}}`
+	if err := json.Unmarshal([]byte(body), &job); !errors.As(err, &typeErr) || typeErr.Field != "requirements.software_fallback" {
+		t.Errorf("json.Unmarshal(%s) error = %v, want a type error for requirements.software_fallback", body, err)
+	}
+}
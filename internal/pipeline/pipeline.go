@@ -0,0 +1,235 @@
+// Package pipeline runs pipelines of dependent jobs. The API server starts a
+// pipeline by queueing its first steps; workers report each step's job as it
+// finishes, which queues the steps waiting for it. Every transition is made
+// on the pipeline's record in Redis, so any server or worker can advance any
+// pipeline.
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/repository/redis"
+	"transcodeflow/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// NotifyTimeout bounds the POST of a finished pipeline to its notify_url
+var NotifyTimeout = 10 * time.Second
+
+// errUnchanged aborts a record update that has nothing to record
+var errUnchanged = errors.New("pipeline record unchanged")
+
+// Orchestrator advances pipelines as their steps' jobs finish
+type Orchestrator struct {
+	redis redis.RedisClient
+	// client posts finished pipelines to their notify_url
+	client *http.Client
+	// remove deletes a file or empty directory a step created during
+	// compensation
+	remove func(path string) error
+}
+
+// New returns an orchestrator keeping its pipelines in Redis
+func New(r redis.RedisClient) *Orchestrator {
+	return &Orchestrator{
+		redis:  r,
+		client: &http.Client{Timeout: NotifyTimeout},
+		remove: os.Remove,
+	}
+}
+
+// Start queues the first steps of a pipeline whose record has been created
+func (o *Orchestrator) Start(ctx context.Context, id string) (model.PipelineRecord, error) {
+	return o.advance(ctx, id, nil)
+}
+
+// StepFinished records the outcome of a pipeline step's job and queues the
+// steps it unblocks. Jobs not queued by a pipeline are ignored.
+func (o *Orchestrator) StepFinished(ctx context.Context, job model.JobRecord) error {
+	if job.Job.Pipeline == "" {
+		return nil
+	}
+	_, err := o.advance(ctx, job.Job.Pipeline, func(rec *model.PipelineRecord) bool {
+		return rec.FinishStep(job.Job.Step, job)
+	})
+	return err
+}
+
+// advance applies change to a pipeline's record, then schedules it: the
+// steps that became ready are queued, and a pipeline that has finished is
+// compensated and reported. change returns false when it changed nothing.
+func (o *Orchestrator) advance(ctx context.Context, id string, change func(*model.PipelineRecord) bool) (model.PipelineRecord, error) {
+	var queued []int
+	var settled bool
+	record, err := o.redis.UpdatePipelineRecord(ctx, id, func(rec *model.PipelineRecord) error {
+		if change != nil && !change(rec) {
+			return errUnchanged
+		}
+		running := rec.State == model.PipelineRunning
+		queued = rec.Schedule(time.Now().UTC())
+		settled = running && rec.State != model.PipelineRunning
+		return nil
+	})
+	if errors.Is(err, errUnchanged) {
+		return record, nil
+	}
+	if err != nil {
+		return record, err
+	}
+
+	log := telemetry.Logger.With(zap.String("pipeline_id", id))
+	for _, i := range queued {
+		if err := o.queueStep(ctx, record, i); err != nil {
+			log.Error("System error: Failed to queue pipeline step", zap.String("step", record.Steps[i].Name), zap.Error(err))
+		}
+	}
+	if settled {
+		if record.State == model.PipelineCompensating {
+			record = o.compensate(ctx, record)
+		}
+		o.finish(ctx, record)
+	}
+	return record, nil
+}
+
+// queueStep creates the job record of a step and enqueues its job. A job
+// that cannot be enqueued fails, which fails its step.
+func (o *Orchestrator) queueStep(ctx context.Context, record model.PipelineRecord, i int) error {
+	job := record.StepJob(i)
+	ctx, span := telemetry.Tracer().Start(ctx, "enqueue pipeline step",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("pipeline.id", record.ID),
+			attribute.String("pipeline.step", job.Step),
+			attribute.String("job.id", job.ID),
+		))
+	job.TraceContext = telemetry.InjectTraceContext(ctx)
+
+	jobRecord := model.JobRecord{
+		ID:          job.ID,
+		State:       model.JobStateQueued,
+		Job:         job,
+		SubmittedAt: time.Now().UTC(),
+		Attempts:    1,
+	}
+	job.Attempt = jobRecord.Attempts
+	err := o.redis.CreateJobRecord(ctx, jobRecord)
+	if err == nil {
+		var jobBytes []byte
+		jobBytes, err = json.Marshal(job)
+		if err == nil {
+			err = o.redis.EnqueueJob(ctx, string(jobBytes))
+		}
+	}
+	telemetry.EndSpan(span, err)
+	if err == nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	jobRecord.State = model.JobStateFailed
+	jobRecord.FinishedAt = &now
+	jobRecord.Error = "failed to enqueue job: " + err.Error()
+	if _, updateErr := o.redis.UpdateJobRecord(ctx, job.ID, func(rec *model.JobRecord) error {
+		*rec = jobRecord
+		return nil
+	}); updateErr != nil && !errors.Is(updateErr, redis.ErrJobNotFound) {
+		telemetry.Logger.Warn("Failed to mark unqueued pipeline step as failed", zap.String("job_id", job.ID), zap.Error(updateErr))
+	}
+	if stepErr := o.StepFinished(ctx, jobRecord); stepErr != nil {
+		return errors.Join(err, stepErr)
+	}
+	return err
+}
+
+// compensate removes what a failed pipeline's succeeded steps created,
+// latest first, and records the pipeline as compensated. Only the files and
+// directories the steps' jobs recorded creating are removed, never anything
+// else at their output paths. Outputs that cannot be removed are noted on
+// their step.
+func (o *Orchestrator) compensate(ctx context.Context, record model.PipelineRecord) model.PipelineRecord {
+	steps := record.Compensations()
+	removeErrs := make(map[int]error, len(steps))
+	for _, i := range steps {
+		// Directories are listed before their contents, so are emptied first
+		created := record.Steps[i].Created
+		for k := len(created) - 1; k >= 0; k-- {
+			if err := o.remove(created[k]); err != nil && !os.IsNotExist(err) {
+				if removeErrs[i] == nil {
+					removeErrs[i] = err
+				}
+				telemetry.Logger.Warn("Failed to remove pipeline step output",
+					zap.String("pipeline_id", record.ID), zap.String("path", created[k]), zap.Error(err))
+			}
+		}
+	}
+
+	updated, err := o.redis.UpdatePipelineRecord(ctx, record.ID, func(rec *model.PipelineRecord) error {
+		for _, i := range steps {
+			if err := removeErrs[i]; err != nil {
+				rec.Steps[i].Error = "failed to remove output: " + err.Error()
+				continue
+			}
+			rec.Steps[i].State = model.StepCompensated
+		}
+		now := time.Now().UTC()
+		rec.State = model.PipelineCompensated
+		rec.FinishedAt = &now
+		return nil
+	})
+	if err != nil {
+		telemetry.Logger.Error("System error: Failed to record pipeline compensation", zap.String("pipeline_id", record.ID), zap.Error(err))
+		return record
+	}
+	return updated
+}
+
+// finish releases the quota slot a finished pipeline held and posts its
+// record to the pipeline's notify_url
+func (o *Orchestrator) finish(ctx context.Context, record model.PipelineRecord) {
+	log := telemetry.Logger.With(zap.String("pipeline_id", record.ID))
+	log.Info("Pipeline finished", zap.String("state", string(record.State)))
+
+	if record.Submitter != "" {
+		if err := o.redis.ReleaseSubmitterSlot(ctx, record.Submitter); err != nil {
+			log.Error("System error: Failed to release submitter slot", zap.Error(err))
+		}
+	}
+	if record.Pipeline.NotifyURL != "" {
+		if err := o.notify(ctx, record); err != nil {
+			log.Warn("Failed to notify pipeline completion", zap.String("notify_url", record.Pipeline.NotifyURL), zap.Error(err))
+		}
+	}
+}
+
+// notify posts a finished pipeline's record to its notify_url
+func (o *Orchestrator) notify(ctx context.Context, record model.PipelineRecord) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, record.Pipeline.NotifyURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notify_url responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"transcodeflow/internal/model"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// storePipeline makes the pipeline record mocks keep a record in memory,
+// applying updates like the Redis implementation does
+func storePipeline(redisMock *mocks.RedisClient, record *model.PipelineRecord) {
+	redisMock.On("UpdatePipelineRecord", mock.Anything, record.ID, mock.Anything).Return(
+		func(_ context.Context, _ string, update func(*model.PipelineRecord) error) (model.PipelineRecord, error) {
+			updated := *record
+			updated.Steps = append([]model.PipelineStepStatus(nil), record.Steps...)
+			if err := update(&updated); err != nil {
+				return model.PipelineRecord{}, err
+			}
+			*record = updated
+			return updated, nil
+		}).Maybe()
+}
+
+// queuedJobs records the jobs enqueued by the orchestrator
+func queuedJobs(redisMock *mocks.RedisClient) *[]model.Job {
+	var jobs []model.Job
+	redisMock.On("CreateJobRecord", mock.Anything, mock.Anything).Return(nil).Maybe()
+	redisMock.On("EnqueueJob", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		var job model.Job
+		json.Unmarshal([]byte(args.String(1)), &job)
+		jobs = append(jobs, job)
+	}).Return(nil).Maybe()
+	return &jobs
+}
+
+func testRecord(policy model.FailurePolicy) model.PipelineRecord {
+	return model.NewPipelineRecord("p1", model.Pipeline{
+		OnFailure: policy,
+		Steps: []model.PipelineStep{
+			{Name: "encode", Job: model.Job{InputFilePath: "in.mkv", OutputFilePath: "out.mp4"}},
+			{Name: "thumbs", Job: model.Job{Type: model.JobTypeThumbnails, InputFilePath: model.StepOutputRef("encode"), OutputFilePath: "thumbs"}},
+		},
+	}, "client", time.Now())
+}
+
+// jobRecord returns the finished job of a pipeline step
+func jobRecord(job model.Job, state model.JobState) model.JobRecord {
+	record := model.JobRecord{ID: job.ID, State: state, Job: job}
+	if state == model.JobStateSucceeded {
+		record.Created = []string{job.OutputFilePath}
+	}
+	return record
+}
+
+func TestStartQueuesStepsWithoutParents(t *testing.T) {
+	redisMock := mocks.NewRedisClient(t)
+	record := testRecord("")
+	storePipeline(redisMock, &record)
+	jobs := queuedJobs(redisMock)
+
+	started, err := New(redisMock).Start(context.Background(), "p1")
+	require.NoError(t, err)
+
+	require.Len(t, *jobs, 1)
+	job := (*jobs)[0]
+	assert.Equal(t, "in.mkv", job.InputFilePath)
+	assert.Equal(t, "p1", job.Pipeline)
+	assert.Equal(t, "encode", job.Step)
+	assert.Equal(t, started.Steps[0].JobID, job.ID)
+	assert.Empty(t, job.Submitter, "steps share the pipeline's quota slot")
+	assert.Equal(t, model.StepPending, started.Steps[1].State)
+}
+
+func TestStepFinishedQueuesChildren(t *testing.T) {
+	redisMock := mocks.NewRedisClient(t)
+	record := testRecord("")
+	storePipeline(redisMock, &record)
+	jobs := queuedJobs(redisMock)
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "client").Return(nil).Once()
+	o := New(redisMock)
+
+	_, err := o.Start(context.Background(), "p1")
+	require.NoError(t, err)
+	require.NoError(t, o.StepFinished(context.Background(), jobRecord((*jobs)[0], model.JobStateSucceeded)))
+
+	require.Len(t, *jobs, 2)
+	assert.Equal(t, "out.mp4", (*jobs)[1].InputFilePath)
+	assert.Equal(t, "thumbs", (*jobs)[1].Step)
+
+	// A finished job reported twice changes nothing
+	require.NoError(t, o.StepFinished(context.Background(), jobRecord((*jobs)[0], model.JobStateSucceeded)))
+	assert.Len(t, *jobs, 2)
+
+	require.NoError(t, o.StepFinished(context.Background(), jobRecord((*jobs)[1], model.JobStateSucceeded)))
+	assert.Equal(t, model.PipelineSucceeded, record.State)
+}
+
+func TestStepFinishedIgnoresOtherJobs(t *testing.T) {
+	redisMock := mocks.NewRedisClient(t)
+	err := New(redisMock).StepFinished(context.Background(), model.JobRecord{ID: "abc", State: model.JobStateSucceeded})
+	assert.NoError(t, err)
+}
+
+func TestFailedPipelineIsCompensatedAndReported(t *testing.T) {
+	notified := make(chan model.PipelineRecord, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record model.PipelineRecord
+		json.NewDecoder(r.Body).Decode(&record)
+		notified <- record
+	}))
+	defer hook.Close()
+
+	redisMock := mocks.NewRedisClient(t)
+	record := testRecord(model.FailureCompensate)
+	record.Pipeline.NotifyURL = hook.URL
+	storePipeline(redisMock, &record)
+	jobs := queuedJobs(redisMock)
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "client").Return(nil).Once()
+
+	var removed []string
+	o := New(redisMock)
+	o.remove = func(path string) error {
+		removed = append(removed, path)
+		return nil
+	}
+
+	_, err := o.Start(context.Background(), "p1")
+	require.NoError(t, err)
+	require.NoError(t, o.StepFinished(context.Background(), jobRecord((*jobs)[0], model.JobStateSucceeded)))
+	failed := jobRecord((*jobs)[1], model.JobStateFailed)
+	failed.Error = "exit status 1"
+	require.NoError(t, o.StepFinished(context.Background(), failed))
+
+	assert.Equal(t, []string{"out.mp4"}, removed)
+	assert.Equal(t, model.PipelineCompensated, record.State)
+	assert.Equal(t, model.StepCompensated, record.Steps[0].State)
+	assert.Equal(t, model.StepFailed, record.Steps[1].State)
+	assert.NotNil(t, record.FinishedAt)
+
+	select {
+	case got := <-notified:
+		assert.Equal(t, "p1", got.ID)
+		assert.Equal(t, model.PipelineCompensated, got.State)
+	default:
+		t.Fatal("notify_url was not called")
+	}
+}
+
+func TestCompensationRemovesOnlyWhatStepsCreated(t *testing.T) {
+	redisMock := mocks.NewRedisClient(t)
+	record := model.NewPipelineRecord("p1", model.Pipeline{
+		OnFailure: model.FailureCompensate,
+		Steps: []model.PipelineStep{
+			{Name: "thumbs", Job: model.Job{Type: model.JobTypeThumbnails, InputFilePath: "in.mkv", OutputFilePath: "/media/shared"}},
+			{Name: "encode", Job: model.Job{InputFilePath: "in.mkv", OutputFilePath: "out.mp4"}},
+		},
+	}, "client", time.Now())
+	storePipeline(redisMock, &record)
+	jobs := queuedJobs(redisMock)
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "client").Return(nil).Once()
+
+	var removed []string
+	o := New(redisMock)
+	o.remove = func(path string) error {
+		removed = append(removed, path)
+		return nil
+	}
+
+	_, err := o.Start(context.Background(), "p1")
+	require.NoError(t, err)
+	require.Len(t, *jobs, 2)
+	thumbs := jobRecord((*jobs)[0], model.JobStateSucceeded)
+	thumbs.Created = []string{"/media/shared/thumbs", "/media/shared/thumbs/001.jpg", "/media/shared/thumbs/002.jpg"}
+	require.NoError(t, o.StepFinished(context.Background(), thumbs))
+	require.NoError(t, o.StepFinished(context.Background(), jobRecord((*jobs)[1], model.JobStateFailed)))
+
+	// The directory the step wrote into was there before it ran
+	assert.Equal(t, []string{"/media/shared/thumbs/002.jpg", "/media/shared/thumbs/001.jpg", "/media/shared/thumbs"}, removed)
+	assert.Equal(t, model.PipelineCompensated, record.State)
+	assert.Equal(t, model.StepCompensated, record.Steps[0].State)
+}
+
+func TestCompensationRecordsOutputsItCannotRemove(t *testing.T) {
+	redisMock := mocks.NewRedisClient(t)
+	record := testRecord(model.FailureCompensate)
+	storePipeline(redisMock, &record)
+	jobs := queuedJobs(redisMock)
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "client").Return(nil).Once()
+	o := New(redisMock)
+	o.remove = func(string) error { return errors.New("permission denied") }
+
+	_, err := o.Start(context.Background(), "p1")
+	require.NoError(t, err)
+	require.NoError(t, o.StepFinished(context.Background(), jobRecord((*jobs)[0], model.JobStateSucceeded)))
+	require.NoError(t, o.StepFinished(context.Background(), jobRecord((*jobs)[1], model.JobStateCancelled)))
+
+	assert.Equal(t, model.PipelineCompensated, record.State)
+	assert.Equal(t, model.StepSucceeded, record.Steps[0].State)
+	assert.Equal(t, "failed to remove output: permission denied", record.Steps[0].Error)
+	assert.Equal(t, "job was cancelled", record.Steps[1].Error)
+}
+
+func TestEnqueueFailureFailsStep(t *testing.T) {
+	redisMock := mocks.NewRedisClient(t)
+	record := testRecord("")
+	storePipeline(redisMock, &record)
+	redisMock.On("CreateJobRecord", mock.Anything, mock.Anything).Return(nil)
+	redisMock.On("EnqueueJob", mock.Anything, mock.Anything).Return(errors.New("connection refused"))
+	var jobError string
+	redisMock.On("UpdateJobRecord", mock.Anything, mock.Anything, mock.Anything).Return(
+		func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			var rec model.JobRecord
+			err := update(&rec)
+			jobError = rec.Error
+			return rec, err
+		})
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "client").Return(nil).Once()
+
+	_, err := New(redisMock).Start(context.Background(), "p1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "failed to enqueue job: connection refused", jobError)
+	assert.Equal(t, model.PipelineFailed, record.State)
+	assert.Equal(t, []model.StepState{model.StepFailed, model.StepNotRun},
+		[]model.StepState{record.Steps[0].State, record.Steps[1].State})
+}
@@ -0,0 +1,198 @@
+// Package planner works out what a job would do without encoding anything:
+// the ffmpeg command, what the input contains, whether any rule skips the
+// job and how long it should take. Dry runs return the plan itself; real
+// runs use it to skip inputs that need no work.
+package planner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/telemetry"
+)
+
+// ThroughputHistory provides the throughput of earlier jobs
+type ThroughputHistory interface {
+	GetThroughput(ctx context.Context, profile string) (model.Throughput, error)
+}
+
+// Planner builds job plans
+type Planner struct {
+	prober  Prober
+	history ThroughputHistory
+}
+
+// New creates a planner that probes inputs with prober and estimates from
+// history
+func New(prober Prober, history ThroughputHistory) *Planner {
+	return &Planner{prober: prober, history: history}
+}
+
+// Plan builds the complete plan for a dry run, including estimates
+func (p *Planner) Plan(ctx context.Context, job model.Job) model.JobPlan {
+	plan := p.Check(ctx, job)
+
+	estimate, warning := p.estimate(ctx, job, plan.Probe)
+	plan.Estimate = estimate
+	if warning != "" {
+		plan.Warnings = append(plan.Warnings, warning)
+	}
+	return plan
+}
+
+// Check probes the input and applies the rules, without estimating. The
+// probe is applied to the job before its command is built, so simple
+// options can choose streams from it. Jobs that normalise loudness also
+// get the command of their analysis pass. A failed probe is reported as a
+// warning and leaves the job to ffmpeg.
+func (p *Planner) Check(ctx context.Context, job model.Job) model.JobPlan {
+	probeCtx, span := telemetry.Tracer().Start(ctx, "probe input")
+	probe, err := p.prober.Probe(probeCtx, job.InputFilePath)
+	telemetry.EndSpan(span, err)
+	job.ApplyProbe(probe)
+
+	plan := model.JobPlan{
+		Command:   append([]string{job.Program()}, job.GetFFmpegCommand()...),
+		Arguments: arguments(job),
+		Warnings:  validate(job),
+	}
+	if job.NeedsLoudnessAnalysis() {
+		analysis := job.LoudnessAnalysis()
+		plan.AnalysisCommand = append([]string{analysis.Program()}, analysis.GetFFmpegCommand()...)
+	}
+	if err != nil {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("input could not be probed: %v", err))
+	} else {
+		plan.Probe = probe
+	}
+	plan.Warnings = append(plan.Warnings, job.StreamWarnings()...)
+
+	plan.Action = model.PlanActionEncode
+	for _, rule := range rules {
+		decision := rule(job, plan.Probe)
+		plan.Decisions = append(plan.Decisions, decision)
+		if decision.Action == model.PlanActionSkip {
+			plan.Action = model.PlanActionSkip
+		}
+	}
+	return plan
+}
+
+// Profile groups jobs whose throughput is comparable: the same preset
+// ("custom" for advanced jobs, "abr" for ladders, the type for other job
+// types), video encoder and hardware use
+func Profile(job model.Job) string {
+	preset, hardware := "custom", "sw"
+	if job.ABR != nil {
+		preset = "abr"
+	} else if job.Kind() != model.JobTypeTranscode {
+		preset = string(job.Kind())
+	} else if job.SimpleOptions != nil {
+		preset = string(job.SimpleOptions.QualityPreset)
+		if job.SimpleOptions.UseHardwareAcceleration {
+			hardware = "hw"
+		}
+	}
+	encoder := job.VideoEncoder()
+	if encoder == "" {
+		encoder = "unknown"
+	}
+	return preset + "/" + encoder + "/" + hardware
+}
+
+// estimate predicts runtime and output size from the mean throughput of
+// earlier jobs with the same profile. It returns a warning instead when
+// there is nothing to base an estimate on.
+func (p *Planner) estimate(ctx context.Context, job model.Job, probe *model.ProbeResult) (*model.PlanEstimate, string) {
+	if probe == nil || probe.DurationSeconds <= 0 {
+		return nil, "no estimate: the input's duration is unknown"
+	}
+
+	profile := Profile(job)
+	throughput, err := p.history.GetThroughput(ctx, profile)
+	if err != nil {
+		return nil, fmt.Sprintf("no estimate: throughput history is unavailable: %v", err)
+	}
+	if throughput.Samples == 0 || throughput.Speed <= 0 || throughput.CompressionRatio <= 0 {
+		return nil, fmt.Sprintf("no estimate: no jobs with profile %s have completed yet", profile)
+	}
+
+	media := encodedDuration(job, probe)
+	return &model.PlanEstimate{
+		Profile:         profile,
+		Samples:         throughput.Samples,
+		DurationSeconds: media / throughput.Speed,
+		OutputBytes:     int64(float64(probe.SizeBytes) * (media / probe.DurationSeconds) / throughput.CompressionRatio),
+	}, ""
+}
+
+// encodedDuration is the length of input the job encodes, after trimming
+func encodedDuration(job model.Job, probe *model.ProbeResult) float64 {
+	media := probe.DurationSeconds
+	if job.SimpleOptions == nil {
+		return media
+	}
+	if start, ok := model.ParseTimestamp(job.SimpleOptions.TrimFrom); ok {
+		media = max(0, media-start)
+	}
+	if length, ok := model.ParseTimestamp(job.SimpleOptions.TrimDuration); ok {
+		media = min(media, length)
+	}
+	return media
+}
+
+// arguments splits the job's ffmpeg arguments the way ffmpeg receives them
+func arguments(job model.Job) model.PlanArguments {
+	return model.PlanArguments{
+		Global:       job.GlobalArgs(),
+		Input:        job.InputArgs(),
+		Output:       job.OutputArgs(),
+		VideoEncoder: job.VideoEncoder(),
+	}
+}
+
+// validate reports problems with a job that would not stop ffmpeg from
+// starting but probably are not what the submitter meant
+func validate(job model.Job) []string {
+	var warnings []string
+
+	switch {
+	case job.Output() == model.OutputNone || job.OutputFilePath == "":
+		// Nothing is written, so nothing can be overwritten
+	case filepath.Clean(job.InputFilePath) == filepath.Clean(job.OutputFilePath):
+		warnings = append(warnings, "output_file_path is the input file; ffmpeg cannot write over its own input")
+	case job.ABR != nil:
+		for _, entrypoint := range job.ABR.Entrypoints(job.OutputFilePath) {
+			if _, err := os.Stat(entrypoint); err == nil {
+				warnings = append(warnings, fmt.Sprintf("%s already exists; the ladder in the output directory will be overwritten", filepath.Base(entrypoint)))
+			}
+		}
+	case !job.OutputIsDirectory():
+		if _, err := os.Stat(job.OutputFilePath); err == nil {
+			warnings = append(warnings, "the output file already exists and will be overwritten")
+		}
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(job.OutputFilePath), ".")
+	if !job.OutputIsDirectory() && job.OutputContainerType != "" && !strings.EqualFold(ext, job.OutputContainerType) {
+		warnings = append(warnings, fmt.Sprintf("output_container_type %q does not match the output file extension %q; ffmpeg picks the format from the extension", job.OutputContainerType, ext))
+	}
+
+	for _, field := range []struct{ name, args string }{
+		{"global_arguments", job.GlobalArguments},
+		{"input_arguments", job.InputArguments},
+		{"output_arguments", job.OutputArguments},
+	} {
+		if strings.ContainsAny(field.args, `"'`) {
+			warnings = append(warnings, fmt.Sprintf("%s contains quotes, which are passed to ffmpeg literally", field.name))
+		}
+	}
+
+	if job.Kind() == model.JobTypeTranscode && job.VideoEncoder() == "" {
+		warnings = append(warnings, "no video encoder is set; ffmpeg picks one from the output file extension")
+	}
+	return warnings
+}
@@ -0,0 +1,182 @@
+package planner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"transcodeflow/internal/model"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const ffprobeJSON = `{
+  "streams": [
+    {"index": 0, "codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080},
+    {"index": 1, "codec_type": "audio", "codec_name": "aac", "channels": 6, "tags": {"language": "eng"}}
+  ],
+  "format": {"format_name": "matroska,webm", "duration": "600.000000", "size": "1200000000", "bit_rate": "16000000"}
+}`
+
+func simpleJob(opts model.SimpleOptions) model.Job {
+	if opts.QualityPreset == "" {
+		opts.QualityPreset = model.DefaultQualityPreset
+	}
+	job := model.Job{InputFilePath: "/media/in.mkv", OutputFilePath: "/media/out.mkv", SimpleOptions: &opts}
+	return job
+}
+
+func TestParseProbe(t *testing.T) {
+	probe, err := parseProbe([]byte(ffprobeJSON))
+
+	require.NoError(t, err)
+	assert.Equal(t, "matroska,webm", probe.FormatName)
+	assert.Equal(t, 600.0, probe.DurationSeconds)
+	assert.Equal(t, int64(1200000000), probe.SizeBytes)
+	require.Len(t, probe.Streams, 2)
+	assert.Equal(t, model.ProbeStream{Index: 1, CodecType: "audio", CodecName: "aac", Channels: 6, Language: "eng"}, probe.Streams[1])
+	assert.Equal(t, 1080, probe.VideoStream().Height)
+
+	_, err = parseProbe([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestRules(t *testing.T) {
+	av1 := &model.ProbeResult{DurationSeconds: 60, Streams: []model.ProbeStream{{CodecType: "video", CodecName: "av1", Height: 1080}}}
+
+	tests := []struct {
+		name   string
+		rule   rule
+		job    model.Job
+		probe  *model.ProbeResult
+		action model.PlanAction
+	}{
+		{"untrimmed job", trimWithinInput, simpleJob(model.SimpleOptions{}), av1, model.PlanActionEncode},
+		{"trim inside the input", trimWithinInput, simpleJob(model.SimpleOptions{TrimFrom: "00:00:30"}), av1, model.PlanActionEncode},
+		{"trim after the end", trimWithinInput, simpleJob(model.SimpleOptions{TrimFrom: "00:01:30"}), av1, model.PlanActionSkip},
+		{"trim with unknown duration", trimWithinInput, simpleJob(model.SimpleOptions{TrimFrom: "90"}), nil, model.PlanActionEncode},
+		{"already av1", alreadyTargetCodec, simpleJob(model.SimpleOptions{}), av1, model.PlanActionSkip},
+		{"already av1 at the target size", alreadyTargetCodec, simpleJob(model.SimpleOptions{Resolution: "1080p"}), av1, model.PlanActionSkip},
+		{"av1 but downscaled", alreadyTargetCodec, simpleJob(model.SimpleOptions{Resolution: "720p"}), av1, model.PlanActionEncode},
+		{"av1 in another container", alreadyTargetCodec, model.Job{InputFilePath: "in.mp4", OutputFilePath: "out.mkv", SimpleOptions: &model.SimpleOptions{QualityPreset: model.PresetFast}}, av1, model.PlanActionEncode},
+		{"different codec", alreadyTargetCodec, simpleJob(model.SimpleOptions{}), &model.ProbeResult{Streams: []model.ProbeStream{{CodecType: "video", CodecName: "h264"}}}, model.PlanActionEncode},
+		{"advanced job", alreadyTargetCodec, model.Job{InputFilePath: "in.mkv", OutputFilePath: "out.mkv", OutputArguments: "-c:v libaom-av1"}, av1, model.PlanActionEncode},
+		{"not probed", alreadyTargetCodec, simpleJob(model.SimpleOptions{}), nil, model.PlanActionEncode},
+		{"already av1 but choosing audio", alreadyTargetCodec, simpleJob(model.SimpleOptions{Audio: &model.AudioOptions{Languages: []string{"eng"}}}), av1, model.PlanActionEncode},
+		{"already av1 but normalising loudness", alreadyTargetCodec, simpleJob(model.SimpleOptions{Loudness: &model.LoudnessOptions{}}), av1, model.PlanActionEncode},
+		{"already av1 but burning subtitles", alreadyTargetCodec, simpleJob(model.SimpleOptions{Subtitles: &model.SubtitleOptions{Mode: model.SubtitlesBurn}}), av1, model.PlanActionEncode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := tt.rule(tt.job, tt.probe)
+			assert.Equal(t, tt.action, decision.Action, decision.Reason)
+			assert.NotEmpty(t, decision.Reason)
+		})
+	}
+}
+
+func TestParseProbeDisposition(t *testing.T) {
+	probe, err := parseProbe([]byte(`{"streams": [
+		{"index": 2, "codec_type": "subtitle", "codec_name": "subrip", "tags": {"language": "fre"}, "disposition": {"default": 0, "forced": 1}},
+		{"index": 3, "codec_type": "audio", "codec_name": "aac", "channels": 2, "tags": {"title": "Commentary"}, "disposition": {"comment": 1}}
+	], "format": {}}`))
+
+	require.NoError(t, err)
+	assert.Equal(t, model.ProbeStream{Index: 2, CodecType: "subtitle", CodecName: "subrip", Language: "fre", Forced: true}, probe.Streams[0])
+	assert.Equal(t, model.ProbeStream{Index: 3, CodecType: "audio", CodecName: "aac", Channels: 2, Title: "Commentary", Comment: true}, probe.Streams[1])
+}
+
+func TestCheckChoosesSubtitlesFromProbe(t *testing.T) {
+	probe := &model.ProbeResult{Streams: []model.ProbeStream{
+		{Index: 0, CodecType: "video", CodecName: "h264"},
+		{Index: 1, CodecType: "subtitle", CodecName: "hdmv_pgs_subtitle", Language: "eng"},
+		{Index: 2, CodecType: "subtitle", CodecName: "subrip", Language: "eng"},
+	}}
+	prober := mocks.NewProber(t)
+	prober.On("Probe", mock.Anything, "/media/in.mkv").Return(probe, nil)
+
+	job := simpleJob(model.SimpleOptions{Subtitles: &model.SubtitleOptions{}})
+	job.OutputFilePath = "/media/out.mp4"
+	plan := New(prober, mocks.NewThroughputHistory(t)).Check(context.Background(), job)
+
+	assert.Subset(t, plan.Arguments.Output, []string{"-map", "0:s:1", "-c:s:0", "mov_text"})
+	assert.NotContains(t, plan.Arguments.Output, "0:s:0")
+	assert.Equal(t, []string{
+		"subtitle track 0 (hdmv_pgs_subtitle, eng) cannot be stored in mp4 and is dropped; burn it in or extract it instead",
+	}, plan.Warnings)
+}
+
+func TestCheckShowsLoudnessAnalysis(t *testing.T) {
+	probe := &model.ProbeResult{Streams: []model.ProbeStream{
+		{Index: 0, CodecType: "video", CodecName: "h264"},
+		{Index: 1, CodecType: "audio", CodecName: "ac3", Channels: 6},
+	}}
+	prober := mocks.NewProber(t)
+	prober.On("Probe", mock.Anything, "/media/in.mkv").Return(probe, nil)
+
+	target := -16.0
+	job := simpleJob(model.SimpleOptions{Loudness: &model.LoudnessOptions{TargetLUFS: &target}})
+	plan := New(prober, mocks.NewThroughputHistory(t)).Check(context.Background(), job)
+
+	require.NotEmpty(t, plan.AnalysisCommand)
+	assert.Equal(t, "ffmpeg", plan.AnalysisCommand[0])
+	assert.Subset(t, plan.AnalysisCommand, []string{"-vn", "-filter:a", "loudnorm=I=-16:TP=-1:LRA=7:print_format=json", "-f", "null"})
+	assert.Subset(t, plan.Arguments.Output, []string{"-filter:a", "loudnorm=I=-16:TP=-1:LRA=7,aresample=48000"})
+	assert.Equal(t, "/media/out.mkv", plan.Command[len(plan.Command)-1])
+
+	// Inputs without audio have nothing to measure
+	prober = mocks.NewProber(t)
+	prober.On("Probe", mock.Anything, "/media/in.mkv").Return(&model.ProbeResult{Streams: probe.Streams[:1]}, nil)
+	plan = New(prober, mocks.NewThroughputHistory(t)).Check(context.Background(), job)
+	assert.Empty(t, plan.AnalysisCommand)
+}
+
+func TestPlanEstimatesFromHistory(t *testing.T) {
+	probe, err := parseProbe([]byte(ffprobeJSON))
+	require.NoError(t, err)
+	prober := mocks.NewProber(t)
+	prober.On("Probe", mock.Anything, "/media/in.mkv").Return(probe, nil)
+	history := mocks.NewThroughputHistory(t)
+
+	job := simpleJob(model.SimpleOptions{TrimDuration: "00:05:00"})
+	history.On("GetThroughput", mock.Anything, "balanced/libaom-av1/sw").
+		Return(model.Throughput{Samples: 4, Speed: 2, CompressionRatio: 3}, nil)
+
+	plan := New(prober, history).Plan(context.Background(), job)
+
+	assert.Equal(t, model.PlanActionEncode, plan.Action)
+	assert.Equal(t, "ffmpeg", plan.Command[0])
+	assert.Equal(t, "/media/out.mkv", plan.Command[len(plan.Command)-1])
+	assert.Equal(t, "libaom-av1", plan.Arguments.VideoEncoder)
+	assert.Equal(t, probe, plan.Probe)
+	assert.Len(t, plan.Decisions, len(rules))
+	require.NotNil(t, plan.Estimate)
+	assert.Equal(t, int64(4), plan.Estimate.Samples)
+	assert.Equal(t, 150.0, plan.Estimate.DurationSeconds, "300s of input at 2x")
+	assert.Equal(t, int64(200000000), plan.Estimate.OutputBytes, "half the input at a 3:1 ratio")
+	assert.Empty(t, plan.Warnings)
+}
+
+func TestPlanWithoutProbeOrHistory(t *testing.T) {
+	prober := mocks.NewProber(t)
+	prober.On("Probe", mock.Anything, mock.Anything).Return(nil, errors.New("No such file or directory"))
+	history := mocks.NewThroughputHistory(t)
+
+	job := model.Job{InputFilePath: "in.mkv", OutputFilePath: "in.mkv", OutputContainerType: "mp4", OutputArguments: `-vf "scale=1280:720"`}
+	plan := New(prober, history).Plan(context.Background(), job)
+
+	assert.Equal(t, model.PlanActionEncode, plan.Action, "jobs run when the input cannot be probed")
+	assert.Nil(t, plan.Probe)
+	assert.Nil(t, plan.Estimate)
+	assert.Equal(t, []string{
+		"output_file_path is the input file; ffmpeg cannot write over its own input",
+		`output_container_type "mp4" does not match the output file extension "mkv"; ffmpeg picks the format from the extension`,
+		"output_arguments contains quotes, which are passed to ffmpeg literally",
+		"no video encoder is set; ffmpeg picks one from the output file extension",
+		"input could not be probed: No such file or directory",
+		"no estimate: the input's duration is unknown",
+	}, plan.Warnings)
+}
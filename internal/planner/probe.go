@@ -0,0 +1,90 @@
+package planner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"transcodeflow/internal/model"
+)
+
+// probeTimeout bounds a single ffprobe run
+const probeTimeout = 30 * time.Second
+
+// Prober inspects media files
+type Prober interface {
+	Probe(ctx context.Context, path string) (*model.ProbeResult, error)
+}
+
+// FFprobe probes files with the ffprobe binary shipped alongside ffmpeg
+type FFprobe struct{}
+
+// Probe runs ffprobe on path and parses its JSON report
+func (FFprobe) Probe(ctx context.Context, path string) (*model.ProbeResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return parseProbe(out)
+}
+
+// ffprobeOutput is the subset of ffprobe's JSON report that is used.
+// ffprobe reports most numbers as strings.
+type ffprobeOutput struct {
+	Streams []struct {
+		Index       int               `json:"index"`
+		CodecType   string            `json:"codec_type"`
+		CodecName   string            `json:"codec_name"`
+		Width       int               `json:"width"`
+		Height      int               `json:"height"`
+		Channels    int               `json:"channels"`
+		Tags        map[string]string `json:"tags"`
+		Disposition map[string]int    `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// parseProbe converts ffprobe's report into a ProbeResult
+func parseProbe(data []byte) (*model.ProbeResult, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("parsing ffprobe output: %w", err)
+	}
+
+	result := &model.ProbeResult{FormatName: out.Format.FormatName, Streams: []model.ProbeStream{}}
+	result.DurationSeconds, _ = strconv.ParseFloat(out.Format.Duration, 64)
+	result.SizeBytes, _ = strconv.ParseInt(out.Format.Size, 10, 64)
+	result.BitRate, _ = strconv.ParseInt(out.Format.BitRate, 10, 64)
+	for _, s := range out.Streams {
+		result.Streams = append(result.Streams, model.ProbeStream{
+			Index:     s.Index,
+			CodecType: s.CodecType,
+			CodecName: s.CodecName,
+			Width:     s.Width,
+			Height:    s.Height,
+			Channels:  s.Channels,
+			Language:  s.Tags["language"],
+			Title:     s.Tags["title"],
+			Forced:    s.Disposition["forced"] == 1,
+			Comment:   s.Disposition["comment"] == 1,
+		})
+	}
+	return result, nil
+}
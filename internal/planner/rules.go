@@ -0,0 +1,132 @@
+package planner
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"transcodeflow/internal/model"
+)
+
+// rule returns its verdict on a job. probe is nil when the input could not
+// be probed; rules then let the job run.
+type rule func(job model.Job, probe *model.ProbeResult) model.RuleDecision
+
+// rules are applied in order to every job. A job is skipped if any of them
+// says so.
+var rules = []rule{
+	trimWithinInput,
+	alreadyTargetCodec,
+}
+
+func encode(name, format string, args ...interface{}) model.RuleDecision {
+	return model.RuleDecision{Rule: name, Action: model.PlanActionEncode, Reason: fmt.Sprintf(format, args...)}
+}
+
+func skip(name, format string, args ...interface{}) model.RuleDecision {
+	return model.RuleDecision{Rule: name, Action: model.PlanActionSkip, Reason: fmt.Sprintf(format, args...)}
+}
+
+// trimWithinInput skips jobs whose trim starts after the input ends, which
+// would produce an empty output
+func trimWithinInput(job model.Job, probe *model.ProbeResult) model.RuleDecision {
+	const name = "trim_within_input"
+	if job.SimpleOptions == nil || job.SimpleOptions.TrimFrom == "" {
+		return encode(name, "the job is not trimmed")
+	}
+	start, ok := model.ParseTimestamp(job.SimpleOptions.TrimFrom)
+	if !ok {
+		return encode(name, "trim_from %q is left to ffmpeg to interpret", job.SimpleOptions.TrimFrom)
+	}
+	if probe == nil || probe.DurationSeconds <= 0 {
+		return encode(name, "the input's duration is unknown")
+	}
+	if start >= probe.DurationSeconds {
+		return skip(name, "the trim starts at %gs but the input ends at %gs", start, probe.DurationSeconds)
+	}
+	return encode(name, "the trim starts within the input")
+}
+
+// alreadyTargetCodec skips simple jobs whose input already has the target
+// video codec, container and size, since encoding again would only lose
+// quality. Advanced jobs are assumed to be deliberate, and jobs that choose
+// audio tracks, normalise loudness, or burn in or extract subtitles, have
+// work to do whatever the video is.
+func alreadyTargetCodec(job model.Job, probe *model.ProbeResult) model.RuleDecision {
+	const name = "already_target_codec"
+	if job.SimpleOptions == nil {
+		return encode(name, "advanced jobs always run")
+	}
+	if probe == nil {
+		return encode(name, "the input was not probed")
+	}
+	if job.SimpleOptions.Audio != nil {
+		return encode(name, "audio options choose the tracks to keep")
+	}
+	if job.SimpleOptions.Loudness != nil {
+		return encode(name, "the audio is normalised to the loudness target")
+	}
+	if subs := job.SimpleOptions.Subtitles; subs != nil && (subs.Mode == model.SubtitlesBurn || subs.Mode == model.SubtitlesExtract) {
+		return encode(name, "subtitle mode %s has work to do whatever the video is", subs.Mode)
+	}
+	video := probe.VideoStream()
+	if video == nil {
+		return encode(name, "the input has no video stream")
+	}
+
+	target := codecFamily(job.VideoEncoder())
+	if target == "" || video.CodecName != target {
+		return encode(name, "the input video is %s; the target is %s", video.CodecName, job.VideoEncoder())
+	}
+	inExt, outExt := filepath.Ext(job.InputFilePath), filepath.Ext(job.OutputFilePath)
+	if !strings.EqualFold(inExt, outExt) {
+		return encode(name, "the container changes from %s to %s", inExt, outExt)
+	}
+	if height := targetHeight(job.SimpleOptions); height > 0 && height < video.Height {
+		return encode(name, "the input is %dp; the target is %dp", video.Height, height)
+	}
+	return skip(name, "the input video is already %s at %dp in a %s file", video.CodecName, video.Height, outExt)
+}
+
+// codecFamily maps an ffmpeg encoder to the codec name ffprobe reports for
+// streams it produces
+func codecFamily(encoder string) string {
+	switch {
+	case strings.Contains(encoder, "av1"):
+		return "av1"
+	case encoder == "libx264" || strings.HasPrefix(encoder, "h264"):
+		return "h264"
+	case encoder == "libx265" || strings.HasPrefix(encoder, "hevc"):
+		return "hevc"
+	case strings.Contains(encoder, "vp9"):
+		return "vp9"
+	}
+	return ""
+}
+
+// targetHeight is the height a simple job scales to, or 0 when it keeps the
+// input's size
+func targetHeight(opts *model.SimpleOptions) int {
+	if opts.KeepOriginalResolution {
+		return 0
+	}
+	switch strings.ToLower(opts.Resolution) {
+	case "", "original":
+		return 0
+	case "480p":
+		return 480
+	case "720p":
+		return 720
+	case "1080p":
+		return 1080
+	case "4k", "2160p":
+		return 2160
+	}
+	// WIDTH:HEIGHT; a negative height keeps the aspect ratio from the width
+	_, h, ok := strings.Cut(opts.Resolution, ":")
+	height, err := strconv.Atoi(h)
+	if !ok || err != nil || height <= 0 {
+		return 0
+	}
+	return height
+}
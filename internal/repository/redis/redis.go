@@ -2,8 +2,14 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/model"
 	"transcodeflow/internal/telemetry"
 
 	redis "github.com/go-redis/redis/v8"
@@ -12,20 +18,71 @@ import (
 
 type RedisClient interface {
 	EnqueueJob(ctx context.Context, job string) error
-	DequeueJob(ctx context.Context) (string, error)
+	DequeueJob(ctx context.Context, accept func(job string) bool) (string, error)
 	EnqueueJobResult(ctx context.Context, jobResult string) error
+	AllowRequest(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, time.Duration, error)
+	ReserveSubmitterSlot(ctx context.Context, submitter string, limit int64) (bool, error)
+	ReleaseSubmitterSlot(ctx context.Context, submitter string) error
+	Ping(ctx context.Context) error
+	QueueDepths(ctx context.Context) (map[string]int64, error)
+	RegisterWorker(ctx context.Context, worker model.WorkerInfo, ttl time.Duration) error
+	ListWorkers(ctx context.Context) ([]model.WorkerInfo, error)
+	CreateJobRecord(ctx context.Context, record model.JobRecord) error
+	GetJobRecord(ctx context.Context, id string) (model.JobRecord, error)
+	UpdateJobRecord(ctx context.Context, id string, update func(*model.JobRecord) error) (model.JobRecord, error)
+	ListJobRecords(ctx context.Context, state model.JobState, limit int) ([]model.JobRecord, error)
+	CreatePipelineRecord(ctx context.Context, record model.PipelineRecord) error
+	GetPipelineRecord(ctx context.Context, id string) (model.PipelineRecord, error)
+	UpdatePipelineRecord(ctx context.Context, id string, update func(*model.PipelineRecord) error) (model.PipelineRecord, error)
+	SaveJobLog(ctx context.Context, id string, log string) error
+	GetJobLog(ctx context.Context, id string) (string, error)
+	RecordThroughput(ctx context.Context, profile string, speed, compressionRatio float64) error
+	GetThroughput(ctx context.Context, profile string) (model.Throughput, error)
+	ListQueue(ctx context.Context, queue string, offset, limit int64) ([]string, int64, error)
+	PurgeQueue(ctx context.Context, queue string) ([]string, error)
+	MoveQueue(ctx context.Context, from, to string, limit int64) ([]string, error)
+	RequeueFailedResults(ctx context.Context) ([]model.JobResult, error)
+	ReturnJob(ctx context.Context, job string) error
+	SetDispatchPaused(ctx context.Context, paused bool) error
+	SetWorkerDraining(ctx context.Context, workerID string, draining bool) error
+	GetDispatchState(ctx context.Context, workerID string) (model.DispatchState, error)
 	Close() error
 }
 
+// ErrJobNotFound is returned when no record exists for a job ID
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrPipelineNotFound is returned when no record exists for a pipeline ID
+var ErrPipelineNotFound = errors.New("pipeline not found")
+
+// ErrUnknownQueue is returned by queue operations given a name other than
+// JobQueue, RoutedQueue, ResultQueue or HeldQueue
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// Queue names accepted by the queue management operations
+const (
+	JobQueue = "jobs"
+	// RoutedQueue holds jobs with requirements, which only some workers
+	// may run
+	RoutedQueue = "routed"
+	ResultQueue = "results"
+	// HeldQueue parks jobs that should not be dispatched until moved back
+	HeldQueue = "held"
+)
+
 type DefaultRedisClient struct {
 	client      *redis.Client
 	jobQueue    string
+	routedQueue string
 	resultQueue string
+	heldQueue   string
 }
 
-func NewDefaultRedisClient() (*DefaultRedisClient, error) {
+func NewDefaultRedisClient(cfg config.RedisConfig) (*DefaultRedisClient, error) {
 	options := &redis.Options{
-		Addr: "redis:6379",
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
 	}
 
 	client := redis.NewClient(options)
@@ -36,12 +93,13 @@ func NewDefaultRedisClient() (*DefaultRedisClient, error) {
 	}
 	telemetry.Logger.Info("Connected to Redis")
 
-	return &DefaultRedisClient{client: client, jobQueue: "jobs", resultQueue: "results"}, nil
+	return &DefaultRedisClient{client: client, jobQueue: JobQueue, routedQueue: RoutedQueue, resultQueue: ResultQueue, heldQueue: HeldQueue}, nil
 }
 
-// EnqueueJob pushes a job onto the Redis jobQueue, using LPUSH.
+// EnqueueJob pushes a job onto the Redis jobQueue, using LPUSH. Jobs with
+// requirements go on the routedQueue instead.
 func (r *DefaultRedisClient) EnqueueJob(ctx context.Context, job string) error {
-	return r.enqueue(ctx, r.jobQueue, job)
+	return r.enqueue(ctx, r.queueFor(job), job)
 }
 
 // EnqueueJobResult pushes a jobresult into the result queue
@@ -60,19 +118,825 @@ func (r *DefaultRedisClient) enqueue(ctx context.Context, queue string, obj stri
 	return nil
 }
 
-// DequeueJob pops a job from the Redis jobQueue, using BRPOP.
-func (r *DefaultRedisClient) DequeueJob(ctx context.Context) (string, error) {
-	res, err := r.client.BRPop(ctx, time.Second*30, r.jobQueue).Result()
-	if err != nil {
-		if err == redis.Nil {
+// queueFor returns the queue a job waits on: the routedQueue if it has
+// requirements restricting which workers may run it, the jobQueue otherwise
+func (r *DefaultRedisClient) queueFor(job string) string {
+	var routing struct {
+		Requirements *model.JobRequirements `json:"requirements"`
+	}
+	if err := json.Unmarshal([]byte(job), &routing); err == nil && routing.Requirements != nil {
+		return r.routedQueue
+	}
+	return r.jobQueue
+}
+
+// dequeueTimeout is how long DequeueJob waits for a job before giving up
+const dequeueTimeout = 30 * time.Second
+
+// dequeueScanPage is how many routed jobs a filtered dequeue reads from
+// Redis at a time
+const dequeueScanPage = 100
+
+// DequeuePollInterval is how often a filtered dequeue checks the routed
+// queue again while it holds only jobs the worker cannot run
+var DequeuePollInterval = time.Second
+
+// DequeueJob removes and returns the oldest job accept approves of, or an
+// empty string if none arrives within dequeueTimeout. A nil accept takes
+// the oldest job of either queue. Otherwise the whole routed queue is
+// scanned for an acceptable job first, so jobs a worker cannot run stay
+// queued for one that can. Plain jobs are always taken with BRPOP; only
+// while the routed queue holds jobs this worker must leave is it checked
+// again every DequeuePollInterval.
+func (r *DefaultRedisClient) DequeueJob(ctx context.Context, accept func(job string) bool) (string, error) {
+	if accept == nil {
+		queue, job, err := r.dequeueNext(ctx, dequeueTimeout, r.jobQueue, r.routedQueue)
+		switch {
+		case err != nil:
+		case job == "":
 			telemetry.Logger.Info("No job available in Redis queue", zap.String("queue", r.jobQueue))
+		default:
+			telemetry.Logger.Info("Job dequeued from Redis", zap.String("queue", queue))
+		}
+		return job, err
+	}
+
+	deadline := time.Now().Add(dequeueTimeout)
+	for {
+		job, waiting, err := r.dequeueAccepted(ctx, accept)
+		if err != nil || job != "" {
+			return job, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			telemetry.Logger.Info("No acceptable job available in Redis queue", zap.String("queue", r.jobQueue))
 			return "", nil
 		}
-		telemetry.Logger.Error("System Error: Failed to dequeue job from Redis", zap.String("queue", r.jobQueue), zap.Error(err))
+		// With nothing routed, block on both queues until a job arrives
+		queues := []string{r.jobQueue, r.routedQueue}
+		if waiting {
+			queues = queues[:1]
+			remaining = min(remaining, DequeuePollInterval)
+		}
+		queue, job, err := r.dequeueNext(ctx, remaining, queues...)
+		if err != nil || job == "" {
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+		if accept(job) {
+			telemetry.Logger.Info("Job dequeued from Redis", zap.String("queue", queue))
+			return job, nil
+		}
+
+		// Jobs this worker cannot run go back to the dequeue end of the
+		// routed queue, including ones with requirements moved onto the job
+		// queue by an administrator
+		if err := r.client.RPush(ctx, r.routedQueue, job).Err(); err != nil {
+			telemetry.Logger.Error("System Error: Failed to return job to Redis queue", zap.String("queue", r.routedQueue), zap.Error(err))
+			return "", err
+		}
+	}
+}
+
+// dequeueNext pops the oldest job from the first of queues holding one,
+// using BRPOP. It returns an empty job when none arrives within timeout.
+func (r *DefaultRedisClient) dequeueNext(ctx context.Context, timeout time.Duration, queues ...string) (string, string, error) {
+	// BRPOP waits at least a second
+	res, err := r.client.BRPop(ctx, max(timeout, time.Second), queues...).Result()
+	if err != nil {
+		if err == redis.Nil {
+			telemetry.Logger.Debug("No job available in Redis queue", zap.Strings("queues", queues))
+			return "", "", nil
+		}
+		telemetry.Logger.Error("System Error: Failed to dequeue job from Redis", zap.Strings("queues", queues), zap.Error(err))
+		return "", "", err
+	}
+	return res[0], res[1], nil
+}
+
+// dequeueAccepted removes the oldest acceptable job in the routed queue,
+// reading it a page at a time from the dequeue end until it finds one or
+// reaches the end. It returns an empty string when there is none, and
+// whether the queue held jobs accept turned down.
+func (r *DefaultRedisClient) dequeueAccepted(ctx context.Context, accept func(job string) bool) (string, bool, error) {
+	waiting := false
+	for start := int64(0); ; start += dequeueScanPage {
+		// Jobs are popped from the right, so the oldest is last
+		jobs, err := r.client.LRange(ctx, r.routedQueue, -(start + dequeueScanPage), -(start + 1)).Result()
+		if err != nil {
+			telemetry.Logger.Error("System Error: Failed to read job queue from Redis", zap.String("queue", r.routedQueue), zap.Error(err))
+			return "", waiting, err
+		}
+
+		for i := len(jobs) - 1; i >= 0; i-- {
+			if !accept(jobs[i]) {
+				waiting = true
+				continue
+			}
+			// Another worker may have taken the job since the scan; only one
+			// LREM removes it
+			removed, err := r.client.LRem(ctx, r.routedQueue, -1, jobs[i]).Result()
+			if err != nil {
+				telemetry.Logger.Error("System Error: Failed to dequeue job from Redis", zap.String("queue", r.routedQueue), zap.Error(err))
+				return "", waiting, err
+			}
+			if removed == 1 {
+				telemetry.Logger.Info("Job dequeued from Redis", zap.String("queue", r.routedQueue))
+				return jobs[i], waiting, nil
+			}
+		}
+		if len(jobs) < dequeueScanPage {
+			return "", waiting, nil
+		}
+	}
+}
+
+// tokenBucketScript implements a token bucket stored in a Redis hash so that
+// every API replica shares the same budget for a client. The server clock is
+// used to avoid skew between replicas. Returns {allowed, retry_after_ms}.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) / 1000 * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, wait}
+`)
+
+// reserveSlotScript atomically increments a submitter's active job counter
+// unless doing so would exceed the limit, and pushes back its expiry. Returns
+// 1 if a slot was reserved.
+var reserveSlotScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current >= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call('INCR', KEYS[1])
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+
+// SubmitterSlotTTL is how long a submitter's quota counter lives after their
+// last reserved slot. Slots leaked by a worker that died mid-job are never
+// released, so the counter expires rather than locking the submitter out
+// for good.
+const SubmitterSlotTTL = 24 * time.Hour
+
+// AllowRequest takes a token from the bucket identified by key. When the bucket
+// is empty it returns false along with how long the caller should wait.
+func (r *DefaultRedisClient) AllowRequest(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, time.Duration, error) {
+	res, err := tokenBucketScript.Run(ctx, r.client, []string{"ratelimit:" + key}, ratePerSecond, burst).Slice()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to evaluate rate limit in Redis", zap.String("key", key), zap.Error(err))
+		return false, 0, err
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit response: %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	waitMs, _ := res[1].(int64)
+	return allowed == 1, time.Duration(waitMs) * time.Millisecond, nil
+}
+
+// ReserveSubmitterSlot counts a new queued job against the submitter's quota.
+// It returns false without changing the counter if the quota is exhausted.
+func (r *DefaultRedisClient) ReserveSubmitterSlot(ctx context.Context, submitter string, limit int64) (bool, error) {
+	ttl := int64(SubmitterSlotTTL / time.Second)
+	res, err := reserveSlotScript.Run(ctx, r.client, []string{submitterKey(submitter)}, limit, ttl).Int()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to reserve submitter slot in Redis", zap.String("submitter", submitter), zap.Error(err))
+		return false, err
+	}
+	return res == 1, nil
+}
+
+// ReleaseSubmitterSlot frees a slot once a job has finished or failed to enqueue.
+func (r *DefaultRedisClient) ReleaseSubmitterSlot(ctx context.Context, submitter string) error {
+	key := submitterKey(submitter)
+	n, err := r.client.Decr(ctx, key).Result()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to release submitter slot in Redis", zap.String("submitter", submitter), zap.Error(err))
+		return err
+	}
+	if n <= 0 {
+		// Never let the counter go negative if a result is pushed twice
+		return r.client.Del(ctx, key).Err()
+	}
+	return nil
+}
+
+func submitterKey(submitter string) string {
+	return "quota:" + submitter
+}
+
+// Ping checks that Redis is reachable
+func (r *DefaultRedisClient) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+// QueueDepths returns the number of items waiting in each queue
+func (r *DefaultRedisClient) QueueDepths(ctx context.Context) (map[string]int64, error) {
+	queues := []string{r.jobQueue, r.routedQueue, r.resultQueue, r.heldQueue}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(queues))
+	for i, queue := range queues {
+		cmds[i] = pipe.LLen(ctx, queue)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		telemetry.Logger.Error("System Error: Failed to read queue depths from Redis", zap.Error(err))
+		return nil, err
+	}
+
+	depths := make(map[string]int64, len(queues))
+	for i, queue := range queues {
+		depths[queue] = cmds[i].Val()
+	}
+	return depths, nil
+}
+
+// RegisterWorker records a worker heartbeat. The entry expires after ttl so
+// crashed workers drop out of the registry on their own.
+func (r *DefaultRedisClient) RegisterWorker(ctx context.Context, worker model.WorkerInfo, ttl time.Duration) error {
+	data, err := json.Marshal(worker)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, workerKey(worker.ID), data, ttl)
+	pipe.SAdd(ctx, workerSet, worker.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		telemetry.Logger.Error("System Error: Failed to register worker in Redis", zap.String("worker_id", worker.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ListWorkers returns every worker with a live heartbeat, pruning expired ones
+func (r *DefaultRedisClient) ListWorkers(ctx context.Context) ([]model.WorkerInfo, error) {
+	ids, err := r.client.SMembers(ctx, workerSet).Result()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to list workers in Redis", zap.Error(err))
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = workerKey(id)
+	}
+	values, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to read workers from Redis", zap.Error(err))
+		return nil, err
+	}
+
+	draining, err := r.client.SMembers(ctx, drainingSet).Result()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to read draining workers from Redis", zap.Error(err))
+		return nil, err
+	}
+	isDraining := make(map[string]bool, len(draining))
+	for _, id := range draining {
+		isDraining[id] = true
+	}
+
+	var workers []model.WorkerInfo
+	for i, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			// Heartbeat expired; forget the worker
+			r.client.SRem(ctx, workerSet, ids[i])
+			continue
+		}
+		var worker model.WorkerInfo
+		if err := json.Unmarshal([]byte(str), &worker); err != nil {
+			telemetry.Logger.Warn("Skipping malformed worker entry", zap.String("worker_id", ids[i]), zap.Error(err))
+			continue
+		}
+		worker.Draining = isDraining[worker.ID]
+		workers = append(workers, worker)
+	}
+	return workers, nil
+}
+
+const (
+	workerSet   = "workers"
+	drainingSet = "workers:draining"
+	pausedKey   = "dispatch:paused"
+)
+
+func workerKey(id string) string {
+	return "worker:" + id
+}
+
+const jobIndex = "jobs:index"
+
+func jobKey(id string) string {
+	return "job:" + id
+}
+
+func pipelineKey(id string) string {
+	return "pipeline:" + id
+}
+
+func jobLogKey(id string) string {
+	return "job:" + id + ":log"
+}
+
+// CreateJobRecord stores a new job record and indexes it by submission time
+func (r *DefaultRedisClient) CreateJobRecord(ctx context.Context, record model.JobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, jobKey(record.ID), data, 0)
+	pipe.ZAdd(ctx, jobIndex, &redis.Z{Score: float64(record.SubmittedAt.UnixMilli()), Member: record.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		telemetry.Logger.Error("System Error: Failed to create job record in Redis", zap.String("job_id", record.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetJobRecord loads the record for a job, returning ErrJobNotFound if missing
+func (r *DefaultRedisClient) GetJobRecord(ctx context.Context, id string) (model.JobRecord, error) {
+	var record model.JobRecord
+	data, err := r.client.Get(ctx, jobKey(id)).Bytes()
+	if err == redis.Nil {
+		return record, ErrJobNotFound
+	}
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to read job record from Redis", zap.String("job_id", id), zap.Error(err))
+		return record, err
+	}
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
+
+// UpdateJobRecord applies update to a job record atomically. Concurrent
+// writers (e.g. a worker starting the job while a client cancels it) are
+// retried so neither change is lost. If update returns an error the record
+// is left untouched and the error is returned.
+func (r *DefaultRedisClient) UpdateJobRecord(ctx context.Context, id string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+	var record model.JobRecord
+	key := jobKey(id)
+
+	txf := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return ErrJobNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		record = model.JobRecord{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		if err := update(&record); err != nil {
+			return err
+		}
+
+		updated, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updated, 0)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		err := r.client.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil && err != ErrJobNotFound {
+			telemetry.Logger.Warn("Failed to update job record in Redis", zap.String("job_id", id), zap.Error(err))
+		}
+		return record, err
+	}
+	return record, fmt.Errorf("update of job %s kept conflicting with other writers", id)
+}
+
+// CreatePipelineRecord stores a new pipeline record
+func (r *DefaultRedisClient) CreatePipelineRecord(ctx context.Context, record model.PipelineRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Set(ctx, pipelineKey(record.ID), data, 0).Err(); err != nil {
+		telemetry.Logger.Error("System Error: Failed to create pipeline record in Redis", zap.String("pipeline_id", record.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetPipelineRecord loads the record for a pipeline, returning
+// ErrPipelineNotFound if missing
+func (r *DefaultRedisClient) GetPipelineRecord(ctx context.Context, id string) (model.PipelineRecord, error) {
+	var record model.PipelineRecord
+	data, err := r.client.Get(ctx, pipelineKey(id)).Bytes()
+	if err == redis.Nil {
+		return record, ErrPipelineNotFound
+	}
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to read pipeline record from Redis", zap.String("pipeline_id", id), zap.Error(err))
+		return record, err
+	}
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
+
+// UpdatePipelineRecord applies update to a pipeline record atomically. Like
+// UpdateJobRecord it retries when another writer changes the record
+// concurrently, so update may run more than once and must not have side
+// effects; if it returns an error the record is left unchanged.
+func (r *DefaultRedisClient) UpdatePipelineRecord(ctx context.Context, id string, update func(*model.PipelineRecord) error) (model.PipelineRecord, error) {
+	var record model.PipelineRecord
+	key := pipelineKey(id)
+
+	txf := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return ErrPipelineNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		record = model.PipelineRecord{}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		if err := update(&record); err != nil {
+			return err
+		}
+
+		updated, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updated, 0)
+			return nil
+		})
+		return err
+	}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		err := r.client.Watch(ctx, txf, key)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil && err != ErrPipelineNotFound {
+			telemetry.Logger.Warn("Failed to update pipeline record in Redis", zap.String("pipeline_id", id), zap.Error(err))
+		}
+		return record, err
+	}
+	return record, fmt.Errorf("update of pipeline %s kept conflicting with other writers", id)
+}
+
+// ListJobRecords returns the most recently submitted jobs, newest first,
+// optionally filtered by state
+func (r *DefaultRedisClient) ListJobRecords(ctx context.Context, state model.JobState, limit int) ([]model.JobRecord, error) {
+	const pageSize = 100
+	var records []model.JobRecord
+
+	for start := int64(0); len(records) < limit; start += pageSize {
+		ids, err := r.client.ZRevRange(ctx, jobIndex, start, start+pageSize-1).Result()
+		if err != nil {
+			telemetry.Logger.Error("System Error: Failed to list job records in Redis", zap.Error(err))
+			return nil, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = jobKey(id)
+		}
+		values, err := r.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			telemetry.Logger.Error("System Error: Failed to read job records from Redis", zap.Error(err))
+			return nil, err
+		}
+
+		for _, value := range values {
+			str, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var record model.JobRecord
+			if err := json.Unmarshal([]byte(str), &record); err != nil {
+				continue
+			}
+			if state != "" && record.State != state {
+				continue
+			}
+			records = append(records, record)
+			if len(records) == limit {
+				break
+			}
+		}
+	}
+	return records, nil
+}
+
+// SaveJobLog stores the output captured while a job ran, replacing any
+// output from an earlier attempt
+func (r *DefaultRedisClient) SaveJobLog(ctx context.Context, id string, log string) error {
+	if err := r.client.Set(ctx, jobLogKey(id), log, 0).Err(); err != nil {
+		telemetry.Logger.Error("System Error: Failed to store job log in Redis", zap.String("job_id", id), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetJobLog loads the output of a job, returning ErrJobNotFound if none was
+// stored
+func (r *DefaultRedisClient) GetJobLog(ctx context.Context, id string) (string, error) {
+	log, err := r.client.Get(ctx, jobLogKey(id)).Result()
+	if err == redis.Nil {
+		return "", ErrJobNotFound
+	}
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to read job log from Redis", zap.String("job_id", id), zap.Error(err))
 		return "", err
 	}
-	telemetry.Logger.Info("Job dequeued from Redis", zap.String("queue", r.jobQueue))
-	return res[1], nil
+	return log, nil
+}
+
+func throughputKey(profile string) string {
+	return "throughput:" + profile
+}
+
+// RecordThroughput adds a completed job to the running totals for its
+// profile. Totals are kept rather than averages so concurrent workers can
+// update them atomically.
+func (r *DefaultRedisClient) RecordThroughput(ctx context.Context, profile string, speed, compressionRatio float64) error {
+	key := throughputKey(profile)
+	pipe := r.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, "samples", 1)
+	pipe.HIncrByFloat(ctx, key, "speed_sum", speed)
+	pipe.HIncrByFloat(ctx, key, "ratio_sum", compressionRatio)
+	if _, err := pipe.Exec(ctx); err != nil {
+		telemetry.Logger.Error("System Error: Failed to record throughput in Redis", zap.String("profile", profile), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetThroughput returns the mean throughput of completed jobs with a
+// profile. Samples is zero when none have been recorded.
+func (r *DefaultRedisClient) GetThroughput(ctx context.Context, profile string) (model.Throughput, error) {
+	var throughput model.Throughput
+	values, err := r.client.HGetAll(ctx, throughputKey(profile)).Result()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to read throughput from Redis", zap.String("profile", profile), zap.Error(err))
+		return throughput, err
+	}
+
+	samples, _ := strconv.ParseInt(values["samples"], 10, 64)
+	if samples <= 0 {
+		return throughput, nil
+	}
+	speedSum, _ := strconv.ParseFloat(values["speed_sum"], 64)
+	ratioSum, _ := strconv.ParseFloat(values["ratio_sum"], 64)
+	throughput.Samples = samples
+	throughput.Speed = speedSum / float64(samples)
+	throughput.CompressionRatio = ratioSum / float64(samples)
+	return throughput, nil
+}
+
+// queueKey maps a public queue name to its Redis key
+func (r *DefaultRedisClient) queueKey(queue string) (string, error) {
+	switch queue {
+	case JobQueue:
+		return r.jobQueue, nil
+	case RoutedQueue:
+		return r.routedQueue, nil
+	case ResultQueue:
+		return r.resultQueue, nil
+	case HeldQueue:
+		return r.heldQueue, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownQueue, queue)
+	}
+}
+
+// ListQueue returns up to limit items from a queue in the order they will be
+// dequeued, skipping the first offset, along with the queue's total length
+func (r *DefaultRedisClient) ListQueue(ctx context.Context, queue string, offset, limit int64) ([]string, int64, error) {
+	key, err := r.queueKey(queue)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Items are pushed on the left and popped from the right, so the next
+	// item to be dequeued is at index -1
+	pipe := r.client.Pipeline()
+	rangeCmd := pipe.LRange(ctx, key, -(offset + limit), -(offset + 1))
+	lenCmd := pipe.LLen(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		telemetry.Logger.Error("System Error: Failed to read queue from Redis", zap.String("queue", queue), zap.Error(err))
+		return nil, 0, err
+	}
+
+	items := rangeCmd.Val()
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, lenCmd.Val(), nil
+}
+
+// PurgeQueue deletes every item in a queue and returns the items removed
+func (r *DefaultRedisClient) PurgeQueue(ctx context.Context, queue string) ([]string, error) {
+	key, err := r.queueKey(queue)
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := r.client.TxPipeline()
+	itemsCmd := pipe.LRange(ctx, key, 0, -1)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		telemetry.Logger.Error("System Error: Failed to purge queue in Redis", zap.String("queue", queue), zap.Error(err))
+		return nil, err
+	}
+	telemetry.Logger.Warn("Queue purged", zap.String("queue", queue), zap.Int("removed", len(itemsCmd.Val())))
+	return itemsCmd.Val(), nil
+}
+
+// moveScript moves items one at a time from the dequeue end of KEYS[1] to
+// the enqueue end of KEYS[2], preserving their order. ARGV[1] caps the
+// number moved; 0 moves everything. Returns the items moved.
+var moveScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local moved = {}
+while limit <= 0 or #moved < limit do
+	local item = redis.call('RPOPLPUSH', KEYS[1], KEYS[2])
+	if not item then
+		break
+	end
+	moved[#moved + 1] = item
+end
+return moved
+`)
+
+// MoveQueue moves up to limit items (all of them when limit is 0) from one
+// queue to another, oldest first, and returns the items moved
+func (r *DefaultRedisClient) MoveQueue(ctx context.Context, from, to string, limit int64) ([]string, error) {
+	fromKey, err := r.queueKey(from)
+	if err != nil {
+		return nil, err
+	}
+	toKey, err := r.queueKey(to)
+	if err != nil {
+		return nil, err
+	}
+	if fromKey == toKey {
+		return nil, fmt.Errorf("cannot move queue %q onto itself", from)
+	}
+
+	moved, err := moveScript.Run(ctx, r.client, []string{fromKey, toKey}, limit).StringSlice()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to move queue items in Redis", zap.String("from", from), zap.String("to", to), zap.Error(err))
+		return nil, err
+	}
+	telemetry.Logger.Info("Queue items moved", zap.String("from", from), zap.String("to", to), zap.Int("moved", len(moved)))
+	return moved, nil
+}
+
+// requeueScript removes one result from KEYS[1] and queues its job on
+// KEYS[2]. Nothing is queued if the result was already removed, so two
+// concurrent requeues cannot run a job twice. Returns 1 if requeued.
+var requeueScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 1 then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// RequeueFailedResults removes every failed result from the result queue and
+// queues its job again as the next attempt. It returns the results that were
+// requeued, holding the jobs as queued.
+func (r *DefaultRedisClient) RequeueFailedResults(ctx context.Context) ([]model.JobResult, error) {
+	items, err := r.client.LRange(ctx, r.resultQueue, 0, -1).Result()
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to read results from Redis", zap.Error(err))
+		return nil, err
+	}
+
+	var requeued []model.JobResult
+	for _, item := range items {
+		var result model.JobResult
+		if err := json.Unmarshal([]byte(item), &result); err != nil || !result.Failed() {
+			continue
+		}
+		if result.Job.Attempt != 0 {
+			result.Job.Attempt++
+		}
+		job, err := json.Marshal(result.Job)
+		if err != nil {
+			return requeued, err
+		}
+
+		n, err := requeueScript.Run(ctx, r.client, []string{r.resultQueue, r.queueFor(string(job))}, item, job).Int()
+		if err != nil {
+			telemetry.Logger.Error("System Error: Failed to requeue job in Redis", zap.String("job_id", result.Job.ID), zap.Error(err))
+			return requeued, err
+		}
+		if n == 1 {
+			requeued = append(requeued, result)
+		}
+	}
+	return requeued, nil
+}
+
+// ReturnJob puts a dequeued job back at the front of its queue so it is the
+// next one dispatched
+func (r *DefaultRedisClient) ReturnJob(ctx context.Context, job string) error {
+	if err := r.client.RPush(ctx, r.queueFor(job), job).Err(); err != nil {
+		telemetry.Logger.Error("System Error: Failed to return job to Redis queue", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SetDispatchPaused stops or restarts job dispatching on every worker
+func (r *DefaultRedisClient) SetDispatchPaused(ctx context.Context, paused bool) error {
+	var err error
+	if paused {
+		err = r.client.Set(ctx, pausedKey, "1", 0).Err()
+	} else {
+		err = r.client.Del(ctx, pausedKey).Err()
+	}
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to set dispatch state in Redis", zap.Bool("paused", paused), zap.Error(err))
+	}
+	return err
+}
+
+// SetWorkerDraining marks a worker so it finishes its current jobs but takes
+// no new ones, or clears the mark
+func (r *DefaultRedisClient) SetWorkerDraining(ctx context.Context, workerID string, draining bool) error {
+	var err error
+	if draining {
+		err = r.client.SAdd(ctx, drainingSet, workerID).Err()
+	} else {
+		err = r.client.SRem(ctx, drainingSet, workerID).Err()
+	}
+	if err != nil {
+		telemetry.Logger.Error("System Error: Failed to set worker drain state in Redis", zap.String("worker_id", workerID), zap.Error(err))
+	}
+	return err
+}
+
+// GetDispatchState reports whether the given worker may take new jobs
+func (r *DefaultRedisClient) GetDispatchState(ctx context.Context, workerID string) (model.DispatchState, error) {
+	pipe := r.client.Pipeline()
+	pausedCmd := pipe.Exists(ctx, pausedKey)
+	drainingCmd := pipe.SIsMember(ctx, drainingSet, workerID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return model.DispatchState{}, err
+	}
+	return model.DispatchState{Paused: pausedCmd.Val() == 1, Draining: drainingCmd.Val()}, nil
 }
 
 // Close closes the Redis client connection
@@ -1,6 +1,7 @@
 package service
 
 import (
+    "transcodeflow/internal/joblog"
     "transcodeflow/internal/repository/redis"
     "transcodeflow/internal/telemetry"
 )
@@ -9,12 +10,14 @@ import (
 type Services struct {
     Metrics telemetry.MetricsClient
     Redis   redis.RedisClient
+    JobLogs joblog.Store
 }
 
 // NewServices creates a new Services instance
-func NewServices(metrics telemetry.MetricsClient, redisClient redis.RedisClient) *Services {
+func NewServices(metrics telemetry.MetricsClient, redisClient redis.RedisClient, jobLogs joblog.Store) *Services {
     return &Services{
         Metrics: metrics,
         Redis:   redisClient,
+        JobLogs: jobLogs,
     }
 }
@@ -1,34 +1,57 @@
 package telemetry
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"transcodeflow/internal/config"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-// Logger is the global logger instance
-var Logger *zap.Logger
+// Logger is the global logger instance. It discards everything until the
+// application installs one built by NewLogger, so importing this package
+// has no side effects.
+var Logger = zap.NewNop()
 
-func init() {
-	// Ensure the logs directory exists
-	if err := os.MkdirAll("./logs", 0755); err != nil {
-		log.Fatalf("failed to create logs directory: %v", err)
+// NewLogger builds a logger from the logging configuration. A file output
+// has its directory created; stdout and stderr are used as they are. When a
+// Loki URL is configured, entries are also pushed there labelled with mode.
+// The returned function flushes entries still waiting to be pushed.
+func NewLogger(cfg config.LoggingConfig, mode string) (*zap.Logger, func(context.Context) error, error) {
+	level, err := zapcore.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing log level: %w", err)
 	}
 
-	config := zap.NewProductionConfig()
-	config.OutputPaths = []string{
-		"stdout",
-		"./logs/server.log",
-	}
-	config.ErrorOutputPaths = []string{
-		"stderr",
-		"./logs/server_error.log",
+	zapCfg := zap.NewProductionConfig()
+	if cfg.Format == "console" {
+		zapCfg = zap.NewDevelopmentConfig()
+		zapCfg.Development = false
 	}
+	zapCfg.Level = zap.NewAtomicLevelAt(level)
+	zapCfg.Encoding = cfg.Format
+	zapCfg.OutputPaths = []string{cfg.Output}
+	zapCfg.ErrorOutputPaths = []string{"stderr"}
 
-	var err error
-	Logger, err = config.Build()
+	if cfg.Output != "stdout" && cfg.Output != "stderr" {
+		if err := os.MkdirAll(filepath.Dir(cfg.Output), 0o755); err != nil {
+			return nil, nil, fmt.Errorf("creating log directory: %w", err)
+		}
+	}
+	logger, err := zapCfg.Build()
 	if err != nil {
-		panic("Failed to initialize logger: " + err.Error())
+		return nil, nil, err
+	}
+
+	if cfg.Loki.URL == "" {
+		return logger, func(context.Context) error { return nil }, nil
 	}
+	loki := newLokiCore(cfg.Loki, level, map[string]string{"service": "transcodeflow", "mode": mode})
+	logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, loki)
+	}))
+	return logger, loki.Close, nil
 }
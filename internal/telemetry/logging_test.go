@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"transcodeflow/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLoggerWritesToFile(t *testing.T) {
+	cfg := config.Default().Logging
+	cfg.Level = "warn"
+	cfg.Output = filepath.Join(t.TempDir(), "nested", "app.log")
+
+	logger, _, err := NewLogger(cfg, "serve")
+	require.NoError(t, err)
+	logger.Info("dropped below the configured level")
+	logger.Warn("kept")
+	require.NoError(t, logger.Sync())
+
+	data, err := os.ReadFile(cfg.Output)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"msg":"kept"`)
+	assert.NotContains(t, string(data), "dropped")
+}
+
+func TestNewLoggerRejectsUnknownLevel(t *testing.T) {
+	cfg := config.Default().Logging
+	cfg.Level = "loud"
+
+	_, _, err := NewLogger(cfg, "serve")
+	assert.Error(t, err)
+}
+
+func TestNewLoggerAlsoPushesToLoki(t *testing.T) {
+	loki := &fakeLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+	cfg := config.Default().Logging
+	cfg.Output = filepath.Join(t.TempDir(), "app.log")
+	cfg.Loki = testLokiConfig(server.URL)
+
+	logger, closeLogs, err := NewLogger(cfg, "serve")
+	require.NoError(t, err)
+	logger.Info("Starting application")
+	require.NoError(t, closeLogs(context.Background()))
+
+	require.Contains(t, loki.lines(), "Starting application")
+	assert.Equal(t, "serve", loki.lines()["Starting application"]["mode"])
+	data, err := os.ReadFile(cfg.Output)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Starting application", "entries still reach the configured output")
+}
@@ -0,0 +1,345 @@
+package telemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"transcodeflow/internal/config"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	lokiPushTimeout = 10 * time.Second
+	lokiMinBackoff  = 500 * time.Millisecond
+)
+
+// lokiContextLabels are fields added with Logger.With that become stream
+// labels. Per-entry fields are not used for worker_id because some entries
+// name another worker, e.g. one being drained.
+var lokiContextLabels = map[string]bool{"worker_id": true, "job_id": true}
+
+// lokiEntryLabels are per-entry fields that become stream labels
+var lokiEntryLabels = map[string]bool{"job_id": true}
+
+// lokiCore is a zapcore.Core that pushes entries to Loki. Writes never
+// block: entries are queued for a background pusher and dropped when the
+// queue is full.
+type lokiCore struct {
+	zapcore.LevelEnabler
+	enc    zapcore.Encoder
+	labels map[string]string
+	pusher *lokiPusher
+}
+
+// newLokiCore starts a pusher for cfg. labels are attached to every stream.
+func newLokiCore(cfg config.LokiConfig, level zapcore.LevelEnabler, labels map[string]string) *lokiCore {
+	return &lokiCore{
+		LevelEnabler: level,
+		enc:          zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		labels:       labels,
+		pusher:       newLokiPusher(cfg, labels),
+	}
+}
+
+func (c *lokiCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := &lokiCore{
+		LevelEnabler: c.LevelEnabler,
+		enc:          c.enc.Clone(),
+		labels:       withLabels(c.labels, fields, lokiContextLabels),
+		pusher:       c.pusher,
+	}
+	for _, f := range fields {
+		f.AddTo(clone.enc)
+	}
+	return clone
+}
+
+func (c *lokiCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *lokiCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := c.enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimSuffix(buf.String(), "\n")
+	buf.Free()
+
+	labels := withLabels(c.labels, fields, lokiEntryLabels)
+	labels["level"] = ent.Level.String()
+	c.pusher.push(lokiEntry{labels: labels, ts: ent.Time, line: line})
+	return nil
+}
+
+// Sync does not wait for Loki; Close flushes queued entries
+func (c *lokiCore) Sync() error {
+	return nil
+}
+
+// Close pushes queued entries and stops the pusher, giving up when ctx ends
+func (c *lokiCore) Close(ctx context.Context) error {
+	return c.pusher.close(ctx)
+}
+
+// withLabels returns a copy of labels plus any string fields named in keys
+func withLabels(labels map[string]string, fields []zapcore.Field, keys map[string]bool) map[string]string {
+	out := make(map[string]string, len(labels)+2)
+	for k, v := range labels {
+		out[k] = v
+	}
+	for _, f := range fields {
+		if keys[f.Key] && f.Type == zapcore.StringType && f.String != "" {
+			out[f.Key] = f.String
+		}
+	}
+	return out
+}
+
+type lokiEntry struct {
+	labels map[string]string
+	ts     time.Time
+	line   string
+}
+
+// lokiPusher batches entries and pushes them from a single goroutine, so a
+// slow or unreachable Loki only ever fills the queue
+type lokiPusher struct {
+	cfg     config.LokiConfig
+	labels  map[string]string
+	client  *http.Client
+	entries chan lokiEntry
+	dropped atomic.Int64
+	quit    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	// errOut receives push failures; logging them would feed them back in
+	errOut io.Writer
+}
+
+func newLokiPusher(cfg config.LokiConfig, labels map[string]string) *lokiPusher {
+	p := &lokiPusher{
+		cfg:     cfg,
+		labels:  labels,
+		client:  &http.Client{Timeout: lokiPushTimeout},
+		entries: make(chan lokiEntry, cfg.BufferSize),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		errOut:  os.Stderr,
+	}
+	go p.run()
+	return p
+}
+
+// push queues an entry, dropping it if the queue is full
+func (p *lokiPusher) push(e lokiEntry) {
+	select {
+	case p.entries <- e:
+	default:
+		p.dropped.Add(1)
+	}
+}
+
+func (p *lokiPusher) close(ctx context.Context) error {
+	p.once.Do(func() { close(p.quit) })
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *lokiPusher) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.cfg.BatchWait)
+	defer ticker.Stop()
+
+	var batch []lokiEntry
+	for {
+		select {
+		case e := <-p.entries:
+			batch = append(batch, e)
+			if len(batch) >= p.cfg.BatchSize {
+				p.send(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 || p.dropped.Load() > 0 {
+				p.send(batch)
+				batch = nil
+			}
+		case <-p.quit:
+			p.drain(batch)
+			return
+		}
+	}
+}
+
+// drain pushes batch along with whatever is still queued
+func (p *lokiPusher) drain(batch []lokiEntry) {
+	for {
+		select {
+		case e := <-p.entries:
+			batch = append(batch, e)
+			if len(batch) >= p.cfg.BatchSize {
+				p.send(batch)
+				batch = nil
+			}
+		default:
+			if len(batch) > 0 || p.dropped.Load() > 0 {
+				p.send(batch)
+			}
+			return
+		}
+	}
+}
+
+// send pushes a batch, retrying with exponential backoff. Entries dropped
+// since the last push are reported in the batch so the gap is visible in
+// Loki.
+func (p *lokiPusher) send(batch []lokiEntry) {
+	if n := p.dropped.Swap(0); n > 0 {
+		batch = append(batch, p.droppedEntry(n))
+	}
+	body, err := encodeLokiPush(batch)
+	if err != nil {
+		fmt.Fprintf(p.errOut, "%s loki: encoding push: %v\n", time.Now().Format(time.RFC3339), err)
+		return
+	}
+
+	backoff := min(lokiMinBackoff, p.cfg.MaxBackoff)
+	for attempt := 0; ; attempt++ {
+		retry, err := p.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= p.cfg.MaxRetries {
+			fmt.Fprintf(p.errOut, "%s loki: dropping %d entries: %v\n", time.Now().Format(time.RFC3339), len(batch), err)
+			p.dropped.Add(int64(len(batch)))
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-p.quit:
+			// Shutting down; one last attempt rather than the full schedule
+			if _, err := p.post(body); err != nil {
+				fmt.Fprintf(p.errOut, "%s loki: dropping %d entries: %v\n", time.Now().Format(time.RFC3339), len(batch), err)
+			}
+			return
+		}
+		backoff = min(backoff*2, p.cfg.MaxBackoff)
+	}
+}
+
+// post sends one push request. It reports whether a failure is worth
+// retrying: network errors, rate limiting and server errors are, anything
+// else means Loki rejected the entries.
+func (p *lokiPusher) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, p.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	if p.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", p.cfg.TenantID)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("loki responded %s", resp.Status)
+}
+
+// droppedEntry reports entries lost to backpressure or failed pushes
+func (p *lokiPusher) droppedEntry(n int64) lokiEntry {
+	labels := withLabels(p.labels, nil, nil)
+	labels["level"] = zapcore.WarnLevel.String()
+	line, _ := json.Marshal(map[string]interface{}{
+		"level":   "warn",
+		"msg":     "Dropped log entries because Loki could not keep up",
+		"dropped": n,
+	})
+	return lokiEntry{labels: labels, ts: time.Now(), line: string(line)}
+}
+
+// lokiStream is one stream in the body of a Loki push request
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// encodeLokiPush groups entries into streams by label set and returns the
+// gzipped JSON push body
+func encodeLokiPush(entries []lokiEntry) ([]byte, error) {
+	streams := map[string]*lokiStream{}
+	var keys []string
+	for _, e := range entries {
+		key := labelKey(e.labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{Stream: e.labels}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.ts.UnixNano(), 10), e.line})
+	}
+
+	body := struct {
+		Streams []*lokiStream `json:"streams"`
+	}{}
+	for _, key := range keys {
+		body.Streams = append(body.Streams, streams[key])
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(body); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// labelKey identifies a label set regardless of map order
+func labelKey(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%q,", name, labels[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package telemetry
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"transcodeflow/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fakeLoki records the streams pushed to it. status, if set, chooses the
+// response for each request.
+type fakeLoki struct {
+	mu       sync.Mutex
+	streams  []lokiStream
+	requests atomic.Int32
+	tenant   string
+	status   func(n int32) int
+}
+
+func (f *fakeLoki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := f.requests.Add(1)
+	if f.status != nil {
+		if code := f.status(n); code != http.StatusNoContent {
+			w.WriteHeader(code)
+			return
+		}
+	}
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil || r.Header.Get("Content-Encoding") != "gzip" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	if err := json.NewDecoder(gz).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.streams = append(f.streams, body.Streams...)
+	f.tenant = r.Header.Get("X-Scope-OrgID")
+	f.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lines returns every pushed line with the labels of its stream
+func (f *fakeLoki) lines() map[string]map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := map[string]map[string]string{}
+	for _, s := range f.streams {
+		for _, v := range s.Values {
+			var entry struct {
+				Msg string `json:"msg"`
+			}
+			json.Unmarshal([]byte(v[1]), &entry)
+			out[entry.Msg] = s.Stream
+		}
+	}
+	return out
+}
+
+func testLokiConfig(url string) config.LokiConfig {
+	cfg := config.Default().Logging.Loki
+	cfg.URL = url
+	cfg.BatchWait = 10 * time.Millisecond
+	cfg.MaxBackoff = 10 * time.Millisecond
+	return cfg
+}
+
+func newTestLokiCore(t *testing.T, cfg config.LokiConfig) *lokiCore {
+	t.Helper()
+	core := newLokiCore(cfg, zapcore.InfoLevel, map[string]string{"service": "transcodeflow", "mode": "work"})
+	core.pusher.errOut = io.Discard
+	return core
+}
+
+func TestLokiCorePushesLabelledEntries(t *testing.T) {
+	loki := &fakeLoki{}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+	cfg := testLokiConfig(server.URL)
+	cfg.TenantID = "media"
+
+	core := newTestLokiCore(t, cfg)
+	logger := zap.New(core).With(zap.String("worker_id", "host-1"))
+	logger.Info("Dequeued job")
+	logger.Warn("Failed to store job log", zap.String("job_id", "abc"))
+	logger.Debug("below the configured level")
+	require.NoError(t, core.Close(context.Background()))
+
+	lines := loki.lines()
+	require.Len(t, lines, 2)
+	assert.Equal(t, map[string]string{"service": "transcodeflow", "mode": "work", "worker_id": "host-1", "level": "info"}, lines["Dequeued job"])
+	assert.Equal(t, map[string]string{"service": "transcodeflow", "mode": "work", "worker_id": "host-1", "level": "warn", "job_id": "abc"}, lines["Failed to store job log"])
+	assert.Equal(t, "media", loki.tenant)
+}
+
+func TestLokiCoreRetriesServerErrors(t *testing.T) {
+	loki := &fakeLoki{status: func(n int32) int {
+		if n < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	}}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	core := newTestLokiCore(t, testLokiConfig(server.URL))
+	zap.New(core).Info("eventually delivered")
+
+	assert.Eventually(t, func() bool { return len(loki.lines()) > 0 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, core.Close(context.Background()))
+	assert.Contains(t, loki.lines(), "eventually delivered")
+	assert.Equal(t, int32(3), loki.requests.Load())
+}
+
+func TestLokiCoreDoesNotRetryRejectedEntries(t *testing.T) {
+	loki := &fakeLoki{status: func(int32) int { return http.StatusBadRequest }}
+	server := httptest.NewServer(loki)
+	defer server.Close()
+
+	core := newTestLokiCore(t, testLokiConfig(server.URL))
+	zap.New(core).Info("rejected")
+
+	// The rejected batch is pushed once; the next push reports it dropped
+	assert.Eventually(t, func() bool { return loki.requests.Load() >= 2 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, core.Close(context.Background()))
+	assert.Empty(t, loki.lines())
+}
+
+func TestLokiCoreDropsUnderBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	loki := &fakeLoki{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		loki.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	cfg := testLokiConfig(server.URL)
+	cfg.BatchSize = 1
+	cfg.BufferSize = 2
+
+	core := newTestLokiCore(t, cfg)
+	logger := zap.New(core)
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		logger.Info("flood")
+	}
+	assert.Less(t, time.Since(start), time.Second, "writes must not wait for Loki")
+	close(release)
+	require.NoError(t, core.Close(context.Background()))
+
+	lines := loki.lines()
+	assert.Contains(t, lines, "flood")
+	require.Contains(t, lines, "Dropped log entries because Loki could not keep up")
+	assert.Equal(t, "warn", lines["Dropped log entries because Loki could not keep up"]["level"])
+}
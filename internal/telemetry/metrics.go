@@ -2,26 +2,105 @@ package telemetry
 
 import (
 	"net/http"
-	"os"
+	"strconv"
+	"transcodeflow/internal/config"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 )
 
+// Job outcomes recorded by IncrementJobOutcomeCounter
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	OutcomeSkipped   = "skipped"
+)
+
 type MetricsClient interface {
 	IncrementQueuePushCounter(submitted string)
 	IncrementServerRequestCounter(status string)
+	IncrementThrottledRequestCounter(reason string)
+
+	// ObserveJobDuration records how long a job ran
+	ObserveJobDuration(labels JobLabels, seconds float64)
+	// SetQueueDepth records the number of entries waiting in a queue
+	SetQueueDepth(queue string, depth int64)
+	// SetJobsInFlight records the number of jobs this process is running
+	SetJobsInFlight(count int)
+	// IncrementJobOutcomeCounter counts a finished job by outcome and reason
+	IncrementJobOutcomeCounter(outcome, reason string)
+	// AddJobBytes counts bytes read (direction "in") or written ("out")
+	AddJobBytes(direction string, bytes int64)
+	// ObserveCompressionRatio records input size divided by output size
+	ObserveCompressionRatio(labels JobLabels, ratio float64)
+	// ObserveFFmpegSpeed records the final speed ffmpeg reported, as a
+	// multiple of real time
+	ObserveFFmpegSpeed(labels JobLabels, speed float64)
+	// IncrementJobRetryCounter counts jobs queued again, by who asked
+	IncrementJobRetryCounter(source string)
+}
+
+// JobLabels describe a job for the per-job histograms
+type JobLabels struct {
+	Preset   string
+	Codec    string
+	Hardware bool
 }
 
+func (l JobLabels) values() []string {
+	return []string{l.Preset, l.Codec, strconv.FormatBool(l.Hardware)}
+}
+
+var jobLabelNames = []string{"preset", "codec", "hardware"}
+
 // Metrics holds all the Prometheus metrics for the application
 type DefaultMetricsCleint struct {
 	QueuePushCounter     *prometheus.CounterVec
 	ServerRequestCounter *prometheus.CounterVec
+	ThrottledCounter     *prometheus.CounterVec
+
+	JobDuration      *prometheus.HistogramVec
+	QueueDepth       *prometheus.GaugeVec
+	JobsInFlight     prometheus.Gauge
+	JobOutcome       *prometheus.CounterVec
+	JobBytes         *prometheus.CounterVec
+	CompressionRatio *prometheus.HistogramVec
+	FFmpegSpeed      *prometheus.HistogramVec
+	JobRetries       *prometheus.CounterVec
 }
 
-// NewMetrics initializes and registers Prometheus metrics
-func NewDefaultMetricsClient() (*DefaultMetricsCleint, error) {
+// NewRegistry returns a registry holding the Go runtime and process
+// collectors, the same ones the default Prometheus registry starts with
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// NewDefaultMetricsClient registers metrics with reg and, when enabled,
+// serves everything in reg on the configured port
+func NewDefaultMetricsClient(cfg config.MetricsConfig, reg *prometheus.Registry) (*DefaultMetricsCleint, error) {
+	metrics, err := NewMetricsClient(reg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Enabled {
+		startMetricsServer(cfg, promhttp.InstrumentMetricHandler(reg, promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+	}
+
+	return metrics, nil
+}
+
+// NewMetricsClient creates the application metrics and registers them with
+// reg. Tests pass a fresh prometheus.NewRegistry() so clients can be created
+// more than once.
+func NewMetricsClient(reg prometheus.Registerer) (*DefaultMetricsCleint, error) {
 	metrics := &DefaultMetricsCleint{
 		QueuePushCounter: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
@@ -37,35 +116,115 @@ func NewDefaultMetricsClient() (*DefaultMetricsCleint, error) {
 			},
 			[]string{"status"},
 		),
+		ThrottledCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "server_throttled_requests_total",
+				Help: "Total number of requests rejected by rate limiting or job quotas",
+			},
+			[]string{"reason"},
+		),
+		JobDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "transcoding_job_duration_seconds",
+				Help: "Time spent running jobs",
+				// Jobs range from seconds-long remuxes to multi-hour encodes
+				Buckets: prometheus.ExponentialBuckets(1, 2.5, 12),
+			},
+			jobLabelNames,
+		),
+		QueueDepth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "transcoding_queue_depth",
+				Help: "Number of entries waiting in each queue",
+			},
+			[]string{"queue"},
+		),
+		JobsInFlight: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "transcoding_jobs_in_flight",
+				Help: "Number of jobs currently running in this process",
+			},
+		),
+		JobOutcome: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "transcoding_job_outcomes_total",
+				Help: "Finished jobs by outcome and reason",
+			},
+			[]string{"outcome", "reason"},
+		),
+		JobBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "transcoding_job_bytes_total",
+				Help: "Bytes read from inputs and written to outputs",
+			},
+			[]string{"direction"},
+		),
+		CompressionRatio: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "transcoding_compression_ratio",
+				Help:    "Input size divided by output size for successful jobs",
+				Buckets: []float64{0.5, 0.75, 1, 1.5, 2, 3, 5, 8, 13, 20},
+			},
+			jobLabelNames,
+		),
+		FFmpegSpeed: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "transcoding_ffmpeg_speed_ratio",
+				Help:    "Encoding speed reported by ffmpeg as a multiple of real time",
+				Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 4, 8, 16, 32},
+			},
+			jobLabelNames,
+		),
+		JobRetries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "transcoding_job_retries_total",
+				Help: "Jobs queued again after failing or being cancelled",
+			},
+			[]string{"source"},
+		),
 	}
 
-	// Register metrics
-	if err := prometheus.Register(metrics.QueuePushCounter); err != nil {
-		Logger.Error("System error: Failed to register QueuePushCounter", zap.Error(err))
-		return nil, err
+	collectors := map[string]prometheus.Collector{
+		"QueuePushCounter":     metrics.QueuePushCounter,
+		"ServerRequestCounter": metrics.ServerRequestCounter,
+		"ThrottledCounter":     metrics.ThrottledCounter,
+		"JobDuration":          metrics.JobDuration,
+		"QueueDepth":           metrics.QueueDepth,
+		"JobsInFlight":         metrics.JobsInFlight,
+		"JobOutcome":           metrics.JobOutcome,
+		"JobBytes":             metrics.JobBytes,
+		"CompressionRatio":     metrics.CompressionRatio,
+		"FFmpegSpeed":          metrics.FFmpegSpeed,
+		"JobRetries":           metrics.JobRetries,
 	}
-	if err := prometheus.Register(metrics.ServerRequestCounter); err != nil {
-		Logger.Error("System error: Failed to register ServerRequestCounter", zap.Error(err))
-		return nil, err
+	for name, collector := range collectors {
+		if err := reg.Register(collector); err != nil {
+			Logger.Error("System error: Failed to register "+name, zap.Error(err))
+			return nil, err
+		}
 	}
 
 	Logger.Info("Expected Metrics registered successfully")
 
-	startMetricsServer(os.Getenv("9090"))
-
 	return metrics, nil
 }
 
-// StartMetricsServer starts an HTTP server for exposing Prometheus metrics
-func startMetricsServer(port string) {
-	http.Handle("/metrics", promhttp.Handler())
-	Logger.Info("Starting metrics server on port " + port + "...")
+// startMetricsServer starts an HTTP server for exposing Prometheus metrics
+func startMetricsServer(cfg config.MetricsConfig, handler http.Handler) {
+	// A dedicated mux keeps the endpoint off http.DefaultServeMux, which
+	// panics if the same path is registered twice
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Path, handler)
 
-	server := &http.Server{Addr: ":" + port}
+	port := strconv.Itoa(cfg.Port)
+	Logger.Info("Starting metrics server", zap.String("port", port), zap.String("path", cfg.Path))
+
+	server := &http.Server{Addr: ":" + port, Handler: mux}
 
 	go func() {
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			Logger.Fatal("Failed to start metrics server", zap.Error(err))
+			// Losing metrics is not worth taking the process down
+			Logger.Error("System error: Metrics server stopped", zap.Error(err))
 		}
 	}()
 }
@@ -77,3 +236,41 @@ func (metricsClient *DefaultMetricsCleint) IncrementQueuePushCounter(submitted s
 func (metricsClient *DefaultMetricsCleint) IncrementServerRequestCounter(status string) {
 	metricsClient.ServerRequestCounter.WithLabelValues(status).Inc()
 }
+
+func (metricsClient *DefaultMetricsCleint) IncrementThrottledRequestCounter(reason string) {
+	metricsClient.ThrottledCounter.WithLabelValues(reason).Inc()
+}
+
+func (metricsClient *DefaultMetricsCleint) ObserveJobDuration(labels JobLabels, seconds float64) {
+	metricsClient.JobDuration.WithLabelValues(labels.values()...).Observe(seconds)
+}
+
+func (metricsClient *DefaultMetricsCleint) SetQueueDepth(queue string, depth int64) {
+	metricsClient.QueueDepth.WithLabelValues(queue).Set(float64(depth))
+}
+
+func (metricsClient *DefaultMetricsCleint) SetJobsInFlight(count int) {
+	metricsClient.JobsInFlight.Set(float64(count))
+}
+
+func (metricsClient *DefaultMetricsCleint) IncrementJobOutcomeCounter(outcome, reason string) {
+	metricsClient.JobOutcome.WithLabelValues(outcome, reason).Inc()
+}
+
+func (metricsClient *DefaultMetricsCleint) AddJobBytes(direction string, bytes int64) {
+	if bytes > 0 {
+		metricsClient.JobBytes.WithLabelValues(direction).Add(float64(bytes))
+	}
+}
+
+func (metricsClient *DefaultMetricsCleint) ObserveCompressionRatio(labels JobLabels, ratio float64) {
+	metricsClient.CompressionRatio.WithLabelValues(labels.values()...).Observe(ratio)
+}
+
+func (metricsClient *DefaultMetricsCleint) ObserveFFmpegSpeed(labels JobLabels, speed float64) {
+	metricsClient.FFmpegSpeed.WithLabelValues(labels.values()...).Observe(speed)
+}
+
+func (metricsClient *DefaultMetricsCleint) IncrementJobRetryCounter(source string) {
+	metricsClient.JobRetries.WithLabelValues(source).Inc()
+}
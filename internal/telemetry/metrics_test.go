@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMetricsClientWithSeparateRegistries(t *testing.T) {
+	_, err := NewMetricsClient(prometheus.NewRegistry())
+	require.NoError(t, err)
+	_, err = NewMetricsClient(prometheus.NewRegistry())
+	require.NoError(t, err, "each registry gets its own copy of the metrics")
+}
+
+func TestNewMetricsClientRejectsDuplicateRegistration(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	_, err := NewMetricsClient(reg)
+	require.NoError(t, err)
+
+	_, err = NewMetricsClient(reg)
+	assert.Error(t, err)
+}
+
+func TestJobMetrics(t *testing.T) {
+	metrics, err := NewMetricsClient(prometheus.NewRegistry())
+	require.NoError(t, err)
+	labels := JobLabels{Preset: "fast", Codec: "libx264", Hardware: false}
+
+	metrics.ObserveJobDuration(labels, 42)
+	metrics.IncrementJobOutcomeCounter(OutcomeFailed, "ffmpeg_exit")
+	metrics.AddJobBytes("in", 1000)
+	metrics.AddJobBytes("in", 0)
+	metrics.SetQueueDepth("jobs", 7)
+	metrics.SetJobsInFlight(2)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.JobDuration))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.JobOutcome.WithLabelValues(OutcomeFailed, "ffmpeg_exit")))
+	assert.Equal(t, 1000.0, testutil.ToFloat64(metrics.JobBytes.WithLabelValues("in")))
+	assert.Equal(t, 7.0, testutil.ToFloat64(metrics.QueueDepth.WithLabelValues("jobs")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.JobsInFlight))
+}
@@ -0,0 +1,118 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"transcodeflow/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// instrumentationName identifies the spans created by this application
+const instrumentationName = "transcodeflow"
+
+// propagator carries trace context across HTTP requests and queued jobs. It
+// is fixed rather than taken from the otel globals so trace context always
+// survives the queue, even before tracing has been set up.
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Tracer returns the tracer for application spans. It is looked up on every
+// call so a provider installed later, such as one in a test, takes effect.
+func Tracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(instrumentationName)
+}
+
+// SetupTracing installs a tracer provider exporting to the configured OTLP
+// endpoint. The returned function flushes and stops it. When tracing is
+// disabled spans are not recorded, but trace context is still propagated.
+func SetupTracing(ctx context.Context, cfg config.TracingConfig, mode string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
+	}
+
+	provider := NewTracerProvider(exporter, cfg, mode)
+	otel.SetTracerProvider(provider)
+	Logger.Info("Tracing enabled", zap.String("endpoint", cfg.Endpoint), zap.Float64("sample_ratio", cfg.SampleRatio))
+
+	return provider.Shutdown, nil
+}
+
+// NewTracerProvider creates a provider that batches spans to exporter. Tests
+// pass a tracetest.InMemoryExporter.
+func NewTracerProvider(exporter sdktrace.SpanExporter, cfg config.TracingConfig, mode string) *sdktrace.TracerProvider {
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.ServiceName),
+		attribute.String("transcodeflow.mode", mode),
+	)
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// Follow the caller's sampling decision so a trace is never half recorded
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+}
+
+// InjectTraceContext returns the trace context of ctx in a form that can be
+// stored in a queued job, or nil if there is none
+func InjectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// ExtractTraceContext returns ctx carrying the trace context stored by
+// InjectTraceContext
+func ExtractTraceContext(ctx context.Context, carrier map[string]string) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// ExtractHTTPTraceContext returns ctx carrying any trace context sent by an
+// HTTP client in the traceparent and baggage headers
+func ExtractHTTPTraceContext(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceFields returns log fields identifying the span in ctx, so log lines
+// can be matched with traces
+func TraceFields(ctx context.Context) []zap.Field {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace_id", sc.TraceID().String()),
+		zap.String("span_id", sc.SpanID().String()),
+	}
+}
+
+// EndSpan records err on span, if any, and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
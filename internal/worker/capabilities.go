@@ -0,0 +1,151 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/repository/redis"
+	"transcodeflow/internal/telemetry"
+
+	"go.uber.org/zap"
+)
+
+// devicePatterns locate the device nodes each hardware backend needs
+var devicePatterns = map[model.HardwareBackend][]string{
+	model.BackendVAAPI: {"/dev/dri/renderD*"},
+	model.BackendQSV:   {"/dev/dri/renderD*"},
+	model.BackendAMF:   {"/dev/dri/renderD*"},
+	model.BackendNVENC: {"/dev/nvidia[0-9]*"},
+}
+
+// listEncoders returns the output of ffmpeg -encoders
+var listEncoders = func(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-encoders").Output()
+	return string(out), err
+}
+
+// DetectCapabilities probes the host for what it can encode: the encoders
+// ffmpeg provides, the hardware devices present and the CPU count. A codec
+// is advertised for hardware encoding when the backend has an encoder for
+// it, ffmpeg provides that encoder and the backend's device is present.
+// maxSessions is how many hardware encodes the worker runs at once.
+func DetectCapabilities(ctx context.Context, backend model.HardwareBackend, maxSessions int) model.WorkerCapabilities {
+	caps := model.WorkerCapabilities{
+		HardwareBackend: backend,
+		MaxSessions:     maxSessions,
+		CPUs:            runtime.NumCPU(),
+	}
+
+	out, err := listEncoders(ctx)
+	if err != nil {
+		telemetry.Logger.Warn("Failed to list ffmpeg encoders; advertising none", zap.Error(err))
+	}
+	caps.Encoders = parseEncoders(out)
+	caps.Devices = findDevices(backend)
+	caps.HardwareEncode = hardwareEncode(backend, caps.Encoders, caps.Devices)
+	return caps
+}
+
+// parseEncoders extracts encoder names from ffmpeg -encoders output, which
+// lists one per line after a legend ending in a line of dashes
+func parseEncoders(out string) []string {
+	var encoders []string
+	listing := false
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if !listing {
+			listing = strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 {
+			encoders = append(encoders, fields[1])
+		}
+	}
+	return encoders
+}
+
+// findDevices returns the device nodes present for a backend, sorted
+func findDevices(backend model.HardwareBackend) []string {
+	var devices []string
+	for _, pattern := range devicePatterns[backend] {
+		matches, _ := filepath.Glob(pattern)
+		devices = append(devices, matches...)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+// hardwareEncode returns the codecs the backend can encode given the
+// encoders ffmpeg provides and the devices present
+func hardwareEncode(backend model.HardwareBackend, encoders, devices []string) []model.VideoCodec {
+	b, ok := model.LookupBackend(backend)
+	if !ok || b.IsSoftware() || len(devices) == 0 {
+		return nil
+	}
+	available := make(map[string]bool, len(encoders))
+	for _, e := range encoders {
+		available[e] = true
+	}
+
+	var codecs []model.VideoCodec
+	for _, codec := range []model.VideoCodec{model.VideoCodecH264, model.VideoCodecHEVC, model.VideoCodecAV1, model.VideoCodecVP9} {
+		if encoder := b.Encoder(codec); encoder != "" && available[encoder] {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
+
+// acceptJob returns the filter deciding which queued jobs this worker
+// takes: those whose requirements it meets, and those allowing a software
+// fallback when no live worker meets them. Payloads that cannot be decoded
+// are taken so the failure is reported.
+func (w *WorkerService) acceptJob(ctx context.Context) func(string) bool {
+	var workers []model.WorkerInfo
+	var listedAt time.Time
+	return func(jobStr string) bool {
+		if !strings.Contains(jobStr, `"requirements"`) {
+			return true
+		}
+		var job model.Job
+		if err := json.Unmarshal([]byte(jobStr), &job); err != nil {
+			return true
+		}
+		if w.Capabilities.Satisfies(job.Requirements) {
+			return true
+		}
+		if !w.Capabilities.SatisfiesInSoftware(job.Requirements) {
+			return false
+		}
+
+		// The registry is read only when needed, and again on each poll so a
+		// capable worker that left while this one waited is noticed
+		if listedAt.IsZero() || time.Since(listedAt) >= redis.DequeuePollInterval {
+			list, err := w.Services.Redis.ListWorkers(ctx)
+			if err != nil {
+				// Without the registry a capable worker may be live, so leave
+				// the job queued rather than run it in software
+				telemetry.Logger.Warn("Failed to list workers for job routing", zap.Error(err))
+				return false
+			}
+			workers, listedAt = list, time.Now()
+		}
+		for _, other := range workers {
+			if other.ID != w.ID && !other.Draining && other.Capabilities != nil && other.Capabilities.Satisfies(job.Requirements) {
+				return false
+			}
+		}
+		return true
+	}
+}
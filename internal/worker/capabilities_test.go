@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/repository/redis"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const encodersOutput = `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ V....D h264_qsv             H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (Intel Quick Sync Video acceleration) (codec h264)
+ V....D av1_qsv              AV1 (Intel Quick Sync Video acceleration) (codec av1)
+ A....D libopus              libopus Opus (codec opus)
+`
+
+func TestDetectCapabilities(t *testing.T) {
+	saved := listEncoders
+	defer func() { listEncoders = saved }()
+	listEncoders = func(context.Context) (string, error) { return encodersOutput, nil }
+
+	caps := DetectCapabilities(context.Background(), model.BackendSoftware, 2)
+
+	assert.Equal(t, []string{"libx264", "h264_qsv", "av1_qsv", "libopus"}, caps.Encoders)
+	assert.Empty(t, caps.HardwareEncode, "software workers encode nothing in hardware")
+	assert.Equal(t, 2, caps.MaxSessions)
+	assert.Positive(t, caps.CPUs)
+}
+
+func TestHardwareEncode(t *testing.T) {
+	encoders := parseEncoders(encodersOutput)
+	devices := []string{"/dev/dri/renderD128"}
+
+	assert.Equal(t, []model.VideoCodec{model.VideoCodecH264, model.VideoCodecAV1}, hardwareEncode(model.BackendQSV, encoders, devices))
+	assert.Empty(t, hardwareEncode(model.BackendQSV, encoders, nil), "encoders without a device cannot run")
+	assert.Empty(t, hardwareEncode(model.BackendNVENC, encoders, devices), "ffmpeg has no NVENC encoders")
+}
+
+func TestAcceptJob(t *testing.T) {
+	arc := model.WorkerCapabilities{Encoders: []string{"av1_qsv", "libx264"}, HardwareEncode: []model.VideoCodec{model.VideoCodecAV1}}
+	cpu := model.WorkerCapabilities{Encoders: []string{"libaom-av1", "libx264"}}
+
+	tests := []struct {
+		name     string
+		caps     model.WorkerCapabilities
+		registry []model.WorkerInfo
+		job      string
+		want     bool
+	}{
+		{"No requirements", cpu, nil, `{"input_file_path":"in.mkv"}`, true},
+		{"Undecodable", cpu, nil, `{"requirements":`, true},
+		{"Hardware present", arc, nil, `{"requirements":{"hardware_encode":["av1"]}}`, true},
+		{"Hardware missing", cpu, nil, `{"requirements":{"hardware_encode":["av1"]}}`, false},
+		{"Encoder missing", arc, nil, `{"requirements":{"encoders":["libsvtav1"],"software_fallback":true}}`, false},
+		{
+			name:     "Fallback while a capable worker is live",
+			caps:     cpu,
+			registry: []model.WorkerInfo{{ID: "arc-1", Capabilities: &arc}},
+			job:      `{"requirements":{"hardware_encode":["av1"],"software_fallback":true}}`,
+			want:     false,
+		},
+		{
+			name:     "Fallback when the capable worker is draining",
+			caps:     cpu,
+			registry: []model.WorkerInfo{{ID: "arc-1", Capabilities: &arc, Draining: true}},
+			job:      `{"requirements":{"hardware_encode":["av1"],"software_fallback":true}}`,
+			want:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redisMock := mocks.NewRedisClient(t)
+			redisMock.On("ListWorkers", mock.Anything).Return(tt.registry, nil).Maybe()
+			workerSvc := NewWorkerService(&service.Services{Redis: redisMock}, 1, nil, nil)
+			workerSvc.Capabilities = tt.caps
+
+			assert.Equal(t, tt.want, workerSvc.acceptJob(context.Background())(tt.job))
+		})
+	}
+}
+
+func TestAcceptJobKeepsFallbackQueuedWhenRegistryFails(t *testing.T) {
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("ListWorkers", mock.Anything).Return(nil, errors.New("connection reset"))
+	workerSvc := NewWorkerService(&service.Services{Redis: redisMock}, 1, nil, nil)
+	workerSvc.Capabilities = model.WorkerCapabilities{Encoders: []string{"libaom-av1"}}
+
+	accept := workerSvc.acceptJob(context.Background())
+	job := `{"requirements":{"hardware_encode":["av1"],"software_fallback":true}}`
+
+	assert.False(t, accept(job))
+	assert.False(t, accept(job))
+	redisMock.AssertNumberOfCalls(t, "ListWorkers", 2)
+}
+
+func TestAcceptJobRereadsRegistryEachPoll(t *testing.T) {
+	saved := redis.DequeuePollInterval
+	defer func() { redis.DequeuePollInterval = saved }()
+	redis.DequeuePollInterval = 0
+
+	arc := model.WorkerCapabilities{Encoders: []string{"av1_qsv"}, HardwareEncode: []model.VideoCodec{model.VideoCodecAV1}}
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("ListWorkers", mock.Anything).Return([]model.WorkerInfo{{ID: "arc-1", Capabilities: &arc}}, nil).Once()
+	redisMock.On("ListWorkers", mock.Anything).Return(nil, nil).Once()
+	workerSvc := NewWorkerService(&service.Services{Redis: redisMock}, 1, nil, nil)
+	workerSvc.Capabilities = model.WorkerCapabilities{Encoders: []string{"libaom-av1"}}
+
+	accept := workerSvc.acceptJob(context.Background())
+	job := `{"requirements":{"hardware_encode":["av1"],"software_fallback":true}}`
+
+	assert.False(t, accept(job), "a capable worker is live")
+	assert.True(t, accept(job), "the capable worker has gone")
+}
+
+func TestFallbackJobRunsInSoftware(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	var ran model.Job
+	workerSvc := NewWorkerService(svc, 1, func(_ context.Context, job model.Job) (string, error) {
+		ran = job
+		return "", nil
+	}, nil)
+	workerSvc.EncoderDefaults = model.EncoderDefaults{HardwareBackend: model.BackendQSV}
+
+	var job model.Job
+	require.NoError(t, json.Unmarshal([]byte(`{"input_file_path":"in.mkv","output_file_path":"out.mkv",
+		"simple_options":{"use_hardware_acceleration":true},
+		"requirements":{"hardware_encode":["av1"],"software_fallback":true}}`), &job))
+	jobBytes, _ := json.Marshal(job)
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil)
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.Equal(t, "libaom-av1", ran.VideoEncoder())
+	assert.NotContains(t, ran.GetFFmpegCommand(), "-init_hw_device")
+}
@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"context"
+	"strings"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// hardwareFailures are lowercase fragments of ffmpeg errors meaning the
+// hardware device or encoder failed, rather than the input or arguments:
+// devices that are missing or busy, and formats the driver rejects
+var hardwareFailures = []string{
+	"for option 'init_hw_device'",
+	"for option 'filter_hw_device'",
+	"device creation failed",
+	"failed to initialise vaapi connection",
+	"no usable encoding profile found",
+	"failed to create encode pipeline",
+	"failed to upload frame",
+	"error initializing an internal mfx session",
+	"error creating a mfx session",
+	"mfx_err_",
+	"current pixel format is unsupported",
+	"openencodesessionex failed",
+	"no capable devices found",
+	"cannot load libnvidia-encode",
+	"cuda_error",
+	"amf failed",
+	"impossible to convert between the formats supported by the filter",
+}
+
+// hardwareFailure returns the line of ffmpeg's output showing that the
+// hardware failed, or an empty string when the failure lies elsewhere
+func hardwareFailure(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		lower := strings.ToLower(line)
+		for _, failure := range hardwareFailures {
+			if strings.Contains(lower, failure) {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+	return ""
+}
+
+// encodeWithFallback runs a job. When ffmpeg fails because of the hardware
+// and the job allows a software fallback, it runs the job again in
+// software. It returns the job that produced the output, and the line
+// explaining the hardware failure when it fell back.
+func (w *WorkerService) encodeWithFallback(ctx context.Context, job model.Job, log *zap.Logger) (model.Job, string, string, error) {
+	output, err := w.runFFmpeg(ctx, job)
+	if err == nil || ctx.Err() != nil || !job.AllowsSoftwareFallback() {
+		return job, output, "", err
+	}
+	failure := hardwareFailure(output)
+	if failure == "" {
+		return job, output, "", err
+	}
+	software, ok := job.WithSoftwareEncoding()
+	if !ok {
+		return job, output, "", err
+	}
+
+	log.Warn("Hardware encode failed; retrying in software", zap.String("reason", failure), zap.Error(err))
+	retryOutput, err := w.runFFmpeg(ctx, software)
+	output += "\n[transcodeflow] hardware encode failed; retrying in software\n" + retryOutput
+	return software, output, failure, err
+}
+
+// runFFmpeg runs one attempt at a job under its own span
+func (w *WorkerService) runFFmpeg(ctx context.Context, job model.Job) (string, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "run ffmpeg",
+		trace.WithAttributes(attribute.String("ffmpeg.video_encoder", job.VideoEncoder())))
+	output, err := w.WorkFunc(ctx, job)
+	telemetry.EndSpan(span, err)
+	return output, err
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const mfxFailure = "[av1_qsv @ 0x5581] Error initializing an internal MFX session: unsupported (-3)"
+
+func TestHardwareFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{"QSV session", "Input #0, matroska\n" + mfxFailure + "\nConversion failed!", mfxFailure},
+		{"VAAPI device", "Failed to set value 'vaapi=va:/dev/dri/renderD128' for option 'init_hw_device': I/O error",
+			"Failed to set value 'vaapi=va:/dev/dri/renderD128' for option 'init_hw_device': I/O error"},
+		{"Missing input", "in.mkv: No such file or directory", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hardwareFailure(tt.output))
+		})
+	}
+}
+
+// runFallbackJob runs a hardware job whose first encode fails on the QSV
+// session and returns the encoders attempted and the pushed result
+func runFallbackJob(t *testing.T, payload string) ([]string, model.JobResult) {
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	var encoders []string
+	workerSvc := NewWorkerService(svc, 1, func(_ context.Context, job model.Job) (string, error) {
+		encoders = append(encoders, job.VideoEncoder())
+		if len(encoders) == 1 {
+			return mfxFailure, errors.New("exit status 187")
+		}
+		return "encoded", nil
+	}, nil)
+
+	var job model.Job
+	require.NoError(t, json.Unmarshal([]byte(payload), &job))
+	jobBytes, _ := json.Marshal(job)
+	var result model.JobResult
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil)
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		require.NoError(t, json.Unmarshal([]byte(args.String(1)), &result))
+	})
+
+	workerSvc.getJobs(context.TODO(), 0)
+	<-workerSvc.resultChannel
+	return encoders, result
+}
+
+func TestHardwareFailureFallsBackToSoftware(t *testing.T) {
+	encoders, result := runFallbackJob(t, `{"input_file_path":"in.mkv","output_file_path":"out.mkv",
+		"simple_options":{"quality_preset":"fast","use_hardware_acceleration":true},
+		"requirements":{"software_fallback":true}}`)
+
+	assert.Equal(t, []string{"av1_qsv", "libaom-av1"}, encoders)
+	assert.False(t, result.Failed())
+	assert.Contains(t, result.Output, "retrying in software")
+	require.NotNil(t, result.Encoding)
+	assert.Equal(t, model.Encoding{
+		Backend:        model.BackendSoftware,
+		Encoder:        "libaom-av1",
+		FallbackReason: "hardware encode failed: " + mfxFailure,
+	}, *result.Encoding)
+	assert.NotEqual(t, model.BackendSoftware, result.Job.HardwareBackend, "the result keeps the job as submitted")
+}
+
+func TestHardwareFailureWithoutFallback(t *testing.T) {
+	encoders, result := runFallbackJob(t, `{"input_file_path":"in.mkv","output_file_path":"out.mkv",
+		"simple_options":{"use_hardware_acceleration":true}}`)
+
+	assert.Equal(t, []string{"av1_qsv"}, encoders)
+	assert.True(t, result.Failed())
+	require.NotNil(t, result.Encoding)
+	assert.Equal(t, model.BackendQSV, result.Encoding.Backend)
+	assert.Empty(t, result.Encoding.FallbackReason)
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/telemetry"
+
+	"go.uber.org/zap"
+)
+
+// encode runs a job, in two passes when it normalises loudness: the first
+// measures the loudness of its audio and the second encodes with what was
+// measured. Both passes report into one output, marked where each starts,
+// so the job's log and the speed taken from it cover the whole job. It
+// returns what encodeWithFallback does.
+func (w *WorkerService) encode(ctx context.Context, job model.Job, log *zap.Logger) (model.Job, string, string, error) {
+	if !job.NeedsLoudnessAnalysis() {
+		return w.encodeWithFallback(ctx, job, log)
+	}
+
+	analysis, err := w.measureLoudness(ctx, &job)
+	output := "[transcodeflow] measuring loudness (pass 1 of 2)\n" + analysis
+	if err != nil {
+		return job, output, "", err
+	}
+	log.Info("Measured loudness; encoding")
+	ran, encoded, failure, err := w.encodeWithFallback(ctx, job, log)
+	output += "\n[transcodeflow] loudness measured; encoding (pass 2 of 2)\n" + encoded
+	return ran, output, failure, err
+}
+
+// measureLoudness runs a job's loudness analysis pass under its own span
+// and gives the job what it measured
+func (w *WorkerService) measureLoudness(ctx context.Context, job *model.Job) (string, error) {
+	ctx, span := telemetry.Tracer().Start(ctx, "measure loudness")
+	output, err := w.WorkFunc(ctx, job.LoudnessAnalysis())
+	if err == nil {
+		err = job.ApplyLoudness(output)
+	}
+	telemetry.EndSpan(span, err)
+	return output, err
+}
@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/service"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const loudnormReport = `[Parsed_loudnorm_0 @ 0x5581]
+{
+	"input_i" : "-31.20",
+	"input_tp" : "-9.80",
+	"input_lra" : "6.10",
+	"input_thresh" : "-41.60",
+	"output_i" : "-23.10",
+	"output_tp" : "-1.70",
+	"output_lra" : "5.20",
+	"output_thresh" : "-33.50",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.10"
+}`
+
+// runLoudnessJob runs a job that normalises loudness, answering its
+// analysis pass with analysis, and returns the commands run and the pushed
+// result
+func runLoudnessJob(t *testing.T, analysis string, analysisErr error) ([]string, model.JobResult) {
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	var commands []string
+	workerSvc := NewWorkerService(svc, 1, func(_ context.Context, job model.Job) (string, error) {
+		commands = append(commands, strings.Join(job.GetFFmpegCommand(), " "))
+		if len(commands) == 1 {
+			return analysis, analysisErr
+		}
+		return "frame=100 speed=2.5x", nil
+	}, nil)
+
+	job := model.Job{
+		InputFilePath:  "in.mkv",
+		OutputFilePath: "out.mkv",
+		SimpleOptions:  &model.SimpleOptions{QualityPreset: model.PresetFast, Loudness: &model.LoudnessOptions{}},
+	}
+	jobBytes, _ := json.Marshal(job)
+	var result model.JobResult
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil)
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		require.NoError(t, json.Unmarshal([]byte(args.String(1)), &result))
+	})
+
+	workerSvc.getJobs(context.TODO(), 0)
+	<-workerSvc.resultChannel
+	return commands, result
+}
+
+func TestLoudnessIsMeasuredBeforeEncoding(t *testing.T) {
+	commands, result := runLoudnessJob(t, "size=N/A speed=40x\n"+loudnormReport, nil)
+
+	require.Len(t, commands, 2)
+	assert.Contains(t, commands[0], "-filter:a loudnorm=I=-23:TP=-1:LRA=7:print_format=json")
+	assert.True(t, strings.HasSuffix(commands[0], "-f null -"))
+	assert.Contains(t, commands[1], "measured_I=-31.2:measured_TP=-9.8:measured_LRA=6.1:measured_thresh=-41.6:offset=0.1:linear=true")
+	assert.True(t, strings.HasSuffix(commands[1], "out.mkv"))
+
+	assert.False(t, result.Failed())
+	assert.Less(t, strings.Index(result.Output, "pass 1 of 2"), strings.Index(result.Output, "pass 2 of 2"))
+	assert.True(t, strings.HasSuffix(result.Output, "speed=2.5x"), "the encode's speed is reported last")
+}
+
+func TestLoudnessAnalysisFailureStopsTheJob(t *testing.T) {
+	commands, result := runLoudnessJob(t, "in.mkv: Invalid data found when processing input", errors.New("exit status 1"))
+
+	assert.Len(t, commands, 1)
+	assert.True(t, result.Failed())
+	assert.Contains(t, result.Output, "Invalid data found")
+}
+
+func TestUnreadableLoudnessAnalysisStopsTheJob(t *testing.T) {
+	commands, result := runLoudnessJob(t, "size=N/A speed=40x", nil)
+
+	assert.Len(t, commands, 1)
+	assert.True(t, result.Failed())
+	assert.Contains(t, result.Error, "loudness analysis reported 0 audio streams")
+}
@@ -0,0 +1,154 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/planner"
+	"transcodeflow/internal/telemetry"
+
+	"go.uber.org/zap"
+)
+
+// Reasons recorded with job outcomes
+const (
+	reasonNone           = "none"
+	reasonCancelled      = "cancelled"
+	reasonShutdown       = "shutdown"
+	reasonFFmpegExit     = "ffmpeg_exit"
+	reasonInvalidPayload = "invalid_payload"
+	reasonError          = "error"
+	reasonDryRun         = "dry_run"
+	reasonRule           = "rule"
+	reasonSuperseded     = "superseded"
+)
+
+// ffmpegSpeedPattern matches the speed field of ffmpeg's progress line,
+// e.g. "speed=1.52x"
+var ffmpegSpeedPattern = regexp.MustCompile(`speed=\s*([0-9]+(?:\.[0-9]+)?)x`)
+
+// jobLabels describes a job for the per-job histograms
+func jobLabels(job model.Job) telemetry.JobLabels {
+	labels := telemetry.JobLabels{Preset: "custom", Codec: job.VideoEncoder()}
+	if job.ABR != nil {
+		labels.Preset = "abr"
+	} else if job.Kind() != model.JobTypeTranscode {
+		labels.Preset = string(job.Kind())
+	} else if job.SimpleOptions != nil {
+		labels.Preset = string(job.SimpleOptions.QualityPreset)
+		labels.Hardware = job.SimpleOptions.UseHardwareAcceleration
+	}
+	if labels.Codec == "" {
+		labels.Codec = "unknown"
+	}
+	return labels
+}
+
+// parseFFmpegSpeed returns the last speed ffmpeg reported in its log
+func parseFFmpegSpeed(log string) (float64, bool) {
+	matches := ffmpegSpeedPattern.FindAllStringSubmatch(log, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	speed, err := strconv.ParseFloat(matches[len(matches)-1][1], 64)
+	if err != nil || speed <= 0 {
+		return 0, false
+	}
+	return speed, true
+}
+
+// failureReason classifies why a job failed. cancelled reports whether the
+// job's own context was cancelled while the worker kept running.
+func failureReason(ctx context.Context, cancelled bool, err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return reasonShutdown
+	case cancelled:
+		return reasonCancelled
+	case errors.As(err, &exitErr):
+		return reasonFFmpegExit
+	default:
+		return reasonError
+	}
+}
+
+// setInFlight adjusts the number of running jobs and publishes it
+func (w *WorkerService) setInFlight(delta int32) {
+	w.Services.Metrics.SetJobsInFlight(int(w.inFlight.Add(delta)))
+}
+
+// recordJobMetrics publishes the duration, outcome and output statistics of
+// a job that ran. Jobs that report both a speed and sizes also add to the
+// throughput history dry runs estimate from.
+func (w *WorkerService) recordJobMetrics(ctx context.Context, job model.Job, elapsed time.Duration, output string, reason string) {
+	metrics := w.Services.Metrics
+	labels := jobLabels(job)
+
+	metrics.ObserveJobDuration(labels, elapsed.Seconds())
+	speed, hasSpeed := parseFFmpegSpeed(output)
+	if hasSpeed {
+		metrics.ObserveFFmpegSpeed(labels, speed)
+	}
+
+	if reason != reasonNone {
+		metrics.IncrementJobOutcomeCounter(telemetry.OutcomeFailed, reason)
+		return
+	}
+	metrics.IncrementJobOutcomeCounter(telemetry.OutcomeSucceeded, reasonNone)
+
+	in, inErr := os.Stat(job.InputFilePath)
+	out, outErr := outputSize(job)
+	if inErr != nil || outErr != nil {
+		return
+	}
+	metrics.AddJobBytes("in", in.Size())
+	metrics.AddJobBytes("out", out)
+	if out == 0 {
+		return
+	}
+	ratio := float64(in.Size()) / float64(out)
+	metrics.ObserveCompressionRatio(labels, ratio)
+
+	if hasSpeed {
+		if err := w.Services.Redis.RecordThroughput(ctx, planner.Profile(job), speed, ratio); err != nil {
+			telemetry.Logger.Warn("Failed to record job throughput", zap.Error(err))
+		}
+	}
+}
+
+// outputSize returns the bytes a job wrote: the output file, everything in
+// the output directory of jobs writing several files, or nothing for jobs
+// that write no output
+func outputSize(job model.Job) (int64, error) {
+	if job.Output() == model.OutputNone {
+		return 0, nil
+	}
+	if !job.OutputIsDirectory() {
+		info, err := os.Stat(job.OutputFilePath)
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	var size int64
+	err := filepath.WalkDir(job.OutputFilePath, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
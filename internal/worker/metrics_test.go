@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/telemetry"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFFmpegSpeed(t *testing.T) {
+	tests := []struct {
+		name   string
+		log    string
+		want   float64
+		wantOK bool
+	}{
+		{"last progress line wins", "frame=  10 speed=0.5x\rframe=  90 fps=30 speed=1.52x \n", 1.52, true},
+		{"padded value", "size=1024kB time=00:00:10.00 speed=  12x", 12, true},
+		{"not reported", "Input #0, matroska", 0, false},
+		{"not available", "speed=N/A", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseFFmpegSpeed(tt.log)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	exitErr := exec.Command("sh", "-c", "exit 1").Run()
+	stopped, stop := context.WithCancel(context.Background())
+	stop()
+
+	assert.Equal(t, reasonShutdown, failureReason(stopped, true, exitErr))
+	assert.Equal(t, reasonCancelled, failureReason(context.Background(), true, exitErr))
+	assert.Equal(t, reasonFFmpegExit, failureReason(context.Background(), false, exitErr))
+	assert.Equal(t, reasonError, failureReason(context.Background(), false, errors.New("ffmpeg not found")))
+}
+
+func TestJobLabels(t *testing.T) {
+	simple := model.Job{SimpleOptions: &model.SimpleOptions{QualityPreset: model.PresetFast, UseHardwareAcceleration: true}}
+	assert.Equal(t, telemetry.JobLabels{Preset: "fast", Codec: "av1_qsv", Hardware: true}, jobLabels(simple))
+
+	advanced := model.Job{OutputArguments: "-crf 23"}
+	assert.Equal(t, telemetry.JobLabels{Preset: "custom", Codec: "unknown"}, jobLabels(advanced))
+
+	ladder := model.Job{ABR: &model.ABROptions{}}
+	assert.Equal(t, telemetry.JobLabels{Preset: "abr", Codec: "libx264"}, jobLabels(ladder))
+}
+
+func TestOutputSize(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "720p"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "master.m3u8"), make([]byte, 100), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "720p", "segment_00000.ts"), make([]byte, 900), 0o644))
+
+	size, err := outputSize(model.Job{OutputFilePath: dir, ABR: &model.ABROptions{}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), size, "a ladder's size is everything in its directory")
+
+	size, err = outputSize(model.Job{OutputFilePath: filepath.Join(dir, "master.m3u8")})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), size)
+
+	size, err = outputSize(model.Job{Type: model.JobTypeVerify, OutputFilePath: filepath.Join(dir, "master.m3u8")})
+	require.NoError(t, err)
+	assert.Zero(t, size, "verify jobs write nothing")
+}
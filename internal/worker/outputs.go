@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"transcodeflow/internal/model"
+)
+
+// outputSnapshot is what existed at a job's output path before the job
+// ran, so the files it creates can be told apart from those it found there
+type outputSnapshot map[string]bool
+
+// snapshotOutputs records what exists at a job's output path: the output
+// file, or everything in the output directory
+func snapshotOutputs(job model.Job) outputSnapshot {
+	existing := outputSnapshot{}
+	if job.OutputFilePath == "" {
+		return existing
+	}
+	if !job.OutputIsDirectory() {
+		if _, err := os.Lstat(job.OutputFilePath); err == nil {
+			existing[job.OutputFilePath] = true
+		}
+		return existing
+	}
+	filepath.WalkDir(job.OutputFilePath, func(path string, _ fs.DirEntry, err error) error {
+		if err == nil {
+			existing[path] = true
+		}
+		return nil
+	})
+	return existing
+}
+
+// created returns what a job that succeeded created at its output path: its
+// output file if there was none before, or everything in its output
+// directory that was not there before it ran, including the directory
+// itself. Directories come before their contents. A file the job replaced
+// is not listed, so undoing the job never removes what the user had.
+func (s outputSnapshot) created(job model.Job) []string {
+	kind := job.Output()
+	if job.IsDryRun() || job.OutputFilePath == "" || kind == model.OutputNone {
+		return nil
+	}
+	if kind != model.OutputDirectory {
+		if s[job.OutputFilePath] {
+			return nil
+		}
+		if info, err := os.Stat(job.OutputFilePath); err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+		return []string{job.OutputFilePath}
+	}
+
+	var created []string
+	filepath.WalkDir(job.OutputFilePath, func(path string, _ fs.DirEntry, err error) error {
+		if err == nil && !s[path] {
+			created = append(created, path)
+		}
+		return nil
+	})
+	return created
+}
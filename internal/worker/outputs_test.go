@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"transcodeflow/internal/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatedOutputsInDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "poster.jpg"), nil, 0o644))
+	job := model.Job{Type: model.JobTypeThumbnails, InputFilePath: "in.mkv", OutputFilePath: dir}
+
+	existing := snapshotOutputs(job)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "720p"), 0o755))
+	for _, name := range []string{"001.jpg", "720p/002.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	assert.Equal(t, []string{
+		filepath.Join(dir, "001.jpg"),
+		filepath.Join(dir, "720p"),
+		filepath.Join(dir, "720p", "002.jpg"),
+	}, existing.created(job))
+}
+
+func TestCreatedOutputDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "thumbs")
+	job := model.Job{Type: model.JobTypeThumbnails, InputFilePath: "in.mkv", OutputFilePath: dir}
+
+	existing := snapshotOutputs(job)
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "001.jpg"), nil, 0o644))
+
+	assert.Equal(t, []string{dir, filepath.Join(dir, "001.jpg")}, existing.created(job))
+}
+
+func TestCreatedOutputFile(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	job := model.Job{InputFilePath: "in.mkv", OutputFilePath: out}
+
+	existing := snapshotOutputs(job)
+	assert.Empty(t, existing.created(job), "nothing was written")
+
+	require.NoError(t, os.WriteFile(out, nil, 0o644))
+	assert.Equal(t, []string{out}, existing.created(job))
+
+	job.DryRun = true
+	assert.Empty(t, existing.created(job))
+}
+
+func TestReplacedOutputFileIsNotCreated(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	require.NoError(t, os.WriteFile(out, []byte("original"), 0o644))
+	job := model.Job{InputFilePath: "in.mkv", OutputFilePath: out}
+
+	existing := snapshotOutputs(job)
+	require.NoError(t, os.WriteFile(out, []byte("encoded"), 0o644))
+
+	assert.Empty(t, existing.created(job), "the file was there before the job ran")
+}
@@ -0,0 +1,32 @@
+package worker
+
+import (
+	"context"
+	"time"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/telemetry"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startJobSpan starts the span covering a job on this worker, continuing the
+// trace of the request that submitted it. The dequeue that delivered the job
+// happened before its trace context was known, so it is recorded afterwards
+// as a child span with its original timestamps.
+func (w *WorkerService) startJobSpan(ctx context.Context, job model.Job, dequeueStarted, dequeued time.Time) (context.Context, trace.Span) {
+	ctx = telemetry.ExtractTraceContext(ctx, job.TraceContext)
+	ctx, span := telemetry.Tracer().Start(ctx, "process job",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithTimestamp(dequeueStarted),
+		trace.WithAttributes(
+			attribute.String("job.id", job.ID),
+			attribute.String("worker.id", w.ID),
+		),
+	)
+
+	_, dequeueSpan := telemetry.Tracer().Start(ctx, "dequeue job", trace.WithTimestamp(dequeueStarted))
+	dequeueSpan.End(trace.WithTimestamp(dequeued))
+
+	return ctx, span
+}
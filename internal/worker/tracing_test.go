@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"transcodeflow/internal/config"
+	"transcodeflow/internal/model"
+	"transcodeflow/internal/service"
+	"transcodeflow/internal/telemetry"
+	"transcodeflow/test/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestJobSpansContinueSubmitTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := telemetry.NewTracerProvider(exporter, config.Default().Tracing, "worker")
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+	svc := &service.Services{Metrics: metricsMock, Redis: redisMock}
+
+	var taskSpan trace.SpanContext
+	workerSvc := NewWorkerService(svc, 1, func(ctx context.Context, _ model.Job) (string, error) {
+		taskSpan = trace.SpanContextFromContext(ctx)
+		return "speed=2x", nil
+	}, nil)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	job := model.Job{
+		InputFilePath:  "in.mp4",
+		OutputFilePath: "out.mkv",
+		TraceContext:   map[string]string{"traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"},
+	}
+	jobBytes, _ := json.Marshal(job)
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
+
+	workerSvc.getJobs(context.Background(), 0)
+	require.NoError(t, (<-workerSvc.resultChannel).Err)
+	require.NoError(t, provider.ForceFlush(context.Background()))
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		assert.Equal(t, traceID, span.SpanContext.TraceID().String(), "span %q left the submit trace", span.Name)
+		spans[span.Name] = span
+	}
+	require.Contains(t, spans, "process job")
+	process := spans["process job"]
+	assert.Equal(t, "00f067aa0ba902b7", process.Parent.SpanID().String())
+	for _, name := range []string{"dequeue job", "run ffmpeg", "push result"} {
+		require.Contains(t, spans, name)
+		assert.Equal(t, process.SpanContext.SpanID(), spans[name].Parent.SpanID(), "%s should be a child of process job", name)
+	}
+	assert.Equal(t, spans["run ffmpeg"].SpanContext.SpanID(), taskSpan.SpanID(), "ffmpeg runs inside its span")
+}
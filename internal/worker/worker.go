@@ -2,18 +2,30 @@ package worker
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"sync/atomic"
 	"time"
+	"transcodeflow/internal/joblog"
 	"transcodeflow/internal/model"
+	"transcodeflow/internal/pipeline"
+	"transcodeflow/internal/planner"
 	"transcodeflow/internal/service"
 	"transcodeflow/internal/telemetry"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
-type JobTask func(model.Job) (string, error)
+// JobTask performs a job. It must stop promptly when ctx is cancelled.
+type JobTask func(context.Context, model.Job) (string, error)
 
 type InternalErrorHandler interface {
 	HandleError(err error)
@@ -26,12 +38,51 @@ func (eh *DefaultErrorHandler) HandleError(err error) {
 	telemetry.Logger.Error(fmt.Sprintf("Error: %e", err))
 }
 
+// HeartbeatInterval is how often a worker refreshes its registry entry
+var HeartbeatInterval = 10 * time.Second
+
+// CancellationPollInterval is how often a running job's record is checked
+// for a cancellation request
+var CancellationPollInterval = 5 * time.Second
+
+// JobLogLimit caps the ffmpeg output kept for each job, in bytes
+var JobLogLimit = 256 << 10
+
+// errJobCancelled marks a dequeued job that was cancelled while queued
+var errJobCancelled = errors.New("job was cancelled")
+
+// errJobSuperseded marks a job retried since this worker dequeued or
+// started an earlier attempt, whose record now belongs to the retry
+var errJobSuperseded = errors.New("job was retried")
+
+// errJobDuplicate marks a dequeued copy of an attempt that has already
+// started
+var errJobDuplicate = errors.New("job attempt already started")
+
 type WorkerService struct {
 	*service.Services
 	resultChannel      chan JobResult
 	MaxParallelization int
 	WorkFunc           JobTask
 	InternalErrorHandler
+
+	// Planner checks jobs before they run and answers dry runs
+	Planner *planner.Planner
+
+	// Pipelines queues the steps waiting on a finished pipeline step
+	Pipelines *pipeline.Orchestrator
+
+	// EncoderDefaults fill in encoder settings simple jobs leave unset
+	EncoderDefaults model.EncoderDefaults
+
+	// Capabilities are advertised in the registry and decide which jobs
+	// this worker takes
+	Capabilities model.WorkerCapabilities
+
+	// ID uniquely identifies this worker process in the registry
+	ID        string
+	startedAt time.Time
+	inFlight  atomic.Int32
 }
 
 // placeholder until we're sure how we want to report the outcome
@@ -47,21 +98,74 @@ func NewWorkerService(svc *service.Services, maxParallelization int, workFunc Jo
 	}
 
 	if workFunc == nil {
-		workFunc = DoTranscode
+		workFunc = RunJob
 	}
 
 	return &WorkerService{
-		svc,
-		make(chan JobResult, maxParallelization),
-		maxParallelization,
-		workFunc,
-		handler,
+		Services:             svc,
+		resultChannel:        make(chan JobResult, maxParallelization),
+		MaxParallelization:   maxParallelization,
+		WorkFunc:             workFunc,
+		InternalErrorHandler: handler,
+		Planner:              planner.New(planner.FFprobe{}, svc.Redis),
+		Pipelines:            pipeline.New(svc.Redis),
+		ID:                   newWorkerID(),
+		startedAt:            time.Now(),
+	}
+}
+
+// newWorkerID combines the hostname with random bytes so several workers on
+// one host remain distinguishable
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "worker"
+	}
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return host
+	}
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// InFlight returns the number of jobs currently being processed
+func (w *WorkerService) InFlight() int {
+	return int(w.inFlight.Load())
+}
+
+// heartbeat periodically advertises this worker in the Redis registry
+func (w *WorkerService) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		info := model.WorkerInfo{
+			ID:                 w.ID,
+			StartedAt:          w.startedAt,
+			LastSeen:           time.Now(),
+			MaxParallelization: w.MaxParallelization,
+			InFlight:           w.InFlight(),
+			Capabilities:       &w.Capabilities,
+		}
+		info.Hostname, _ = os.Hostname()
+		if err := w.Services.Redis.RegisterWorker(ctx, info, 3*HeartbeatInterval); err != nil && ctx.Err() == nil {
+			telemetry.Logger.Warn("Failed to register worker heartbeat", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
 
 func (w *WorkerService) Start(ctx context.Context) error {
+	go w.heartbeat(ctx)
+
 	currentWorkers := 0
 	workerId := 0 //just increment an int for now; better solution later if necessary
+	accepting := true
 	for {
 		select {
 		case <-ctx.Done():
@@ -74,6 +178,13 @@ func (w *WorkerService) Start(ctx context.Context) error {
 			}
 		default:
 			if currentWorkers < w.MaxParallelization {
+				// Only consult the dispatch state when there is capacity to use
+				if now := w.acceptingJobs(ctx); now != accepting {
+					accepting = now
+					telemetry.Logger.Info("Dispatch state changed", zap.Bool("accepting_jobs", accepting))
+				}
+			}
+			if currentWorkers < w.MaxParallelization && accepting {
 				currentWorkers++
 				//start new job
 				go w.getJobs(ctx, workerId) //give distinct contexts later if necessary
@@ -85,34 +196,343 @@ func (w *WorkerService) Start(ctx context.Context) error {
 }
 
 func (w *WorkerService) getJobs(ctx context.Context, id int) {
-	jobStr, err := w.Services.Redis.DequeueJob(ctx)
+	dequeueStarted := time.Now()
+	jobStr, err := w.Services.Redis.DequeueJob(ctx, w.acceptJob(ctx))
+	dequeued := time.Now()
 	if err != nil {
 		w.resultChannel <- JobResult{jobStr, err}
 		return
 	}
+	if jobStr == "" {
+		// Dequeue timed out without a job; let the loop start a new poller
+		w.resultChannel <- JobResult{jobStr, nil}
+		return
+	}
 	telemetry.Logger.Info("Dequeued job", zap.Any("worker_ID", id))
 
+	// Dispatching may have been paused while this poller was blocked waiting
+	// for a job; hand the job back rather than start it
+	if !w.acceptingJobs(ctx) {
+		telemetry.Logger.Info("Returning job to queue: worker is not accepting jobs", zap.Any("worker_ID", id))
+		w.resultChannel <- JobResult{jobStr, w.Services.Redis.ReturnJob(ctx, jobStr)}
+		return
+	}
+
+	w.setInFlight(1)
+	defer w.setInFlight(-1)
+
 	var job model.Job
 	err = json.Unmarshal([]byte(jobStr), &job)
+	if err != nil {
+		w.Services.Metrics.IncrementJobOutcomeCounter(telemetry.OutcomeFailed, reasonInvalidPayload)
+		w.resultChannel <- JobResult{jobStr, err}
+		return
+	}
+	defaults := w.EncoderDefaults
+	fallback := !w.Capabilities.Satisfies(job.Requirements)
+	if fallback {
+		// Taken because no worker has the hardware the job asks for
+		defaults.HardwareBackend = model.BackendSoftware
+	}
+	job.ApplyDefaults(defaults)
+
+	ctx, span := w.startJobSpan(ctx, job, dequeueStarted, dequeued)
+	defer span.End()
+	log := telemetry.Logger.With(telemetry.TraceFields(ctx)...)
+	if job.ID != "" {
+		log = log.With(zap.String("job_id", job.ID))
+	}
+	if fallback {
+		log.Info("Running job in software: no worker has the hardware it requires", zap.Any("worker_ID", id))
+	}
+
+	attempt := 0
+	if job.ID != "" {
+		var err error
+		attempt, err = w.startRecord(ctx, job)
+		if errors.Is(err, errJobSuperseded) || errors.Is(err, errJobDuplicate) {
+			log.Info("Dropping stale copy of job", zap.Any("worker_ID", id), zap.Int("attempt", job.Attempt), zap.Error(err))
+			span.SetAttributes(attribute.String("job.outcome", telemetry.OutcomeSkipped))
+			w.Services.Metrics.IncrementJobOutcomeCounter(telemetry.OutcomeSkipped, reasonSuperseded)
+			// The copy of an earlier attempt still held that attempt's slot
+			if errors.Is(err, errJobSuperseded) {
+				w.releaseSlot(ctx, job)
+			}
+			w.resultChannel <- JobResult{jobStr, nil}
+			return
+		}
+		if errors.Is(err, errJobCancelled) {
+			log.Info("Skipping cancelled job", zap.Any("worker_ID", id))
+			span.SetAttributes(attribute.String("job.outcome", telemetry.OutcomeSkipped))
+			w.Services.Metrics.IncrementJobOutcomeCounter(telemetry.OutcomeSkipped, reasonCancelled)
+			w.releaseSlot(ctx, job)
+			if job.Pipeline != "" {
+				if rec, err := w.Services.Redis.GetJobRecord(ctx, job.ID); err == nil {
+					w.stepFinished(ctx, rec)
+				}
+			}
+			w.resultChannel <- JobResult{jobStr, nil}
+			return
+		}
+	}
+
+	plan, done := w.planJob(ctx, job)
+	if done {
+		w.finishPlanned(ctx, jobStr, job, attempt, plan)
+		log.Info("Finished job without encoding", zap.Any("worker_ID", id), zap.String("action", string(plan.Action)))
+		return
+	}
+	// Encode with the streams the plan chose from the probed input
+	job.ApplyProbe(plan.Probe)
+
+	jobCtx, cancelJob := context.WithCancel(ctx)
+	if job.ID != "" {
+		go w.watchCancellation(jobCtx, job.ID, attempt, cancelJob)
+	}
+	existing := snapshotOutputs(job)
+	started := time.Now()
+	ran, output, failure, err := w.encode(jobCtx, job, log)
+	var encoding *model.Encoding
+	if job.RequestsHardware() {
+		e := ran.Encoding()
+		switch {
+		case failure != "":
+			e.FallbackReason = "hardware encode failed: " + failure
+		case fallback:
+			e.FallbackReason = "no worker has the hardware the job requires"
+		}
+		encoding = &e
+	}
+	cancelled := jobCtx.Err() != nil
+	cancelJob()
+	log.Info("Finished job", zap.Any("worker_ID", id))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	reason := reasonNone
+	if err != nil {
+		reason = failureReason(ctx, cancelled, err)
+	}
+	w.recordJobMetrics(ctx, ran, time.Since(started), output, reason)
+
+	if job.ID != "" {
+		w.saveJobLog(ctx, job.ID, output)
+		var created []string
+		if err == nil {
+			created = existing.created(ran)
+		}
+		w.stepFinished(ctx, w.finishRecord(ctx, job.ID, attempt, err, nil, encoding, created))
+	}
+
+	// The job no longer counts against its submitter's quota, whether or not
+	// its result can be pushed
+	releaseErr := w.releaseSlot(ctx, job)
+
+	pushCtx, pushSpan := telemetry.Tracer().Start(ctx, "push result", trace.WithSpanKind(trace.SpanKindProducer))
+	err = w.pushResult(pushCtx, job, output, err, nil, encoding)
+	telemetry.EndSpan(pushSpan, err)
 	if err != nil {
 		w.resultChannel <- JobResult{jobStr, err}
 		return
 	}
+	log.Info("Pushed job result", zap.Any("worker_ID", id))
+	w.resultChannel <- JobResult{jobStr, releaseErr}
+}
+
+// planJob plans a job before it runs. It reports done when the job needs no
+// encoding: dry runs, and jobs asking to be skipped when a planning rule
+// says so. Other jobs are probed only when their command depends on it.
+func (w *WorkerService) planJob(ctx context.Context, job model.Job) (model.JobPlan, bool) {
+	if job.IsDryRun() {
+		return w.Planner.Plan(ctx, job), true
+	}
+	if !job.SkipUnneeded && !job.UsesProbe() {
+		return model.JobPlan{}, false
+	}
+	plan := w.Planner.Check(ctx, job)
+	return plan, job.SkipUnneeded && plan.Action == model.PlanActionSkip
+}
 
-	output, err := w.WorkFunc(job)
-	telemetry.Logger.Info("Finished job", zap.Any("worker_ID", id))
+// finishPlanned completes a job that was planned but not encoded. The plan
+// takes the place of ffmpeg's output in the job log and result.
+func (w *WorkerService) finishPlanned(ctx context.Context, jobStr string, job model.Job, attempt int, plan model.JobPlan) {
+	reason := reasonDryRun
+	if !job.IsDryRun() {
+		reason = reasonRule
+	}
+	w.Services.Metrics.IncrementJobOutcomeCounter(telemetry.OutcomeSkipped, reason)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("job.outcome", telemetry.OutcomeSkipped),
+		attribute.String("plan.action", string(plan.Action)),
+	)
 
-	err = w.pushResult(ctx, job, output, err)
+	planBytes, err := json.MarshalIndent(plan, "", "  ")
 	if err != nil {
 		w.resultChannel <- JobResult{jobStr, err}
 		return
 	}
-	telemetry.Logger.Info("Pushed job result", zap.Any("worker_ID", id))
-	w.resultChannel <- JobResult{jobStr, nil}
+	output := string(planBytes)
+
+	if job.ID != "" {
+		w.saveJobLog(ctx, job.ID, output)
+		w.stepFinished(ctx, w.finishRecord(ctx, job.ID, attempt, nil, &plan, nil, nil))
+	}
+	releaseErr := w.releaseSlot(ctx, job)
+	if err := w.pushResult(ctx, job, output, nil, &plan, nil); err != nil {
+		w.resultChannel <- JobResult{jobStr, err}
+		return
+	}
+	w.resultChannel <- JobResult{jobStr, releaseErr}
+}
+
+// acceptingJobs reports whether dispatching is running and this worker has
+// not been drained. Errors fail open so a Redis hiccup does not stall work.
+func (w *WorkerService) acceptingJobs(ctx context.Context) bool {
+	state, err := w.Services.Redis.GetDispatchState(ctx, w.ID)
+	if err != nil {
+		if ctx.Err() == nil {
+			telemetry.Logger.Warn("Failed to read dispatch state", zap.Error(err))
+		}
+		return true
+	}
+	return state.Accepting()
+}
+
+// releaseSlot frees the submitter quota slot held by a job
+func (w *WorkerService) releaseSlot(ctx context.Context, job model.Job) error {
+	if job.Submitter == "" {
+		return nil
+	}
+	return w.Services.Redis.ReleaseSubmitterSlot(ctx, job.Submitter)
+}
+
+// startRecord marks a job as running on this worker and returns the
+// attempt it runs, or 0 when that is unknown. It returns errJobCancelled if
+// the job was cancelled while it sat in the queue, errJobSuperseded if the
+// dequeued copy belongs to an earlier attempt, as one left queued by a
+// cancel and retry does, and errJobDuplicate if its attempt has already
+// started. Other failures are logged but do not stop the job from running.
+func (w *WorkerService) startRecord(ctx context.Context, job model.Job) (int, error) {
+	rec, err := w.Services.Redis.UpdateJobRecord(ctx, job.ID, func(rec *model.JobRecord) error {
+		switch {
+		case job.Attempt != 0 && job.Attempt < rec.Attempts:
+			return errJobSuperseded
+		case job.Attempt > rec.Attempts:
+			// An administrator requeued the job and has yet to record it
+			rec.Attempts = job.Attempt
+		case rec.State == model.JobStateCancelled:
+			return errJobCancelled
+		case rec.State != model.JobStateQueued:
+			return errJobDuplicate
+		}
+		now := time.Now().UTC()
+		rec.State = model.JobStateRunning
+		rec.StartedAt = &now
+		rec.WorkerID = w.ID
+		return nil
+	})
+	if errors.Is(err, errJobCancelled) || errors.Is(err, errJobSuperseded) || errors.Is(err, errJobDuplicate) {
+		return 0, err
+	}
+	if err != nil {
+		telemetry.Logger.Warn("Failed to mark job as running", zap.String("job_id", job.ID), zap.Error(err))
+		return 0, err
+	}
+	return rec.Attempts, err
+}
+
+// saveJobLog stores a job's output for GET /jobs/{id}/logs. Failures are
+// logged; the job's outcome is still recorded.
+func (w *WorkerService) saveJobLog(ctx context.Context, jobID string, output string) {
+	if err := w.Services.JobLogs.Save(ctx, jobID, output); err != nil {
+		telemetry.Logger.Warn("Failed to store job log", zap.String("job_id", jobID), zap.Error(err))
+	}
+}
+
+// finishRecord stores the outcome of a job. plan is set for jobs that were
+// planned instead of encoded; a job whose plan skips it ends as skipped
+// unless it was a dry run. created lists what a succeeded job created. A
+// job cancelled while running stays cancelled, and one retried since
+// attempt started is left to the retry. It returns the updated record,
+// which is empty if it could not be stored.
+func (w *WorkerService) finishRecord(ctx context.Context, jobID string, attempt int, jobErr error, plan *model.JobPlan, encoding *model.Encoding, created []string) model.JobRecord {
+	record, err := w.Services.Redis.UpdateJobRecord(ctx, jobID, func(rec *model.JobRecord) error {
+		if attempt != 0 && rec.Attempts != attempt {
+			return errJobSuperseded
+		}
+		now := time.Now().UTC()
+		rec.FinishedAt = &now
+		if rec.State == model.JobStateCancelled {
+			return nil
+		}
+		rec.Plan = plan
+		rec.Encoding = encoding
+		switch {
+		case jobErr != nil:
+			rec.State = model.JobStateFailed
+			rec.Error = jobErr.Error()
+		case plan != nil && plan.Action == model.PlanActionSkip && !rec.Job.IsDryRun():
+			rec.State = model.JobStateSkipped
+		default:
+			rec.State = model.JobStateSucceeded
+			rec.Created = created
+		}
+		return nil
+	})
+	if errors.Is(err, errJobSuperseded) {
+		telemetry.Logger.Info("Not recording outcome of a retried job's earlier attempt",
+			zap.String("job_id", jobID), zap.Int("attempt", attempt))
+		return model.JobRecord{}
+	}
+	if err != nil {
+		telemetry.Logger.Warn("Failed to record job outcome", zap.String("job_id", jobID), zap.Error(err))
+		return model.JobRecord{}
+	}
+	return record
+}
+
+// stepFinished advances the pipeline of a finished pipeline step. Failures
+// are logged and leave the pipeline waiting on the step.
+func (w *WorkerService) stepFinished(ctx context.Context, rec model.JobRecord) {
+	if rec.Job.Pipeline == "" || w.Pipelines == nil {
+		return
+	}
+	if err := w.Pipelines.StepFinished(ctx, rec); err != nil {
+		telemetry.Logger.Error("System error: Failed to advance pipeline",
+			zap.String("pipeline_id", rec.Job.Pipeline), zap.String("job_id", rec.ID), zap.Error(err))
+	}
+}
+
+// watchCancellation polls the job record and cancels the running job when a
+// client asks for it, or when the job was cancelled and retried between
+// polls so that a later attempt replaces this one. It returns when ctx is
+// done.
+func (w *WorkerService) watchCancellation(ctx context.Context, jobID string, attempt int, cancel context.CancelFunc) {
+	ticker := time.NewTicker(CancellationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rec, err := w.Services.Redis.GetJobRecord(ctx, jobID)
+			if err == nil && (rec.State == model.JobStateCancelled || (attempt != 0 && rec.Attempts != attempt)) {
+				telemetry.Logger.Info("Cancelling running job", zap.String("job_id", jobID))
+				cancel()
+				return
+			}
+		}
+	}
 }
 
-func (w *WorkerService) pushResult(ctx context.Context, completedJob model.Job, stdout string, err error) error {
-	resultBytes, err := json.Marshal(model.JobResult{Job: completedJob, Output: stdout, Error: err})
+func (w *WorkerService) pushResult(ctx context.Context, completedJob model.Job, stdout string, err error, plan *model.JobPlan, encoding *model.Encoding) error {
+	result := model.JobResult{Job: completedJob, Output: stdout, Plan: plan, Encoding: encoding}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	resultBytes, err := json.Marshal(result)
 	if err != nil {
 		return err
 	}
@@ -126,23 +546,34 @@ func (w *WorkerService) pushResult(ctx context.Context, completedJob model.Job,
 	return nil
 }
 
-func DoTranscode(job model.Job) (string, error) {
+// RunJob runs the program a job's type calls for, ffmpeg or ffprobe, and
+// finishes its output. Both write their log and ffmpeg its progress,
+// including the speed reported in metrics, to stderr, so the returned
+// output combines both streams, capped at JobLogLimit.
+func RunJob(ctx context.Context, job model.Job) (string, error) {
+	// ffmpeg creates the rendition directories of a ladder but not the
+	// directory holding them, nor the directory for thumbnails or sprites
+	if job.OutputIsDirectory() {
+		if err := os.MkdirAll(job.OutputFilePath, 0o755); err != nil {
+			return "", err
+		}
+	}
 	args := job.GetFFmpegCommand()
-	cmd := exec.Command("ffmpeg", args...)
-	stdout, err := cmd.Output()
-	if err != nil {
-		return string(stdout), err
+	output := joblog.NewBuffer(JobLogLimit)
+	cmd := exec.CommandContext(ctx, job.Program(), args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Run(); err != nil {
+		return output.String(), err
 	}
-
-	fmt.Println(string(stdout))
-	return string(stdout), nil
+	return output.String(), job.Finish(output.String())
 }
 
-func FakeDoTranscode(job model.Job) (string, error) {
+func FakeDoTranscode(ctx context.Context, job model.Job) (string, error) {
 	//Temporarily just print stuff for testing
 
 	args := job.GetFFmpegCommand()
-	cmd := exec.Command("echo", args...)
+	cmd := exec.CommandContext(ctx, "echo", args...)
 	stdout, err := cmd.Output()
 	if err != nil {
 		return string(stdout), err
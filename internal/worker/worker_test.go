@@ -4,19 +4,26 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 	"transcodeflow/internal/model"
+	"transcodeflow/internal/planner"
 	"transcodeflow/internal/service"
+	"transcodeflow/internal/telemetry"
 	"transcodeflow/test/mocks"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
 func TestProcessJobs(t *testing.T) {
 	// Create mocks
 	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
 	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("RegisterWorker", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
 
 	// Create services container
 	svc := &service.Services{
@@ -24,7 +31,7 @@ func TestProcessJobs(t *testing.T) {
 		Redis:   redisMock,
 	}
 
-	workerSvc := NewWorkerService(svc, 2, func(model.Job) (string, error) { return "job output", nil }, nil)
+	workerSvc := NewWorkerService(svc, 2, func(context.Context, model.Job) (string, error) { return "job output", nil }, nil)
 
 	jobs := []model.Job{
 		{
@@ -54,17 +61,22 @@ func TestProcessJobs(t *testing.T) {
 	results := []string{}
 	for _, j := range jobs {
 		jobBytes, _ := json.Marshal(j)
-		redisMock.On("DequeueJob", mock.Anything).Return(string(jobBytes), nil).Once()
+		redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
 
 		var unmarshaledJob model.Job
 		json.Unmarshal(jobBytes, &unmarshaledJob)
 
-		result, _ := json.Marshal(model.JobResult{Job: unmarshaledJob, Output: "job output", Error: nil})
+		expected := model.JobResult{Job: unmarshaledJob, Output: "job output"}
+		if unmarshaledJob.RequestsHardware() {
+			expected.Encoding = &model.Encoding{Backend: model.BackendQSV, Encoder: "av1_qsv"}
+		}
+		result, _ := json.Marshal(expected)
 		results = append(results, string(result))
 		redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
 	}
-	ctx, _ := context.WithTimeout(context.TODO(), 3*time.Second)
-	redisMock.On("DequeueJob", ctx).Return("", errors.New("cancelled")).Run(func(args mock.Arguments) { <-ctx.Done() })
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	redisMock.On("DequeueJob", ctx, mock.Anything).Return("", errors.New("cancelled")).Run(func(args mock.Arguments) { <-ctx.Done() })
 
 	workerSvc.Start(ctx)
 
@@ -76,7 +88,10 @@ func TestProcessJobs(t *testing.T) {
 func TestJobsTaskFails(t *testing.T) {
 	// Create mocks
 	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
 	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("RegisterWorker", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
 
 	// Create services container
 	svc := &service.Services{
@@ -84,9 +99,9 @@ func TestJobsTaskFails(t *testing.T) {
 		Redis:   redisMock,
 	}
 
-	workerSvc := NewWorkerService(svc, 2, func(model.Job) (string, error) { return "job output", nil }, nil)
-	mockFunc := func(model.Job) (string, error) {
-		workerSvc.WorkFunc = func(model.Job) (string, error) {
+	workerSvc := NewWorkerService(svc, 2, func(context.Context, model.Job) (string, error) { return "job output", nil }, nil)
+	mockFunc := func(context.Context, model.Job) (string, error) {
+		workerSvc.WorkFunc = func(context.Context, model.Job) (string, error) {
 			return "job failed", errors.New("job failed")
 		}
 		return "job output", nil
@@ -102,19 +117,20 @@ func TestJobsTaskFails(t *testing.T) {
 	results := []string{}
 
 	jobBytes, _ := json.Marshal(job)
-	redisMock.On("DequeueJob", mock.Anything).Return(string(jobBytes), nil).Twice()
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Twice()
 
 	var unmarshaledJob model.Job
 	json.Unmarshal(jobBytes, &unmarshaledJob)
 
-	result, _ := json.Marshal(model.JobResult{Job: unmarshaledJob, Output: "job output", Error: nil})
+	result, _ := json.Marshal(model.JobResult{Job: unmarshaledJob, Output: "job output"})
 	results = append(results, string(result))
-	badResult, _ := json.Marshal(model.JobResult{Job: unmarshaledJob, Output: "job failed", Error: errors.New("job failed")})
+	badResult, _ := json.Marshal(model.JobResult{Job: unmarshaledJob, Output: "job failed", Error: "job failed"})
 	results = append(results, string(badResult))
 
 	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
-	ctx, _ := context.WithTimeout(context.TODO(), 3*time.Second)
-	redisMock.On("DequeueJob", ctx).Return("", errors.New("cancelled")).Run(func(args mock.Arguments) { <-ctx.Done() })
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	redisMock.On("DequeueJob", ctx, mock.Anything).Return("", errors.New("cancelled")).Run(func(args mock.Arguments) { <-ctx.Done() })
 
 	workerSvc.Start(ctx)
 
@@ -126,7 +142,10 @@ func TestJobsTaskFails(t *testing.T) {
 func TestInternalWorkerError(t *testing.T) {
 	// Create mocks
 	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
 	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("RegisterWorker", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
 
 	// Create services container
 	svc := &service.Services{
@@ -137,7 +156,7 @@ func TestInternalWorkerError(t *testing.T) {
 	errorHandlerMock := mocks.InternalErrorHandler{}
 	errorHandlerMock.On("HandleError", mock.Anything).Return()
 
-	workerSvc := NewWorkerService(svc, 2, func(model.Job) (string, error) { return "job output", nil }, &errorHandlerMock)
+	workerSvc := NewWorkerService(svc, 2, func(context.Context, model.Job) (string, error) { return "job output", nil }, &errorHandlerMock)
 
 	job := model.Job{
 		InputFilePath:  "some/path/to/input.mp4",
@@ -145,21 +164,547 @@ func TestInternalWorkerError(t *testing.T) {
 	}
 
 	jobBytes, _ := json.Marshal(job)
-	redisMock.On("DequeueJob", mock.Anything).Return("", errors.New("failed dequeue")).Once()
-	redisMock.On("DequeueJob", mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return("", errors.New("failed dequeue")).Once()
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
 
 	var unmarshaledJob model.Job
 	json.Unmarshal(jobBytes, &unmarshaledJob)
 
-	result, _ := json.Marshal(model.JobResult{Job: unmarshaledJob, Output: "job output", Error: nil})
+	result, _ := json.Marshal(model.JobResult{Job: unmarshaledJob, Output: "job output"})
 
 	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
 
-	ctx, _ := context.WithTimeout(context.TODO(), 3*time.Second)
-	redisMock.On("DequeueJob", ctx).Return("", errors.New("cancelled")).Run(func(args mock.Arguments) { <-ctx.Done() })
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	redisMock.On("DequeueJob", ctx, mock.Anything).Return("", errors.New("cancelled")).Run(func(args mock.Arguments) { <-ctx.Done() })
 
 	workerSvc.Start(ctx)
 
 	redisMock.AssertCalled(t, "EnqueueJobResult", mock.Anything, string(result))
 	errorHandlerMock.AssertCalled(t, "HandleError", errors.New("failed dequeue"))
 }
+
+func TestReleasesSubmitterSlot(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("RegisterWorker", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) { return "job output", nil }, nil)
+
+	job := model.Job{
+		InputFilePath:  "some/path/to/input.mp4",
+		OutputFilePath: "some/path/to/output.mkv",
+		Submitter:      "ip:192.0.2.1",
+	}
+
+	jobBytes, _ := json.Marshal(job)
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "ip:192.0.2.1").Return(nil)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	redisMock.On("DequeueJob", ctx, mock.Anything).Return("", errors.New("cancelled")).Run(func(args mock.Arguments) { <-ctx.Done() })
+
+	workerSvc.Start(ctx)
+
+	redisMock.AssertCalled(t, "ReleaseSubmitterSlot", mock.Anything, "ip:192.0.2.1")
+}
+
+func TestReleasesSubmitterSlotWhenPushFails(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("RegisterWorker", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+	svc := &service.Services{Metrics: metricsMock, Redis: redisMock}
+
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) { return "job output", nil }, nil)
+
+	job := model.Job{
+		InputFilePath:  "some/path/to/input.mp4",
+		OutputFilePath: "some/path/to/output.mkv",
+		Submitter:      "ip:192.0.2.1",
+	}
+
+	jobBytes, _ := json.Marshal(job)
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(errors.New("connection reset"))
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "ip:192.0.2.1").Return(nil)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+	redisMock.On("DequeueJob", ctx, mock.Anything).Return("", errors.New("cancelled")).Run(func(args mock.Arguments) { <-ctx.Done() })
+
+	workerSvc.Start(ctx)
+
+	redisMock.AssertCalled(t, "ReleaseSubmitterSlot", mock.Anything, "ip:192.0.2.1")
+}
+
+func TestHeartbeatRegistersWorker(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	workerSvc := NewWorkerService(svc, 3, nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 500*time.Millisecond)
+	defer cancel()
+
+	isThisWorker := mock.MatchedBy(func(info model.WorkerInfo) bool {
+		return info.ID == workerSvc.ID && info.MaxParallelization == 3 && info.InFlight == 0
+	})
+	redisMock.On("RegisterWorker", mock.Anything, isThisWorker, 3*HeartbeatInterval).Return(nil)
+
+	workerSvc.heartbeat(ctx)
+
+	redisMock.AssertCalled(t, "RegisterWorker", mock.Anything, isThisWorker, 3*HeartbeatInterval)
+}
+
+func TestRecordsJobLifecycle(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+
+	logsMock := mocks.NewStore(t)
+	logsMock.On("Save", mock.Anything, "abc", "job output").Return(nil)
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+		JobLogs: logsMock,
+	}
+
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) { return "job output", nil }, nil)
+
+	jobBytes, _ := json.Marshal(model.Job{ID: "abc", InputFilePath: "in.mp4", OutputFilePath: "out.mkv"})
+	record := model.JobRecord{ID: "abc", State: model.JobStateQueued}
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			err := update(&record)
+			return record, err
+		})
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.Equal(t, model.JobStateSucceeded, record.State)
+	assert.Equal(t, workerSvc.ID, record.WorkerID)
+	assert.NotNil(t, record.StartedAt)
+	assert.NotNil(t, record.FinishedAt)
+	metricsMock.AssertCalled(t, "IncrementJobOutcomeCounter", telemetry.OutcomeSucceeded, "none")
+	metricsMock.AssertCalled(t, "ObserveJobDuration", mock.Anything, mock.AnythingOfType("float64"))
+}
+
+func TestRetriedJobKeepsItsRecord(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+	logsMock := mocks.NewStore(t)
+	logsMock.On("Save", mock.Anything, "abc", mock.Anything).Return(nil)
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+		JobLogs: logsMock,
+	}
+
+	record := model.JobRecord{ID: "abc", State: model.JobStateQueued, Attempts: 1}
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) {
+		// The job is cancelled and retried before the worker notices
+		record.State, record.Attempts, record.WorkerID = model.JobStateQueued, 2, ""
+		return "killed", errors.New("signal: killed")
+	}, nil)
+
+	jobBytes, _ := json.Marshal(model.Job{ID: "abc", InputFilePath: "in.mp4", OutputFilePath: "out.mkv"})
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			err := update(&record)
+			return record, err
+		})
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
+
+	workerSvc.getJobs(context.TODO(), 0)
+	<-workerSvc.resultChannel
+
+	assert.Equal(t, model.JobStateQueued, record.State, "the retry's record is left alone")
+	assert.Equal(t, 2, record.Attempts)
+	assert.Nil(t, record.FinishedAt)
+}
+
+func TestSkipsJobCancelledWhileQueued(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	ran := false
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) {
+		ran = true
+		return "", nil
+	}, nil)
+
+	jobBytes, _ := json.Marshal(model.Job{ID: "abc", InputFilePath: "in.mp4", OutputFilePath: "out.mkv", Submitter: "ip:192.0.2.1"})
+	record := model.JobRecord{ID: "abc", State: model.JobStateCancelled}
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			err := update(&record)
+			return record, err
+		})
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "ip:192.0.2.1").Return(nil)
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.False(t, ran, "cancelled jobs must not run")
+	metricsMock.AssertCalled(t, "IncrementJobOutcomeCounter", telemetry.OutcomeSkipped, "cancelled")
+	redisMock.AssertNotCalled(t, "EnqueueJobResult", mock.Anything, mock.Anything)
+}
+
+func TestDropsCopyOfEarlierAttempt(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	ran := false
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) {
+		ran = true
+		return "", nil
+	}, nil)
+
+	// The job was cancelled while queued and retried, leaving the first
+	// attempt's copy behind the retry's
+	jobBytes, _ := json.Marshal(model.Job{ID: "abc", InputFilePath: "in.mp4", OutputFilePath: "out.mkv", Submitter: "ip:192.0.2.1", Attempt: 1})
+	record := model.JobRecord{ID: "abc", State: model.JobStateQueued, Attempts: 2}
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			updated := record
+			err := update(&updated)
+			if err == nil {
+				record = updated
+			}
+			return updated, err
+		})
+	redisMock.On("ReleaseSubmitterSlot", mock.Anything, "ip:192.0.2.1").Return(nil).Once()
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.False(t, ran, "copies of an earlier attempt must not run")
+	assert.Equal(t, model.JobStateQueued, record.State, "the retry's record is left to the retry")
+	metricsMock.AssertCalled(t, "IncrementJobOutcomeCounter", telemetry.OutcomeSkipped, "superseded")
+	redisMock.AssertNotCalled(t, "EnqueueJobResult", mock.Anything, mock.Anything)
+}
+
+func TestFinishedStepAdvancesPipeline(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+
+	pipeline := model.NewPipelineRecord("p1", model.Pipeline{Steps: []model.PipelineStep{
+		{Name: "encode", Job: model.Job{InputFilePath: "in.mp4", OutputFilePath: "out.mkv"}},
+		{Name: "audio", Job: model.Job{Type: model.JobTypeAudioExtract, InputFilePath: model.StepOutputRef("encode"), OutputFilePath: "out.mka"}},
+	}}, "", time.Now())
+	pipeline.Schedule(time.Now())
+	step := pipeline.StepJob(0)
+
+	logsMock := mocks.NewStore(t)
+	logsMock.On("Save", mock.Anything, step.ID, "job output").Return(nil)
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+		JobLogs: logsMock,
+	}
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) { return "job output", nil }, nil)
+
+	jobBytes, _ := json.Marshal(step)
+	record := model.JobRecord{ID: step.ID, State: model.JobStateQueued, Job: step}
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("UpdateJobRecord", mock.Anything, step.ID, mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			err := update(&record)
+			return record, err
+		})
+	redisMock.On("UpdatePipelineRecord", mock.Anything, "p1", mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.PipelineRecord) error) (model.PipelineRecord, error) {
+			err := update(&pipeline)
+			return pipeline, err
+		})
+	redisMock.On("CreateJobRecord", mock.Anything, mock.Anything).Return(nil)
+	var queued model.Job
+	redisMock.On("EnqueueJob", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		json.Unmarshal([]byte(args.String(1)), &queued)
+	}).Return(nil)
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.Equal(t, model.StepSucceeded, pipeline.Steps[0].State)
+	assert.Equal(t, model.StepQueued, pipeline.Steps[1].State)
+	assert.Equal(t, "audio", queued.Step)
+	assert.Equal(t, "out.mkv", queued.InputFilePath)
+}
+
+func TestDryRunReturnsPlan(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+	redisMock.On("GetThroughput", mock.Anything, mock.Anything).Return(model.Throughput{}, nil).Maybe()
+	proberMock := mocks.NewProber(t)
+	proberMock.On("Probe", mock.Anything, "in.mp4").Return(&model.ProbeResult{DurationSeconds: 60}, nil)
+
+	logsMock := mocks.NewStore(t)
+	logsMock.On("Save", mock.Anything, "abc", mock.MatchedBy(func(log string) bool {
+		return strings.Contains(log, `"action": "encode"`)
+	})).Return(nil)
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+		JobLogs: logsMock,
+	}
+
+	ran := false
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) {
+		ran = true
+		return "", nil
+	}, nil)
+	workerSvc.Planner = planner.New(proberMock, redisMock)
+
+	jobBytes, _ := json.Marshal(model.Job{ID: "abc", InputFilePath: "in.mp4", OutputFilePath: "out.mkv", DryRun: true})
+	record := model.JobRecord{ID: "abc", State: model.JobStateQueued}
+	json.Unmarshal(jobBytes, &record.Job)
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			err := update(&record)
+			return record, err
+		})
+	var pushed model.JobResult
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil).
+		Run(func(args mock.Arguments) { json.Unmarshal([]byte(args.String(1)), &pushed) })
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.False(t, ran, "dry runs must not encode")
+	assert.Equal(t, model.JobStateSucceeded, record.State)
+	if assert.NotNil(t, record.Plan) && assert.NotNil(t, pushed.Plan) {
+		assert.Equal(t, model.PlanActionEncode, record.Plan.Action)
+		assert.Equal(t, record.Plan.Command, pushed.Plan.Command)
+	}
+	metricsMock.AssertCalled(t, "IncrementJobOutcomeCounter", telemetry.OutcomeSkipped, "dry_run")
+}
+
+func TestRuleSkipsJob(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+	proberMock := mocks.NewProber(t)
+	proberMock.On("Probe", mock.Anything, "in.mkv").Return(&model.ProbeResult{
+		DurationSeconds: 60,
+		Streams:         []model.ProbeStream{{CodecType: "video", CodecName: "av1", Height: 1080}},
+	}, nil)
+
+	logsMock := mocks.NewStore(t)
+	logsMock.On("Save", mock.Anything, "abc", mock.Anything).Return(nil)
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+		JobLogs: logsMock,
+	}
+
+	ran := false
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) {
+		ran = true
+		return "", nil
+	}, nil)
+	workerSvc.Planner = planner.New(proberMock, redisMock)
+
+	job := model.Job{ID: "abc", InputFilePath: "in.mkv", OutputFilePath: "out.mkv", SimpleOptions: &model.SimpleOptions{QualityPreset: model.PresetBalanced},
+		SkipUnneeded: true}
+	jobBytes, _ := json.Marshal(job)
+	record := model.JobRecord{ID: "abc", Job: job, State: model.JobStateQueued}
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			err := update(&record)
+			return record, err
+		})
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.False(t, ran, "skipped jobs must not encode")
+	assert.Equal(t, model.JobStateSkipped, record.State)
+	if assert.NotNil(t, record.Plan) {
+		assert.Equal(t, model.PlanActionSkip, record.Plan.Action)
+	}
+	metricsMock.AssertCalled(t, "IncrementJobOutcomeCounter", telemetry.OutcomeSkipped, "rule")
+}
+
+func TestRulesDoNotSkipJobsByDefault(t *testing.T) {
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("GetDispatchState", mock.Anything, mock.Anything).Return(model.DispatchState{}, nil).Maybe()
+	redisMock.On("RecordThroughput", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+	// The job's command does not depend on its input, so it is not probed
+	proberMock := mocks.NewProber(t)
+
+	logsMock := mocks.NewStore(t)
+	logsMock.On("Save", mock.Anything, "abc", mock.Anything).Return(nil)
+
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+		JobLogs: logsMock,
+	}
+
+	ran := false
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) {
+		ran = true
+		return "", nil
+	}, nil)
+	workerSvc.Planner = planner.New(proberMock, redisMock)
+
+	job := model.Job{ID: "abc", InputFilePath: "in.mkv", OutputFilePath: "out.mkv", SimpleOptions: &model.SimpleOptions{QualityPreset: model.PresetBalanced}}
+	jobBytes, _ := json.Marshal(job)
+	record := model.JobRecord{ID: "abc", Job: job, State: model.JobStateQueued}
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("UpdateJobRecord", mock.Anything, "abc", mock.Anything).
+		Return(func(_ context.Context, _ string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+			err := update(&record)
+			return record, err
+		})
+	redisMock.On("EnqueueJobResult", mock.Anything, mock.Anything).Return(nil)
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.True(t, ran, "jobs that do not opt in to skipping must encode")
+	assert.Equal(t, model.JobStateSucceeded, record.State)
+	assert.Nil(t, record.Plan)
+}
+
+func TestPausedWorkerReturnsJob(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	ran := false
+	workerSvc := NewWorkerService(svc, 1, func(context.Context, model.Job) (string, error) {
+		ran = true
+		return "", nil
+	}, nil)
+
+	jobBytes, _ := json.Marshal(model.Job{ID: "abc", InputFilePath: "in.mp4", OutputFilePath: "out.mkv"})
+	redisMock.On("DequeueJob", mock.Anything, mock.Anything).Return(string(jobBytes), nil).Once()
+	redisMock.On("GetDispatchState", mock.Anything, workerSvc.ID).Return(model.DispatchState{Paused: true}, nil)
+	redisMock.On("ReturnJob", mock.Anything, string(jobBytes)).Return(nil)
+
+	workerSvc.getJobs(context.TODO(), 0)
+	result := <-workerSvc.resultChannel
+
+	assert.NoError(t, result.Err)
+	assert.False(t, ran, "jobs must not start while dispatching is paused")
+	redisMock.AssertCalled(t, "ReturnJob", mock.Anything, string(jobBytes))
+}
+
+func TestDrainedWorkerStopsPolling(t *testing.T) {
+	// Create mocks
+	metricsMock := mocks.NewMetricsClient(t)
+	allowJobMetrics(metricsMock)
+	redisMock := mocks.NewRedisClient(t)
+	redisMock.On("RegisterWorker", mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+
+	// Create services container
+	svc := &service.Services{
+		Metrics: metricsMock,
+		Redis:   redisMock,
+	}
+
+	workerSvc := NewWorkerService(svc, 2, nil, nil)
+	redisMock.On("GetDispatchState", mock.Anything, workerSvc.ID).Return(model.DispatchState{Draining: true}, nil)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 1500*time.Millisecond)
+	defer cancel()
+	workerSvc.Start(ctx)
+
+	redisMock.AssertNotCalled(t, "DequeueJob", mock.Anything, mock.Anything)
+}
+
+// allowJobMetrics lets a worker record job metrics without every test
+// having to spell them out
+func allowJobMetrics(metricsMock *mocks.MetricsClient) {
+	metricsMock.On("SetJobsInFlight", mock.Anything).Return().Maybe()
+	metricsMock.On("ObserveJobDuration", mock.Anything, mock.Anything).Return().Maybe()
+	metricsMock.On("ObserveFFmpegSpeed", mock.Anything, mock.Anything).Return().Maybe()
+	metricsMock.On("ObserveCompressionRatio", mock.Anything, mock.Anything).Return().Maybe()
+	metricsMock.On("AddJobBytes", mock.Anything, mock.Anything).Return().Maybe()
+	metricsMock.On("IncrementJobOutcomeCounter", mock.Anything, mock.Anything).Return().Maybe()
+}
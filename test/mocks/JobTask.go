@@ -3,6 +3,7 @@
 package mocks
 
 import (
+	context "context"
 	model "transcodeflow/internal/model"
 
 	mock "github.com/stretchr/testify/mock"
@@ -13,9 +14,9 @@ type JobTask struct {
 	mock.Mock
 }
 
-// Execute provides a mock function with given fields: _a0
-func (_m *JobTask) Execute(_a0 model.Job) (string, error) {
-	ret := _m.Called(_a0)
+// Execute provides a mock function with given fields: _a0, _a1
+func (_m *JobTask) Execute(_a0 context.Context, _a1 model.Job) (string, error) {
+	ret := _m.Called(_a0, _a1)
 
 	if len(ret) == 0 {
 		panic("no return value specified for Execute")
@@ -23,17 +24,17 @@ func (_m *JobTask) Execute(_a0 model.Job) (string, error) {
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(model.Job) (string, error)); ok {
-		return rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, model.Job) (string, error)); ok {
+		return rf(_a0, _a1)
 	}
-	if rf, ok := ret.Get(0).(func(model.Job) string); ok {
-		r0 = rf(_a0)
+	if rf, ok := ret.Get(0).(func(context.Context, model.Job) string); ok {
+		r0 = rf(_a0, _a1)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(model.Job) error); ok {
-		r1 = rf(_a0)
+	if rf, ok := ret.Get(1).(func(context.Context, model.Job) error); ok {
+		r1 = rf(_a0, _a1)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -2,13 +2,32 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	telemetry "transcodeflow/internal/telemetry"
+
+	mock "github.com/stretchr/testify/mock"
+)
 
 // MetricsClient is an autogenerated mock type for the MetricsClient type
 type MetricsClient struct {
 	mock.Mock
 }
 
+// AddJobBytes provides a mock function with given fields: direction, bytes
+func (_m *MetricsClient) AddJobBytes(direction string, bytes int64) {
+	_m.Called(direction, bytes)
+}
+
+// IncrementJobOutcomeCounter provides a mock function with given fields: outcome, reason
+func (_m *MetricsClient) IncrementJobOutcomeCounter(outcome string, reason string) {
+	_m.Called(outcome, reason)
+}
+
+// IncrementJobRetryCounter provides a mock function with given fields: source
+func (_m *MetricsClient) IncrementJobRetryCounter(source string) {
+	_m.Called(source)
+}
+
 // IncrementQueuePushCounter provides a mock function with given fields: submitted
 func (_m *MetricsClient) IncrementQueuePushCounter(submitted string) {
 	_m.Called(submitted)
@@ -19,6 +38,36 @@ func (_m *MetricsClient) IncrementServerRequestCounter(status string) {
 	_m.Called(status)
 }
 
+// IncrementThrottledRequestCounter provides a mock function with given fields: reason
+func (_m *MetricsClient) IncrementThrottledRequestCounter(reason string) {
+	_m.Called(reason)
+}
+
+// ObserveCompressionRatio provides a mock function with given fields: labels, ratio
+func (_m *MetricsClient) ObserveCompressionRatio(labels telemetry.JobLabels, ratio float64) {
+	_m.Called(labels, ratio)
+}
+
+// ObserveFFmpegSpeed provides a mock function with given fields: labels, speed
+func (_m *MetricsClient) ObserveFFmpegSpeed(labels telemetry.JobLabels, speed float64) {
+	_m.Called(labels, speed)
+}
+
+// ObserveJobDuration provides a mock function with given fields: labels, seconds
+func (_m *MetricsClient) ObserveJobDuration(labels telemetry.JobLabels, seconds float64) {
+	_m.Called(labels, seconds)
+}
+
+// SetJobsInFlight provides a mock function with given fields: count
+func (_m *MetricsClient) SetJobsInFlight(count int) {
+	_m.Called(count)
+}
+
+// SetQueueDepth provides a mock function with given fields: queue, depth
+func (_m *MetricsClient) SetQueueDepth(queue string, depth int64) {
+	_m.Called(queue, depth)
+}
+
 // NewMetricsClient creates a new instance of MetricsClient. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewMetricsClient(t interface {
@@ -4,8 +4,11 @@ package mocks
 
 import (
 	context "context"
+	model "transcodeflow/internal/model"
 
 	mock "github.com/stretchr/testify/mock"
+
+	time "time"
 )
 
 // RedisClient is an autogenerated mock type for the RedisClient type
@@ -13,6 +16,41 @@ type RedisClient struct {
 	mock.Mock
 }
 
+// AllowRequest provides a mock function with given fields: ctx, key, ratePerSecond, burst
+func (_m *RedisClient) AllowRequest(ctx context.Context, key string, ratePerSecond float64, burst int) (bool, time.Duration, error) {
+	ret := _m.Called(ctx, key, ratePerSecond, burst)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AllowRequest")
+	}
+
+	var r0 bool
+	var r1 time.Duration
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, float64, int) (bool, time.Duration, error)); ok {
+		return rf(ctx, key, ratePerSecond, burst)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, float64, int) bool); ok {
+		r0 = rf(ctx, key, ratePerSecond, burst)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, float64, int) time.Duration); ok {
+		r1 = rf(ctx, key, ratePerSecond, burst)
+	} else {
+		r1 = ret.Get(1).(time.Duration)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, float64, int) error); ok {
+		r2 = rf(ctx, key, ratePerSecond, burst)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // Close provides a mock function with no fields
 func (_m *RedisClient) Close() error {
 	ret := _m.Called()
@@ -31,9 +69,45 @@ func (_m *RedisClient) Close() error {
 	return r0
 }
 
-// DequeueJob provides a mock function with given fields: ctx
-func (_m *RedisClient) DequeueJob(ctx context.Context) (string, error) {
-	ret := _m.Called(ctx)
+// CreateJobRecord provides a mock function with given fields: ctx, record
+func (_m *RedisClient) CreateJobRecord(ctx context.Context, record model.JobRecord) error {
+	ret := _m.Called(ctx, record)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreateJobRecord")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.JobRecord) error); ok {
+		r0 = rf(ctx, record)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreatePipelineRecord provides a mock function with given fields: ctx, record
+func (_m *RedisClient) CreatePipelineRecord(ctx context.Context, record model.PipelineRecord) error {
+	ret := _m.Called(ctx, record)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CreatePipelineRecord")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.PipelineRecord) error); ok {
+		r0 = rf(ctx, record)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DequeueJob provides a mock function with given fields: ctx, accept
+func (_m *RedisClient) DequeueJob(ctx context.Context, accept func(string) bool) (string, error) {
+	ret := _m.Called(ctx, accept)
 
 	if len(ret) == 0 {
 		panic("no return value specified for DequeueJob")
@@ -41,17 +115,17 @@ func (_m *RedisClient) DequeueJob(ctx context.Context) (string, error) {
 
 	var r0 string
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context) (string, error)); ok {
-		return rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, func(string) bool) (string, error)); ok {
+		return rf(ctx, accept)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context) string); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, func(string) bool) string); ok {
+		r0 = rf(ctx, accept)
 	} else {
 		r0 = ret.Get(0).(string)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, func(string) bool) error); ok {
+		r1 = rf(ctx, accept)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -95,6 +169,591 @@ func (_m *RedisClient) EnqueueJobResult(ctx context.Context, jobResult string) e
 	return r0
 }
 
+// GetDispatchState provides a mock function with given fields: ctx, workerID
+func (_m *RedisClient) GetDispatchState(ctx context.Context, workerID string) (model.DispatchState, error) {
+	ret := _m.Called(ctx, workerID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetDispatchState")
+	}
+
+	var r0 model.DispatchState
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (model.DispatchState, error)); ok {
+		return rf(ctx, workerID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) model.DispatchState); ok {
+		r0 = rf(ctx, workerID)
+	} else {
+		r0 = ret.Get(0).(model.DispatchState)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, workerID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobLog provides a mock function with given fields: ctx, id
+func (_m *RedisClient) GetJobLog(ctx context.Context, id string) (string, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetJobLog")
+	}
+
+	var r0 string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (string, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) string); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobRecord provides a mock function with given fields: ctx, id
+func (_m *RedisClient) GetJobRecord(ctx context.Context, id string) (model.JobRecord, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetJobRecord")
+	}
+
+	var r0 model.JobRecord
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (model.JobRecord, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) model.JobRecord); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(model.JobRecord)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPipelineRecord provides a mock function with given fields: ctx, id
+func (_m *RedisClient) GetPipelineRecord(ctx context.Context, id string) (model.PipelineRecord, error) {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetPipelineRecord")
+	}
+
+	var r0 model.PipelineRecord
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (model.PipelineRecord, error)); ok {
+		return rf(ctx, id)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) model.PipelineRecord); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(model.PipelineRecord)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetThroughput provides a mock function with given fields: ctx, profile
+func (_m *RedisClient) GetThroughput(ctx context.Context, profile string) (model.Throughput, error) {
+	ret := _m.Called(ctx, profile)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetThroughput")
+	}
+
+	var r0 model.Throughput
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (model.Throughput, error)); ok {
+		return rf(ctx, profile)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) model.Throughput); ok {
+		r0 = rf(ctx, profile)
+	} else {
+		r0 = ret.Get(0).(model.Throughput)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, profile)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListJobRecords provides a mock function with given fields: ctx, state, limit
+func (_m *RedisClient) ListJobRecords(ctx context.Context, state model.JobState, limit int) ([]model.JobRecord, error) {
+	ret := _m.Called(ctx, state, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListJobRecords")
+	}
+
+	var r0 []model.JobRecord
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.JobState, int) ([]model.JobRecord, error)); ok {
+		return rf(ctx, state, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, model.JobState, int) []model.JobRecord); ok {
+		r0 = rf(ctx, state, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.JobRecord)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, model.JobState, int) error); ok {
+		r1 = rf(ctx, state, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListQueue provides a mock function with given fields: ctx, queue, offset, limit
+func (_m *RedisClient) ListQueue(ctx context.Context, queue string, offset int64, limit int64) ([]string, int64, error) {
+	ret := _m.Called(ctx, queue, offset, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListQueue")
+	}
+
+	var r0 []string
+	var r1 int64
+	var r2 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) ([]string, int64, error)); ok {
+		return rf(ctx, queue, offset, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64, int64) []string); ok {
+		r0 = rf(ctx, queue, offset, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64, int64) int64); ok {
+		r1 = rf(ctx, queue, offset, limit)
+	} else {
+		r1 = ret.Get(1).(int64)
+	}
+
+	if rf, ok := ret.Get(2).(func(context.Context, string, int64, int64) error); ok {
+		r2 = rf(ctx, queue, offset, limit)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
+// ListWorkers provides a mock function with given fields: ctx
+func (_m *RedisClient) ListWorkers(ctx context.Context) ([]model.WorkerInfo, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListWorkers")
+	}
+
+	var r0 []model.WorkerInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]model.WorkerInfo, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []model.WorkerInfo); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.WorkerInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MoveQueue provides a mock function with given fields: ctx, from, to, limit
+func (_m *RedisClient) MoveQueue(ctx context.Context, from string, to string, limit int64) ([]string, error) {
+	ret := _m.Called(ctx, from, to, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MoveQueue")
+	}
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64) ([]string, error)); ok {
+		return rf(ctx, from, to, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, int64) []string); ok {
+		r0 = rf(ctx, from, to, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, int64) error); ok {
+		r1 = rf(ctx, from, to, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Ping provides a mock function with given fields: ctx
+func (_m *RedisClient) Ping(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Ping")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PurgeQueue provides a mock function with given fields: ctx, queue
+func (_m *RedisClient) PurgeQueue(ctx context.Context, queue string) ([]string, error) {
+	ret := _m.Called(ctx, queue)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PurgeQueue")
+	}
+
+	var r0 []string
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) ([]string, error)); ok {
+		return rf(ctx, queue)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) []string); ok {
+		r0 = rf(ctx, queue)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, queue)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// QueueDepths provides a mock function with given fields: ctx
+func (_m *RedisClient) QueueDepths(ctx context.Context) (map[string]int64, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for QueueDepths")
+	}
+
+	var r0 map[string]int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (map[string]int64, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) map[string]int64); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int64)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecordThroughput provides a mock function with given fields: ctx, profile, speed, compressionRatio
+func (_m *RedisClient) RecordThroughput(ctx context.Context, profile string, speed float64, compressionRatio float64) error {
+	ret := _m.Called(ctx, profile, speed, compressionRatio)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecordThroughput")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, float64, float64) error); ok {
+		r0 = rf(ctx, profile, speed, compressionRatio)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RegisterWorker provides a mock function with given fields: ctx, worker, ttl
+func (_m *RedisClient) RegisterWorker(ctx context.Context, worker model.WorkerInfo, ttl time.Duration) error {
+	ret := _m.Called(ctx, worker, ttl)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RegisterWorker")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.WorkerInfo, time.Duration) error); ok {
+		r0 = rf(ctx, worker, ttl)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReleaseSubmitterSlot provides a mock function with given fields: ctx, submitter
+func (_m *RedisClient) ReleaseSubmitterSlot(ctx context.Context, submitter string) error {
+	ret := _m.Called(ctx, submitter)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReleaseSubmitterSlot")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, submitter)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RequeueFailedResults provides a mock function with given fields: ctx
+func (_m *RedisClient) RequeueFailedResults(ctx context.Context) ([]model.JobResult, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RequeueFailedResults")
+	}
+
+	var r0 []model.JobResult
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]model.JobResult, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []model.JobResult); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.JobResult)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReserveSubmitterSlot provides a mock function with given fields: ctx, submitter, limit
+func (_m *RedisClient) ReserveSubmitterSlot(ctx context.Context, submitter string, limit int64) (bool, error) {
+	ret := _m.Called(ctx, submitter, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReserveSubmitterSlot")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) (bool, error)); ok {
+		return rf(ctx, submitter, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) bool); ok {
+		r0 = rf(ctx, submitter, limit)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, int64) error); ok {
+		r1 = rf(ctx, submitter, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ReturnJob provides a mock function with given fields: ctx, job
+func (_m *RedisClient) ReturnJob(ctx context.Context, job string) error {
+	ret := _m.Called(ctx, job)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReturnJob")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, job)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveJobLog provides a mock function with given fields: ctx, id, log
+func (_m *RedisClient) SaveJobLog(ctx context.Context, id string, log string) error {
+	ret := _m.Called(ctx, id, log)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveJobLog")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, log)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetDispatchPaused provides a mock function with given fields: ctx, paused
+func (_m *RedisClient) SetDispatchPaused(ctx context.Context, paused bool) error {
+	ret := _m.Called(ctx, paused)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetDispatchPaused")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, bool) error); ok {
+		r0 = rf(ctx, paused)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetWorkerDraining provides a mock function with given fields: ctx, workerID, draining
+func (_m *RedisClient) SetWorkerDraining(ctx context.Context, workerID string, draining bool) error {
+	ret := _m.Called(ctx, workerID, draining)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetWorkerDraining")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool) error); ok {
+		r0 = rf(ctx, workerID, draining)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateJobRecord provides a mock function with given fields: ctx, id, update
+func (_m *RedisClient) UpdateJobRecord(ctx context.Context, id string, update func(*model.JobRecord) error) (model.JobRecord, error) {
+	ret := _m.Called(ctx, id, update)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdateJobRecord")
+	}
+
+	var r0 model.JobRecord
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(*model.JobRecord) error) (model.JobRecord, error)); ok {
+		return rf(ctx, id, update)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(*model.JobRecord) error) model.JobRecord); ok {
+		r0 = rf(ctx, id, update)
+	} else {
+		r0 = ret.Get(0).(model.JobRecord)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, func(*model.JobRecord) error) error); ok {
+		r1 = rf(ctx, id, update)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdatePipelineRecord provides a mock function with given fields: ctx, id, update
+func (_m *RedisClient) UpdatePipelineRecord(ctx context.Context, id string, update func(*model.PipelineRecord) error) (model.PipelineRecord, error) {
+	ret := _m.Called(ctx, id, update)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UpdatePipelineRecord")
+	}
+
+	var r0 model.PipelineRecord
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(*model.PipelineRecord) error) (model.PipelineRecord, error)); ok {
+		return rf(ctx, id, update)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, func(*model.PipelineRecord) error) model.PipelineRecord); ok {
+		r0 = rf(ctx, id, update)
+	} else {
+		r0 = ret.Get(0).(model.PipelineRecord)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, func(*model.PipelineRecord) error) error); ok {
+		r1 = rf(ctx, id, update)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // NewRedisClient creates a new instance of RedisClient. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewRedisClient(t interface {